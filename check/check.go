@@ -79,6 +79,48 @@ func EscapePath(str string) (escapeStr string) {
 	return
 }
 
+// IsWindowsPath returns true if str is a Windows style path with drive letter.
+// ex) `C:\Users\a`, `C:/Users/a`, `/C:/Users/a` (sftp style)
+func IsWindowsPath(str string) bool {
+	str = strings.TrimPrefix(str, "/")
+	if len(str) < 2 || str[1] != ':' {
+		return false
+	}
+
+	drive := str[0]
+	if !('a' <= drive && drive <= 'z' || 'A' <= drive && drive <= 'Z') {
+		return false
+	}
+
+	return len(str) == 2 || str[2] == '\\' || str[2] == '/'
+}
+
+// NormalizeWindowsPath converts a Windows style path to the path convention of Windows OpenSSH server (scp, sftp).
+// ex) `C:\Users\a` => `/C:/Users/a`
+func NormalizeWindowsPath(str string) string {
+	str = strings.Replace(str, "\\", "/", -1)
+	if !strings.HasPrefix(str, "/") {
+		str = "/" + str
+	}
+	return str
+}
+
+// EscapeWindowsPath quotes str with double quote for cmd.exe (default shell of Windows OpenSSH server), if needed.
+func EscapeWindowsPath(str string) string {
+	if strings.ContainsAny(str, " &()^;,") {
+		return `"` + str + `"`
+	}
+	return str
+}
+
+// EscapeRemotePath escapes remote path. Windows style path is normalized for Windows OpenSSH server.
+func EscapeRemotePath(str string) string {
+	if IsWindowsPath(str) {
+		return EscapeWindowsPath(NormalizeWindowsPath(str))
+	}
+	return EscapePath(str)
+}
+
 // CheckTypeError validates from-remote, from-local, to-remote and host-counts.
 func CheckTypeError(isFromInRemote, isFromInLocal, isToRemote bool, countHosts int) {
 	// from in local and remote
@@ -71,6 +71,45 @@ func TestEscapePath(t *testing.T) {
 	}
 }
 
+func TestIsWindowsPath(t *testing.T) {
+	type TestData struct {
+		desc   string
+		str    string
+		expect bool
+	}
+	tds := []TestData{
+		{desc: "Backslash", str: `C:\Users\a`, expect: true},
+		{desc: "Slash", str: `c:/Users/a`, expect: true},
+		{desc: "Sftp style", str: `/C:/Users/a`, expect: true},
+		{desc: "Drive only", str: `D:`, expect: true},
+		{desc: "Unix path", str: `/tmp/a.txt`, expect: false},
+		{desc: "Relative path", str: `a:b`, expect: false},
+		{desc: "Empty string", str: ``, expect: false},
+	}
+	for _, v := range tds {
+		got := IsWindowsPath(v.str)
+		assert.Equal(t, v.expect, got, v.desc)
+	}
+}
+
+func TestEscapeRemotePath(t *testing.T) {
+	type TestData struct {
+		desc   string
+		str    string
+		expect string
+	}
+	tds := []TestData{
+		{desc: "Windows path", str: `C:\Users\a\b.txt`, expect: `/C:/Users/a/b.txt`},
+		{desc: "Windows path (sftp style)", str: `/C:/Users/a`, expect: `/C:/Users/a`},
+		{desc: "Windows path with whitespace", str: `C:\Program Files\a`, expect: `"/C:/Program Files/a"`},
+		{desc: "Unix path", str: `/tmp/a b`, expect: `/tmp/a\ b`},
+	}
+	for _, v := range tds {
+		got := EscapeRemotePath(v.str)
+		assert.Equal(t, v.expect, got, v.desc)
+	}
+}
+
 func TestCheckTypeError(t *testing.T) {
 	type TestData struct {
 		desc       string
@@ -4,15 +4,16 @@ import (
 	"fmt"
 	"os"
 	"os/user"
-	"sort"
 	"strings"
 
 	"github.com/blacknon/lssh/check"
 	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/completion"
 	"github.com/blacknon/lssh/conf"
 	"github.com/blacknon/lssh/list"
 	"github.com/blacknon/lssh/ssh"
 	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 func Lscp() (app *cli.App) {
@@ -28,9 +29,9 @@ USAGE:
     {{if len .Authors}}
 AUTHOR:
     {{range .Authors}}{{ . }}{{end}}
-    {{end}}{{if .Commands}}
+    {{end}}{{if .VisibleCommands}}
 COMMANDS:
-    {{range .Commands}}{{if not .HideHelp}}{{join .Names ", "}}{{ "\t"}}{{.Usage}}{{ "\n" }}{{end}}{{end}}{{end}}{{if .VisibleFlags}}
+    {{range .VisibleCommands}}{{if not .HideHelp}}{{join .Names ", "}}{{ "\t"}}{{.Usage}}{{ "\n" }}{{end}}{{end}}{{end}}{{if .VisibleFlags}}
 OPTIONS:
     {{range .VisibleFlags}}{{.}}
     {{end}}{{end}}{{if .Copyright }}
@@ -62,11 +63,35 @@ USAGE:
 		cli.BoolFlag{Name: "list,l", Usage: "print server list from config"},
 		cli.StringFlag{Name: "file,f", Value: defConf, Usage: "config file path"},
 		cli.BoolFlag{Name: "permission,p", Usage: "copy file permission"},
+		cli.BoolFlag{Name: "verify", Usage: "verify sha256 checksum of copied files, and copy again if mismatched"},
+		cli.StringSliceFlag{Name: "include", Usage: "copy only files that match glob pattern at recursive copy (ex. '*.conf')"},
+		cli.StringSliceFlag{Name: "exclude", Usage: "do not copy files and directories that match glob pattern at recursive copy (ex. '.git')"},
+		cli.BoolFlag{Name: "tar", Usage: "stream files as tar, faster for directory trees with many small files (not remote to remote copy)"},
+		cli.StringFlag{Name: "tar-compress", Usage: "compress tar stream with `gzip|zstd` (zstd command is required at local and remote)"},
+		cli.IntFlag{Name: "chunks", Usage: "split files of 64MiB or more into `N` ranges, and transfer them concurrently (not remote to remote copy)"},
+		cli.BoolFlag{Name: "chunk-conn", Usage: "use new ssh connection for each range of --chunks, for high-latency links"},
+		cli.BoolFlag{Name: "direct", Usage: "copy remote to remote directly with scp at source server, not relay via local (relay if failed)"},
+		cli.BoolFlag{Name: "delta", Usage: "send only changed blocks of files that already exist at remote (local to remote copy)"},
+		cli.IntFlag{Name: "retry", Usage: "retry failed servers up to `N` times with backoff (retry_backoff in config)"},
+		cli.StringFlag{Name: "report", Usage: "write report of results to `FILE` (default: lscp_report.json in state directory, if multiple servers or failed)"},
+		cli.StringFlag{Name: "retry-failed-from", Usage: "copy again only with failed servers in report `FILE`. from and to paths can be omitted"},
+		cli.BoolFlag{Name: "dry-run", Usage: "print copy plan (servers, proxy route, auth methods and file manifest with size) without copying. remote from paths are listed"},
+		cli.BoolFlag{Name: "json", Usage: "print file manifest of --dry-run as JSON"},
+		cli.BoolFlag{Name: "mux", Usage: "use authenticated connections of running lssh --mux (servers selected at lssh, if -H is not set)"},
+		cli.StringFlag{Name: "mux-socket", Usage: "unix socket path of --mux (default: $XDG_RUNTIME_DIR/lssh/mux.sock or mux/mux.sock in state directory)"},
+		cli.BoolFlag{Name: "force-auth", Usage: "connect even if recent authentication failures reach auth_failure_limit"},
+		cli.StringFlag{Name: "state-dir", Usage: "directory of history, cache and other state files (default: $LSSH_STATE_DIR, $XDG_STATE_HOME/lssh or ~/.local/state/lssh)"},
 		cli.BoolFlag{Name: "help,h", Usage: "print this help"},
 	}
 	app.EnableBashCompletion = true
 	app.HideHelp = true
 
+	// Set subcommands
+	app.Commands = []cli.Command{
+		completion.Command(app, true),
+		completeRemoteCommand(),
+	}
+
 	app.Action = func(c *cli.Context) error {
 		// show help messages
 		if c.Bool("help") {
@@ -76,41 +101,140 @@ USAGE:
 
 		hosts := c.StringSlice("host")
 		confpath := c.String("file")
+		ssh.IgnoreAuthFailures = c.Bool("force-auth")
+		common.StateDir = c.String("state-dir")
+
+		args := c.Args()
+
+		// copy again only with failed servers of report
+		if path := c.String("retry-failed-from"); path != "" {
+			report, err := ssh.ReadScpReport(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "cannot read report %s, %v\n", path, err)
+				os.Exit(1)
+			}
+
+			hosts = report.FailedServers()
+			if len(hosts) == 0 {
+				fmt.Fprintln(os.Stderr, "No failed server in report.")
+				os.Exit(0)
+			}
+			if len(args) == 0 {
+				args = report.Args
+			}
+		}
 
 		// check count args
-		if len(c.Args()) < 2 {
+		if len(args) < 2 {
 			fmt.Fprintln(os.Stderr, "Too few arguments.")
 			cli.ShowAppHelp(c)
 			os.Exit(1)
 		}
 
 		// Set args path
-		fromsArgs := c.Args()[:c.NArg()-1]
-		toArg := c.Args()[c.NArg()-1]
+		fromsArgs := args[:len(args)-1]
+		toArg := args[len(args)-1]
 
 		isFromInRemote := false
 		isFromInLocal := false
+		isStdio := false
 		for _, from := range fromsArgs {
 			// parse args
-			isFromRemote, _ := check.ParseScpPath(from)
+			isFromRemote, fromPath := check.ParseScpPath(from)
 
 			if isFromRemote {
 				isFromInRemote = true
 			} else {
 				isFromInLocal = true
+				isStdio = isStdio || fromPath == ssh.STDIO_PATH
 			}
 		}
-		isToRemote, _ := check.ParseScpPath(toArg)
+		isToRemote, toArgPath := check.ParseScpPath(toArg)
+		isStdio = isStdio || (!isToRemote && toArgPath == ssh.STDIO_PATH)
 
 		// Check from and to Type
 		check.CheckTypeError(isFromInRemote, isFromInLocal, isToRemote, len(hosts))
 
+		// include and exclude are applied with file list at local or remote, so remote to remote copy is not supported.
+		isFiltered := len(c.StringSlice("include")) > 0 || len(c.StringSlice("exclude")) > 0
+		if isFiltered && isFromInRemote && isToRemote {
+			fmt.Fprintln(os.Stderr, "--include and --exclude can not be used with remote to remote copy.")
+			os.Exit(1)
+		}
+
+		// tar stream is created and extracted at local, so remote to remote copy is not supported.
+		if c.Bool("tar") && isFromInRemote && isToRemote {
+			fmt.Fprintln(os.Stderr, "--tar can not be used with remote to remote copy.")
+			os.Exit(1)
+		}
+		if !ssh.IsTarCompress(c.String("tar-compress")) {
+			fmt.Fprintf(os.Stderr, "unknown --tar-compress %s, use gzip or zstd.\n", c.String("tar-compress"))
+			os.Exit(1)
+		}
+		if c.Bool("tar") && c.Bool("delta") {
+			fmt.Fprintln(os.Stderr, "--tar and --delta can not be used together.")
+			os.Exit(1)
+		}
+
+		// chunks are written at local or remote with offset, so remote to remote copy is not supported.
+		if c.Int("chunks") > 1 && (isFromInRemote && isToRemote || isFiltered || c.Bool("tar") || c.Bool("delta")) {
+			fmt.Fprintln(os.Stderr, "--chunks can not be used with remote to remote copy, --include, --exclude, --tar and --delta.")
+			os.Exit(1)
+		}
+
+		if c.Bool("direct") && !(isFromInRemote && isToRemote) {
+			fmt.Fprintln(os.Stderr, "--direct can be used only with remote to remote copy.")
+			os.Exit(1)
+		}
+
+		// delta transfer compare local file with existing remote file, so only local to remote copy is supported.
+		if c.Bool("delta") && (isFromInRemote || isFiltered) {
+			fmt.Fprintln(os.Stderr, "--delta can be used only with local to remote copy, without --include and --exclude.")
+			os.Exit(1)
+		}
+
+		// `-` is local stdin (from) or stdout (to). data is streamed as it is.
+		if isStdio && len(fromsArgs) > 1 && !isFromInRemote {
+			fmt.Fprintln(os.Stderr, "- (stdin) can not be used with other from paths.")
+			os.Exit(1)
+		}
+		if isStdio && (isFiltered || c.Bool("tar") || c.Int("chunks") > 1 || c.Bool("delta") || c.Bool("verify")) {
+			fmt.Fprintln(os.Stderr, "- (stdin, stdout) can not be used with --include, --exclude, --tar, --chunks, --delta and --verify.")
+			os.Exit(1)
+		}
+
 		// Get config data
 		data := conf.ReadConf(confpath)
 
 		// Get Server Name List (and sort List)
 		names := conf.GetNameList(data)
-		sort.Strings(names)
+		if err := conf.SortNameList(data, names, data.Sort); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		// use authenticated connections of running lssh (--mux). servers selected at lssh are used, if not specified.
+		muxSocket := c.String("mux-socket")
+		if c.Bool("mux") && muxSocket == "" {
+			muxSocket = ssh.DefaultMuxSocket()
+		}
+		if muxSocket != "" {
+			muxServers, err := ssh.MuxServers(muxSocket)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "cannot use mux socket %s, %v\n", muxSocket, err)
+				os.Exit(1)
+			}
+
+			for _, server := range muxServers {
+				if serverConf, ok := data.Server[server]; ok {
+					serverConf.MuxSocket = muxSocket
+					data.Server[server] = serverConf
+				}
+			}
+			if len(hosts) == 0 && !(isFromInRemote && isToRemote) {
+				hosts = muxServers
+			}
+		}
 
 		selected := []string{}
 		toServer := []string{}
@@ -123,6 +247,8 @@ USAGE:
 			if check.ExistServer(hosts, names) == false {
 				fmt.Fprintln(os.Stderr, "Input Server not found from list.")
 				os.Exit(1)
+			} else if isFromInRemote {
+				fromServer = hosts
 			} else {
 				toServer = hosts
 			}
@@ -186,7 +312,7 @@ USAGE:
 			isFromRemote, fromPath := check.ParseScpPath(from)
 
 			// Check local file exisits
-			if !isFromRemote {
+			if !isFromRemote && fromPath != ssh.STDIO_PATH {
 				_, err := os.Stat(common.GetFullPath(fromPath))
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "not found path %s \n", fromPath)
@@ -198,7 +324,7 @@ USAGE:
 			// set from data
 			runScp.From.IsRemote = isFromRemote
 			if isFromRemote {
-				fromPath = check.EscapePath(fromPath)
+				fromPath = check.EscapeRemotePath(fromPath)
 			}
 			runScp.From.Path = append(runScp.From.Path, fromPath)
 
@@ -209,14 +335,55 @@ USAGE:
 		isToRemote, toPath := check.ParseScpPath(toArg)
 		runScp.To.IsRemote = isToRemote
 		if isToRemote {
-			toPath = check.EscapePath(toPath)
+			toPath = check.EscapeRemotePath(toPath)
 		}
 		runScp.To.Path = []string{toPath}
 		runScp.To.Server = toServer
 
 		runScp.Permission = c.Bool("permission")
+		runScp.Verify = c.Bool("verify")
+		runScp.Include = c.StringSlice("include")
+		runScp.Exclude = c.StringSlice("exclude")
+		runScp.Delta = c.Bool("delta")
+		runScp.Tar = c.Bool("tar")
+		runScp.TarCompress = c.String("tar-compress")
+		runScp.Chunks = c.Int("chunks")
+		runScp.ChunkConn = c.Bool("chunk-conn")
+		runScp.Direct = c.Bool("direct")
+		runScp.Retry = c.Int("retry")
+		if report := c.String("report"); report != "" {
+			runScp.ReportPath = common.GetFullPath(report)
+		}
+		runScp.Args = args
 		runScp.Config = data
 
+		// pick remote from paths with file browser, if they match nothing
+		if isFromInRemote && !c.Bool("dry-run") && terminal.IsTerminal(int(os.Stdin.Fd())) && terminal.IsTerminal(int(os.Stdout.Fd())) {
+			missing, picked, err := runScp.BrowseMissingFrom()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if len(missing) > 0 {
+				isMissing := map[string]bool{}
+				for _, p := range missing {
+					isMissing[p] = true
+				}
+
+				paths := []string{}
+				for _, p := range runScp.From.Path {
+					if !isMissing[p] {
+						paths = append(paths, p)
+					}
+				}
+				for _, p := range picked {
+					paths = append(paths, check.EscapeRemotePath(p))
+				}
+				runScp.From.Path = paths
+			}
+		}
+
 		// print from
 		if !isFromInRemote {
 			fmt.Fprintf(os.Stderr, "From local:%s\n", runScp.From.Path)
@@ -231,7 +398,25 @@ USAGE:
 			fmt.Fprintf(os.Stderr, "To   remote(%s):%s\n", strings.Join(runScp.To.Server, ","), runScp.To.Path)
 		}
 
+		// print copy plan only
+		if c.Bool("dry-run") && c.Bool("json") {
+			if err := runScp.DryRunJSON(os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return nil
+		} else if c.Bool("dry-run") {
+			runScp.DryRun(os.Stdout)
+			return nil
+		}
+
 		runScp.Start()
+		switch {
+		case runScp.Interrupted():
+			os.Exit(130)
+		case len(runScp.FailedServers()) > 0:
+			os.Exit(1)
+		}
 		return nil
 	}
 
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+	"github.com/blacknon/lssh/ssh"
+	"github.com/urfave/cli"
+)
+
+// completeRemoteCommand return hidden `lscp __complete-remote` subcommand, that is called from completion scripts.
+// It print remote paths that start with argument, at first server of --host.
+func completeRemoteCommand() cli.Command {
+	return cli.Command{
+		Name:      "__complete-remote",
+		Usage:     "print remote paths that start with path, at first server of --host (for completion scripts)",
+		ArgsUsage: "path",
+		Hidden:    true,
+		Action: func(c *cli.Context) error {
+			hosts := c.GlobalStringSlice("host")
+			if len(hosts) == 0 {
+				return nil
+			}
+
+			data, err := conf.LoadConf(common.GetFullPath(c.GlobalString("file")), conf.LoadOptions{})
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			if _, ok := data.Server[hosts[0]]; !ok {
+				fmt.Fprintf(os.Stderr, "%s is not found in config\n", hosts[0])
+				os.Exit(1)
+			}
+
+			paths, err := ssh.CompleteRemotePath(data, hosts[0], c.Args().First())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", hosts[0], err)
+				os.Exit(1)
+			}
+			for _, p := range paths {
+				fmt.Println(p)
+			}
+			return nil
+		},
+	}
+}
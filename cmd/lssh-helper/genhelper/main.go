@@ -0,0 +1,64 @@
+//go:build ignore
+// +build ignore
+
+// genhelper build lssh-helper for each os/arch, and generate go files that embed them to ssh package.
+// Generated files have `helper` build tag. (build lssh with `go build -tags helper`)
+//
+// Usage (at ssh package directory):
+//
+//	go generate
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// target os/arch of helper
+var targets = [][2]string{
+	{"linux", "amd64"},
+	{"linux", "386"},
+	{"linux", "arm"},
+	{"linux", "arm64"},
+	{"darwin", "amd64"},
+	{"freebsd", "amd64"},
+}
+
+func main() {
+	tmpDir, err := ioutil.TempDir("", "lssh-helper")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, t := range targets {
+		goos, goarch := t[0], t[1]
+		binPath := filepath.Join(tmpDir, "lssh-helper_"+goos+"_"+goarch)
+
+		// build static binary
+		cmd := exec.Command("go", "build", "-ldflags", "-s -w", "-o", binPath, "../cmd/lssh-helper")
+		cmd.Env = append(os.Environ(), "CGO_ENABLED=0", "GOOS="+goos, "GOARCH="+goarch)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "build %s/%s: %v\n", goos, goarch, err)
+			os.Exit(1)
+		}
+
+		data, err := ioutil.ReadFile(binPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		src := fmt.Sprintf("// Code generated by genhelper. DO NOT EDIT.\n\n//go:build helper\n// +build helper\n\npackage ssh\n\nfunc init() {\n\thelperBinaries[%q] = []byte(%q)\n}\n", goos+"/"+goarch, data)
+		if err := ioutil.WriteFile("helper_bin_"+goos+"-"+goarch+".go", []byte(src), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+/*
+lssh-helper is a small static binary that lssh uploads to remote server on demand.
+It provides functions that are slow or not portable in shell.
+
+If execution of uploaded binary is forbidden (ex. noexec tmp), lssh use pure-shell fallback
+with the same output format. See also: ssh/helper.go
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+)
+
+// Version of helper. Must be same as ssh.HelperVersion.
+const Version = "2"
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: lssh-helper version|sha256|facts|blocksums|patch [args...]")
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "version":
+		fmt.Println(Version)
+	case "sha256":
+		err = sha256Files(os.Args[2:])
+	case "facts":
+		err = facts()
+	case "blocksums":
+		err = blockSums(os.Args[2:])
+	case "patch":
+		err = patch(os.Args[2:])
+	default:
+		err = fmt.Errorf("unknown function: %s", os.Args[1])
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// sha256Files print sha256 hash of files, as same format as sha256sum.
+func sha256Files(paths []string) (err error) {
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		h := sha256.New()
+		_, err = io.Copy(h, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%x  %s\n", h.Sum(nil), path)
+	}
+	return
+}
+
+// facts print host facts as `key=value` lines.
+func facts() (err error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return
+	}
+
+	fmt.Printf("hostname=%s\n", hostname)
+	fmt.Printf("os=%s\n", runtime.GOOS)
+	fmt.Printf("arch=%s\n", runtime.GOARCH)
+	return
+}
+
+// weakSum return rsync style rolling checksum of block. Must be same as weakSum in ssh/scp_delta.go.
+func weakSum(block []byte) uint32 {
+	var a, b uint32
+	l := uint32(len(block))
+	for i, c := range block {
+		a += uint32(c)
+		b += (l - uint32(i)) * uint32(c)
+	}
+	return (a & 0xffff) | (b&0xffff)<<16
+}
+
+// blockSums print weak and md5 checksum of each block of file, as `<weak> <md5>` lines.
+// args: <block size> <path>
+func blockSums(args []string) (err error) {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: lssh-helper blocksums <block size> <path>")
+	}
+	blockSize, err := strconv.Atoi(args[0])
+	if err != nil || blockSize <= 0 {
+		return fmt.Errorf("invalid block size: %s", args[0])
+	}
+
+	file, err := os.Open(args[1])
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	r := bufio.NewReaderSize(file, 1<<20)
+	block := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(r, block)
+		if n > 0 {
+			fmt.Fprintf(w, "%08x %x\n", weakSum(block[:n]), md5.Sum(block[:n]))
+		}
+		switch err {
+		case nil:
+			continue
+		case io.EOF, io.ErrUnexpectedEOF:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// patch rebuild file from current file and delta read from stdin, and replace it atomically.
+// File mode is same as current file, or mode if specified (octal).
+// args: <block size> <path> [mode]
+//
+// Delta is a sequence of operations:
+//   - 'C' <block index (uint32)>      ... copy block of current file
+//   - 'D' <length (uint32)> <data>    ... write data
+//   - 'E' <sha256 of new file>        ... end. new file is verified with sha256
+func patch(args []string) (err error) {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: lssh-helper patch <block size> <path> [mode]")
+	}
+	blockSize, err := strconv.Atoi(args[0])
+	if err != nil || blockSize <= 0 {
+		return fmt.Errorf("invalid block size: %s", args[0])
+	}
+	path := args[1]
+
+	current, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer current.Close()
+
+	info, err := current.Stat()
+	if err != nil {
+		return
+	}
+	mode := info.Mode().Perm()
+	if len(args) > 2 {
+		m, err := strconv.ParseUint(args[2], 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid mode: %s", args[2])
+		}
+		mode = os.FileMode(m)
+	}
+
+	tmp, err := os.OpenFile(filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".lssh-patch"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	w := bufio.NewWriterSize(io.MultiWriter(tmp, h), 1<<20)
+	r := bufio.NewReaderSize(os.Stdin, 1<<20)
+	block := make([]byte, blockSize)
+
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("unexpected end of delta")
+		}
+
+		switch op {
+		case 'C':
+			var index uint32
+			if err = binary.Read(r, binary.BigEndian, &index); err != nil {
+				return err
+			}
+			n, err := current.ReadAt(block, int64(index)*int64(blockSize))
+			if err != nil && err != io.EOF {
+				return err
+			}
+			w.Write(block[:n])
+
+		case 'D':
+			var length uint32
+			if err = binary.Read(r, binary.BigEndian, &length); err != nil {
+				return err
+			}
+			if _, err = io.CopyN(w, r, int64(length)); err != nil {
+				return err
+			}
+
+		case 'E':
+			sum := make([]byte, sha256.Size)
+			if _, err = io.ReadFull(r, sum); err != nil {
+				return err
+			}
+			if err = w.Flush(); err != nil {
+				return err
+			}
+			if !bytes.Equal(sum, h.Sum(nil)) {
+				return fmt.Errorf("sha256 mismatch of patched file: %s", path)
+			}
+			if err = tmp.Chmod(mode); err != nil {
+				return err
+			}
+			if err = tmp.Close(); err != nil {
+				return err
+			}
+			return os.Rename(tmp.Name(), path)
+
+		default:
+			return fmt.Errorf("invalid delta operation: %q", op)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/blacknon/lssh/conf"
+	sshcmd "github.com/blacknon/lssh/ssh"
+	"github.com/urfave/cli"
+)
+
+// addKeyCommand return `lssh add-key` subcommand. (like ssh-copy-id)
+func addKeyCommand() cli.Command {
+	return cli.Command{
+		Name:      "add-key",
+		Usage:     "add public key to authorized_keys of hosts, like ssh-copy-id (prompt password, if needed)",
+		ArgsUsage: "[hosts...]",
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{Name: "host,H", Usage: "connect servernames"},
+			cli.StringFlag{Name: "key,i", Usage: "public key file path (default: ~/.ssh/id_ed25519.pub, id_ecdsa.pub or id_rsa.pub)"},
+		},
+		Action: func(c *cli.Context) error {
+			path := c.String("key")
+			if path == "" {
+				var err error
+				if path, err = sshcmd.DefaultPublicKeyFile(); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+
+			a, err := sshcmd.ReadPublicKeyFile(path)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			hosts := append(c.StringSlice("host"), c.Args()...)
+
+			data := conf.ReadConf(c.GlobalString("file"))
+			a.ServerList = selectServers(data, hosts, true)
+			a.Conf = data
+			a.IsPasswordPrompt = true
+
+			fmt.Fprintf(os.Stderr, "Key File      :%s\n", path)
+			if failed := a.Push(); failed > 0 {
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"os"
 	"os/user"
-	"sort"
+	"strings"
+	"time"
 
-	"github.com/blacknon/lssh/check"
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/completion"
 	"github.com/blacknon/lssh/conf"
 	"github.com/blacknon/lssh/list"
 	sshcmd "github.com/blacknon/lssh/ssh"
@@ -47,6 +49,30 @@ USAGE:
 
     # parallel run command in select server over ssh, do it interactively.
     {{.Name}} -s
+
+    # clear remote capability cache
+    {{.Name}} cache clear [servername...]
+
+    # remove lssh-helper uploaded to remote servers
+    {{.Name}} helper clean servername...
+
+    # scan tcp ports from the remote host's perspective
+    {{.Name}} scan-ports [servername] 1-1024
+
+    # connect to database of server with local client (psql, mysql, redis-cli)
+    {{.Name}} db [servername] --type postgres
+
+    # run command in container at remote server (docker exec)
+    {{.Name}} exec [servername] --container web -- ps aux
+
+    # stream systemd journal of servers
+    {{.Name}} journal -H server1 -H server2 -u nginx -f --since "1 hour ago"
+
+    # use lssh as ProxyCommand (like ssh -W)
+    ssh -o ProxyCommand='{{.Name}} --stdio server' server.example.com
+
+    # port forwarding only, as service (systemd socket activation)
+    {{.Name}} -H server --service --portforward-remote 127.0.0.1:80
 `
 
 	// Create app
@@ -63,22 +89,110 @@ USAGE:
 	//     -w      ... コマンド実行時にサーバ名ヘッダの表示をする
 	//     -W      ... コマンド実行時にサーバ名ヘッダの表示をしない
 
+	// Set version flag (-v is verbose)
+	cli.VersionFlag = cli.BoolFlag{Name: "version,V", Usage: "print the version"}
+
 	// Set options
 	app.Flags = []cli.Flag{
 		cli.StringSliceFlag{Name: "host,H", Usage: "connect servernames"},
 		cli.StringFlag{Name: "file,f", Value: defConf, Usage: "config file path"},
+		cli.StringSliceFlag{Name: "option,o", Usage: "override server config of selected servers for this run, like ssh -o (ex. -o port=2222 -o user=admin)"},
+		cli.StringSliceFlag{Name: "exclude-host", Usage: "exclude servernames from selected servers"},
+		cli.StringSliceFlag{Name: "exclude-tag", Usage: "exclude servers that have the tag from selected servers"},
+		cli.BoolFlag{Name: "exclude-select", Usage: "select servers to exclude from selected servers, with list"},
+		cli.StringFlag{Name: "sample", Usage: "randomly pick number(ex. 5) or percentage(ex. 10%) of selected servers"},
+		cli.Int64Flag{Name: "sample-seed", Usage: "random seed of --sample, for reproducibility (default: current time)"},
 		cli.StringFlag{Name: "portforward-local", Usage: "port forwarding local port(ex. 127.0.0.1:8080)"},
 		cli.StringFlag{Name: "portforward-remote", Usage: "port forwarding remote port(ex. 127.0.0.1:80)"},
+		cli.BoolFlag{Name: "ipv4,4", Usage: "use IPv4 only (overwrite address_family in config)"},
+		cli.BoolFlag{Name: "ipv6,6", Usage: "use IPv6 only (overwrite address_family in config)"},
+		cli.IntFlag{Name: "connect-timeout", Usage: "connect timeout seconds (overwrite connect_timeout in config)"},
+		cli.IntFlag{Name: "connect-retries", Usage: "number of retries on connect failure (overwrite connect_retries in config)"},
+		cli.IntFlag{Name: "retry-backoff", Usage: "seconds of first retry wait, doubled at each retry (overwrite retry_backoff in config)"},
 		cli.BoolFlag{Name: "list,l", Usage: "print server list from config"},
+		cli.BoolFlag{Name: "dry-run", Usage: "print execution plan (servers, proxy route, auth methods and command) without connecting"},
+		cli.StringFlag{Name: "sort", Usage: "sort key of server list. name, addr, tag or last-used (overwrite sort.key in config)"},
+		cli.StringFlag{Name: "sort-order", Usage: "sort order of server list. asc or desc (overwrite sort.order in config)"},
 		cli.BoolFlag{Name: "term,t", Usage: "run specified command at terminal"},
+		cli.BoolFlag{Name: "no-pty,T", Usage: "disable pseudo-terminal allocation, even if --term is set (need command)"},
 		cli.BoolFlag{Name: "shell,s", Usage: "use lssh shell (Beta)"},
 		cli.BoolFlag{Name: "parallel,p", Usage: "run command parallel node(tail -F etc...)"},
-		cli.BoolFlag{Name: "x11,X", Usage: "x11 forwarding(forward to ${DISPLAY})"},
+		cli.BoolFlag{Name: "rerun-last", Usage: "rerun the previous command against the same servers (from cmd_history in state directory)"},
+		cli.BoolFlag{Name: "confirm", Usage: "confirm before running command (tag_policy in config can enforce it)"},
+		cli.BoolFlag{Name: "yes,y", Usage: "skip confirmation of destructive command guard (for automation)"},
+		cli.BoolFlag{Name: "force-auth", Usage: "connect even if recent authentication failures reach auth_failure_limit"},
+		cli.IntFlag{Name: "max-parallel", Usage: "max number of servers to run command in parallel (tag_policy in config can lower it)"},
+		cli.DurationFlag{Name: "watch", Usage: "re-run command on selected servers periodically at interval(ex. 2s), like watch(1)"},
+		cli.BoolFlag{Name: "watch-diff", Usage: "highlight changes from previous run at --watch"},
+		cli.BoolFlag{Name: "no-motd", Usage: "not print banner and login message (MOTD) of servers at command run, so that output can be parsed"},
+		cli.BoolFlag{Name: "dedup", Usage: "collapse identical output lines from multiple servers, like \"message (x42 hosts)\""},
+		cli.StringFlag{Name: "run-id", Usage: "id of this run, exported to remote as LSSH_RUN_ID and written to audit log of [audit] (default: generated)"},
+		cli.BoolFlag{Name: "summary", Usage: "print per-server summary table after command run (interactive, if stdout is terminal)"},
+		cli.BoolFlag{Name: "pager", Usage: "buffer per-server output of command run, and view it with pager (switch server, search and save) after all commands finished"},
+		cli.BoolFlag{Name: "changed", Usage: "report servers whose command output changed from previous run of same command (output is stored in state directory)"},
+		cli.BoolFlag{Name: "changed-only", Usage: "print only diff of output of changed servers, instead of output (implies --changed)"},
+		cli.StringFlag{Name: "report", Usage: "write report of command run (servers, status, exit code, duration and bytes transferred of each server) to `FILE` as json"},
+		cli.DurationFlag{Name: "dedup-window", Value: time.Second, Usage: "time window to collapse identical output lines"},
+		cli.BoolFlag{Name: "tmux", Usage: "open tmux window with one pane per selected server, running interactive session"},
+		cli.BoolFlag{Name: "tmux-sync", Usage: "synchronize input to all panes of --tmux window"},
+		cli.BoolFlag{Name: "share", Usage: "share terminal session with read-only observers, over local unix socket (attach with `lssh attach`)"},
+		cli.StringFlag{Name: "share-socket", Usage: "unix socket path of --share (default: $XDG_RUNTIME_DIR/lssh/share-<pid>.sock or share/share-<pid>.sock in state directory)"},
+		cli.BoolFlag{Name: "mux", Usage: "share authenticated connections of terminal or --shell with lscp --mux, over local unix socket"},
+		cli.StringFlag{Name: "mux-socket", Usage: "unix socket path of --mux (default: $XDG_RUNTIME_DIR/lssh/mux.sock or mux/mux.sock in state directory)"},
+		cli.BoolFlag{Name: "x11,X", Usage: "x11 forwarding(forward to ${DISPLAY}). untrusted, restricted by X security extension"},
+		cli.BoolFlag{Name: "x11-trusted,Y", Usage: "trusted x11 forwarding(forward to ${DISPLAY})"},
+		cli.StringFlag{Name: "stdio", Usage: "forward stdin/stdout to server(name in config) or host:port via -H server, like ssh -W"},
+		cli.BoolFlag{Name: "mosh", Usage: "connect with mosh (need mosh-server at remote, mosh-client at local)"},
+		cli.BoolFlag{Name: "ephemeral-key", Usage: "generate keypair for this run, install public key with existing credential, and remove it afterwards"},
+		cli.BoolFlag{Name: "ephemeral-key-print", Usage: "same as --ephemeral-key, but print public key for out-of-band installation"},
+		cli.BoolFlag{Name: "run-agent", Usage: "load identity files into in-process ssh-agent at startup (passphrase is prompted once), and use and forward it for all servers"},
+		cli.BoolFlag{Name: "system-ssh", Usage: "connect with local ssh command (OpenSSH). arguments after -- are passed to ssh"},
+		cli.BoolFlag{Name: "service", Usage: "run port forwarding only, as service mode (support systemd socket activation)"},
+		cli.StringFlag{Name: "metrics", Usage: "expose metrics of --service or --mux in Prometheus text format at http://`ADDR`/metrics (ex. 127.0.0.1:9100)"},
+		cli.StringFlag{Name: "state-dir", Usage: "directory of history, cache and other state files (default: $LSSH_STATE_DIR, $XDG_STATE_HOME/lssh or ~/.local/state/lssh)"},
+		cli.BoolFlag{Name: "plain-ui", EnvVar: "LSSH_PLAIN_UI", Usage: "use sequential prompts and plain text instead of full-screen TUI and colors (for screen readers)"},
+		cli.BoolFlag{Name: "verbose,v", Usage: "verbose mode. multiple -v options increase the verbosity (max 3)"},
 		cli.BoolFlag{Name: "help,h", Usage: "print this help"},
 	}
 	app.EnableBashCompletion = true
 	app.HideHelp = true
 
+	// Set subcommands
+	app.Commands = []cli.Command{
+		cacheCommand(),
+		helperCommand(),
+		scanPortsCommand(),
+		dbCommand(),
+		execCommand(),
+		journalCommand(),
+		tailCommand(),
+		statsCommand(),
+		keyCommand(),
+		addKeyCommand(),
+		auditHostKeysCommand(),
+		pingCommand(),
+		supportBundleCommand(),
+		attachCommand(),
+		completion.Command(app, false),
+	}
+
+	// Set global options (also used by subcommands)
+	closeDebugLog := func() {}
+	app.Before = func(c *cli.Context) error {
+		isPlainUI = c.Bool("plain-ui")
+		confPath = c.String("file")
+		sshcmd.IgnoreAuthFailures = c.Bool("force-auth")
+		common.StateDir = c.String("state-dir")
+
+		// debug log is written to state directory too. (for `lssh support-bundle`)
+		closeDebugLog = sshcmd.OpenDebugLog()
+		return nil
+	}
+	app.After = func(c *cli.Context) error {
+		closeDebugLog()
+		return nil
+	}
+
 	// Run command action
 	app.Action = func(c *cli.Context) error {
 		// show help messages
@@ -93,18 +207,97 @@ USAGE:
 		// Get config data
 		data := conf.ReadConf(confpath)
 
+		// command to run. with --rerun-last, repeat the previous command run against the same servers.
+		execCmd := []string(c.Args())
+		isParallel := c.Bool("parallel")
+		isTerm := c.Bool("term")
+
+		// system ssh mode. arguments (after `--`) are passed to local ssh command, not run as command.
+		var systemSshArgs []string
+		if c.Bool("system-ssh") {
+			systemSshArgs, execCmd = execCmd, nil
+		}
+
+		if c.Bool("rerun-last") {
+			last, ok := sshcmd.LastCmdHistory()
+			if !ok {
+				fmt.Fprintln(os.Stderr, "No command history.")
+				os.Exit(1)
+			}
+
+			hosts = last.Servers
+			execCmd = last.Command
+			isParallel = isParallel || last.IsParallel
+			isTerm = isTerm || last.IsTerm
+			fmt.Fprintf(os.Stderr, "Rerun         :%s (%s)\n", last, last.Time.Format("2006/01/02 15:04:05"))
+		}
+
+		// check config overrides (-o key=value). applied to selected servers.
+		overrides := c.StringSlice("option")
+		if _, err := conf.ApplyServerOverrides(conf.ServerConfig{}, overrides); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		// Overwrite sort order of server list
+		if c.IsSet("sort") {
+			data.Sort.Key = c.String("sort")
+		}
+		if c.IsSet("sort-order") {
+			data.Sort.Order = c.String("sort-order")
+		}
+
+		// Overwrite address family, connect timeout and retry setting
+		for name, serverConf := range data.Server {
+			if c.Bool("ipv4") {
+				serverConf.AddressFamily = "inet"
+			}
+			if c.Bool("ipv6") {
+				serverConf.AddressFamily = "inet6"
+			}
+			if c.IsSet("connect-timeout") {
+				serverConf.ConnectTimeout = c.Int("connect-timeout")
+			}
+			if c.IsSet("connect-retries") {
+				serverConf.ConnectRetries = c.Int("connect-retries")
+			}
+			if c.IsSet("retry-backoff") {
+				serverConf.RetryBackoff = c.Int("retry-backoff")
+			}
+			data.Server[name] = serverConf
+		}
+
+		// stdio forward mode. use lssh as ProxyCommand.
+		if target := c.String("stdio"); target != "" {
+			r := new(sshcmd.Run)
+			r.ServerList = hosts
+			r.Conf = data
+			r.StdioTarget = target
+			r.Start()
+			return nil
+		}
+
 		// Set `exec command` or `shell` flag
 		isMulti := false
-		if len(c.Args()) > 0 || c.Bool("shell") {
+		if len(execCmd) > 0 || c.Bool("shell") || c.Bool("tmux") {
 			isMulti = true
 		}
 
-		// Extraction server name list from 'data'
-		names := conf.GetNameList(data)
-		sort.Strings(names)
+		// batch mode (batch_mode in config). server list and prompts are not shown, so servers must be specified.
+		if commonConf, _ := conf.ApplyServerOverrides(data.Common, overrides); commonConf.BatchMode && !c.Bool("list") && (len(hosts) == 0 || c.Bool("exclude-select")) {
+			fmt.Fprintln(os.Stderr, "Servers must be specified with --host at batch mode (--exclude-select can not be used).")
+			os.Exit(1)
+		}
 
 		// Check list flag
 		if c.Bool("list") {
+			// Extraction server name list from 'data'
+			names := conf.GetNameList(data)
+			if err := conf.SortNameList(data, names, data.Sort); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
 			fmt.Fprintf(os.Stdout, "lssh Server List:\n")
 			for v := range names {
 				fmt.Fprintf(os.Stdout, "  %s\n", names[v])
@@ -112,43 +305,232 @@ USAGE:
 			os.Exit(0)
 		}
 
-		selected := []string{}
-		if len(hosts) > 0 {
-			if !check.ExistServer(hosts, names) {
-				fmt.Fprintln(os.Stderr, "Input Server not found from list.")
-				os.Exit(1)
-			} else {
-				selected = hosts
-			}
-		} else {
-			// View List And Get Select Line
+		selected := selectServers(data, hosts, isMulti)
+
+		// exclude servers
+		selected = conf.ExcludeNameList(data, selected, c.StringSlice("exclude-host"), c.StringSlice("exclude-tag"))
+		if c.Bool("exclude-select") && len(selected) > 0 {
 			l := new(list.ListInfo)
-			l.Prompt = "lssh>>"
-			l.NameList = names
+			l.Prompt = "exclude>>"
+			l.NameList = selected
 			l.DataList = data
-			l.MultiFlag = isMulti
+			l.MultiFlag = true
+			l.IsPlain = isPlainUI
 
 			l.View()
-			selected = l.SelectName
-			if selected[0] == "ServerName" {
-				fmt.Fprintln(os.Stderr, "Server not selected.")
+			selected = conf.ExcludeNameList(data, selected, l.SelectName, nil)
+		}
+		if len(selected) == 0 {
+			fmt.Fprintln(os.Stderr, "All selected servers are excluded.")
+			os.Exit(1)
+		}
+
+		// random sampling (canary run)
+		if sample := c.String("sample"); sample != "" {
+			seed := c.Int64("sample-seed")
+			if !c.IsSet("sample-seed") {
+				seed = time.Now().UnixNano()
+			}
+
+			var err error
+			selected, err = common.SampleList(selected, sample, seed)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "Sample Seed   :%d\n", seed)
+
+			if len(selected) == 0 {
+				fmt.Fprintln(os.Stderr, "No server sampled.")
 				os.Exit(1)
 			}
 		}
 
+		// config overrides of selected servers
+		isBatch := false
+		for _, name := range selected {
+			data.Server[name], _ = conf.ApplyServerOverrides(data.Server[name], overrides)
+			isBatch = isBatch || data.Server[name].BatchMode
+		}
+
+		// batch mode and no pty. command is run without pty, and nothing is asked. output is plain text.
+		isInteractive := (len(execCmd) == 0 && !c.Bool("system-ssh") && !c.Bool("service")) || c.Bool("shell")
+		if (isBatch || c.Bool("no-pty")) && isInteractive {
+			fmt.Fprintln(os.Stderr, "Command must be specified at batch mode or with --no-pty.")
+			os.Exit(1)
+		}
+		if isBatch || c.Bool("no-pty") {
+			isTerm = false
+		}
+		if isBatch {
+			isPlainUI = true
+		}
+
+		// tmux mode. interactive session per server at tmux pane.
+		if c.Bool("tmux") && len(selected) > 1 && !c.Bool("dry-run") {
+			if len(execCmd) > 0 || c.Bool("shell") {
+				fmt.Fprintln(os.Stderr, "--tmux can not be used with command or --shell.")
+				os.Exit(1)
+			}
+
+			// pass through connect options to sessions at panes
+			options := []string{}
+			for _, name := range []string{"x11", "x11-trusted", "ipv4", "ipv6", "plain-ui"} {
+				if c.Bool(name) {
+					options = append(options, "--"+name)
+				}
+			}
+			for _, override := range overrides {
+				options = append(options, "-o", override)
+			}
+
+			if err := runTmux(confpath, selected, options, c.Bool("tmux-sync")); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return nil
+		}
+
+		// execution policy (layered tag policies and flags, the strictest one is used)
+		maxParallel := c.Int("max-parallel")
+		if len(execCmd) > 0 {
+			policy, tags := conf.GetTagPolicy(data, selected)
+			if len(tags) > 0 {
+				fmt.Fprintf(os.Stderr, "Tag Policy    :%s (confirm: %v, max_parallel: %d)\n", strings.Join(tags, ","), policy.Confirm, policy.MaxParallel)
+			}
+			if policy.MaxParallel > 0 && (maxParallel <= 0 || policy.MaxParallel < maxParallel) {
+				maxParallel = policy.MaxParallel
+			}
+
+			isConfirm := (c.Bool("confirm") || policy.Confirm) && !c.Bool("dry-run")
+			if isConfirm && isBatch {
+				fmt.Fprintln(os.Stderr, "Canceled. confirmation is required, but it is not asked at batch mode.")
+				os.Exit(1)
+			}
+			if isConfirm && !confirmRun(selected, execCmd) {
+				fmt.Fprintln(os.Stderr, "Canceled.")
+				os.Exit(1)
+			}
+
+			// destructive command guard
+			pattern, err := conf.MatchGuard(data.Guard, strings.Join(execCmd, " "))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			if pattern != "" && c.Bool("dry-run") {
+				fmt.Fprintf(os.Stderr, "Guard         :matched '%s' (confirmation required)\n", pattern)
+			} else if pattern != "" && !c.Bool("yes") && isBatch {
+				fmt.Fprintf(os.Stderr, "Canceled. command matched '%s', but confirmation is not asked at batch mode (use --yes).\n", pattern)
+				os.Exit(1)
+			} else if pattern != "" && !c.Bool("yes") && !confirmDangerous(selected, execCmd) {
+				fmt.Fprintln(os.Stderr, "Canceled.")
+				os.Exit(1)
+			}
+		}
+
+		// ephemeral key is removed at exit of lssh, so it can not be used with modes that use other client or keep running.
+		isEphemeralKey := c.Bool("ephemeral-key") || c.Bool("ephemeral-key-print")
+		if isEphemeralKey && (c.Bool("system-ssh") || c.Bool("mosh") || c.Bool("service")) {
+			fmt.Fprintln(os.Stderr, "--ephemeral-key can not be used with --system-ssh, --mosh or --service.")
+			os.Exit(1)
+		}
+
+		// shared session is terminal connection only.
+		shareSocket := c.String("share-socket")
+		if c.Bool("share") && shareSocket == "" {
+			shareSocket = sshcmd.DefaultShareSocket()
+		}
+		if shareSocket != "" && (len(execCmd) > 0 || len(selected) > 1 || c.Bool("shell") || c.Bool("system-ssh") || c.Bool("mosh") || c.Bool("service")) {
+			fmt.Fprintln(os.Stderr, "--share can be used with terminal connection to single server only.")
+			os.Exit(1)
+		}
+
+		// connections are shared while terminal or shell is running.
+		muxSocket := c.String("mux-socket")
+		if c.Bool("mux") && muxSocket == "" {
+			muxSocket = sshcmd.DefaultMuxSocket()
+		}
+		if muxSocket != "" && (len(execCmd) > 0 || c.Bool("system-ssh") || c.Bool("mosh") || c.Bool("service") || (len(selected) > 1 && !c.Bool("shell"))) {
+			fmt.Fprintln(os.Stderr, "--mux can be used with terminal connection to single server or --shell only.")
+			os.Exit(1)
+		}
+
+		// output of command run is compared with previous run.
+		if (c.Bool("changed") || c.Bool("changed-only")) && (len(execCmd) == 0 || c.Duration("watch") > 0) {
+			fmt.Fprintln(os.Stderr, "--changed can be used with command run only, and not with --watch.")
+			os.Exit(1)
+		}
+
+		// report is written after command run.
+		if c.String("report") != "" && (len(execCmd) == 0 || c.Duration("watch") > 0) {
+			fmt.Fprintln(os.Stderr, "--report can be used with command run only, and not with --watch.")
+			os.Exit(1)
+		}
+
+		// pager views output of command run, after all commands finished.
+		if c.Bool("pager") && (len(execCmd) == 0 || c.Duration("watch") > 0 || c.Bool("dedup")) {
+			fmt.Fprintln(os.Stderr, "--pager can be used with command run only, and not with --watch or --dedup.")
+			os.Exit(1)
+		}
+
+		// metrics is exposed by long-running service and mux.
+		if c.String("metrics") != "" && !c.Bool("service") && muxSocket == "" {
+			fmt.Fprintln(os.Stderr, "--metrics can be used with --service or --mux only.")
+			os.Exit(1)
+		}
+
 		r := new(sshcmd.Run)
 		r.ServerList = selected
 		r.Conf = data
-		r.IsTerm = c.Bool("term")
-		r.IsParallel = c.Bool("parallel")
+		r.IsTerm = isTerm
+		r.IsParallel = isParallel
 		r.IsShell = c.Bool("shell")
-		r.ExecCmd = c.Args()
+		r.ExecCmd = execCmd
 		r.IsX11 = c.Bool("x11")
+		r.IsX11Trusted = c.Bool("x11-trusted")
+		r.IsService = c.Bool("service")
+		r.IsMosh = c.Bool("mosh")
+		r.IsEphemeralKey = isEphemeralKey
+		r.IsEphemeralPrint = c.Bool("ephemeral-key-print")
+		r.IsRunAgent = c.Bool("run-agent")
+		r.IsNoMotd = c.Bool("no-motd") || isBatch
+		r.IsYes = c.Bool("yes")
+		r.IsSystemSsh = c.Bool("system-ssh")
+		r.SystemSshArgs = systemSshArgs
+		r.IsDedup = c.Bool("dedup")
+		r.IsSummary = c.Bool("summary")
+		r.IsPager = c.Bool("pager")
+		r.IsChanged = c.Bool("changed")
+		r.IsChangedOnly = c.Bool("changed-only")
+		if report := c.String("report"); report != "" {
+			r.ReportPath = common.GetFullPath(report)
+		}
+		r.MaxParallel = maxParallel
+		r.IsPlainUI = isPlainUI
+		r.WatchInterval = c.Duration("watch")
+		r.IsWatchDiff = c.Bool("watch-diff")
+		r.DedupWindow = c.Duration("dedup-window")
+		r.RunID = c.String("run-id")
+		r.ShareSocket = shareSocket
+		r.MuxSocket = muxSocket
+		r.MetricsAddr = c.String("metrics")
 
 		r.PortForwardLocal = c.String("portforward-local")
 		r.PortForwardRemote = c.String("portforward-remote")
 
+		// print execution plan only
+		if c.Bool("dry-run") {
+			r.DryRun(os.Stdout)
+			return nil
+		}
+
 		r.Start()
+
+		// exit with remote command's exit status (single server)
+		if r.ExitStatus != 0 {
+			os.Exit(r.ExitStatus)
+		}
 		return nil
 	}
 	return app
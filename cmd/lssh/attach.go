@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	sshcmd "github.com/blacknon/lssh/ssh"
+	"github.com/urfave/cli"
+)
+
+// attachCommand return `lssh attach` subcommand.
+func attachCommand() cli.Command {
+	return cli.Command{
+		Name:      "attach",
+		Usage:     "attach to session shared with `lssh --share`, as read-only observer",
+		ArgsUsage: "socket_path|host:port",
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				cli.ShowCommandHelp(c, "attach")
+				os.Exit(1)
+			}
+
+			if err := sshcmd.AttachShare(c.Args()[0]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	sshcmd "github.com/blacknon/lssh/ssh"
+	"github.com/urfave/cli"
+)
+
+// cacheCommand return `lssh cache` subcommand.
+func cacheCommand() cli.Command {
+	return cli.Command{
+		Name:  "cache",
+		Usage: "manage remote capability cache",
+		Subcommands: []cli.Command{
+			{
+				Name:      "clear",
+				Usage:     "clear remote capability cache (all servers, if not specified)",
+				ArgsUsage: "[servername...]",
+				Action: func(c *cli.Context) error {
+					if err := sshcmd.ClearCapabilityCache(c.Args()); err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						os.Exit(1)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
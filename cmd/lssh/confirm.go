@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// confirmRun ask whether to run command on servers, and return true if answered yes.
+// Answer is read from /dev/tty, because stdin may be piped to the command.
+func confirmRun(servers, command []string) bool {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot open terminal to confirm, %v\n", err)
+		return false
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "Run `%s` on %d servers (%s)? [y/N]: ", strings.Join(command, " "), len(servers), strings.Join(servers, ","))
+
+	answer, _ := bufio.NewReader(tty).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
+
+// confirmDangerous ask whether to run dangerous command (matched guard pattern) on servers.
+// Return true only if answered `yes` explicitly.
+func confirmDangerous(servers, command []string) bool {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot open terminal to confirm, %v (use --yes to run without confirmation)\n", err)
+		return false
+	}
+	defer tty.Close()
+
+	// show up to 10 servers
+	names := servers
+	if len(names) > 10 {
+		names = append(append([]string{}, names[:10]...), fmt.Sprintf("... (%d more)", len(servers)-10))
+	}
+
+	fmt.Fprintf(tty, "WARNING: `%s` looks like a destructive command.\n", strings.Join(command, " "))
+	fmt.Fprintf(tty, "You are about to run this on %d hosts: %s\n", len(servers), strings.Join(names, ", "))
+	fmt.Fprint(tty, "Type 'yes' to continue: ")
+
+	answer, _ := bufio.NewReader(tty).ReadString('\n')
+	return strings.TrimSpace(answer) == "yes"
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/blacknon/lssh/conf"
+	sshcmd "github.com/blacknon/lssh/ssh"
+	"github.com/urfave/cli"
+)
+
+// dbCommand return `lssh db` subcommand.
+func dbCommand() cli.Command {
+	return cli.Command{
+		Name:      "db",
+		Usage:     "create tunnel to database of server, and exec local db client (psql, mysql, redis-cli)",
+		ArgsUsage: "[servername] [-- client args...]",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "type", Usage: "db type in config (postgres, mysql, redis)"},
+			cli.StringFlag{Name: "local-port", Usage: "local port of tunnel (default: local_port in config, or random)"},
+			cli.BoolFlag{Name: "tunnel-only,n", Usage: "create tunnel only, do not exec local client"},
+		},
+		Action: func(c *cli.Context) error {
+			args := c.Args()
+
+			hosts := []string{}
+			if len(args) > 0 && args[0] != "--" {
+				hosts = []string{args[0]}
+				args = args[1:]
+			}
+			if len(args) > 0 && args[0] == "--" {
+				args = args[1:]
+			}
+
+			data := conf.ReadConf(c.GlobalString("file"))
+			selected := selectServers(data, hosts, false)
+
+			d := &sshcmd.DBTunnel{
+				Server:     selected[0],
+				Conf:       data,
+				Type:       c.String("type"),
+				LocalPort:  c.String("local-port"),
+				ExecClient: !c.Bool("tunnel-only"),
+				ClientArgs: args,
+			}
+
+			err := d.Start()
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				os.Exit(exitErr.ExitCode())
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/blacknon/lssh/conf"
+	sshcmd "github.com/blacknon/lssh/ssh"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// execCommand return `lssh exec` subcommand.
+func execCommand() cli.Command {
+	return cli.Command{
+		Name:      "exec",
+		Usage:     "run command in container at remote server (docker exec, nerdctl exec...)",
+		ArgsUsage: "[servername] --container name [-- command...]",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "container,c", Usage: "container name or id"},
+			cli.StringFlag{Name: "runtime", Usage: "container runtime command (default: container_runtime in config, or docker)"},
+			cli.StringFlag{Name: "user,u", Usage: "user in container"},
+			cli.BoolFlag{Name: "tty,t", Usage: "force tty allocation"},
+			cli.BoolFlag{Name: "no-tty,T", Usage: "disable tty allocation"},
+		},
+		Action: func(c *cli.Context) error {
+			if c.String("container") == "" {
+				cli.ShowCommandHelp(c, "exec")
+				os.Exit(1)
+			}
+
+			args := c.Args()
+			hosts := []string{}
+			if len(args) > 0 && args[0] != "--" {
+				hosts = []string{args[0]}
+				args = args[1:]
+			}
+			if len(args) > 0 && args[0] == "--" {
+				args = args[1:]
+			}
+
+			data := conf.ReadConf(c.GlobalString("file"))
+			selected := selectServers(data, hosts, false)
+
+			// allocate tty, if stdin is terminal and run shell (like ssh)
+			isTerm := terminal.IsTerminal(int(os.Stdin.Fd())) && len(args) == 0
+			if c.Bool("tty") {
+				isTerm = true
+			}
+			if c.Bool("no-tty") {
+				isTerm = false
+			}
+
+			e := &sshcmd.ContainerExec{
+				Server:    selected[0],
+				Conf:      data,
+				Container: c.String("container"),
+				Runtime:   c.String("runtime"),
+				User:      c.String("user"),
+				Command:   args,
+				IsTerm:    isTerm,
+			}
+
+			err := e.Start()
+			if exitErr, ok := err.(*ssh.ExitError); ok {
+				os.Exit(exitErr.ExitStatus())
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+}
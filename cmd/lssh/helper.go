@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/blacknon/lssh/check"
+	"github.com/blacknon/lssh/conf"
+	sshcmd "github.com/blacknon/lssh/ssh"
+	"github.com/urfave/cli"
+)
+
+// helperCommand return `lssh helper` subcommand.
+func helperCommand() cli.Command {
+	return cli.Command{
+		Name:  "helper",
+		Usage: "manage lssh-helper uploaded to remote server",
+		Subcommands: []cli.Command{
+			{
+				Name:      "clean",
+				Usage:     "remove lssh-helper from remote servers",
+				ArgsUsage: "servername...",
+				Action: func(c *cli.Context) error {
+					servers := []string(c.Args())
+					if len(servers) == 0 {
+						fmt.Fprintln(os.Stderr, "Please specify servername.")
+						os.Exit(1)
+					}
+
+					data := conf.ReadConf(c.GlobalString("file"))
+					if !check.ExistServer(servers, conf.GetNameList(data)) {
+						fmt.Fprintln(os.Stderr, "Input Server not found from list.")
+						os.Exit(1)
+					}
+
+					sshcmd.RemoveHelpers(data, servers)
+					return nil
+				},
+			},
+		},
+	}
+}
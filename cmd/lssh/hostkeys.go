@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/blacknon/lssh/check"
+	"github.com/blacknon/lssh/conf"
+	sshcmd "github.com/blacknon/lssh/ssh"
+	"github.com/urfave/cli"
+)
+
+// auditHostKeysCommand return `lssh audit-hostkeys` subcommand.
+func auditHostKeysCommand() cli.Command {
+	return cli.Command{
+		Name:  "audit-hostkeys",
+		Usage: "connect to all servers, and report host keys changed from known_hosts or stored baseline",
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{Name: "host,H", Usage: "audit servernames (default: all servers)"},
+			cli.StringFlag{Name: "known-hosts", Value: "~/.ssh/known_hosts", Usage: "known_hosts file path"},
+			cli.BoolFlag{Name: "update", Usage: "store current host keys as baseline"},
+		},
+		Action: func(c *cli.Context) error {
+			data := conf.ReadConf(c.GlobalString("file"))
+			names := conf.GetNameList(data)
+			if err := conf.SortNameList(data, names, data.Sort); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			hosts := c.StringSlice("host")
+			if len(hosts) > 0 {
+				if !check.ExistServer(hosts, names) {
+					fmt.Fprintln(os.Stderr, "Input Server not found from list.")
+					os.Exit(1)
+				}
+				names = hosts
+			}
+
+			a := &sshcmd.HostKeyAudit{
+				ServerList: names,
+				Conf:       data,
+				KnownHosts: c.String("known-hosts"),
+				IsUpdate:   c.Bool("update"),
+			}
+			if changed := a.Start(); changed > 0 {
+				fmt.Fprintf(os.Stderr, "%d host keys are changed.\n", changed)
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+}
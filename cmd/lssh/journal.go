@@ -0,0 +1,52 @@
+package main
+
+import (
+	"time"
+
+	"github.com/blacknon/lssh/conf"
+	sshcmd "github.com/blacknon/lssh/ssh"
+	"github.com/urfave/cli"
+)
+
+// journalCommand return `lssh journal` subcommand.
+func journalCommand() cli.Command {
+	return cli.Command{
+		Name:  "journal",
+		Usage: "stream systemd journal (journalctl) of servers, with server name prefix",
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{Name: "host,H", Usage: "connect servernames"},
+			cli.StringSliceFlag{Name: "unit,u", Usage: "show logs of the unit"},
+			cli.StringFlag{Name: "since,S", Usage: "show entries since the date (ex. \"1 hour ago\", \"2019-01-01 00:00:00\")"},
+			cli.StringFlag{Name: "until,U", Usage: "show entries until the date"},
+			cli.StringFlag{Name: "priority,p", Usage: "filter output by message priority (ex. err, warning..info)"},
+			cli.IntFlag{Name: "lines,n", Usage: "number of journal entries to show (default: all, or 10 with --follow)"},
+			cli.BoolFlag{Name: "follow,f", Usage: "follow the journal, and reconnect when the connection is dropped"},
+			cli.BoolFlag{Name: "sudo", Usage: "run journalctl with sudo -n"},
+			cli.DurationFlag{Name: "retry-interval", Value: 5 * time.Second, Usage: "wait time to reconnect"},
+		},
+		Action: func(c *cli.Context) error {
+			data := conf.ReadConf(c.GlobalString("file"))
+			selected := selectServers(data, c.StringSlice("host"), true)
+
+			j := &sshcmd.Journal{
+				Units:    c.StringSlice("unit"),
+				Since:    c.String("since"),
+				Until:    c.String("until"),
+				Priority: c.String("priority"),
+				Lines:    c.Int("lines"),
+				IsFollow: c.Bool("follow"),
+				IsSudo:   c.Bool("sudo"),
+			}
+
+			f := &sshcmd.Follow{
+				ServerList:    selected,
+				Conf:          data,
+				Command:       j.Command,
+				Reconnect:     j.IsFollow,
+				RetryInterval: c.Duration("retry-interval"),
+			}
+			f.Start()
+			return nil
+		},
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/blacknon/lssh/conf"
+	sshcmd "github.com/blacknon/lssh/ssh"
+	"github.com/urfave/cli"
+)
+
+// keyCommand return `lssh key` subcommand.
+func keyCommand() cli.Command {
+	// keyAction return action that run f with public key and selected servers.
+	keyAction := func(f func(a *sshcmd.AuthorizedKeys) int) func(c *cli.Context) error {
+		return func(c *cli.Context) error {
+			if c.String("pub") == "" {
+				fmt.Fprintln(os.Stderr, "Please specify public key file with --pub.")
+				os.Exit(1)
+			}
+
+			a, err := sshcmd.ReadPublicKeyFile(c.String("pub"))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			data := conf.ReadConf(c.GlobalString("file"))
+			a.ServerList = selectServers(data, c.StringSlice("host"), true)
+			a.Conf = data
+			a.IsForce = c.Bool("force")
+
+			if failed := f(a); failed > 0 {
+				os.Exit(1)
+			}
+			return nil
+		}
+	}
+
+	return cli.Command{
+		Name:  "key",
+		Usage: "manage public key at authorized_keys of remote servers",
+		Subcommands: []cli.Command{
+			{
+				Name:  "push",
+				Usage: "add public key to authorized_keys of selected servers (skip, if already exists)",
+				Flags: []cli.Flag{
+					cli.StringSliceFlag{Name: "host,H", Usage: "connect servernames"},
+					cli.StringFlag{Name: "pub", Usage: "public key file path (ex. ~/.ssh/id_ed25519.pub)"},
+				},
+				Action: keyAction((*sshcmd.AuthorizedKeys).Push),
+			},
+			{
+				Name:  "revoke",
+				Usage: "remove public key from authorized_keys of selected servers",
+				Flags: []cli.Flag{
+					cli.StringSliceFlag{Name: "host,H", Usage: "connect servernames"},
+					cli.StringFlag{Name: "pub", Usage: "public key file path (ex. ~/.ssh/id_ed25519.pub)"},
+					cli.BoolFlag{Name: "force", Usage: "remove key, even if it is the last key in authorized_keys"},
+				},
+				Action: keyAction((*sshcmd.AuthorizedKeys).Revoke),
+			},
+		},
+	}
+}
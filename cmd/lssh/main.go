@@ -2,9 +2,15 @@ package main
 
 import (
 	"os"
+
+	sshcmd "github.com/blacknon/lssh/ssh"
 )
 
 func main() {
 	app := Lssh()
-	app.Run(os.Args)
+
+	args, level := parseVerbose(app.Flags, os.Args)
+	sshcmd.DebugLevel = level
+
+	app.Run(args)
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/blacknon/lssh/check"
+	"github.com/blacknon/lssh/conf"
+	sshcmd "github.com/blacknon/lssh/ssh"
+	"github.com/urfave/cli"
+)
+
+// pingCommand return `lssh ping` subcommand.
+func pingCommand() cli.Command {
+	return cli.Command{
+		Name:  "ping",
+		Usage: "check reachability of servers in parallel (tcp connect, ssh banner and authentication)",
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{Name: "host,H", Usage: "check servernames (default: all servers)"},
+			cli.StringSliceFlag{Name: "tag", Usage: "check servers that have the tag"},
+			cli.StringSliceFlag{Name: "exclude-tag", Usage: "exclude servers that have the tag"},
+			cli.BoolFlag{Name: "auth,a", Usage: "try authentication"},
+			cli.IntFlag{Name: "parallel,p", Value: 10, Usage: "number of parallel check"},
+			cli.DurationFlag{Name: "timeout", Value: 5 * time.Second, Usage: "timeout of each server"},
+			cli.StringFlag{Name: "sort", Value: "name", Usage: "sort key of result. name, latency or status"},
+		},
+		Action: func(c *cli.Context) error {
+			data := conf.ReadConf(c.GlobalString("file"))
+			names := conf.GetNameList(data)
+			if err := conf.SortNameList(data, names, data.Sort); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			hosts := c.StringSlice("host")
+			if len(hosts) > 0 {
+				if !check.ExistServer(hosts, names) {
+					fmt.Fprintln(os.Stderr, "Input Server not found from list.")
+					os.Exit(1)
+				}
+				names = hosts
+			}
+			names = conf.FilterNameListByTag(data, names, c.StringSlice("tag"))
+			names = conf.ExcludeNameList(data, names, nil, c.StringSlice("exclude-tag"))
+			if len(names) == 0 {
+				fmt.Fprintln(os.Stderr, "Server not found.")
+				os.Exit(1)
+			}
+
+			p := &sshcmd.Ping{
+				ServerList: names,
+				Conf:       data,
+				Parallel:   c.Int("parallel"),
+				Timeout:    c.Duration("timeout"),
+				IsAuth:     c.Bool("auth"),
+				SortKey:    c.String("sort"),
+			}
+			if failed := p.Start(); failed > 0 {
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+	sshcmd "github.com/blacknon/lssh/ssh"
+	"github.com/urfave/cli"
+)
+
+// scanPortsCommand return `lssh scan-ports` subcommand.
+func scanPortsCommand() cli.Command {
+	return cli.Command{
+		Name:      "scan-ports",
+		Usage:     "scan tcp ports from the remote host's perspective (via ssh connection)",
+		ArgsUsage: "[servername] ports(ex. 1-1024,8080)",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "target", Value: "127.0.0.1", Usage: "scan target host, from remote host"},
+			cli.IntFlag{Name: "parallel,p", Value: 10, Usage: "number of parallel connection"},
+			cli.DurationFlag{Name: "timeout", Value: 3 * time.Second, Usage: "timeout of each port"},
+			cli.BoolFlag{Name: "all,a", Usage: "print closed and filtered ports"},
+		},
+		Action: func(c *cli.Context) error {
+			args := c.Args()
+			if len(args) == 0 || len(args) > 2 {
+				cli.ShowCommandHelp(c, "scan-ports")
+				os.Exit(1)
+			}
+
+			hosts := []string{}
+			if len(args) == 2 {
+				hosts = []string{args[0]}
+			}
+
+			ports, err := common.ParsePortRange(args[len(args)-1])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			data := conf.ReadConf(c.GlobalString("file"))
+			selected := selectServers(data, hosts, false)
+
+			p := &sshcmd.PortScan{
+				Server:   selected[0],
+				Conf:     data,
+				Target:   c.String("target"),
+				Ports:    ports,
+				Parallel: c.Int("parallel"),
+				Timeout:  c.Duration("timeout"),
+				ShowAll:  c.Bool("all"),
+			}
+			if err := p.Start(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+}
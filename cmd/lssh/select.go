@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/blacknon/lssh/check"
+	"github.com/blacknon/lssh/conf"
+	"github.com/blacknon/lssh/list"
+)
+
+// isPlainUI is flag of plain text ui (--plain-ui). set at app.Before.
+var isPlainUI bool
+
+// confPath is config file path (--file). set at app.Before, to reload server list.
+var confPath string
+
+// selectServers return servers specified by hosts, or selected with TUI list (or plain text prompts).
+// If server is not found or not selected, exit.
+func selectServers(data conf.Config, hosts []string, isMulti bool) (selected []string) {
+	// Extraction server name list from 'data'
+	names := conf.GetNameList(data)
+	if err := conf.SortNameList(data, names, data.Sort); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if len(hosts) > 0 {
+		if !check.ExistServer(hosts, names) {
+			fmt.Fprintln(os.Stderr, "Input Server not found from list.")
+			os.Exit(1)
+		}
+		conf.UpdateLastUsed(hosts)
+		return hosts
+	}
+
+	// View List And Get Select Line
+	l := new(list.ListInfo)
+	l.Prompt = "lssh>>"
+	l.NameList = names
+	l.DataList = data
+	l.MultiFlag = isMulti
+	l.IsPlain = isPlainUI
+	l.Reload = func() ([]string, conf.Config, error) {
+		return reloadServers(data)
+	}
+
+	l.View()
+	selected = l.SelectName
+	if selected[0] == "ServerName" {
+		fmt.Fprintln(os.Stderr, "Server not selected.")
+		os.Exit(1)
+	}
+	conf.UpdateLastUsed(selected)
+
+	return
+}
+
+// reloadServers read servers of config again, without cache of inventories (ex. teleport nodes).
+// New servers are added to data and removed servers are deleted. Servers in data are kept (with options of command line).
+// Warnings of inventories are returned as error, with server list.
+func reloadServers(data conf.Config) (names []string, _ conf.Config, err error) {
+	warnings := []string{}
+	reloaded, err := conf.LoadConf(confPath, conf.LoadOptions{
+		Warn:    func(err error) { warnings = append(warnings, err.Error()) },
+		Refresh: true,
+	})
+	if err != nil {
+		return nil, data, err
+	}
+
+	for name := range data.Server {
+		if _, ok := reloaded.Server[name]; !ok {
+			delete(data.Server, name)
+		}
+	}
+	for name, value := range reloaded.Server {
+		if _, ok := data.Server[name]; !ok {
+			data.Server[name] = value
+		}
+	}
+
+	names = conf.GetNameList(data)
+	conf.SortNameList(data, names, data.Sort)
+
+	if len(warnings) > 0 {
+		err = errors.New(strings.Join(warnings, ", "))
+	}
+	return names, data, err
+}
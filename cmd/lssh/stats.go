@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+
+	sshcmd "github.com/blacknon/lssh/ssh"
+	"github.com/urfave/cli"
+)
+
+// statsCommand return `lssh stats` subcommand.
+func statsCommand() cli.Command {
+	return cli.Command{
+		Name:  "stats",
+		Usage: "summarize local usage history (most used hosts, busiest days, session length, transferred data)",
+		Flags: []cli.Flag{
+			cli.IntFlag{Name: "top,n", Value: 10, Usage: "number of hosts and days to show"},
+		},
+		Action: func(c *cli.Context) error {
+			sshcmd.GetStats().Print(os.Stdout, c.Int("top"))
+			return nil
+		},
+	}
+}
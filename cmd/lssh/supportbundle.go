@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/blacknon/lssh/conf"
+	sshcmd "github.com/blacknon/lssh/ssh"
+	"github.com/urfave/cli"
+)
+
+// supportBundleCommand return `lssh support-bundle` subcommand.
+func supportBundleCommand() cli.Command {
+	return cli.Command{
+		Name:  "support-bundle",
+		Usage: "create tarball of version, sanitized config, recent debug log and last run summary, for bug reports",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "output,o", Usage: "output file path (default: ./lssh-support-<date>.tar.gz)"},
+			cli.IntFlag{Name: "lines,n", Value: 500, Usage: "number of last lines of debug log"},
+			cli.BoolFlag{Name: "keep-address", Usage: "not redact addresses and user names"},
+			cli.BoolFlag{Name: "keep-credential", Usage: "not redact passwords, passphrases and PINs"},
+		},
+		Action: func(c *cli.Context) error {
+			output := c.String("output")
+			if output == "" {
+				output = "lssh-support-" + time.Now().Format("20060102-150405") + ".tar.gz"
+			}
+
+			b := &sshcmd.SupportBundle{
+				Conf:           conf.ReadConf(c.GlobalString("file")),
+				Version:        c.App.Version,
+				LogLines:       c.Int("lines"),
+				KeepAddress:    c.Bool("keep-address"),
+				KeepCredential: c.Bool("keep-credential"),
+			}
+			if err := b.Write(output); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Fprintf(os.Stderr, "Support bundle:%s\n", output)
+			if b.KeepAddress || b.KeepCredential {
+				fmt.Fprintln(os.Stderr, "Warning: bundle contains unredacted values. check it before attaching.")
+			}
+			return nil
+		},
+	}
+}
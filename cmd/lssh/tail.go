@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/blacknon/lssh/conf"
+	sshcmd "github.com/blacknon/lssh/ssh"
+	"github.com/urfave/cli"
+)
+
+// tailCommand return `lssh tail` subcommand.
+func tailCommand() cli.Command {
+	return cli.Command{
+		Name:      "tail",
+		Usage:     "follow files (tail -F) of servers, merged into a single stream with timestamp and server name",
+		ArgsUsage: "path...",
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{Name: "host,H", Usage: "connect servernames"},
+			cli.IntFlag{Name: "lines,n", Value: 10, Usage: "number of last lines to show at start"},
+			cli.BoolFlag{Name: "sudo", Usage: "run tail with sudo -n"},
+			cli.DurationFlag{Name: "retry-interval", Value: 5 * time.Second, Usage: "wait time to reconnect"},
+		},
+		Action: func(c *cli.Context) error {
+			if len(c.Args()) == 0 {
+				fmt.Fprintln(os.Stderr, "path is not specified.")
+				os.Exit(1)
+			}
+
+			data := conf.ReadConf(c.GlobalString("file"))
+			selected := selectServers(data, c.StringSlice("host"), true)
+
+			t := &sshcmd.Tail{
+				Paths:  c.Args(),
+				Lines:  c.Int("lines"),
+				IsSudo: c.Bool("sudo"),
+			}
+
+			f := &sshcmd.Follow{
+				ServerList:    selected,
+				Conf:          data,
+				Command:       t.Command,
+				Reconnect:     true,
+				RetryInterval: c.Duration("retry-interval"),
+				IsMerge:       true,
+			}
+			f.Start()
+			return nil
+		},
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runTmux open tmux window that has one pane per server, running interactive lssh session.
+// options are passed to lssh at each pane. If not in tmux, create new tmux session and attach it.
+func runTmux(confpath string, servers, options []string, isSync bool) (err error) {
+	if _, err = exec.LookPath("tmux"); err != nil {
+		return fmt.Errorf("tmux is not found, %v", err)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// pane commands
+	paneCmds := []string{}
+	for _, server := range servers {
+		args := []string{shellQuote(self), "-f", shellQuote(confpath), "-H", shellQuote(server)}
+		for _, option := range options {
+			args = append(args, shellQuote(option))
+		}
+		paneCmds = append(paneCmds, strings.Join(args, " "))
+	}
+
+	// create window
+	isInTmux := os.Getenv("TMUX") != ""
+	sessionName := fmt.Sprintf("lssh-%d", os.Getpid())
+
+	var window string
+	if isInTmux {
+		window, err = tmuxCmd("new-window", "-P", "-F", "#{window_id}", "-n", "lssh", paneCmds[0])
+	} else {
+		window, err = tmuxCmd("new-session", "-d", "-P", "-F", "#{window_id}", "-s", sessionName, "-n", "lssh", paneCmds[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	// split pane for each server.
+	// re-layout at each split, so that there is space for next pane.
+	for _, paneCmd := range paneCmds[1:] {
+		if _, err = tmuxCmd("split-window", "-t", window, paneCmd); err != nil {
+			return err
+		}
+		if _, err = tmuxCmd("select-layout", "-t", window, "tiled"); err != nil {
+			return err
+		}
+	}
+
+	// synchronize input to all panes
+	if isSync {
+		if _, err = tmuxCmd("set-window-option", "-t", window, "synchronize-panes", "on"); err != nil {
+			return err
+		}
+	}
+
+	if isInTmux {
+		return nil
+	}
+
+	// attach new session
+	cmd := exec.Command("tmux", "attach-session", "-t", sessionName)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// tmuxCmd run tmux command, and return trimmed stdout.
+func tmuxCmd(args ...string) (output string, err error) {
+	out, err := exec.Command("tmux", args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("tmux %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("tmux %s: %v", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// shellQuote quote str with single quote for sh.
+func shellQuote(str string) string {
+	return "'" + strings.Replace(str, "'", `'\''`, -1) + "'"
+}
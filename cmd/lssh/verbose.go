@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// maxVerbose is max level of -v option.
+const maxVerbose = 3
+
+// parseVerbose remove -v, -vv, -vvv and --verbose from args, and return verbose level.
+// urfave/cli cannot count repeated bool flags, so it is parsed before app.Run.
+// Only options before the first non-option argument (or `--`) are parsed, to not remove remote command's options.
+func parseVerbose(flags []cli.Flag, args []string) (result []string, level int) {
+	// option names with value
+	valueFlags := map[string]bool{}
+	for _, flag := range flags {
+		if _, ok := flag.(cli.BoolFlag); ok {
+			continue
+		}
+		for _, name := range strings.Split(flag.GetName(), ",") {
+			valueFlags[strings.TrimSpace(name)] = true
+		}
+	}
+
+	if len(args) == 0 {
+		return args, 0
+	}
+	result = []string{args[0]}
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "--verbose":
+			level++
+			continue
+		case len(arg) > 1 && strings.Trim(arg[1:], "v") == "" && arg[0] == '-':
+			level += len(arg) - 1
+			continue
+		}
+
+		result = append(result, arg)
+
+		if arg == "--" || !strings.HasPrefix(arg, "-") || arg == "-" {
+			result = append(result, args[i+1:]...)
+			break
+		}
+
+		// skip value of option
+		name := strings.TrimLeft(arg, "-")
+		if !strings.Contains(name, "=") && valueFlags[name] && i+1 < len(args) {
+			i++
+			result = append(result, args[i])
+		}
+	}
+
+	if level > maxVerbose {
+		level = maxVerbose
+	}
+	return
+}
@@ -9,11 +9,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"math/rand"
 	"os"
 	"os/user"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
@@ -50,6 +52,10 @@ func MapReduce(map1, map2 map[string]interface{}) map[string]interface{} {
 			if value == true && map2Value.Bool() == false {
 				map2[ia] = value
 			}
+		case int:
+			if value != 0 && map2[ia] == 0 {
+				map2[ia] = value
+			}
 		}
 	}
 
@@ -100,6 +106,44 @@ func GetFullPath(path string) (fullPath string) {
 	return fullPath
 }
 
+// StateDir is directory of mutable state files (history, cache, host key baseline...), set by `--state-dir`.
+// State is kept apart from config file, so that config can be provisioned read-only.
+// If empty, $LSSH_STATE_DIR, $XDG_STATE_HOME/lssh or ~/.local/state/lssh is used.
+var StateDir = ""
+
+// GetStateDir returns a fullpath of state directory.
+func GetStateDir() string {
+	switch {
+	case StateDir != "":
+		return GetFullPath(StateDir)
+	case os.Getenv("LSSH_STATE_DIR") != "":
+		return GetFullPath(os.Getenv("LSSH_STATE_DIR"))
+	case os.Getenv("XDG_STATE_HOME") != "":
+		return filepath.Join(GetFullPath(os.Getenv("XDG_STATE_HOME")), "lssh")
+	}
+	return GetFullPath("~/.local/state/lssh")
+}
+
+// GetStatePath returns a fullpath of state file name in state directory, and creates state directory.
+// For compatibility with older versions, if writable legacy file (~/.lssh_<name>) exists and state file does not,
+// legacy file is used.
+func GetStatePath(name string) string {
+	dir := GetStateDir()
+	path := filepath.Join(dir, name)
+
+	legacy := GetFullPath("~/.lssh_" + name)
+	if !IsExist(path) && IsExist(legacy) {
+		// legacy file at read-only home is not used.
+		if f, err := os.OpenFile(legacy, os.O_WRONLY, 0); err == nil {
+			f.Close()
+			return legacy
+		}
+	}
+
+	os.MkdirAll(dir, 0700)
+	return path
+}
+
 // Get order num in array
 func GetOrderNumber(value string, array []string) int {
 	for i, v := range array {
@@ -205,6 +249,121 @@ func RandomString(n int) string {
 	return string(b)
 }
 
+// NaturalLess compare a and b in natural order. Numbers in strings are compared by value.
+// ex) web2 < web10
+func NaturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		ca, cb := naturalChunk(a), naturalChunk(b)
+		a, b = a[len(ca):], b[len(cb):]
+
+		if isDigit(ca[0]) && isDigit(cb[0]) {
+			na, nb := strings.TrimLeft(ca, "0"), strings.TrimLeft(cb, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			continue
+		}
+
+		if ca != cb {
+			return ca < cb
+		}
+	}
+	return len(a) < len(b)
+}
+
+// naturalChunk return leading digits or non-digits of str.
+func naturalChunk(str string) string {
+	digit := isDigit(str[0])
+	for i := 1; i < len(str); i++ {
+		if isDigit(str[i]) != digit {
+			return str[:i]
+		}
+	}
+	return str
+}
+
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
+}
+
+// NewRunID return new run id. ex) `20060102-150405-1a2b3c4d`
+// It is unique per lssh invocation, and used to correlate remote logs with local logs.
+func NewRunID() string {
+	return fmt.Sprintf("%s-%08x", time.Now().Format("20060102-150405"), rand.Uint32())
+}
+
+// SampleList return randomly picked subset of list. The order of list is kept.
+// sample is number (ex. `5`) or percentage (ex. `10%`) of list.
+// Same seed returns same result.
+func SampleList(list []string, sample string, seed int64) (result []string, err error) {
+	var num int
+	if strings.HasSuffix(sample, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(sample, "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("invalid sample value: %s", sample)
+		}
+
+		// at least 1 host
+		num = int(math.Ceil(float64(len(list)) * percent / 100))
+	} else {
+		num, err = strconv.Atoi(sample)
+		if err != nil || num < 0 {
+			return nil, fmt.Errorf("invalid sample value: %s", sample)
+		}
+	}
+
+	if num >= len(list) {
+		return list, nil
+	}
+
+	r := rand.New(rand.NewSource(seed))
+	picked := map[int]bool{}
+	for _, i := range r.Perm(len(list))[:num] {
+		picked[i] = true
+	}
+
+	for i, v := range list {
+		if picked[i] {
+			result = append(result, v)
+		}
+	}
+	return
+}
+
+// ParsePortRange parse port list string, and return ports.
+// ex) `22`, `1-1024`, `22,80,8000-8100`
+func ParsePortRange(portRange string) (ports []int, err error) {
+	for _, r := range strings.Split(portRange, ",") {
+		r = strings.TrimSpace(r)
+		startEnd := strings.SplitN(r, "-", 2)
+
+		start, err := strconv.Atoi(startEnd[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid port: %s", r)
+		}
+
+		end := start
+		if len(startEnd) == 2 {
+			end, err = strconv.Atoi(startEnd[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid port: %s", r)
+			}
+		}
+
+		if start < 1 || end > 65535 || start > end {
+			return nil, fmt.Errorf("invalid port range: %s", r)
+		}
+
+		for p := start; p <= end; p++ {
+			ports = append(ports, p)
+		}
+	}
+	return
+}
+
 // func GetAbsPath(path string) string {
 // 	// Replace home directory
 // 	usr, _ := user.Current()
@@ -1,6 +1,9 @@
 package common
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -32,6 +35,7 @@ func TestMapReduce(t *testing.T) {
 		{desc: "(string) Overrides value if key exists but value is empty", map1: map[string]interface{}{"a": "1", "b": "2", "c": "3"}, map2: map[string]interface{}{"a": "", "b": "1"}, expect: map[string]interface{}{"a": "1", "b": "1"}},
 		{desc: "([]string) Overrides value if key exists but value is empty", map1: map[string]interface{}{"a": []string{"1"}, "b": "2", "c": "3"}, map2: map[string]interface{}{"a": "", "b": "1"}, expect: map[string]interface{}{"a": []string{"1"}, "b": "1"}},
 		{desc: "(bool) Overrides value if key exists but value is empty", map1: map[string]interface{}{"a": true, "b": "2", "c": "3"}, map2: map[string]interface{}{"a": false, "b": "1"}, expect: map[string]interface{}{"a": true, "b": "1"}},
+		{desc: "(int) Overrides value if key exists but value is empty", map1: map[string]interface{}{"a": 1, "b": 2, "c": 3}, map2: map[string]interface{}{"a": 0, "b": 1}, expect: map[string]interface{}{"a": 1, "b": 1}},
 
 		{desc: "Returns map2 if map1 doesn't has keys", map1: map[string]interface{}{}, map2: map[string]interface{}{"a": "", "b": "1"}, expect: map[string]interface{}{"a": "", "b": "1"}},
 	}
@@ -118,3 +122,108 @@ func TestGetMaxLength(t *testing.T) {
 // TODO
 // func TestGetFilesBase64(t *testing.T) {
 // }
+
+func TestSampleList(t *testing.T) {
+	type TestData struct {
+		desc   string
+		list   []string
+		sample string
+		expect int
+		err    bool
+	}
+	list := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	tds := []TestData{
+		{desc: "number", list: list, sample: "3", expect: 3},
+		{desc: "percentage", list: list, sample: "20%", expect: 2},
+		{desc: "percentage round up", list: list, sample: "1%", expect: 1},
+		{desc: "over list length", list: list, sample: "20", expect: 10},
+		{desc: "zero", list: list, sample: "0", expect: 0},
+		{desc: "invalid number", list: list, sample: "abc", err: true},
+		{desc: "invalid percentage", list: list, sample: "120%", err: true},
+	}
+	for _, v := range tds {
+		got, err := SampleList(v.list, v.sample, 1)
+		assert.Equal(t, v.err, err != nil, v.desc)
+		assert.Equal(t, v.expect, len(got), v.desc)
+	}
+
+	// same seed, same result
+	a, _ := SampleList(list, "5", 100)
+	b, _ := SampleList(list, "5", 100)
+	assert.Equal(t, a, b, "same seed")
+}
+
+func TestParsePortRange(t *testing.T) {
+	type TestData struct {
+		desc      string
+		portRange string
+		expect    []int
+		err       bool
+	}
+	tds := []TestData{
+		{desc: "single port", portRange: "22", expect: []int{22}},
+		{desc: "range", portRange: "20-23", expect: []int{20, 21, 22, 23}},
+		{desc: "list", portRange: "22, 80,8000-8001", expect: []int{22, 80, 8000, 8001}},
+		{desc: "reverse range", portRange: "23-20", err: true},
+		{desc: "out of range", portRange: "0-10", err: true},
+		{desc: "not number", portRange: "ssh", err: true},
+	}
+	for _, v := range tds {
+		got, err := ParsePortRange(v.portRange)
+		assert.Equal(t, v.err, err != nil, v.desc)
+		assert.Equal(t, v.expect, got, v.desc)
+	}
+}
+
+func TestNewRunID(t *testing.T) {
+	a := NewRunID()
+	b := NewRunID()
+
+	assert.Regexp(t, `^[0-9]{8}-[0-9]{6}-[0-9a-f]{8}$`, a)
+	assert.NotEqual(t, a, b)
+}
+
+func TestNaturalLess(t *testing.T) {
+	type TestData struct {
+		a, b   string
+		expect bool
+	}
+	tds := []TestData{
+		{a: "web2", b: "web10", expect: true},
+		{a: "web10", b: "web2", expect: false},
+		{a: "web", b: "web1", expect: true},
+		{a: "db1", b: "web1", expect: true},
+		{a: "web01", b: "web2", expect: true},
+		{a: "web1a", b: "web1b", expect: true},
+		{a: "web1", b: "web1", expect: false},
+		{a: "10.0.0.9", b: "10.0.0.10", expect: true},
+	}
+	for _, v := range tds {
+		assert.Equal(t, v.expect, NaturalLess(v.a, v.b), v.a+" < "+v.b)
+	}
+}
+
+func TestGetStatePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lssh-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// --state-dir
+	StateDir = filepath.Join(dir, "flag")
+	defer func() { StateDir = "" }()
+	assert.Equal(t, filepath.Join(dir, "flag"), GetStateDir())
+	assert.Equal(t, filepath.Join(dir, "flag", "test_state.json"), GetStatePath("test_state.json"))
+	assert.True(t, IsExist(filepath.Join(dir, "flag")), "state directory is created")
+
+	// $LSSH_STATE_DIR, $XDG_STATE_HOME
+	StateDir = ""
+	os.Setenv("LSSH_STATE_DIR", filepath.Join(dir, "env"))
+	assert.Equal(t, filepath.Join(dir, "env"), GetStateDir())
+	os.Unsetenv("LSSH_STATE_DIR")
+
+	os.Setenv("XDG_STATE_HOME", dir)
+	assert.Equal(t, filepath.Join(dir, "lssh"), GetStateDir())
+	os.Unsetenv("XDG_STATE_HOME")
+}
@@ -0,0 +1,266 @@
+// Package completion generate shell completion scripts of lssh and lscp.
+//
+// Scripts complete flags and subcommands statically, and values of `--host` with
+// server names of config at completion time (by hidden `completion hosts` subcommand).
+// So that servers added to config (or inventories) are completed without regenerating script.
+package completion
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+	"github.com/urfave/cli"
+)
+
+// Shells is shells that completion script can be generated.
+var Shells = []string{"bash", "zsh", "fish"}
+
+// loadCommands return command to load completion script of command name, for each shell.
+var loadCommands = map[string]func(name string) string{
+	"bash": func(name string) string { return fmt.Sprintf("source <(%s completion bash)", name) },
+	"zsh":  func(name string) string { return fmt.Sprintf("source <(%s completion zsh)", name) },
+	"fish": func(name string) string { return fmt.Sprintf("%s completion fish | source", name) },
+}
+
+// flagSpec is a flag of completion script.
+type flagSpec struct {
+	Long    []string // long names, without `--`
+	Short   []string // short names, without `-`
+	Usage   string
+	IsValue bool // take value
+	IsMulti bool // can be specified multiple times
+	IsHost  bool // value is server name (`--host`)
+}
+
+// Names return all names of flag, with `-` or `--`.
+func (f flagSpec) Names() (names []string) {
+	for _, s := range f.Short {
+		names = append(names, "-"+s)
+	}
+	for _, l := range f.Long {
+		names = append(names, "--"+l)
+	}
+	return
+}
+
+// commandSpec is a subcommand of completion script.
+type commandSpec struct {
+	Name  string
+	Usage string
+}
+
+// scriptData is data of script templates.
+type scriptData struct {
+	Name     string // command name
+	Func     string // command name that can be used in shell function name
+	Flags    []flagSpec
+	Commands []commandSpec
+	IsScp    bool // complete `(local|remote):path` of lscp
+}
+
+// Command return `completion` subcommand of app.
+// If isScp, positional arguments are completed as `(local|remote):path` of lscp.
+func Command(app *cli.App, isScp bool) cli.Command {
+	var subcommands []cli.Command
+	for _, shell := range Shells {
+		shell := shell
+		subcommands = append(subcommands, cli.Command{
+			Name:  shell,
+			Usage: fmt.Sprintf("print %s completion script (load: %s)", shell, loadCommands[shell](app.Name)),
+			Action: func(c *cli.Context) error {
+				return Script(os.Stdout, shell, app, isScp)
+			},
+		})
+	}
+
+	// called from completion scripts
+	subcommands = append(subcommands, cli.Command{
+		Name:   "hosts",
+		Usage:  "print server names of config, for completion of --host",
+		Hidden: true,
+		Action: func(c *cli.Context) error {
+			for _, name := range Hosts(c.GlobalString("file")) {
+				fmt.Println(name)
+			}
+			return nil
+		},
+	})
+
+	return cli.Command{
+		Name:        "completion",
+		Usage:       "print shell completion script (bash, zsh or fish), that complete --host with server names of config",
+		Subcommands: subcommands,
+	}
+}
+
+// Hosts return sorted server names of config file at confPath.
+// Errors are ignored, because it is called at completion time. (nothing is completed)
+func Hosts(confPath string) []string {
+	config, err := conf.LoadConf(common.GetFullPath(confPath), conf.LoadOptions{})
+	if err != nil {
+		return nil
+	}
+
+	names := conf.GetNameList(config)
+	sort.Strings(names)
+	return names
+}
+
+// Script write completion script of shell for app to w.
+func Script(w io.Writer, shell string, app *cli.App, isScp bool) error {
+	tmpl, ok := scriptTemplates[shell]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q (supported: %s)", shell, strings.Join(Shells, ", "))
+	}
+
+	data := scriptData{
+		Name:  app.Name,
+		Func:  regexp.MustCompile(`[^a-zA-Z0-9_]`).ReplaceAllString(app.Name, "_"),
+		Flags: flagSpecs(app.VisibleFlags()),
+		IsScp: isScp,
+	}
+	for _, c := range app.VisibleCommands() {
+		if c.Name == "help" {
+			continue
+		}
+		data.Commands = append(data.Commands, commandSpec{Name: c.Name, Usage: c.Usage})
+	}
+
+	return tmpl.Execute(w, data)
+}
+
+// flagSpecs return flagSpec of cli flags.
+func flagSpecs(flags []cli.Flag) (specs []flagSpec) {
+	for _, flag := range flags {
+		var spec flagSpec
+		for _, name := range strings.Split(flag.GetName(), ",") {
+			name = strings.TrimSpace(name)
+			switch {
+			case name == "":
+			case len(name) == 1:
+				spec.Short = append(spec.Short, name)
+			default:
+				spec.Long = append(spec.Long, name)
+			}
+		}
+
+		switch flag.(type) {
+		case cli.BoolFlag, cli.BoolTFlag:
+		case cli.StringSliceFlag, cli.IntSliceFlag, cli.Int64SliceFlag:
+			spec.IsValue = true
+			spec.IsMulti = true
+		default:
+			spec.IsValue = true
+		}
+		for _, name := range spec.Long {
+			spec.IsHost = spec.IsHost || (spec.IsValue && name == "host")
+		}
+
+		// usage placeholder (ex. "`FILE`") is shown without back quote
+		v := reflect.Indirect(reflect.ValueOf(flag))
+		if usage := v.FieldByName("Usage"); usage.IsValid() && usage.Kind() == reflect.String {
+			spec.Usage = strings.Replace(usage.String(), "`", "", -1)
+		}
+
+		specs = append(specs, spec)
+	}
+	return
+}
+
+// zshSpec return _arguments spec of zsh for f, with function name prefix fn.
+//
+// ex) `'*'{-H+,--host=}'[connect servernames]:server:__lssh_hosts'`
+func zshSpec(f flagSpec, fn string) string {
+	var names []string
+	for _, s := range f.Short {
+		if f.IsValue {
+			s += "+"
+		}
+		names = append(names, "-"+s)
+	}
+	for _, l := range f.Long {
+		if f.IsValue {
+			l += "="
+		}
+		names = append(names, "--"+l)
+	}
+
+	spec := ""
+	switch {
+	case f.IsMulti:
+		spec = "'*'"
+	case len(names) > 1:
+		spec = "'(" + strings.Join(f.Names(), " ") + ")'"
+	}
+
+	if len(names) > 1 {
+		spec += "{" + strings.Join(names, ",") + "}"
+	} else {
+		spec += names[0]
+	}
+
+	desc := strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(f.Usage)
+	spec += "'[" + desc + "]"
+	switch {
+	case f.IsHost:
+		spec += ":server:__" + fn + "_hosts"
+	case f.IsValue:
+		spec += ":" + strings.TrimLeft(f.Names()[len(f.Names())-1], "-") + ":_files"
+	}
+	return spec + "'"
+}
+
+// template functions
+var funcMap = template.FuncMap{
+	"join": strings.Join,
+
+	// quote s with single quote.
+	"squote": func(s string) string {
+		return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+	},
+
+	"zshSpec": zshSpec,
+
+	// names of flags that take value, joined with ` | ` for case pattern of bash.
+	"valueNames": func(flags []flagSpec, isHost bool) string {
+		var names []string
+		for _, f := range flags {
+			if f.IsValue && f.IsHost == isHost {
+				names = append(names, f.Names()...)
+			}
+		}
+		return strings.Join(names, " | ")
+	},
+
+	// all names of flags.
+	"flagNames": func(flags []flagSpec) string {
+		var names []string
+		for _, f := range flags {
+			names = append(names, f.Names()...)
+		}
+		return strings.Join(names, " ")
+	},
+
+	// names of commands.
+	"commandNames": func(commands []commandSpec) string {
+		var names []string
+		for _, c := range commands {
+			names = append(names, c.Name)
+		}
+		return strings.Join(names, " ")
+	},
+}
+
+var scriptTemplates = map[string]*template.Template{
+	"bash": template.Must(template.New("bash").Funcs(funcMap).Parse(bashTemplate)),
+	"zsh":  template.Must(template.New("zsh").Funcs(funcMap).Parse(zshTemplate)),
+	"fish": template.Must(template.New("fish").Funcs(funcMap).Parse(fishTemplate)),
+}
@@ -0,0 +1,145 @@
+package completion
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func testApp() *cli.App {
+	app := cli.NewApp()
+	app.Name = "lssh"
+	app.HideVersion = true
+	app.Flags = []cli.Flag{
+		cli.StringSliceFlag{Name: "host,H", Usage: "connect servernames"},
+		cli.StringFlag{Name: "file,f", Usage: "config file path"},
+		cli.IntFlag{Name: "retry", Usage: "retry up to `N` times"},
+		cli.BoolFlag{Name: "list,l", Usage: "print server list"},
+		cli.BoolFlag{Name: "secret", Usage: "hidden flag", Hidden: true},
+	}
+	app.Commands = []cli.Command{
+		{Name: "stats", Usage: "summarize local usage history"},
+		{Name: "internal", Usage: "hidden command", Hidden: true},
+	}
+	return app
+}
+
+func TestFlagSpecs(t *testing.T) {
+	expect := []flagSpec{
+		{Long: []string{"host"}, Short: []string{"H"}, Usage: "connect servernames", IsValue: true, IsMulti: true, IsHost: true},
+		{Long: []string{"file"}, Short: []string{"f"}, Usage: "config file path", IsValue: true},
+		{Long: []string{"retry"}, Usage: "retry up to N times", IsValue: true},
+		{Long: []string{"list"}, Short: []string{"l"}, Usage: "print server list"},
+	}
+	assert.Equal(t, expect, flagSpecs(testApp().VisibleFlags()))
+}
+
+func TestZshSpec(t *testing.T) {
+	type TestData struct {
+		desc   string
+		flag   flagSpec
+		expect string
+	}
+	tds := []TestData{
+		{
+			desc:   "Host",
+			flag:   flagSpec{Long: []string{"host"}, Short: []string{"H"}, Usage: "connect servernames", IsValue: true, IsMulti: true, IsHost: true},
+			expect: `'*'{-H+,--host=}'[connect servernames]:server:__lssh_hosts'`,
+		},
+		{
+			desc:   "Value",
+			flag:   flagSpec{Long: []string{"file"}, Short: []string{"f"}, Usage: "path (default: ~/[x]'s)", IsValue: true},
+			expect: `'(-f --file)'{-f+,--file=}'[path (default\: ~/\[x\]'\''s)]:file:_files'`,
+		},
+		{
+			desc:   "Bool",
+			flag:   flagSpec{Long: []string{"dry-run"}, Usage: "print plan"},
+			expect: `--dry-run'[print plan]'`,
+		},
+	}
+	for _, v := range tds {
+		assert.Equal(t, v.expect, zshSpec(v.flag, "lssh"), v.desc)
+	}
+}
+
+func TestScript(t *testing.T) {
+	type TestData struct {
+		desc    string
+		shell   string
+		isScp   bool
+		expects []string
+	}
+	tds := []TestData{
+		{
+			desc:  "bash",
+			shell: "bash",
+			expects: []string{
+				`lssh "${file[@]}" completion hosts`,
+				"    -H | --host)\n",
+				"    -f | --file | --retry)\n",
+				`compgen -W "-H --host -f --file --retry -l --list"`,
+				`compgen -W "stats"`,
+				"complete -F _lssh lssh\n",
+			},
+		},
+		{
+			desc:  "bash of lscp",
+			shell: "bash",
+			isScp: true,
+			expects: []string{
+				`compgen -W "local: remote:"`,
+				`lssh "${args[@]}" __complete-remote "$1"`,
+			},
+		},
+		{
+			desc:  "zsh",
+			shell: "zsh",
+			expects: []string{
+				"#compdef lssh\n",
+				`'*'{-H+,--host=}'[connect servernames]:server:__lssh_hosts'`,
+				`'stats:summarize local usage history'`,
+				"compdef _lssh lssh\n",
+			},
+		},
+		{
+			desc:  "fish",
+			shell: "fish",
+			expects: []string{
+				"complete -c lssh -s H -l host -x -a '(__lssh_hosts)' -d 'connect servernames'\n",
+				"complete -c lssh -s f -l file -r -d 'config file path'\n",
+				"complete -c lssh -s l -l list -d 'print server list'\n",
+				"complete -c lssh -n '__fish_use_subcommand' -f -a stats -d 'summarize local usage history'\n",
+			},
+		},
+	}
+	for _, v := range tds {
+		buf := new(bytes.Buffer)
+		assert.Nil(t, Script(buf, v.shell, testApp(), v.isScp), v.desc)
+		for _, e := range v.expects {
+			assert.Contains(t, buf.String(), e, v.desc)
+		}
+		assert.NotContains(t, buf.String(), "secret", v.desc)
+		assert.NotContains(t, buf.String(), "internal", v.desc)
+	}
+
+	assert.NotNil(t, Script(new(bytes.Buffer), "tcsh", testApp(), false))
+}
+
+func TestHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lssh_completion")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "lssh.conf")
+	data := "[server.web02]\naddr = \"192.168.0.2\"\nuser = \"user\"\npass = \"pass\"\n\n" +
+		"[server.web01]\naddr = \"192.168.0.1\"\nuser = \"user\"\npass = \"pass\"\n"
+	assert.Nil(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	assert.Equal(t, []string{"web01", "web02"}, Hosts(path))
+	assert.Nil(t, Hosts(filepath.Join(dir, "not_found.conf")))
+}
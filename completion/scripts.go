@@ -0,0 +1,215 @@
+package completion
+
+// bashTemplate is template of bash completion script.
+// `:` and `=` are in COMP_WORDBREAKS, so `--host=web` and `remote:/path` are split into some words.
+const bashTemplate = `# bash completion of {{.Name}}. (generated by ` + "`{{.Name}} completion bash`" + `)
+#
+# load: source <({{.Name}} completion bash)
+
+# __{{.Func}}_hosts print server names of config (-f of command line, if specified).
+__{{.Func}}_hosts() {
+    local i file=()
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+        -f | --file) file=(-f "${COMP_WORDS[i + 1]}") ;;
+        esac
+    done
+    {{.Name}} "${file[@]}" completion hosts 2>/dev/null
+}
+{{- if .IsScp}}
+
+# __{{.Func}}_remote_paths print remote paths that start with $1, at first server of -H.
+__{{.Func}}_remote_paths() {
+    local i args=()
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+        -f | --file | -H | --host) args+=("${COMP_WORDS[i]}" "${COMP_WORDS[i + 1]}") ;;
+        esac
+    done
+    {{.Name}} "${args[@]}" __complete-remote "$1" 2>/dev/null
+}
+{{- end}}
+
+_{{.Func}}() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD - 1]}"
+    if [[ $cur == [=:] ]]; then
+        cur=""
+    elif [[ $prev == "=" ]]; then
+        prev="${COMP_WORDS[COMP_CWORD - 2]}"
+    fi
+
+    case "$prev" in
+    {{valueNames .Flags true}})
+        COMPREPLY=($(compgen -W "$(__{{.Func}}_hosts)" -- "$cur"))
+        return
+        ;;
+    {{valueNames .Flags false}})
+        compopt -o filenames 2>/dev/null
+        COMPREPLY=($(compgen -f -- "$cur"))
+        return
+        ;;
+    esac
+
+    if [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "{{flagNames .Flags}}" -- "$cur"))
+        return
+    fi
+{{- if .IsScp}}
+
+    # (local|remote):path
+    local word="${COMP_LINE:0:COMP_POINT}"
+    word="${word##*[[:space:]]}"
+    case "$word" in
+    l:* | local:*)
+        compopt -o filenames 2>/dev/null
+        COMPREPLY=($(compgen -f -- "$cur"))
+        ;;
+    r:* | remote:*)
+        mapfile -t COMPREPLY < <(__{{.Func}}_remote_paths "${word#*:}")
+        if [[ ${#COMPREPLY[@]} == 1 && ${COMPREPLY[0]} == */ ]]; then
+            compopt -o nospace 2>/dev/null
+        fi
+        ;;
+    *)
+        COMPREPLY=($(compgen -W "local: remote:" -- "$cur") $(compgen -f -- "$cur"))
+        if [[ ${#COMPREPLY[@]} == 1 && ${COMPREPLY[0]} == *: ]]; then
+            compopt -o nospace 2>/dev/null
+        else
+            compopt -o filenames 2>/dev/null
+        fi
+        ;;
+    esac
+{{- else}}
+
+    if ((COMP_CWORD == 1)); then
+        COMPREPLY=($(compgen -W "{{commandNames .Commands}}" -- "$cur"))
+    fi
+{{- end}}
+}
+
+complete -F _{{.Func}} {{.Name}}
+`
+
+// zshTemplate is template of zsh completion script.
+// It can be sourced, or put in fpath as `_{{.Name}}`.
+const zshTemplate = `#compdef {{.Name}}
+# zsh completion of {{.Name}}. (generated by ` + "`{{.Name}} completion zsh`" + `)
+#
+# load: source <({{.Name}} completion zsh)
+
+# __{{.Func}}_hosts complete server names of config (-f of command line, if specified).
+__{{.Func}}_hosts() {
+    local -a file hosts expl
+    local i=${words[(I)(-f|--file)]}
+    ((i > 0)) && file=(-f "${words[i + 1]}")
+    hosts=(${(f)"$({{.Name}} "${file[@]}" completion hosts 2>/dev/null)"})
+    _wanted hosts expl 'server' compadd -a hosts
+}
+{{- if .IsScp}}
+
+# __{{.Func}}_remote_paths complete remote paths at first server of -H.
+__{{.Func}}_remote_paths() {
+    local -a args paths expl
+    local host=${opt_args[-H]:-${opt_args[--host]}} file=${opt_args[-f]:-${opt_args[--file]}}
+    [[ -z $host ]] && return 1
+    [[ -n $file ]] && args=(-f "$file")
+    paths=(${(f)"$({{.Name}} "${args[@]}" -H "${host%%:*}" __complete-remote "$PREFIX" 2>/dev/null)"})
+    _wanted remote-paths expl 'remote path' compadd -S '' -- ${(M)paths:#*/}
+    _wanted remote-paths expl 'remote path' compadd -- ${paths:#*/}
+}
+{{- end}}
+
+_{{.Func}}() {
+    local curcontext="$curcontext" state line ret=1
+    local -A opt_args
+    _arguments -s -S \
+{{- range .Flags}}
+        {{zshSpec . $.Func}} \
+{{- end}}
+        '*:: :->args' && ret=0
+
+    case $state in
+    args)
+{{- if .IsScp}}
+        # (local|remote):path
+        if compset -P '(l|local):'; then
+            _files && ret=0
+        elif compset -P '(r|remote):'; then
+            __{{.Func}}_remote_paths && ret=0
+        else
+            compadd -S '' -- local: remote: && ret=0
+            _files && ret=0
+        fi
+{{- else}}
+        if ((CURRENT == 1)); then
+            local -a commands
+            commands=(
+{{- range .Commands}}
+                {{squote (printf "%s:%s" .Name .Usage)}}
+{{- end}}
+            )
+            _describe -t commands 'command' commands && ret=0
+        fi
+{{- end}}
+        ;;
+    esac
+
+    return ret
+}
+
+if [ "$funcstack[1]" = "_{{.Func}}" ]; then
+    _{{.Func}} "$@"
+else
+    compdef _{{.Func}} {{.Name}}
+fi
+`
+
+// fishTemplate is template of fish completion script.
+const fishTemplate = `# fish completion of {{.Name}}. (generated by ` + "`{{.Name}} completion fish`" + `)
+#
+# load: {{.Name}} completion fish | source
+
+# __{{.Func}}_hosts print server names of config (-f of command line, if specified).
+function __{{.Func}}_hosts
+    set -l tokens (commandline -opc)
+    set -l file
+    for i in (seq (count $tokens))
+        if contains -- $tokens[$i] -f --file; and test $i -lt (count $tokens)
+            set file -f $tokens[(math $i + 1)]
+        end
+    end
+    {{.Name}} $file completion hosts 2>/dev/null
+end
+{{- if .IsScp}}
+
+# __{{.Func}}_remote_paths print remote paths that start with current (r|remote):path, at first server of -H.
+function __{{.Func}}_remote_paths
+    set -l token (commandline -ct)
+    set -l tokens (commandline -opc)
+    set -l args
+    for i in (seq (count $tokens))
+        if contains -- $tokens[$i] -f --file -H --host; and test $i -lt (count $tokens)
+            set args $args $tokens[$i] $tokens[(math $i + 1)]
+        end
+    end
+    set -l type (string replace -r ':.*' '' -- $token)
+    for p in ({{.Name}} $args __complete-remote (string replace -r '^[^:]*:' '' -- $token) 2>/dev/null)
+        echo $type:$p
+    end
+end
+{{- end}}
+
+complete -c {{.Name}} -e
+{{- range .Flags}}
+complete -c {{$.Name}}{{range .Short}} -s {{.}}{{end}}{{range .Long}} -l {{.}}{{end}}
+{{- if .IsHost}} -x -a '(__{{$.Func}}_hosts)'{{else if .IsValue}} -r{{end}} -d {{squote .Usage}}
+{{- end}}
+{{- if .IsScp}}
+complete -c {{.Name}} -n 'not string match -q -- "-*" (commandline -ct)' -a 'local: remote:' -d 'path type'
+complete -c {{.Name}} -n 'string match -qr "^(r|remote):" -- (commandline -ct)' -f -a '(__{{.Func}}_remote_paths)'
+{{- else}}
+{{- range .Commands}}
+complete -c {{$.Name}} -n '__fish_use_subcommand' -f -a {{.Name}} -d {{squote .Usage}}
+{{- end}}
+{{- end}}
+`
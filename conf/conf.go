@@ -6,6 +6,7 @@ package conf
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"os/user"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/blacknon/lssh/common"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 // Config is Struct that stores the entire configuration file
@@ -27,6 +29,21 @@ type Config struct {
 	Proxy    map[string]ProxyConfig
 
 	SshConfig map[string]OpenSshConfig
+
+	Kubernetes map[string]KubernetesConfig
+
+	Teleport map[string]TeleportConfig
+
+	Inventory    map[string]InventoryConfig
+	InventoryCmd string `toml:"inventory_cmd"` // command to print servers in JSON, run at startup
+
+	TagPolicy map[string]TagPolicyConfig `toml:"tag_policy"`
+
+	Sort SortConfig `toml:"sort"`
+
+	Guard GuardConfig `toml:"guard"`
+
+	Audit AuditConfig `toml:"audit"`
 }
 
 // LogConfig store the contents about the terminal log.
@@ -42,6 +59,16 @@ type LogConfig struct {
 	Dir string `toml:"dirpath"`
 }
 
+// AuditConfig store the contents about the connection audit log.
+// Every connection (server, proxy chain, command, duration and exit status) is appended to the file as JSON lines.
+type AuditConfig struct {
+	// Enable connection audit log.
+	Enable bool `toml:"enable"`
+
+	// Specifies the audit log file path. (default: audit.log in state directory)
+	Path string `toml:"path"`
+}
+
 // Structure for storing lssh-shell settings.
 type ShellConfig struct {
 	// prompt
@@ -59,6 +86,22 @@ type ShellConfig struct {
 	PostCmd string `toml:"post_cmd"`
 }
 
+// TagPolicyConfig is execution policy of servers that have the tag.
+// Policies of all tags of selected servers are layered, the strictest one is used.
+//
+// example:
+//
+//	[tag_policy.db]
+//	confirm = true
+//	max_parallel = 1
+type TagPolicyConfig struct {
+	// Require confirmation before running command.
+	Confirm bool `toml:"confirm"`
+
+	// Max number of servers to run command in parallel. (0 is unlimited)
+	MaxParallel int `toml:"max_parallel"`
+}
+
 // Specify the configuration file to include (ServerConfig only).
 type IncludeConfig struct {
 	Path string `toml:"path"`
@@ -77,10 +120,18 @@ type IncludesConfig struct {
 
 // Structure for holding SSH connection information
 type ServerConfig struct {
+	// server name. (key of Config.Server, set by LoadConf and Inventory)
+	Name string `toml:"-"`
+
+	// unix socket of running lssh (--mux) that serve connection of this server. it is used instead of new connection.
+	// (set by lscp --mux)
+	MuxSocket string `toml:"-"`
+
 	// Connect basic Setting
-	Addr string `toml:"addr"`
-	Port string `toml:"port"`
-	User string `toml:"user"`
+	Addr  string   `toml:"addr"`
+	Addrs []string `toml:"addrs"` // multiple addresses. connect to whichever answers first (with addr)
+	Port  string   `toml:"port"`
+	User  string   `toml:"user"`
 
 	// Connect auth Setting
 	Pass            string   `toml:"pass"`
@@ -94,14 +145,46 @@ type ServerConfig struct {
 	AgentAuth       bool     `toml:"agentauth"`
 	SSHAgentUse     bool     `toml:"ssh_agent"`
 	SSHAgentKeyPath []string `toml:"ssh_agent_key"` // "keypath::passphase"
+	AgentSocket     string   `toml:"agent_socket"`  // ssh-agent socket path (like OpenSSH IdentityAgent). "none" is no agent. default: $SSH_AUTH_SOCK
 	PKCS11Use       bool     `toml:"pkcs11"`
 	PKCS11Provider  string   `toml:"pkcs11provider"` // PKCS11 Provider PATH
 	PKCS11PIN       string   `toml:"pkcs11pin"`      // PKCS11 PIN code
 
+	// batch mode (like OpenSSH BatchMode). no pty and no prompt (password, passphrase, PIN and confirmation fail instead of asking), for cron and CI.
+	BatchMode bool `toml:"batch_mode"`
+
+	// pre-authentication banner of sshd. show (default), hide, log (append to banner.log in state directory)
+	Banner string `toml:"banner"`
+
 	// pre | post command setting
 	PreCmd  string `toml:"pre_cmd"`
 	PostCmd string `toml:"post_cmd"`
 
+	// address family and source address setting (like OpenSSH AddressFamily, BindAddress, BindInterface)
+	AddressFamily string `toml:"address_family"` // any (default), inet, inet6
+	BindAddress   string `toml:"bind_address"`
+	BindInterface string `toml:"bind_interface"`
+
+	// connect timeout and retry setting
+	ConnectTimeout int `toml:"connect_timeout"` // seconds (default: 30)
+	ConnectRetries int `toml:"connect_retries"` // number of retries on dial failure (default: 0)
+	RetryBackoff   int `toml:"retry_backoff"`   // seconds of first retry wait. doubled at each retry (default: 1)
+
+	// authentication failure protection. if failures to the account in window reach limit, connection is refused. (override with --force-auth)
+	AuthFailureLimit  int `toml:"auth_failure_limit"`  // number of failures (default: 3, -1: disable)
+	AuthFailureWindow int `toml:"auth_failure_window"` // seconds to keep failures (default: 600)
+
+	// algorithm setting. if the first value starts with `+`, values are appended to default algorithms.
+	// ex) kex_algorithms = ["+diffie-hellman-group14-sha1"]
+	Ciphers           []string `toml:"ciphers"`
+	KexAlgorithms     []string `toml:"kex_algorithms"`
+	MACs              []string `toml:"macs"`
+	HostKeyAlgorithms []string `toml:"host_key_algorithms"`
+
+	// compression (zlib) setting. It is passed to local ssh (`ssh -C`) at system ssh mode.
+	// The built-in client connects without compression, because golang.org/x/crypto/ssh supports only "none" compression.
+	Compress bool `toml:"compress"`
+
 	// proxy setting
 	ProxyType    string `toml:"proxy_type"`
 	Proxy        string `toml:"proxy"`
@@ -110,14 +193,73 @@ type ServerConfig struct {
 	// local rcfile setting
 	LocalRcUse       string   `toml:"local_rc"` // yes|no (default: yes)
 	LocalRcPath      []string `toml:"local_rc_file"`
+	LocalRcSnippet   []string `toml:"local_rc_snippet"` // rc text appended after local_rc_file
 	LocalRcDecodeCmd string   `toml:"local_rc_decode_cmd"`
+	LocalRcShell     string   `toml:"local_rc_shell"`  // bash|zsh|fish (default: remote login shell)
+	LocalRcBundle    []string `toml:"local_rc_bundle"` // files and directories uploaded to remote temp dir (enable local_rc)
 
 	// port forwarding setting
 	PortForwardLocal  string `toml:"port_forward_local"`  // port forward (local). "host:port"
 	PortForwardRemote string `toml:"port_forward_remote"` // port forward (remote). "host:port"
 
+	// transport setting. wrap ssh connection in websocket or tls.
+	//   - websocket ... transport_url = "wss://gateway.example.com/ssh"
+	//   - tls       ... transport_url = "gateway.example.com:443"
+	Transport         string `toml:"transport"`
+	TransportURL      string `toml:"transport_url"`
+	TransportInsecure bool   `toml:"transport_insecure"` // skip tls certificate verify
+
 	// x11 forwarding setting
-	X11 bool `toml:"x11"`
+	X11        bool `toml:"x11"`
+	X11Trusted bool `toml:"x11_trusted"` // forward with local xauth cookie (like `ssh -Y`)
+
+	// allow remote to set local clipboard with OSC52 escape sequence (ex. vim, tmux copy). default: false
+	Clipboard bool `toml:"clipboard"`
+
+	// disable ZMODEM file transfer with `sz` and `rz` at remote in terminal. default: false (enabled)
+	DisableZmodem bool `toml:"disable_zmodem"`
+
+	// disable trzsz file transfer with `tsz` and `trz` at remote in terminal. default: false (enabled)
+	DisableTrzsz bool `toml:"disable_trzsz"`
+
+	// connect with mosh setting
+	UseMosh bool `toml:"use_mosh"`
+
+	// system ssh passthrough setting. connect terminal with local ssh command (OpenSSH) instead of built-in client.
+	// ExtraSshArgs are appended to ssh options. ex) extra_ssh_args = ["-o", "PubkeyAcceptedAlgorithms=+ssh-rsa"]
+	UseSystemSsh bool     `toml:"use_system_ssh"`
+	ExtraSshArgs []string `toml:"extra_ssh_args"`
+
+	// docker exec setting.
+	// If DockerContainer is set, connect to container with `docker exec` instead of ssh.
+	DockerContainer string `toml:"docker_container"` // container name or id (service name, if use docker_compose)
+	DockerCompose   string `toml:"docker_compose"`   // docker-compose file path. if set, use `docker-compose exec`
+	DockerHost      string `toml:"docker_host"`      // DOCKER_HOST value. ex) unix:///var/run/docker.sock, tcp://host:2376
+	DockerServer    string `toml:"docker_server"`    // server name. use docker socket of this server over ssh.
+	DockerSocket    string `toml:"docker_socket"`    // docker socket path at DockerServer (default: /var/run/docker.sock)
+	DockerShell     string `toml:"docker_shell"`     // shell in container (default: /bin/sh)
+
+	// container runtime at remote server, used by `lssh exec`. docker (default), nerdctl, podman...
+	ContainerRuntime string `toml:"container_runtime"`
+
+	// shell to run command at remote. ex) /bin/sh, /usr/bin/fish, powershell (default: remote login shell)
+	// command is quoted for the shell. powershell is run with -EncodedCommand (Windows OpenSSH).
+	RemoteShell string `toml:"remote_shell"`
+
+	// working directory and initial command at remote. ex) chdir = "/srv/app", initial_cmd = "sudo -i"
+	// command is run after `cd` to Chdir. initial_cmd is run instead of login shell at terminal (session end, when it exit).
+	Chdir      string `toml:"chdir"`
+	InitialCmd string `toml:"initial_cmd"`
+
+	// character encoding of remote output. ex) shift_jis, euc-jp, gbk (default: utf-8)
+	// output of terminal and command is converted to UTF-8 at local.
+	RemoteEncoding string `toml:"remote_encoding"`
+
+	// server tags. use filter servers.
+	Tags []string `toml:"tags"`
+
+	// database settings (key is db type. postgres, mysql, redis). use `lssh db`.
+	DB map[string]DBConfig `toml:"db"`
 
 	Note string `toml:"note"`
 }
@@ -128,9 +270,26 @@ type ProxyConfig struct {
 	Port string `toml:"port"`
 	User string `toml:"user"`
 	Pass string `toml:"pass"`
+
+	// CA certificate file path (PEM) to verify https proxy.
+	// If not set, use system root CA.
+	CACert string `toml:"ca_cert"`
+
 	Note string `toml:"note"`
 }
 
+// Struct that stores database settings of server, used by `lssh db`.
+// Addr and Port are address from the remote server.
+type DBConfig struct {
+	Addr      string `toml:"addr"`       // default: 127.0.0.1
+	Port      string `toml:"port"`       // default: default port of db type
+	LocalPort string `toml:"local_port"` // local port of tunnel. default: random
+	User      string `toml:"user"`
+	Pass      string `toml:"pass"`
+	Name      string `toml:"name"`   // database name
+	Client    string `toml:"client"` // local client command. default: psql, mysql, redis-cli
+}
+
 // Structure to read OpenSSH configuration file.
 //
 // WARN: This struct is not use...
@@ -140,10 +299,16 @@ type OpenSshConfig struct {
 	ServerConfig
 }
 
-// ReadConf load configuration file and return Config structure
+// ReadConf load configuration file and return Config structure.
+// If config file is not found at terminal, it is created with onboarding wizard. If config cannot be loaded, exit.
 func ReadConf(confPath string) (config Config) {
-	// user path
-	usr, _ := user.Current()
+	// first run. if terminal, create config with onboarding wizard.
+	if !common.IsExist(confPath) && terminal.IsTerminal(int(os.Stdin.Fd())) {
+		if err := Onboard(confPath, os.Stdin, os.Stdout); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
 
 	if !common.IsExist(confPath) {
 		fmt.Printf("Config file(%s) Not Found.\nPlease create file.\n\n", confPath)
@@ -151,13 +316,50 @@ func ReadConf(confPath string) (config Config) {
 		os.Exit(1)
 	}
 
+	config, err := LoadConf(confPath, LoadOptions{
+		Warn: func(err error) { fmt.Fprintln(os.Stderr, err) },
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	return
+}
+
+// LoadOptions is options of LoadConf.
+type LoadOptions struct {
+	// Warn is called with error that does not stop loading (ex. cannot get kubernetes nodes). If nil, it is ignored.
+	Warn func(err error)
+
+	// Refresh list servers of inventories again, without cache. (ex. reload server list)
+	Refresh bool
+}
+
+// LoadConf load configuration file and return Config structure.
+// Unlike ReadConf, it does not prompt, print or exit. Invalid server config is returned as error.
+func LoadConf(confPath string, opts LoadOptions) (config Config, err error) {
+	// user path
+	usr, _ := user.Current()
+
+	warn := opts.Warn
+	if warn == nil {
+		warn = func(error) {}
+	}
+
+	if !common.IsExist(confPath) {
+		return config, fmt.Errorf("config file(%s) not found", confPath)
+	}
+
 	config.Server = map[string]ServerConfig{}
 
 	// Read config file
-	_, err := toml.DecodeFile(confPath, &config)
+	md, err := toml.DecodeFile(confPath, &config)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return
+	}
+	for _, e := range unsupportedKeyErrors(md) {
+		warn(e)
 	}
 
 	// reduce common setting (in .lssh.conf servers)
@@ -166,30 +368,6 @@ func ReadConf(confPath string) (config Config) {
 		config.Server[key] = setValue
 	}
 
-	// Read Openssh configs
-	if len(config.SshConfig) == 0 {
-		openSshServerConfig, err := getOpenSshConfig("~/.ssh/config")
-		if err == nil {
-			// append data
-			for key, value := range openSshServerConfig {
-				value := serverConfigReduct(config.Common, value)
-				config.Server[key] = value
-			}
-		}
-	} else {
-		for _, sshConfig := range config.SshConfig {
-			openSshServerConfig, err := getOpenSshConfig(sshConfig.Path)
-			if err == nil {
-				// append data
-				for key, value := range openSshServerConfig {
-					value := serverConfigReduct(config.Common, value)
-					value = serverConfigReduct(sshConfig.ServerConfig, value)
-					config.Server[key] = value
-				}
-			}
-		}
-	}
-
 	// for append includes to include.path
 	if config.Includes.Path != nil {
 		if config.Include == nil {
@@ -210,41 +388,44 @@ func ReadConf(confPath string) (config Config) {
 		}
 	}
 
-	// Read include files
-	if config.Include != nil {
-		for _, v := range config.Include {
-			var includeConf Config
-
-			// user path
-			path := strings.Replace(v.Path, "~", usr.HomeDir, 1)
-
-			// Read include config file
-			_, err := toml.DecodeFile(path, &includeConf)
-			if err != nil {
-				panic(err)
+	// Read servers of inventories (ssh_config, kubernetes, teleport, include files and inventory providers)
+	sources, err := inventorySources(config)
+	if err != nil {
+		return
+	}
+	for _, source := range sources {
+		source.IsRefresh = opts.Refresh
+		servers, err := source.List()
+		if err != nil {
+			switch {
+			case source.IsRequired:
+				return config, fmt.Errorf("%s: %v", source.Name, err)
+			case !source.IsOptional:
+				warn(fmt.Errorf("%s: %v", source.Name, err))
 			}
+		}
 
-			// reduce common setting
-			setCommon := serverConfigReduct(config.Common, includeConf.Common)
-
-			// map init
-			if len(config.Server) == 0 {
-				config.Server = map[string]ServerConfig{}
-			}
+		// append data
+		for _, value := range servers {
+			name := value.Name
+			value = serverConfigReduct(config.Common, value)
+			value = serverConfigReduct(source.Defaults, value)
+			config.Server[name] = value
+		}
+	}
 
-			// add include file serverconf
-			for key, value := range includeConf.Server {
-				// reduce common setting
-				setValue := serverConfigReduct(setCommon, value)
-				config.Server[key] = setValue
-			}
+	// set first address of addrs to addr, if addr is not set
+	for key, value := range config.Server {
+		if value.Addr == "" && len(value.Addrs) > 0 {
+			value.Addr = value.Addrs[0]
 		}
+		value.Name = key
+		config.Server[key] = value
 	}
 
 	// Check Config Parameter
-	checkAlertFlag := checkFormatServerConf(config)
-	if !checkAlertFlag {
-		os.Exit(1)
+	if errs := serverConfErrors(config); len(errs) > 0 {
+		return config, errors.New(strings.Join(errs, "\n"))
 	}
 
 	return
@@ -257,23 +438,55 @@ func ReadConf(confPath string) (config Config) {
 //
 // See also: checkFormatServerConfAuth function.
 func checkFormatServerConf(c Config) (isFormat bool) {
-	isFormat = true
+	errs := serverConfErrors(c)
+	for _, e := range errs {
+		fmt.Println(e)
+	}
+	return len(errs) == 0
+}
+
+// unsupportedKeys is config keys that the built-in client does not support, and the message to user.
+// They are not decoded (ignored), but warned to not fall back to other authentication silently.
+var unsupportedKeys = map[string]string{
+	"gssapi_auth":           "GSSAPI (Kerberos) authentication is not supported. use use_system_ssh (GSSAPIAuthentication of ssh_config)",
+	"gssapi_delegate_creds": "GSSAPI (Kerberos) authentication is not supported. use use_system_ssh (GSSAPIDelegateCredentials of ssh_config)",
+}
+
+// unsupportedKeyErrors return errors of unsupportedKeys in config file.
+func unsupportedKeyErrors(md toml.MetaData) (errs []error) {
+	for _, key := range md.Undecoded() {
+		if msg, ok := unsupportedKeys[key[len(key)-1]]; ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, msg))
+		}
+	}
+	return
+}
+
+// serverConfErrors return messages of server configs that lack required fields.
+func serverConfErrors(c Config) (errs []string) {
 	for k, v := range c.Server {
+		// docker exec server (not use ssh)
+		if v.DockerContainer != "" {
+			if v.DockerServer != "" {
+				if _, ok := c.Server[v.DockerServer]; !ok {
+					errs = append(errs, fmt.Sprintf("%s: docker_server '%s' is not found.", k, v.DockerServer))
+				}
+			}
+			continue
+		}
+
 		// Address Set Check
 		if v.Addr == "" {
-			fmt.Printf("%s: 'addr' is not set.\n", k)
-			isFormat = false
+			errs = append(errs, fmt.Sprintf("%s: 'addr' is not set.", k))
 		}
 
 		// User Set Check
 		if v.User == "" {
-			fmt.Printf("%s: 'user' is not set.\n", k)
-			isFormat = false
+			errs = append(errs, fmt.Sprintf("%s: 'user' is not set.", k))
 		}
 
 		if !checkFormatServerConfAuth(v) {
-			fmt.Printf("%s: Authentication information is not set.\n", k)
-			isFormat = false
+			errs = append(errs, fmt.Sprintf("%s: Authentication information is not set.", k))
 		}
 	}
 	return
@@ -329,3 +542,81 @@ func GetNameList(listConf Config) (nameList []string) {
 	}
 	return
 }
+
+// ExcludeNameList return nameList without servers that match excludeHosts or have tag in excludeTags.
+func ExcludeNameList(listConf Config, nameList, excludeHosts, excludeTags []string) (result []string) {
+	isExclude := map[string]bool{}
+	for _, h := range excludeHosts {
+		isExclude[h] = true
+	}
+
+	for _, name := range nameList {
+		if isExclude[name] {
+			continue
+		}
+
+		hasTag := false
+		for _, tag := range listConf.Server[name].Tags {
+			for _, et := range excludeTags {
+				if tag == et {
+					hasTag = true
+				}
+			}
+		}
+		if hasTag {
+			continue
+		}
+
+		result = append(result, name)
+	}
+	return
+}
+
+// FilterNameListByTag return servers in nameList that have any tag in tags. If tags is empty, return nameList.
+func FilterNameListByTag(listConf Config, nameList, tags []string) (result []string) {
+	if len(tags) == 0 {
+		return nameList
+	}
+
+	for _, name := range nameList {
+		hasTag := false
+		for _, tag := range listConf.Server[name].Tags {
+			for _, t := range tags {
+				if tag == t {
+					hasTag = true
+				}
+			}
+		}
+		if hasTag {
+			result = append(result, name)
+		}
+	}
+	return
+}
+
+// GetTagPolicy return layered execution policy of servers in nameList, and tags that policy applied.
+//   - confirm      ... true, if any policy require it
+//   - max_parallel ... minimum value of policies (0 is unlimited)
+func GetTagPolicy(listConf Config, nameList []string) (policy TagPolicyConfig, tags []string) {
+	isApplied := map[string]bool{}
+
+	for _, name := range nameList {
+		for _, tag := range listConf.Server[name].Tags {
+			p, ok := listConf.TagPolicy[tag]
+			if !ok {
+				continue
+			}
+
+			if !isApplied[tag] {
+				isApplied[tag] = true
+				tags = append(tags, tag)
+			}
+
+			policy.Confirm = policy.Confirm || p.Confirm
+			if p.MaxParallel > 0 && (policy.MaxParallel == 0 || p.MaxParallel < policy.MaxParallel) {
+				policy.MaxParallel = p.MaxParallel
+			}
+		}
+	}
+	return
+}
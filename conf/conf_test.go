@@ -1,8 +1,15 @@
 package conf
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
 	"testing"
 
+	"github.com/BurntSushi/toml"
+	"github.com/blacknon/lssh/common"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -49,6 +56,24 @@ func TestCheckFormatServerConf(t *testing.T) {
 			},
 			expect: false,
 		},
+		{
+			desc: "Docker container",
+			c: Config{
+				Server: map[string]ServerConfig{
+					"a": ServerConfig{DockerContainer: "web"},
+				},
+			},
+			expect: true,
+		},
+		{
+			desc: "Docker container via not found server",
+			c: Config{
+				Server: map[string]ServerConfig{
+					"a": ServerConfig{DockerContainer: "web", DockerServer: "b"},
+				},
+			},
+			expect: false,
+		},
 		{
 			desc: "1 server config is illegal",
 			c: Config{
@@ -156,3 +181,537 @@ func TestGetNameList(t *testing.T) {
 		assert.Equal(t, v.expect, got, v.desc)
 	}
 }
+
+func TestExcludeNameList(t *testing.T) {
+	type TestData struct {
+		desc         string
+		listConf     Config
+		nameList     []string
+		excludeHosts []string
+		excludeTags  []string
+		expect       []string
+	}
+	listConf := Config{
+		Server: map[string]ServerConfig{
+			"web1": ServerConfig{Tags: []string{"prod", "web"}},
+			"web2": ServerConfig{Tags: []string{"prod", "web", "draining"}},
+			"web3": ServerConfig{Tags: []string{"prod", "web"}},
+			"db1":  ServerConfig{Tags: []string{"prod", "db"}},
+		},
+	}
+	tds := []TestData{
+		{
+			desc:     "No exclude",
+			listConf: listConf,
+			nameList: []string{"web1", "web2", "web3"},
+			expect:   []string{"web1", "web2", "web3"},
+		},
+		{
+			desc:         "Exclude host",
+			listConf:     listConf,
+			nameList:     []string{"web1", "web2", "web3"},
+			excludeHosts: []string{"web3"},
+			expect:       []string{"web1", "web2"},
+		},
+		{
+			desc:        "Exclude tag",
+			listConf:    listConf,
+			nameList:    []string{"web1", "web2", "web3", "db1"},
+			excludeTags: []string{"draining", "db"},
+			expect:      []string{"web1", "web3"},
+		},
+		{
+			desc:         "Exclude all",
+			listConf:     listConf,
+			nameList:     []string{"web1", "db1"},
+			excludeHosts: []string{"web1"},
+			excludeTags:  []string{"db"},
+			expect:       nil,
+		},
+	}
+	for _, v := range tds {
+		got := ExcludeNameList(v.listConf, v.nameList, v.excludeHosts, v.excludeTags)
+		assert.Equal(t, v.expect, got, v.desc)
+	}
+}
+
+func TestParseKubernetesNodes(t *testing.T) {
+	data := []byte(`{"items": [
+		{"metadata": {"name": "node1", "labels": {"role": "worker", "zone": "a"}},
+		 "status": {"addresses": [{"type": "InternalIP", "address": "10.0.0.1"}, {"type": "ExternalIP", "address": "203.0.113.1"}]}},
+		{"metadata": {"name": "node2"},
+		 "status": {"addresses": [{"type": "Hostname", "address": "node2.local"}]}},
+		{"metadata": {"name": "node3"}, "status": {}}
+	]}`)
+
+	type TestData struct {
+		desc        string
+		context     string
+		addressType string
+		expect      map[string]ServerConfig
+	}
+	tds := []TestData{
+		{
+			desc:        "current context, internal address",
+			context:     "",
+			addressType: "",
+			expect: map[string]ServerConfig{
+				"node1": ServerConfig{Addr: "10.0.0.1", Tags: []string{"role=worker", "zone=a"}, Note: "kubernetes node"},
+				"node2": ServerConfig{Addr: "node2.local", Tags: []string{}, Note: "kubernetes node"},
+			},
+		},
+		{
+			desc:        "specified context, external address",
+			context:     "prod",
+			addressType: "external",
+			expect: map[string]ServerConfig{
+				"prod/node1": ServerConfig{Addr: "203.0.113.1", Tags: []string{"role=worker", "zone=a"}, Note: "kubernetes node (prod)"},
+				"prod/node2": ServerConfig{Addr: "node2.local", Tags: []string{}, Note: "kubernetes node (prod)"},
+			},
+		},
+	}
+	for _, v := range tds {
+		got, err := parseKubernetesNodes(data, v.context, v.addressType)
+		assert.Nil(t, err, v.desc)
+		assert.Equal(t, v.expect, got, v.desc)
+	}
+}
+
+func TestFilterNameListByTag(t *testing.T) {
+	type TestData struct {
+		desc   string
+		tags   []string
+		expect []string
+	}
+	listConf := Config{
+		Server: map[string]ServerConfig{
+			"web1": ServerConfig{Tags: []string{"prod", "web"}},
+			"db1":  ServerConfig{Tags: []string{"prod", "db"}},
+			"dev1": ServerConfig{Tags: []string{"dev"}},
+		},
+	}
+	nameList := []string{"web1", "db1", "dev1"}
+	tds := []TestData{
+		{desc: "No tags", tags: nil, expect: []string{"web1", "db1", "dev1"}},
+		{desc: "Single tag", tags: []string{"prod"}, expect: []string{"web1", "db1"}},
+		{desc: "Multiple tags", tags: []string{"db", "dev"}, expect: []string{"db1", "dev1"}},
+		{desc: "Not found", tags: []string{"stg"}, expect: nil},
+	}
+	for _, v := range tds {
+		got := FilterNameListByTag(listConf, nameList, v.tags)
+		assert.Equal(t, v.expect, got, v.desc)
+	}
+}
+
+func TestGetTagPolicy(t *testing.T) {
+	type TestData struct {
+		desc         string
+		nameList     []string
+		expectPolicy TagPolicyConfig
+		expectTags   []string
+	}
+	listConf := Config{
+		Server: map[string]ServerConfig{
+			"web1": ServerConfig{Tags: []string{"prod", "web"}},
+			"db1":  ServerConfig{Tags: []string{"prod", "db"}},
+			"dev1": ServerConfig{Tags: []string{"dev"}},
+		},
+		TagPolicy: map[string]TagPolicyConfig{
+			"prod": TagPolicyConfig{MaxParallel: 10},
+			"db":   TagPolicyConfig{Confirm: true, MaxParallel: 1},
+		},
+	}
+	tds := []TestData{
+		{desc: "No policy", nameList: []string{"dev1"}},
+		{desc: "Single tag", nameList: []string{"web1"}, expectPolicy: TagPolicyConfig{MaxParallel: 10}, expectTags: []string{"prod"}},
+		{desc: "Layered", nameList: []string{"web1", "db1", "dev1"}, expectPolicy: TagPolicyConfig{Confirm: true, MaxParallel: 1}, expectTags: []string{"prod", "db"}},
+	}
+	for _, v := range tds {
+		policy, tags := GetTagPolicy(listConf, v.nameList)
+		assert.Equal(t, v.expectPolicy, policy, v.desc)
+		assert.Equal(t, v.expectTags, tags, v.desc)
+	}
+}
+
+func TestSortNameList(t *testing.T) {
+	type TestData struct {
+		desc     string
+		sortConf SortConfig
+		expect   []string
+		err      bool
+	}
+	listConf := Config{
+		Server: map[string]ServerConfig{
+			"web10": ServerConfig{Addr: "10.0.0.3", Tags: []string{"web"}},
+			"web2":  ServerConfig{Addr: "10.0.0.20", Tags: []string{"web"}},
+			"db1":   ServerConfig{Addr: "10.0.0.10", Tags: []string{"db"}},
+			"dev1":  ServerConfig{Addr: "10.0.0.1"},
+		},
+	}
+	tds := []TestData{
+		{desc: "Default (natural sort by name)", expect: []string{"db1", "dev1", "web2", "web10"}},
+		{desc: "Name desc", sortConf: SortConfig{Key: "name", Order: "desc"}, expect: []string{"web10", "web2", "dev1", "db1"}},
+		{desc: "Addr", sortConf: SortConfig{Key: "addr"}, expect: []string{"dev1", "web10", "db1", "web2"}},
+		{desc: "Tag", sortConf: SortConfig{Key: "tag"}, expect: []string{"db1", "web2", "web10", "dev1"}},
+		{desc: "Unknown key", sortConf: SortConfig{Key: "foo"}, expect: []string{"web10", "web2", "db1", "dev1"}, err: true},
+	}
+	for _, v := range tds {
+		names := []string{"web10", "web2", "db1", "dev1"}
+		err := SortNameList(listConf, names, v.sortConf)
+		assert.Equal(t, v.err, err != nil, v.desc)
+		assert.Equal(t, v.expect, names, v.desc)
+	}
+}
+
+func TestParseKnownHosts(t *testing.T) {
+	data := `# comment
+web10.example.com,192.168.0.10 ssh-ed25519 AAAA
+web2.example.com ssh-rsa AAAA
+[db.example.com]:2222 ecdsa-sha2-nistp256 AAAA
+|1|hashed=|hash= ssh-rsa AAAA
+*.example.com ssh-rsa AAAA
+@cert-authority *.example.com ssh-rsa AAAA
+web2.example.com ecdsa-sha2-nistp256 AAAA
+`
+	expect := []onboardHost{
+		{Name: "192.168.0.10", Addr: "192.168.0.10", Port: "22"},
+		{Name: "db.example.com:2222", Addr: "db.example.com", Port: "2222"},
+		{Name: "web2.example.com", Addr: "web2.example.com", Port: "22"},
+		{Name: "web10.example.com", Addr: "web10.example.com", Port: "22"},
+	}
+	assert.Equal(t, expect, parseKnownHosts(data))
+}
+
+func TestOnboardConfigText(t *testing.T) {
+	text := onboardConfigText(true, []onboardHost{
+		{Name: "web1", Addr: "192.168.0.1", Port: "22", User: "user", Key: "~/.ssh/id_rsa", Note: "web server"},
+		{Name: "db.example.com:2222", Addr: "db.example.com", Port: "2222", User: "user"},
+	})
+
+	var config Config
+	_, err := toml.Decode(text, &config)
+	assert.Nil(t, err)
+	assert.Equal(t, "~/.ssh/config", config.SshConfig["default"].Path)
+	assert.Equal(t, ServerConfig{Addr: "192.168.0.1", Port: "22", User: "user", Key: "~/.ssh/id_rsa", Note: "web server"}, config.Server["web1"])
+	assert.Equal(t, ServerConfig{Addr: "db.example.com", Port: "2222", User: "user"}, config.Server["db.example.com:2222"])
+}
+
+func TestMatchGuard(t *testing.T) {
+	type TestData struct {
+		desc    string
+		guard   GuardConfig
+		command string
+		expect  bool
+		err     bool
+	}
+	tds := []TestData{
+		{desc: "Safe command", command: "uptime", expect: false},
+		{desc: "rm -rf", command: "sudo rm -rf /var/tmp/cache", expect: true},
+		{desc: "rm -f -r", command: "rm -f -r dir", expect: true},
+		{desc: "rm file", command: "rm -f file.txt", expect: false},
+		{desc: "Not rm", command: "firm -r", expect: false},
+		{desc: "shutdown", command: "shutdown -h now", expect: true},
+		{desc: "mkfs", command: "mkfs.ext4 /dev/sdb1", expect: true},
+		{desc: "DROP TABLE", command: `mysql -e "drop table users"`, expect: true},
+		{desc: "Disabled", guard: GuardConfig{Disable: true}, command: "rm -rf /", expect: false},
+		{desc: "Custom patterns", guard: GuardConfig{Patterns: []string{`systemctl\s+stop`}}, command: "systemctl stop nginx", expect: true},
+		{desc: "Custom patterns (default is not used)", guard: GuardConfig{Patterns: []string{`systemctl\s+stop`}}, command: "reboot", expect: false},
+		{desc: "Invalid pattern", guard: GuardConfig{Patterns: []string{`(`}}, command: "ls", err: true},
+	}
+	for _, v := range tds {
+		pattern, err := MatchGuard(v.guard, v.command)
+		assert.Equal(t, v.err, err != nil, v.desc)
+		assert.Equal(t, v.expect, pattern != "", v.desc)
+	}
+}
+
+func TestApplyServerOverrides(t *testing.T) {
+	type TestData struct {
+		desc      string
+		overrides []string
+		expect    ServerConfig
+		err       bool
+	}
+	base := ServerConfig{Addr: "192.168.0.1", Port: "22", User: "user"}
+	tds := []TestData{
+		{desc: "No override", expect: base},
+		{desc: "String", overrides: []string{"port=2222", "User=admin"}, expect: ServerConfig{Addr: "192.168.0.1", Port: "2222", User: "admin"}},
+		{desc: "Int and bool", overrides: []string{"connect_timeout=5", "ssh_agent=yes"}, expect: ServerConfig{Addr: "192.168.0.1", Port: "22", User: "user", ConnectTimeout: 5, SSHAgentUse: true}},
+		{desc: "Slice", overrides: []string{"tags=a, b"}, expect: ServerConfig{Addr: "192.168.0.1", Port: "22", User: "user", Tags: []string{"a", "b"}}},
+		{desc: "Empty value", overrides: []string{"proxy="}, expect: base},
+		{desc: "Unknown key", overrides: []string{"foo=bar"}, err: true},
+		{desc: "Bad format", overrides: []string{"port"}, err: true},
+		{desc: "Bad number", overrides: []string{"connect_timeout=x"}, err: true},
+		{desc: "Not overridable", overrides: []string{"db=x"}, err: true},
+	}
+	for _, v := range tds {
+		result, err := ApplyServerOverrides(base, v.overrides)
+		assert.Equal(t, v.err, err != nil, v.desc)
+		if !v.err {
+			assert.Equal(t, v.expect, result, v.desc)
+		}
+	}
+}
+
+func TestLoadConf(t *testing.T) {
+	type TestData struct {
+		desc    string
+		data    string
+		servers []string
+		err     bool
+	}
+
+	dir, err := ioutil.TempDir("", "lssh-conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	include := filepath.Join(dir, "include.conf")
+	ioutil.WriteFile(include, []byte("[server.inc]\naddr = \"10.0.0.3\"\n"), 0600)
+
+	// not read ~/.ssh/config
+	sshConfig := "[sshconfig.none]\npath = \"" + filepath.Join(dir, "none") + "\"\n"
+
+	tds := []TestData{
+		{
+			desc:    "Servers",
+			data:    "[common]\nuser = \"test\"\npass = \"p\"\n[server.a]\naddr = \"10.0.0.1\"\n[server.b]\naddrs = [\"10.0.0.2\"]\n",
+			servers: []string{"a", "b"},
+		},
+		{
+			desc:    "Include",
+			data:    "[common]\nuser = \"test\"\npass = \"p\"\n[include.inc]\npath = \"" + include + "\"\n",
+			servers: []string{"inc"},
+		},
+		{desc: "Invalid server config", data: "[server.a]\naddr = \"10.0.0.1\"\n", err: true},
+		{desc: "Syntax error", data: "[server.a\n", err: true},
+		{desc: "Include not found", data: "[include.inc]\npath = \"" + filepath.Join(dir, "none") + "\"\n", err: true},
+	}
+	for i, v := range tds {
+		path := filepath.Join(dir, fmt.Sprintf("%d.conf", i))
+		ioutil.WriteFile(path, []byte(v.data+sshConfig), 0600)
+
+		config, err := LoadConf(path, LoadOptions{})
+		assert.Equal(t, v.err, err != nil, v.desc)
+		if err == nil {
+			names := GetNameList(config)
+			sort.Strings(names)
+			assert.Equal(t, v.servers, names, v.desc)
+		}
+	}
+
+	_, err = LoadConf(filepath.Join(dir, "none"), LoadOptions{})
+	assert.Error(t, err, "Not found")
+}
+
+// countInventory is Inventory for test, that count calls of List.
+type countInventory struct {
+	count   *int
+	servers []ServerConfig
+}
+
+func (i countInventory) List() ([]ServerConfig, error) {
+	*i.count++
+	return i.servers, nil
+}
+
+func TestLoadConfInventory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lssh-conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stateDir := common.StateDir
+	common.StateDir = dir
+	defer func() { common.StateDir = stateDir }()
+
+	count := 0
+	RegisterInventory("test", func(c InventoryConfig) (Inventory, error) {
+		return countInventory{count: &count, servers: []ServerConfig{{Name: "t1", Addr: c.Options["addr"]}}}, nil
+	})
+
+	script := filepath.Join(dir, "script.conf")
+	ioutil.WriteFile(script, []byte("[common]\nport = \"2222\"\n[server.s1]\naddr = \"10.0.0.2\"\n"), 0600)
+
+	inventoryCmd := filepath.Join(dir, "inventory.json")
+	ioutil.WriteFile(inventoryCmd, []byte(`{"c1": {"addr": "10.0.0.3", "user": "cmd"}}`), 0600)
+
+	data := "inventory_cmd = \"cat " + inventoryCmd + "\"\n" +
+		"[common]\npass = \"p\"\n" +
+		"[sshconfig.none]\npath = \"" + filepath.Join(dir, "none") + "\"\n" +
+		"[inventory.test]\ntype = \"test\"\nuser = \"test\"\ncache_ttl = 60\noptions = { addr = \"10.0.0.1\" }\n" +
+		"[inventory.script]\ntype = \"script\"\nuser = \"script\"\ncommand = \"cat " + script + "\"\n"
+	path := filepath.Join(dir, "inventory.conf")
+	ioutil.WriteFile(path, []byte(data), 0600)
+
+	config, err := LoadConf(path, LoadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, ServerConfig{Name: "t1", Addr: "10.0.0.1", User: "test", Pass: "p"}, config.Server["t1"])
+	assert.Equal(t, "10.0.0.2", config.Server["s1"].Addr)
+	assert.Equal(t, "2222", config.Server["s1"].Port)
+	assert.Equal(t, "script", config.Server["s1"].User)
+	assert.Equal(t, ServerConfig{Name: "c1", Addr: "10.0.0.3", User: "cmd", Pass: "p"}, config.Server["c1"])
+
+	// cached
+	_, err = LoadConf(path, LoadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// unknown type
+	ioutil.WriteFile(path, []byte(data+"[inventory.unknown]\ntype = \"unknown\"\n"), 0600)
+	_, err = LoadConf(path, LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestParseInventoryJSON(t *testing.T) {
+	type TestData struct {
+		desc   string
+		data   string
+		expect []ServerConfig
+		err    bool
+	}
+	tds := []TestData{
+		{
+			desc:   "Object",
+			data:   `{"web02": {"addr": "10.0.0.2"}, "web01": {"addr": "10.0.0.1", "port": 2222, "tags": ["web"], "x11": true}}`,
+			expect: []ServerConfig{{Name: "web01", Addr: "10.0.0.1", Port: "2222", Tags: []string{"web"}, X11: true}, {Name: "web02", Addr: "10.0.0.2"}},
+		},
+		{
+			desc:   "Array",
+			data:   `[{"name": "web01", "addr": "10.0.0.1", "user": "admin"}]`,
+			expect: []ServerConfig{{Name: "web01", Addr: "10.0.0.1", User: "admin"}},
+		},
+		{desc: "Empty", data: `{}`, expect: nil},
+		{desc: "No name", data: `[{"addr": "10.0.0.1"}]`, err: true},
+		{desc: "Unknown key", data: `{"web01": {"address": "10.0.0.1"}}`, err: true},
+		{desc: "Not array field", data: `{"web01": {"addr": ["10.0.0.1"]}}`, err: true},
+		{desc: "Not server", data: `"web01"`, err: true},
+	}
+	for _, v := range tds {
+		got, err := parseInventoryJSON([]byte(v.data))
+		assert.Equal(t, v.err, err != nil, v.desc)
+		if !v.err {
+			assert.Equal(t, v.expect, got, v.desc)
+		}
+	}
+}
+
+func TestParseTeleportNodes(t *testing.T) {
+	data := []byte(`[
+		{"kind": "node", "metadata": {"name": "5f1c", "labels": {"env": "prod", "role": "web"}}, "spec": {"addr": "10.0.0.1:3022", "hostname": "web1"}},
+		{"kind": "node", "metadata": {"name": "9a2b"}, "spec": {"addr": "", "hostname": "tunnel1"}},
+		{"kind": "node", "metadata": {"name": "c3d4"}, "spec": {"addr": "10.0.0.3:2222"}}
+	]`)
+
+	expect := []ServerConfig{
+		{Name: "web1", Addr: "web1", Port: "3022", Tags: []string{"env=prod", "role=web"}, Note: "teleport node (prod)"},
+		{Name: "tunnel1", Addr: "tunnel1", Port: "3022", Tags: []string{}, Note: "teleport node (prod)"},
+		{Name: "c3d4", Addr: "c3d4", Port: "2222", Tags: []string{}, Note: "teleport node (prod)"},
+	}
+	got, err := parseTeleportNodes(data, "prod")
+	assert.Nil(t, err)
+	assert.Equal(t, expect, got)
+
+	_, err = parseTeleportNodes([]byte(`{"items": []}`), "")
+	assert.Error(t, err)
+}
+
+func TestParseTeleportProfile(t *testing.T) {
+	type TestData struct {
+		desc   string
+		data   string
+		expect teleportProfile
+	}
+	tds := []TestData{
+		{
+			desc:   "profile",
+			data:   "web_proxy_addr: teleport.example.com:443\nssh_proxy_addr: teleport.example.com:3023\nuser: alice\ncluster: prod\ndynamic_forwarded_ports:\n  - 8080\n",
+			expect: teleportProfile{WebProxyAddr: "teleport.example.com:443", SSHProxyAddr: "teleport.example.com:3023", User: "alice", Cluster: "prod"},
+		},
+		{
+			desc:   "old profile",
+			data:   "web_proxy_addr: teleport.example.com:3080\nuser: \"bob\"\nsite_name: root\n",
+			expect: teleportProfile{WebProxyAddr: "teleport.example.com:3080", User: "bob", Cluster: "root"},
+		},
+		{
+			desc:   "cluster is not set",
+			data:   "web_proxy_addr: teleport.example.com:443\nuser: alice\n",
+			expect: teleportProfile{WebProxyAddr: "teleport.example.com:443", User: "alice", Cluster: "teleport.example.com"},
+		},
+	}
+	for _, v := range tds {
+		assert.Equal(t, v.expect, parseTeleportProfile([]byte(v.data)), v.desc)
+	}
+}
+
+func TestTeleportInventory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lssh-conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// tsh profile and fake tsh, print args and nodes
+	ioutil.WriteFile(filepath.Join(dir, "current-profile"), []byte("teleport.example.com\n"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "teleport.example.com.yaml"), []byte("web_proxy_addr: teleport.example.com:443\nuser: alice\ncluster: prod\n"), 0600)
+	tsh := filepath.Join(dir, "tsh")
+	ioutil.WriteFile(tsh, []byte("#!/bin/sh\necho \"$*\" > "+filepath.Join(dir, "args")+"\necho '[{\"spec\": {\"hostname\": \"web1\"}}]'\n"), 0700)
+
+	servers, err := teleportInventory{TeleportConfig{Profile: dir, Tsh: tsh}}.List()
+	assert.NoError(t, err)
+	args, _ := ioutil.ReadFile(filepath.Join(dir, "args"))
+	assert.Equal(t, "ls --format=json --proxy=teleport.example.com:443 --cluster=prod\n", string(args))
+	assert.Equal(t, []ServerConfig{{
+		Name:         "web1",
+		Addr:         "web1",
+		Port:         "3022",
+		Cert:         filepath.Join(dir, "keys/teleport.example.com/alice-ssh/prod-cert.pub"),
+		CertKey:      filepath.Join(dir, "keys/teleport.example.com/alice"),
+		ProxyCommand: tsh + " proxy ssh --proxy=teleport.example.com:443 --cluster=prod %r@%h:%p",
+		Tags:         []string{},
+		Note:         "teleport node (prod)",
+	}}, servers)
+
+	// identity file
+	servers, err = teleportInventory{TeleportConfig{Profile: filepath.Join(dir, "none"), Proxy: "tp.example.com:443", Identity: "/id", Tsh: tsh}}.List()
+	assert.NoError(t, err)
+	assert.Equal(t, "/id", servers[0].Cert)
+	assert.Equal(t, "/id", servers[0].CertKey)
+	assert.Equal(t, tsh+" proxy ssh --proxy=tp.example.com:443 --identity=/id %r@%h:%p", servers[0].ProxyCommand)
+
+	// no profile
+	_, err = teleportInventory{TeleportConfig{Profile: filepath.Join(dir, "none"), Tsh: tsh}}.List()
+	assert.Error(t, err)
+}
+
+func TestUnsupportedKeyErrors(t *testing.T) {
+	text := `
+[common]
+user = "user"
+
+[server.a]
+addr = "192.168.0.1"
+gssapi_auth = true
+gssapi_delegate_creds = true
+
+[server.b]
+addr = "192.168.0.2"
+`
+
+	var config Config
+	md, err := toml.Decode(text, &config)
+	assert.Nil(t, err)
+
+	msgs := []string{}
+	for _, e := range unsupportedKeyErrors(md) {
+		msgs = append(msgs, e.Error())
+	}
+	sort.Strings(msgs)
+
+	assert.Equal(t, []string{
+		"server.a.gssapi_auth: GSSAPI (Kerberos) authentication is not supported. use use_system_ssh (GSSAPIAuthentication of ssh_config)",
+		"server.a.gssapi_delegate_creds: GSSAPI (Kerberos) authentication is not supported. use use_system_ssh (GSSAPIDelegateCredentials of ssh_config)",
+	}, msgs)
+}
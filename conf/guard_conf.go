@@ -0,0 +1,59 @@
+package conf
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// GuardConfig is setting of destructive command guard.
+// Command that matches one of patterns require explicit confirmation before run.
+//
+// example:
+//
+//	[guard]
+//	patterns = ['rm\s+-\w*r', '(?i)truncate\s+table']
+type GuardConfig struct {
+	// Disable guard.
+	Disable bool `toml:"disable"`
+
+	// Regular expressions of dangerous command. If not set, DefaultGuardPatterns is used.
+	Patterns []string `toml:"patterns"`
+}
+
+// DefaultGuardPatterns is dangerous command patterns used when guard.patterns is not set.
+var DefaultGuardPatterns = []string{
+	`\brm\s+(.*\s)?(-\w*[rR]\w*|--recursive)\b`, // rm -rf, rm -r -f, rm --recursive
+	`\b(shutdown|reboot|halt|poweroff)\b`,
+	`\binit\s+[06]\b`,
+	`\bmkfs(\.\w+)?\b`,
+	`\bdd\s+.*\bof=/dev/`,
+	`\bwipefs\b`,
+	`(?i)\bdrop\s+(table|database|schema)\b`,
+	`(?i)\btruncate\s+table\b`,
+	`:\(\)\s*\{\s*:\|:&\s*\};:`, // fork bomb
+}
+
+// MatchGuard return the first pattern of guard that matches command.
+// If guard is disabled or no pattern matches, return empty string.
+func MatchGuard(guard GuardConfig, command string) (pattern string, err error) {
+	if guard.Disable {
+		return "", nil
+	}
+
+	patterns := guard.Patterns
+	if patterns == nil {
+		patterns = DefaultGuardPatterns
+	}
+
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return "", fmt.Errorf("guard pattern '%s' is invalid, %v", p, err)
+		}
+
+		if re.MatchString(command) {
+			return p, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,393 @@
+package conf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/blacknon/lssh/common"
+)
+
+// InventoryCacheFile is name of cache file of inventory servers, in state directory.
+var InventoryCacheFile = "inventory.json"
+
+// Inventory is source of servers (static TOML, ssh_config, kubernetes, script...), aggregated into Config.Server by LoadConf.
+// Name of listed server is ServerConfig.Name.
+type Inventory interface {
+	List() ([]ServerConfig, error)
+}
+
+// InventoryConfig is setting of inventory provider. Servers listed by provider are added to config.
+//
+// example:
+//
+//	[inventory.aws]
+//	type = "script"
+//	command = "~/bin/aws-inventory.sh"  # print servers in config format ([server.<name>])
+//	cache_ttl = 300
+//	user = "ec2-user"
+//	key = "~/.ssh/aws.pem"
+type InventoryConfig struct {
+	Type     string            `toml:"type"`      // toml | ssh_config | script | type registered by RegisterInventory
+	Path     string            `toml:"path"`      // config file path (toml, ssh_config)
+	Command  string            `toml:"command"`   // command to print servers in JSON or config format (script)
+	Options  map[string]string `toml:"options"`   // options of registered provider
+	CacheTTL int               `toml:"cache_ttl"` // seconds to cache servers in state directory. 0 is not cached
+
+	// ssh settings of listed servers
+	ServerConfig
+}
+
+// InventoryFactory return Inventory of setting.
+type InventoryFactory func(c InventoryConfig) (Inventory, error)
+
+var (
+	inventoryFactories = map[string]InventoryFactory{
+		"toml":       func(c InventoryConfig) (Inventory, error) { return tomlInventory{Path: c.Path}, nil },
+		"ssh_config": func(c InventoryConfig) (Inventory, error) { return sshConfigInventory{Path: c.Path}, nil },
+		"script":     func(c InventoryConfig) (Inventory, error) { return scriptInventory{Command: c.Command}, nil },
+	}
+	inventoryMutex sync.Mutex
+)
+
+// RegisterInventory register inventory provider of typeName, used by `[inventory.<name>]` with `type = typeName`.
+// If typeName is already registered, it is replaced.
+func RegisterInventory(typeName string, factory InventoryFactory) {
+	inventoryMutex.Lock()
+	defer inventoryMutex.Unlock()
+
+	inventoryFactories[typeName] = factory
+}
+
+// newInventory return Inventory of c, created by registered provider of c.Type.
+func newInventory(c InventoryConfig) (Inventory, error) {
+	inventoryMutex.Lock()
+	factory, ok := inventoryFactories[c.Type]
+	inventoryMutex.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown inventory type '%s'", c.Type)
+	}
+	return factory(c)
+}
+
+// inventorySource is inventory aggregated into config.
+type inventorySource struct {
+	Name      string // section name. ex) `kubernetes.prod`
+	Inventory Inventory
+	Defaults  ServerConfig // settings of listed servers
+	CacheTTL  time.Duration
+	CacheKey  string // cache is not used if setting is changed
+
+	IsRequired bool // error stop loading config (include)
+	IsOptional bool // error is ignored (ssh_config)
+	IsRefresh  bool // cache is not read
+}
+
+// inventorySources return inventories of config, in order of ssh_config, kubernetes, teleport, include, inventory_cmd and `[inventory.<name>]`.
+func inventorySources(config Config) (sources []inventorySource, err error) {
+	// ssh_config (default: ~/.ssh/config)
+	if len(config.SshConfig) == 0 {
+		sources = append(sources, inventorySource{
+			Name:       "sshconfig",
+			Inventory:  sshConfigInventory{Path: "~/.ssh/config"},
+			IsOptional: true,
+		})
+	}
+	for _, name := range sortedKeys(config.SshConfig) {
+		sources = append(sources, inventorySource{
+			Name:       "sshconfig." + name,
+			Inventory:  sshConfigInventory{Path: config.SshConfig[name].Path},
+			Defaults:   config.SshConfig[name].ServerConfig,
+			IsOptional: true,
+		})
+	}
+
+	// kubernetes nodes
+	for _, name := range sortedKeys(config.Kubernetes) {
+		sources = append(sources, inventorySource{
+			Name:      "kubernetes." + name,
+			Inventory: kubernetesInventory{config.Kubernetes[name]},
+			Defaults:  config.Kubernetes[name].ServerConfig,
+		})
+	}
+
+	// teleport nodes
+	for _, name := range sortedKeys(config.Teleport) {
+		c := config.Teleport[name]
+		key := sha256.Sum256([]byte(fmt.Sprintf("%#v", c)))
+		sources = append(sources, inventorySource{
+			Name:      "teleport." + name,
+			Inventory: teleportInventory{c},
+			Defaults:  c.ServerConfig,
+			CacheTTL:  time.Duration(c.CacheTTL) * time.Second,
+			CacheKey:  hex.EncodeToString(key[:]),
+		})
+	}
+
+	// include files
+	for _, name := range sortedKeys(config.Include) {
+		sources = append(sources, inventorySource{
+			Name:       "include." + name,
+			Inventory:  tomlInventory{Path: config.Include[name].Path},
+			IsRequired: true,
+		})
+	}
+
+	// inventory command
+	if config.InventoryCmd != "" {
+		sources = append(sources, inventorySource{
+			Name:      "inventory_cmd",
+			Inventory: scriptInventory{Command: config.InventoryCmd},
+		})
+	}
+
+	// inventory providers
+	for _, name := range sortedKeys(config.Inventory) {
+		c := config.Inventory[name]
+		inventory, err := newInventory(c)
+		if err != nil {
+			return nil, fmt.Errorf("inventory.%s: %v", name, err)
+		}
+
+		key := sha256.Sum256([]byte(fmt.Sprintf("%#v", c)))
+		sources = append(sources, inventorySource{
+			Name:      "inventory." + name,
+			Inventory: inventory,
+			Defaults:  c.ServerConfig,
+			CacheTTL:  time.Duration(c.CacheTTL) * time.Second,
+			CacheKey:  hex.EncodeToString(key[:]),
+		})
+	}
+
+	return
+}
+
+// List return servers of inventory. If CacheTTL is set, servers are cached (cache is not read if IsRefresh).
+// If inventory failed and cache is expired, expired servers are returned with error.
+func (s inventorySource) List() (servers []ServerConfig, err error) {
+	if s.CacheTTL <= 0 {
+		return s.Inventory.List()
+	}
+
+	cache, ok := readInventoryCache()[s.Name]
+	if ok && !s.IsRefresh && cache.Key == s.CacheKey && time.Since(cache.Time) < s.CacheTTL {
+		return cache.Servers, nil
+	}
+
+	servers, err = s.Inventory.List()
+	if err != nil {
+		if ok && cache.Key == s.CacheKey {
+			return cache.Servers, fmt.Errorf("%v, use cache of %s", err, cache.Time.Format("2006/01/02 15:04:05"))
+		}
+		return
+	}
+
+	writeInventoryCache(s.Name, inventoryCache{Key: s.CacheKey, Time: time.Now(), Servers: servers})
+	return
+}
+
+// inventoryCache is cached servers of inventory.
+type inventoryCache struct {
+	Key     string
+	Time    time.Time
+	Servers []ServerConfig
+}
+
+// readInventoryCache return caches by inventory name.
+func readInventoryCache() (caches map[string]inventoryCache) {
+	caches = map[string]inventoryCache{}
+
+	data, err := ioutil.ReadFile(common.GetStatePath(InventoryCacheFile))
+	if err == nil {
+		json.Unmarshal(data, &caches)
+	}
+	return
+}
+
+// writeInventoryCache write cache of inventory name to cache file.
+func writeInventoryCache(name string, cache inventoryCache) (err error) {
+	caches := readInventoryCache()
+	caches[name] = cache
+
+	data, err := json.MarshalIndent(caches, "", "  ")
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(common.GetStatePath(InventoryCacheFile), data, 0600)
+}
+
+// tomlInventory list servers of config file (`[common]` and `[server.<name>]`).
+type tomlInventory struct {
+	Path string
+}
+
+func (i tomlInventory) List() ([]ServerConfig, error) {
+	data, err := ioutil.ReadFile(common.GetFullPath(i.Path))
+	if err != nil {
+		return nil, err
+	}
+	return parseInventoryToml(data)
+}
+
+// sshConfigInventory list hosts of OpenSSH config file.
+type sshConfigInventory struct {
+	Path string
+}
+
+func (i sshConfigInventory) List() ([]ServerConfig, error) {
+	config, err := getOpenSshConfig(i.Path)
+	if err != nil {
+		return nil, err
+	}
+	return namedServers(config), nil
+}
+
+// kubernetesInventory list nodes of kubernetes.
+type kubernetesInventory struct {
+	KubernetesConfig
+}
+
+func (i kubernetesInventory) List() ([]ServerConfig, error) {
+	config, err := getKubernetesConfig(i.KubernetesConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get nodes, %v", err)
+	}
+	return namedServers(config), nil
+}
+
+// scriptInventory list servers printed by command, in JSON or config format (`[common]` and `[server.<name>]`).
+// It can be used for inventory of cloud APIs (ex. `aws ec2 describe-instances` and `jq`).
+type scriptInventory struct {
+	Command string
+}
+
+func (i scriptInventory) List() ([]ServerConfig, error) {
+	stderr := new(bytes.Buffer)
+	cmd := exec.Command("sh", "-c", i.Command)
+	cmd.Stderr = stderr
+
+	data, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v, %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	if json.Valid(data) {
+		return parseInventoryJSON(data)
+	}
+	return parseInventoryToml(data)
+}
+
+// parseInventoryJSON return servers of JSON data. Keys of server are same as config (ex. `addr`, `proxy_cmd`).
+// Data is object of server name and server, or array of servers with `name`.
+//
+// example:
+//
+//	{"web01": {"addr": "10.0.0.1", "user": "admin", "tags": ["web"]}}
+//	[{"name": "web01", "addr": "10.0.0.1", "port": 2222}]
+func parseInventoryJSON(data []byte) (servers []ServerConfig, err error) {
+	var list []map[string]interface{}
+	var m map[string]map[string]interface{}
+	if err = json.Unmarshal(data, &m); err != nil {
+		if err = json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("servers must be object of server name and server, or array of servers")
+		}
+	}
+
+	for _, name := range sortedKeys(m) {
+		m[name]["name"] = name
+		list = append(list, m[name])
+	}
+
+	for i, values := range list {
+		name, _ := values["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("name of server %d is not set", i+1)
+		}
+		delete(values, "name")
+
+		server, err := jsonServerConfig(values)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		server.Name = name
+		servers = append(servers, server)
+	}
+	return
+}
+
+// jsonServerConfig return ServerConfig of JSON values by config key. Values are converted as ApplyServerOverrides.
+func jsonServerConfig(values map[string]interface{}) (server ServerConfig, err error) {
+	for _, key := range sortedKeys(values) {
+		switch value := values[key].(type) {
+		case []interface{}:
+			list := []string{}
+			for _, v := range value {
+				s, ok := v.(string)
+				if !ok {
+					return server, fmt.Errorf("%s must be array of string", key)
+				}
+				list = append(list, s)
+			}
+
+			field, ok := serverFieldByKey(reflect.ValueOf(&server).Elem(), key)
+			if !ok || field.Kind() != reflect.Slice || field.Type().Elem().Kind() != reflect.String {
+				return server, fmt.Errorf("%s can not be array", key)
+			}
+			field.Set(reflect.ValueOf(list))
+
+		case string, float64, bool:
+			server, err = ApplyServerOverrides(server, []string{fmt.Sprintf("%s=%v", key, value)})
+			if err != nil {
+				return
+			}
+
+		default:
+			return server, fmt.Errorf("%s can not be %T", key, value)
+		}
+	}
+	return
+}
+
+// parseInventoryToml return servers of config format data. `[common]` is applied to servers.
+func parseInventoryToml(data []byte) (servers []ServerConfig, err error) {
+	var c Config
+	if _, err = toml.Decode(string(data), &c); err != nil {
+		return
+	}
+
+	for name, value := range c.Server {
+		value = serverConfigReduct(c.Common, value)
+		value.Name = name
+		servers = append(servers, value)
+	}
+	return
+}
+
+// namedServers return servers of config, with name.
+func namedServers(config map[string]ServerConfig) (servers []ServerConfig) {
+	for name, value := range config {
+		value.Name = name
+		servers = append(servers, value)
+	}
+	return
+}
+
+// sortedKeys return sorted keys of map of config sections.
+func sortedKeys(m interface{}) (keys []string) {
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return
+}
@@ -0,0 +1,161 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+)
+
+// KubernetesConfig is setting to use nodes of kubernetes cluster as servers.
+// Nodes are listed with `kubectl get nodes`.
+//
+// example:
+//
+//	[kubernetes.prod]
+//	contexts = ["prod-tokyo", "prod-osaka"]
+//	selector = "node-role.kubernetes.io/worker"
+//	user = "core"
+//	key = "~/.ssh/id_rsa"
+type KubernetesConfig struct {
+	Kubeconfig  string   `toml:"kubeconfig"`   // kubeconfig path. default: kubectl default
+	Contexts    []string `toml:"contexts"`     // kubeconfig contexts. default: current context
+	Selector    string   `toml:"selector"`     // label selector (kubectl -l)
+	AddressType string   `toml:"address_type"` // internal (default) | external
+	Kubectl     string   `toml:"kubectl"`      // kubectl command path. default: kubectl
+
+	// ssh settings of node servers
+	ServerConfig
+}
+
+// kubernetesNodeList is output of `kubectl get nodes -o json`.
+type kubernetesNodeList struct {
+	Items []struct {
+		Metadata struct {
+			Name   string            `json:"name"`
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+		Status struct {
+			Addresses []struct {
+				Type    string `json:"type"`
+				Address string `json:"address"`
+			} `json:"addresses"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// getKubernetesConfig list nodes of kubernetes contexts, and returns it in conf.ServerConfig format.
+// If contexts is set, server name is `context/node`.
+func getKubernetesConfig(k KubernetesConfig) (config map[string]ServerConfig, err error) {
+	config = map[string]ServerConfig{}
+
+	contexts := k.Contexts
+	if len(contexts) == 0 {
+		contexts = []string{""} // current context
+	}
+
+	for _, context := range contexts {
+		data, err := kubectlGetNodes(k, context)
+		if err != nil {
+			return config, err
+		}
+
+		nodes, err := parseKubernetesNodes(data, context, k.AddressType)
+		if err != nil {
+			return config, err
+		}
+
+		for key, value := range nodes {
+			config[key] = value
+		}
+	}
+
+	return
+}
+
+// kubectlGetNodes run `kubectl get nodes -o json` of context, and return output.
+func kubectlGetNodes(k KubernetesConfig, context string) (data []byte, err error) {
+	kubectl := k.Kubectl
+	if kubectl == "" {
+		kubectl = "kubectl"
+	}
+
+	args := []string{"get", "nodes", "-o", "json"}
+	if k.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", common.GetFullPath(k.Kubeconfig))
+	}
+	if context != "" {
+		args = append(args, "--context", context)
+	}
+	if k.Selector != "" {
+		args = append(args, "-l", k.Selector)
+	}
+
+	data, err = exec.Command(kubectl, args...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		err = fmt.Errorf("%v %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+
+	return
+}
+
+// parseKubernetesNodes parse output of `kubectl get nodes -o json`.
+// Node labels are set to tags as `key=value`.
+func parseKubernetesNodes(data []byte, context, addressType string) (config map[string]ServerConfig, err error) {
+	config = map[string]ServerConfig{}
+
+	var nodeList kubernetesNodeList
+	if err = json.Unmarshal(data, &nodeList); err != nil {
+		return
+	}
+
+	// address priority
+	addressTypes := []string{"InternalIP", "ExternalIP", "Hostname"}
+	if strings.ToLower(addressType) == "external" {
+		addressTypes = []string{"ExternalIP", "InternalIP", "Hostname"}
+	}
+
+	for _, node := range nodeList.Items {
+		addresses := map[string]string{}
+		for _, a := range node.Status.Addresses {
+			if _, ok := addresses[a.Type]; !ok {
+				addresses[a.Type] = a.Address
+			}
+		}
+
+		var addr string
+		for _, t := range addressTypes {
+			if addresses[t] != "" {
+				addr = addresses[t]
+				break
+			}
+		}
+		if addr == "" {
+			continue
+		}
+
+		tags := []string{}
+		for key, value := range node.Metadata.Labels {
+			tags = append(tags, key+"="+value)
+		}
+		sort.Strings(tags)
+
+		name := node.Metadata.Name
+		note := "kubernetes node"
+		if context != "" {
+			name = context + "/" + name
+			note = "kubernetes node (" + context + ")"
+		}
+
+		config[name] = ServerConfig{
+			Addr: addr,
+			Tags: tags,
+			Note: note,
+		}
+	}
+
+	return
+}
@@ -0,0 +1,216 @@
+package conf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+)
+
+// onboardHost is server entry created at onboarding.
+type onboardHost struct {
+	Name string
+	Addr string
+	Port string
+	User string
+	Key  string
+	Note string
+}
+
+// Onboard run first-run wizard when config file is not found, and write config to confPath.
+// It offers to import ~/.ssh/config, scan ~/.ssh/known_hosts, or create a first server entry.
+func Onboard(confPath string, in io.Reader, out io.Writer) (err error) {
+	r := bufio.NewReader(in)
+
+	username := ""
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	defaultKey := ""
+	if common.IsExist(common.GetFullPath("~/.ssh/id_rsa")) {
+		defaultKey = "~/.ssh/id_rsa"
+	}
+
+	fmt.Fprintf(out, "Config file(%s) Not Found. Create it now.\n\n", confPath)
+
+	// import ~/.ssh/config
+	isSshConfig := false
+	if common.IsExist(common.GetFullPath("~/.ssh/config")) {
+		isSshConfig = onboardAskYesNo(r, out, "Import hosts of ~/.ssh/config?", true)
+	}
+
+	// scan ~/.ssh/known_hosts
+	hosts := []onboardHost{}
+	if data, err := ioutil.ReadFile(common.GetFullPath("~/.ssh/known_hosts")); err == nil {
+		known := parseKnownHosts(string(data))
+		if len(known) > 0 && onboardAskYesNo(r, out, fmt.Sprintf("Add %d hosts found in ~/.ssh/known_hosts?", len(known)), false) {
+			for _, h := range known {
+				h.User = username
+				h.Key = defaultKey
+				h.Note = "from known_hosts"
+				hosts = append(hosts, h)
+			}
+		}
+	}
+
+	// create first server entry
+	if onboardAskYesNo(r, out, "Create a server entry?", !isSshConfig && len(hosts) == 0) {
+		h := onboardHost{}
+		h.Addr = onboardAsk(r, out, "Address", "")
+		h.Name = onboardAsk(r, out, "Server name", h.Addr)
+		h.Port = onboardAsk(r, out, "Port", "22")
+		h.User = onboardAsk(r, out, "User", username)
+		h.Key = onboardAsk(r, out, "Private key path (empty for password or ssh-agent)", defaultKey)
+		h.Note = onboardAsk(r, out, "Note", "")
+		if h.Addr != "" {
+			hosts = append(hosts, h)
+		}
+	}
+
+	if !isSshConfig && len(hosts) == 0 {
+		return fmt.Errorf("no server is configured.\nsample: %s", "https://raw.githubusercontent.com/blacknon/lssh/master/example/config.tml")
+	}
+
+	if err = ioutil.WriteFile(confPath, []byte(onboardConfigText(isSshConfig, hosts)), 0600); err != nil {
+		return
+	}
+	fmt.Fprintf(out, "\nConfig file(%s) is created.\n\n", confPath)
+	return
+}
+
+// onboardAsk print question, and return answer (or defaultValue, if empty).
+func onboardAsk(r *bufio.Reader, w io.Writer, question, defaultValue string) string {
+	if defaultValue != "" {
+		fmt.Fprintf(w, "%s [%s]: ", question, defaultValue)
+	} else {
+		fmt.Fprintf(w, "%s: ", question)
+	}
+
+	line, _ := r.ReadString('\n')
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer
+	}
+	return defaultValue
+}
+
+// onboardAskYesNo print yes/no question, and return answer.
+func onboardAskYesNo(r *bufio.Reader, w io.Writer, question string, defaultValue bool) bool {
+	choice := "y/N"
+	if defaultValue {
+		choice = "Y/n"
+	}
+
+	answer := strings.ToLower(onboardAsk(r, w, question+" ("+choice+")", ""))
+	switch answer {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return defaultValue
+}
+
+// parseKnownHosts return hosts in known_hosts data. Hashed hosts, wildcards and revoked keys are skipped.
+func parseKnownHosts(data string) (hosts []onboardHost) {
+	isAdded := map[string]bool{}
+
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "|") {
+			continue
+		}
+		if fields[0] == "@revoked" {
+			continue
+		}
+		if fields[0] == "@cert-authority" {
+			continue
+		}
+
+		for _, pattern := range strings.Split(fields[0], ",") {
+			if strings.ContainsAny(pattern, "*?!") {
+				continue
+			}
+
+			h := onboardHost{Addr: pattern, Port: "22"}
+			if strings.HasPrefix(pattern, "[") {
+				host, port, err := net.SplitHostPort(pattern)
+				if err != nil {
+					continue
+				}
+				if _, err := strconv.Atoi(port); err != nil {
+					continue
+				}
+				h.Addr, h.Port = strings.Trim(host, "[]"), port
+			}
+
+			// name is host, or host:port if not default port
+			h.Name = h.Addr
+			if h.Port != "22" {
+				h.Name = h.Addr + ":" + h.Port
+			}
+			if isAdded[h.Name] {
+				continue
+			}
+			isAdded[h.Name] = true
+
+			hosts = append(hosts, h)
+		}
+	}
+
+	sort.SliceStable(hosts, func(i, j int) bool { return common.NaturalLess(hosts[i].Name, hosts[j].Name) })
+	return
+}
+
+// onboardConfigText return commented config text.
+func onboardConfigText(isSshConfig bool, hosts []onboardHost) string {
+	var b strings.Builder
+
+	b.WriteString(`# lssh config file. (created by first-run wizard)
+# See https://github.com/blacknon/lssh for all settings.
+#   sample: https://raw.githubusercontent.com/blacknon/lssh/master/example/config.tml
+
+# terminal log setting.
+# [log]
+# enable = true
+# timestamp = true
+# dirpath = "~/log/lssh/<Date>/<Hostname>"
+
+# common setting of all servers. (values of each server take precedence)
+# [common]
+# port = "22"
+# user = "user"
+# key = "~/.ssh/id_rsa"
+`)
+
+	if isSshConfig {
+		b.WriteString(`
+# import hosts from OpenSSH config.
+[sshconfig.default]
+path = "~/.ssh/config"
+`)
+	}
+
+	for _, h := range hosts {
+		fmt.Fprintf(&b, "\n[server.%q]\n", h.Name)
+		fmt.Fprintf(&b, "addr = %q\n", h.Addr)
+		fmt.Fprintf(&b, "port = %q\n", h.Port)
+		fmt.Fprintf(&b, "user = %q\n", h.User)
+		if h.Key != "" {
+			fmt.Fprintf(&b, "key = %q\n", h.Key)
+		} else {
+			b.WriteString("# pass = \"password\"  # or use ssh-agent with `agentauth = true`\n")
+		}
+		if h.Note != "" {
+			fmt.Fprintf(&b, "note = %q\n", h.Note)
+		}
+	}
+
+	return b.String()
+}
@@ -64,6 +64,13 @@ func getOpenSshConfig(path string) (config map[string]ServerConfig, err error) {
 			serverConfig.Key = key
 		}
 
+		// agent socket of host is used for ssh-agent auth
+		identityAgent := ssh_config.Get(host, "IdentityAgent")
+		if identityAgent != "" {
+			serverConfig.AgentSocket = identityAgent
+			serverConfig.AgentAuth = identityAgent != "none"
+		}
+
 		pkcs11Provider := ssh_config.Get(host, "PKCS11Provider")
 		if pkcs11Provider != "" {
 			serverConfig.PKCS11Use = true
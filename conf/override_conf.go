@@ -0,0 +1,81 @@
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ApplyServerOverrides return serverConf overwritten by `key=value` overrides (like `ssh -o`).
+// key is toml key of server config (ex. port, user, proxy, connect_timeout). value is converted by field type.
+//   - string   ... as it is
+//   - int      ... number
+//   - bool     ... true/false, yes/no
+//   - []string ... comma separated
+func ApplyServerOverrides(serverConf ServerConfig, overrides []string) (ServerConfig, error) {
+	v := reflect.ValueOf(&serverConf).Elem()
+
+	for _, override := range overrides {
+		kv := strings.SplitN(override, "=", 2)
+		if len(kv) != 2 {
+			return serverConf, fmt.Errorf("bad override '%s', use key=value", override)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+		field, ok := serverFieldByKey(v, key)
+		if !ok {
+			return serverConf, fmt.Errorf("unknown server config key '%s'", key)
+		}
+
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+
+		case reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return serverConf, fmt.Errorf("'%s' of %s is not a number", value, key)
+			}
+			field.SetInt(int64(n))
+
+		case reflect.Bool:
+			switch strings.ToLower(value) {
+			case "true", "yes", "y", "1":
+				field.SetBool(true)
+			case "false", "no", "n", "0":
+				field.SetBool(false)
+			default:
+				return serverConf, fmt.Errorf("'%s' of %s is not a boolean", value, key)
+			}
+
+		case reflect.Slice:
+			if field.Type().Elem().Kind() != reflect.String {
+				return serverConf, fmt.Errorf("%s can not be overridden", key)
+			}
+			list := []string{}
+			for _, s := range strings.Split(value, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					list = append(list, s)
+				}
+			}
+			field.Set(reflect.ValueOf(list))
+
+		default:
+			return serverConf, fmt.Errorf("%s can not be overridden", key)
+		}
+	}
+
+	return serverConf, nil
+}
+
+// serverFieldByKey return field of ServerConfig value v, that has toml key (case insensitive).
+func serverFieldByKey(v reflect.Value, key string) (field reflect.Value, ok bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if strings.EqualFold(t.Field(i).Tag.Get("toml"), key) {
+			return v.Field(i), true
+		}
+	}
+	return
+}
@@ -0,0 +1,125 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blacknon/lssh/common"
+)
+
+// sort key of server list
+const (
+	SORT_NAME     = "name"
+	SORT_ADDR     = "addr"
+	SORT_TAG      = "tag"
+	SORT_LASTUSED = "last-used"
+)
+
+// SortConfig is sort order of server list (TUI list and --list).
+// Names and addresses are compared in natural order (web2 < web10).
+//
+// example:
+//
+//	[sort]
+//	key = "last-used"
+//	order = "desc"
+type SortConfig struct {
+	// sort key. name(default), addr, tag or last-used.
+	Key string `toml:"key"`
+
+	// sort order. asc(default) or desc.
+	// last-used is sorted from most recently used at asc.
+	Order string `toml:"order"`
+}
+
+// LastUsedFile is name of file that records the time each server was last used, in state directory.
+var LastUsedFile = "lastused.json"
+
+// SortNameList sort nameList with sortConf.
+func SortNameList(listConf Config, nameList []string, sortConf SortConfig) (err error) {
+	var lastUsed map[string]time.Time
+
+	switch sortConf.Key {
+	case "", SORT_NAME, SORT_ADDR, SORT_TAG:
+	case SORT_LASTUSED:
+		lastUsed, _ = ReadLastUsed()
+	default:
+		return fmt.Errorf("unknown sort key: %s", sortConf.Key)
+	}
+	if sortConf.Order != "" && sortConf.Order != "asc" && sortConf.Order != "desc" {
+		return fmt.Errorf("unknown sort order: %s", sortConf.Order)
+	}
+
+	// key of server. tie is broken by name.
+	key := func(name string) string {
+		server := listConf.Server[name]
+		switch sortConf.Key {
+		case SORT_ADDR:
+			return server.Addr
+		case SORT_TAG:
+			tags := append([]string{}, server.Tags...)
+			sort.Strings(tags)
+			return strings.Join(tags, ",")
+		}
+		return name
+	}
+
+	less := func(a, b string) bool {
+		if sortConf.Key == SORT_LASTUSED {
+			ta, tb := lastUsed[a], lastUsed[b]
+			if !ta.Equal(tb) {
+				return ta.After(tb)
+			}
+		}
+
+		ka, kb := key(a), key(b)
+		if ka != kb {
+			// servers without key (ex. no tags) are at last
+			if ka == "" || kb == "" {
+				return kb == ""
+			}
+			return common.NaturalLess(ka, kb)
+		}
+		return common.NaturalLess(a, b)
+	}
+
+	sort.SliceStable(nameList, func(i, j int) bool {
+		if sortConf.Order == "desc" {
+			return less(nameList[j], nameList[i])
+		}
+		return less(nameList[i], nameList[j])
+	})
+	return
+}
+
+// ReadLastUsed return the time each server was last used, from LastUsedFile.
+func ReadLastUsed() (lastUsed map[string]time.Time, err error) {
+	lastUsed = map[string]time.Time{}
+
+	data, err := ioutil.ReadFile(common.GetStatePath(LastUsedFile))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &lastUsed)
+	return
+}
+
+// UpdateLastUsed record servers are used now, to LastUsedFile.
+func UpdateLastUsed(servers []string) (err error) {
+	lastUsed, _ := ReadLastUsed()
+
+	now := time.Now()
+	for _, server := range servers {
+		lastUsed[server] = now
+	}
+
+	data, err := json.MarshalIndent(lastUsed, "", "  ")
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(common.GetStatePath(LastUsedFile), data, 0600)
+}
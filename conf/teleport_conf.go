@@ -0,0 +1,235 @@
+package conf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+)
+
+// TELEPORT_NODE_PORT is default ssh port of Teleport node.
+const TELEPORT_NODE_PORT = "3022"
+
+// TeleportConfig is setting to use nodes of Teleport cluster as servers.
+// Nodes are listed with `tsh ls`, and connected via Teleport proxy with `tsh proxy ssh` (proxy_cmd).
+// Certificate of tsh profile (`tsh login`) or identity file (`tsh login -o`) is used for authentication.
+//
+// example:
+//
+//	[teleport.prod]
+//	proxy = "teleport.example.com:443"  # default: proxy of current tsh profile
+//	cluster = "prod"                     # default: cluster of tsh profile
+//	user = "ubuntu"                      # login of nodes
+type TeleportConfig struct {
+	Proxy    string `toml:"proxy"`     // web proxy address. default: current profile of tsh
+	Cluster  string `toml:"cluster"`   // cluster name. default: cluster of tsh profile
+	Identity string `toml:"identity"`  // identity file (`tsh login -o`). default: key and certificate of tsh profile
+	Profile  string `toml:"profile"`   // tsh profile directory. default: ~/.tsh
+	Tsh      string `toml:"tsh"`       // tsh command path. default: tsh
+	CacheTTL int    `toml:"cache_ttl"` // seconds to cache nodes in state directory. 0 is not cached
+
+	// ssh settings of node servers
+	ServerConfig
+}
+
+// teleportProfile is tsh profile (`~/.tsh/<proxy>.yaml`), written by `tsh login`.
+type teleportProfile struct {
+	WebProxyAddr string
+	SSHProxyAddr string
+	User         string
+	Cluster      string
+}
+
+// teleportNodeList is output of `tsh ls --format=json`.
+type teleportNodeList []struct {
+	Metadata struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Spec struct {
+		Addr     string `json:"addr"`
+		Hostname string `json:"hostname"`
+	} `json:"spec"`
+}
+
+// teleportInventory list nodes of Teleport cluster.
+type teleportInventory struct {
+	TeleportConfig
+}
+
+func (i teleportInventory) List() (servers []ServerConfig, err error) {
+	t := i.TeleportConfig
+	if t.Tsh == "" {
+		t.Tsh = "tsh"
+	}
+	if t.Profile == "" {
+		t.Profile = "~/.tsh"
+	}
+
+	// proxy and cluster of tsh profile
+	profile, err := readTeleportProfile(common.GetFullPath(t.Profile), t.Proxy)
+	if err != nil && (t.Proxy == "" || t.Identity == "") {
+		return nil, fmt.Errorf("cannot read tsh profile, %v", err)
+	}
+	if t.Proxy == "" {
+		t.Proxy = profile.WebProxyAddr
+	}
+	if t.Cluster == "" {
+		t.Cluster = profile.Cluster
+	}
+
+	args := []string{"ls", "--format=json"}
+	args = append(args, teleportArgs(t)...)
+	stderr := new(bytes.Buffer)
+	cmd := exec.Command(t.Tsh, args...)
+	cmd.Stderr = stderr
+
+	data, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get nodes, %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	servers, err = parseTeleportNodes(data, t.Cluster)
+	if err != nil {
+		return
+	}
+
+	// connect via teleport proxy with certificate
+	proxyCommand := strings.Join(append([]string{t.Tsh, "proxy", "ssh"}, teleportArgs(t)...), " ") + " %r@%h:%p"
+	cert, key := t.Identity, t.Identity
+	if t.Identity == "" {
+		key = filepath.Join(t.Profile, "keys", teleportProxyHost(t.Proxy), profile.User)
+		cert = filepath.Join(key+"-ssh", t.Cluster+"-cert.pub")
+	}
+	for i := range servers {
+		servers[i].ProxyCommand = proxyCommand
+		servers[i].Cert = cert
+		servers[i].CertKey = key
+	}
+	return
+}
+
+// teleportArgs return tsh options of proxy, cluster and identity file.
+func teleportArgs(t TeleportConfig) (args []string) {
+	if t.Proxy != "" {
+		args = append(args, "--proxy="+t.Proxy)
+	}
+	if t.Cluster != "" {
+		args = append(args, "--cluster="+t.Cluster)
+	}
+	if t.Identity != "" {
+		args = append(args, "--identity="+common.GetFullPath(t.Identity))
+	}
+	return
+}
+
+// teleportProxyHost return host of proxy address. (name of tsh profile)
+func teleportProxyHost(proxy string) string {
+	host, _, err := net.SplitHostPort(proxy)
+	if err != nil {
+		return proxy
+	}
+	return host
+}
+
+// readTeleportProfile read tsh profile of proxy in dir. If proxy is empty, current profile is read.
+func readTeleportProfile(dir, proxy string) (profile teleportProfile, err error) {
+	name := teleportProxyHost(proxy)
+	if name == "" {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "current-profile"))
+		if err != nil {
+			return profile, err
+		}
+		name = strings.TrimSpace(string(data))
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, name+".yaml"))
+	if err != nil {
+		return
+	}
+	return parseTeleportProfile(data), nil
+}
+
+// parseTeleportProfile parse tsh profile. It is flat yaml of `key: value`.
+func parseTeleportProfile(data []byte) (profile teleportProfile) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) != 2 || strings.HasPrefix(kv[0], " ") {
+			continue
+		}
+		value := strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+
+		switch kv[0] {
+		case "web_proxy_addr":
+			profile.WebProxyAddr = value
+		case "ssh_proxy_addr":
+			profile.SSHProxyAddr = value
+		case "user":
+			profile.User = value
+		case "cluster":
+			profile.Cluster = value
+		case "site_name": // old tsh
+			if profile.Cluster == "" {
+				profile.Cluster = value
+			}
+		}
+	}
+
+	// cluster is proxy host, if not set
+	if profile.Cluster == "" {
+		profile.Cluster = teleportProxyHost(profile.WebProxyAddr)
+	}
+	return
+}
+
+// parseTeleportNodes parse output of `tsh ls --format=json`. Server name is hostname of node.
+// Node labels are set to tags as `key=value`.
+func parseTeleportNodes(data []byte, cluster string) (servers []ServerConfig, err error) {
+	var nodes teleportNodeList
+	if err = json.Unmarshal(data, &nodes); err != nil {
+		return
+	}
+
+	note := "teleport node"
+	if cluster != "" {
+		note = "teleport node (" + cluster + ")"
+	}
+
+	for _, node := range nodes {
+		hostname := node.Spec.Hostname
+		if hostname == "" {
+			hostname = node.Metadata.Name
+		}
+
+		// tunnel node has no address
+		port := TELEPORT_NODE_PORT
+		if _, p, err := net.SplitHostPort(node.Spec.Addr); err == nil {
+			port = p
+		}
+
+		tags := []string{}
+		for key, value := range node.Metadata.Labels {
+			tags = append(tags, key+"="+value)
+		}
+		sort.Strings(tags)
+
+		servers = append(servers, ServerConfig{
+			Name: hostname,
+			Addr: hostname,
+			Port: port,
+			Tags: tags,
+			Note: note,
+		})
+	}
+
+	return
+}
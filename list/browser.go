@@ -0,0 +1,271 @@
+package list
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	runewidth "github.com/mattn/go-runewidth"
+	termbox "github.com/nsf/termbox-go"
+)
+
+// Browser is file browser in TUI, to pick files and directories of (remote) file system.
+// Paths are slash separated, and directories are read with ReadDir.
+type Browser struct {
+	Title   string
+	Dir     string // current directory (absolute path)
+	Keyword string // filter keyword of entries
+
+	// ReadDir return entries of directory. (without `.` and `..`)
+	ReadDir func(dir string) ([]BrowserEntry, error)
+
+	// Selected is picked paths, in order of selection.
+	Selected []string
+
+	entries     []BrowserEntry // entries of Dir, with `..`
+	viewEntries []BrowserEntry // entries filtered with Keyword
+	cursor      int
+	message     string // message shown at headline (ex. read error)
+}
+
+// BrowserEntry is an entry of directory in Browser.
+type BrowserEntry struct {
+	Name  string
+	IsDir bool
+}
+
+// View display browser in TUI, and return picked paths.
+// Tab key toggle selection, Enter key open directory (or pick file at cursor, if nothing is selected), and Enter with selection finish.
+// If Esc or Ctrl+C is pressed, nil is returned.
+func (b *Browser) View() []string {
+	if err := termbox.Init(); err != nil {
+		panic(err)
+	}
+	defer termbox.Close()
+
+	b.open(b.Dir)
+	b.draw()
+
+	for {
+		ev := termbox.PollEvent()
+		if ev.Type == termbox.EventResize {
+			termbox.Sync()
+		}
+		if ev.Type != termbox.EventKey {
+			b.draw()
+			continue
+		}
+
+		switch ev.Key {
+		// cancel
+		case termbox.KeyEsc, termbox.KeyCtrlC:
+			return nil
+
+		case termbox.KeyArrowUp:
+			if b.cursor > 0 {
+				b.cursor--
+			}
+
+		case termbox.KeyArrowDown:
+			if b.cursor < len(b.viewEntries)-1 {
+				b.cursor++
+			}
+
+		// open directory at cursor
+		case termbox.KeyArrowRight:
+			if e, ok := b.current(); ok && e.IsDir {
+				b.open(b.path(e))
+			}
+
+		// open parent directory
+		case termbox.KeyArrowLeft:
+			b.open(path.Dir(b.Dir))
+
+		// toggle selection
+		case termbox.KeyTab:
+			b.toggle()
+			if b.cursor < len(b.viewEntries)-1 {
+				b.cursor++
+			}
+
+		case termbox.KeyEnter:
+			if b.enter() {
+				return b.Selected
+			}
+
+		case termbox.KeyBackspace, termbox.KeyBackspace2:
+			if len(b.Keyword) > 0 {
+				sc := []rune(b.Keyword)
+				b.Keyword = string(sc[:len(sc)-1])
+				b.update()
+			}
+
+		case termbox.KeySpace:
+			b.Keyword += " "
+
+		default:
+			if ev.Ch != 0 {
+				b.Keyword += string(ev.Ch)
+				b.update()
+			}
+		}
+
+		b.draw()
+	}
+}
+
+// open read directory dir, and set it to current directory. If it cannot be read, current directory is not changed.
+func (b *Browser) open(dir string) {
+	entries, err := b.ReadDir(dir)
+	if err != nil {
+		b.message = fmt.Sprintf("cannot open %s, %v", dir, err)
+		return
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	if dir != "/" {
+		entries = append([]BrowserEntry{{Name: "..", IsDir: true}}, entries...)
+	}
+
+	b.Dir = dir
+	b.entries = entries
+	b.Keyword = ""
+	b.message = ""
+	b.cursor = 0
+	b.update()
+}
+
+// update filter entries with keyword. (ignore case, all words)
+func (b *Browser) update() {
+	keywords := strings.Fields(strings.ToLower(b.Keyword))
+
+	b.viewEntries = []BrowserEntry{}
+	for _, e := range b.entries {
+		match := true
+		for _, keyword := range keywords {
+			if !strings.Contains(strings.ToLower(e.Name), keyword) {
+				match = false
+				break
+			}
+		}
+		if match {
+			b.viewEntries = append(b.viewEntries, e)
+		}
+	}
+
+	if b.cursor >= len(b.viewEntries) {
+		b.cursor = len(b.viewEntries) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+}
+
+// current return entry at cursor.
+func (b *Browser) current() (e BrowserEntry, ok bool) {
+	if b.cursor >= len(b.viewEntries) {
+		return e, false
+	}
+	return b.viewEntries[b.cursor], true
+}
+
+// path return path of entry e in current directory.
+func (b *Browser) path(e BrowserEntry) string {
+	if e.Name == ".." {
+		return path.Dir(b.Dir)
+	}
+	return path.Join(b.Dir, e.Name)
+}
+
+// toggle selection of entry at cursor. `..` can not be selected.
+func (b *Browser) toggle() {
+	e, ok := b.current()
+	if !ok || e.Name == ".." {
+		return
+	}
+
+	p := b.path(e)
+	for i, s := range b.Selected {
+		if s == p {
+			b.Selected = append(b.Selected[:i], b.Selected[i+1:]...)
+			return
+		}
+	}
+	b.Selected = append(b.Selected, p)
+}
+
+// enter is action of Enter key. It return true, if picking is finished.
+func (b *Browser) enter() bool {
+	if len(b.Selected) > 0 {
+		return true
+	}
+
+	e, ok := b.current()
+	if !ok {
+		return false
+	}
+	if e.IsDir {
+		b.open(b.path(e))
+		return false
+	}
+
+	b.Selected = []string{b.path(e)}
+	return true
+}
+
+// isSelected return true if path p is selected.
+func (b *Browser) isSelected(p string) bool {
+	for _, s := range b.Selected {
+		if s == p {
+			return true
+		}
+	}
+	return false
+}
+
+// draw browser
+func (b *Browser) draw() {
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+
+	headline := 2
+	height := viewHeight(headline)
+
+	info := fmt.Sprintf("%s: %s (%d selected) [Tab]select [Enter]open/finish [Left]parent [Esc]cancel", b.Title, b.Dir, len(b.Selected))
+	drawLine(0, 0, info, 3, 255)
+	if b.message != "" {
+		width, _ := termbox.Size()
+		drawLine(width-runewidth.StringWidth(b.message)-1, 1, b.message, 1, 255)
+	}
+
+	prompt := "filter>>"
+	drawLine(0, 1, prompt, 3, 255)
+	drawLine(len(prompt), 1, b.Keyword, 255, 255)
+
+	// view range
+	first := (b.cursor / height) * height
+	for i := first; i < first+height && i < len(b.viewEntries); i++ {
+		e := b.viewEntries[i]
+		name := e.Name
+		if e.IsDir {
+			name += "/"
+		}
+
+		color, backColor := 255, 255
+		if b.isSelected(b.path(e)) {
+			color, backColor = 0, 6
+		}
+		if i == b.cursor {
+			color, backColor = 0, 2
+		}
+		drawLine(2, i-first+headline, fmt.Sprintf("%-1000s", name), color, backColor)
+	}
+
+	termbox.SetCursor(len(prompt)+len([]rune(b.Keyword)), 1)
+	termbox.Flush()
+}
@@ -0,0 +1,101 @@
+package list
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testBrowser return Browser of fake file system.
+func testBrowser() *Browser {
+	fs := map[string][]BrowserEntry{
+		"/":                {{Name: "var", IsDir: true}},
+		"/var":             {{Name: "local.txt"}, {Name: "log", IsDir: true}, {Name: "lib", IsDir: true}},
+		"/var/log":         {{Name: "syslog"}, {Name: "nginx", IsDir: true}},
+		"/var/log/nginx":   {{Name: "access.log"}, {Name: "error.log"}},
+		"/var/log/private": nil,
+	}
+	return &Browser{
+		Dir: "/var",
+		ReadDir: func(dir string) ([]BrowserEntry, error) {
+			entries, ok := fs[dir]
+			if !ok || dir == "/var/log/private" {
+				return nil, fmt.Errorf("permission denied")
+			}
+			return append([]BrowserEntry{}, entries...), nil
+		},
+	}
+}
+
+func TestBrowserOpen(t *testing.T) {
+	b := testBrowser()
+	b.open(b.Dir)
+	assert.Equal(t, []BrowserEntry{{"..", true}, {"lib", true}, {"log", true}, {"local.txt", false}}, b.viewEntries)
+
+	// root has no parent
+	b.open("/")
+	assert.Equal(t, []BrowserEntry{{"var", true}}, b.viewEntries)
+
+	// directory that cannot be read is not opened
+	b.open("/var/log/private")
+	assert.Equal(t, "/", b.Dir)
+	assert.NotEmpty(t, b.message)
+}
+
+func TestBrowserUpdate(t *testing.T) {
+	b := testBrowser()
+	b.open(b.Dir)
+	b.cursor = 3
+
+	b.Keyword = "LO"
+	b.update()
+	assert.Equal(t, []BrowserEntry{{"log", true}, {"local.txt", false}}, b.viewEntries)
+	assert.Equal(t, 1, b.cursor)
+
+	b.Keyword = "lo txt"
+	b.update()
+	assert.Equal(t, []BrowserEntry{{"local.txt", false}}, b.viewEntries)
+}
+
+func TestBrowserEnter(t *testing.T) {
+	type TestData struct {
+		desc     string
+		keys     []string // "enter", "tab", "up" or "down"
+		dir      string
+		selected []string
+		finished bool
+	}
+	tds := []TestData{
+		{desc: "Open parent", keys: []string{"enter"}, dir: "/", finished: false},
+		{desc: "Open directory", keys: []string{"down", "down", "enter"}, dir: "/var/log", finished: false},
+		{desc: "Pick file", keys: []string{"down", "down", "enter", "down", "down", "enter"}, dir: "/var/log", selected: []string{"/var/log/syslog"}, finished: true},
+		{desc: "Pick selected", keys: []string{"down", "tab", "tab", "enter"}, dir: "/var", selected: []string{"/var/lib", "/var/log"}, finished: true},
+		{desc: "Unselect", keys: []string{"down", "tab", "up", "tab"}, dir: "/var", selected: []string{}, finished: false},
+		{desc: "Parent can not be selected", keys: []string{"tab"}, dir: "/var", selected: nil, finished: false},
+	}
+	for _, v := range tds {
+		b := testBrowser()
+		b.open(b.Dir)
+
+		finished := false
+		for _, key := range v.keys {
+			switch key {
+			case "enter":
+				finished = b.enter()
+			case "tab":
+				b.toggle()
+				if b.cursor < len(b.viewEntries)-1 {
+					b.cursor++
+				}
+			case "up":
+				b.cursor--
+			case "down":
+				b.cursor++
+			}
+		}
+		assert.Equal(t, v.dir, b.Dir, v.desc)
+		assert.Equal(t, v.selected, b.Selected, v.desc)
+		assert.Equal(t, v.finished, finished, v.desc)
+	}
+}
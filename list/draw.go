@@ -19,6 +19,17 @@ func drawLine(x, y int, str string, colorNum int, backColorNum int) {
 	}
 }
 
+// viewHeight return number of lines to draw list, under headline.
+// It is at least 1, not to break paging when the terminal is too small.
+func viewHeight(headline int) int {
+	_, height := termbox.Size()
+	height = height - headline
+	if height < 1 {
+		height = 1
+	}
+	return height
+}
+
 // Highlight lines and draw text based on filtering results
 func drawFilterLine(x, y int, str string, colorNum int, backColorNum int, keywordColorNum int, searchText string) {
 	// SearchText Bounds Space
@@ -72,8 +83,7 @@ func (l *ListInfo) draw() {
 	termbox.Clear(termbox.Attribute(l.Term.Color+1), termbox.Attribute(l.Term.BackgroundColor+1))
 
 	// Get Terminal Size
-	_, height := termbox.Size()
-	height = height - l.Term.Headline
+	height := viewHeight(l.Term.Headline)
 
 	// Set View List Range
 	firstLine := (l.CursorLine/height)*height + 1
@@ -91,6 +101,10 @@ func (l *ListInfo) draw() {
 	drawLine(0, 0, l.Prompt, 3, l.Term.BackgroundColor)
 	drawLine(len(l.Prompt), 0, l.Keyword, l.Term.Color, l.Term.BackgroundColor)
 	drawLine(l.Term.LeftMargin, 1, l.ViewText[0], 3, l.Term.BackgroundColor)
+	if l.message != "" {
+		width, _ := termbox.Size()
+		drawLine(width-runewidth.StringWidth(l.message)-1, 0, l.message, 1, l.Term.BackgroundColor)
+	}
 
 	// View List
 	for listKey, listValue := range viewList {
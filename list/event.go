@@ -24,9 +24,6 @@ func (l *ListInfo) keyEvent() (lineData []string) {
 	l.CursorLine = 0
 	headLine := 2
 
-	_, height := termbox.Size()
-	height = height - headLine
-
 	l.Keyword = ""
 	allFlag := false // input Ctrl + A flag
 
@@ -59,6 +56,7 @@ func (l *ListInfo) keyEvent() (lineData []string) {
 
 			// AllowRight Key
 			case termbox.KeyArrowRight:
+				height := viewHeight(headLine)
 				nextPosition := ((l.CursorLine + height) / height) * height
 				if nextPosition+2 <= len(l.ViewText) {
 					l.CursorLine = nextPosition
@@ -67,6 +65,7 @@ func (l *ListInfo) keyEvent() (lineData []string) {
 
 			// AllowLeft Key
 			case termbox.KeyArrowLeft:
+				height := viewHeight(headLine)
 				beforePosition := ((l.CursorLine - height) / height) * height
 				if beforePosition >= 0 {
 					l.CursorLine = beforePosition
@@ -96,6 +95,14 @@ func (l *ListInfo) keyEvent() (lineData []string) {
 				}
 				l.draw()
 
+			// Ctrl + r Key(reload list)
+			case termbox.KeyCtrlR:
+				if l.Reload != nil {
+					l.reload()
+					allFlag = false
+				}
+				l.draw()
+
 			// Ctrl + h Key(Help Window)
 			//case termbox.KeyCtrlH:
 
@@ -152,6 +159,12 @@ func (l *ListInfo) keyEvent() (lineData []string) {
 				l.draw()
 			}
 
+		// Terminal resized
+		// Cursor line is kept, and the page including it is drawn with new size.
+		case termbox.EventResize:
+			termbox.Sync()
+			l.draw()
+
 		// Other
 		default:
 			l.draw()
@@ -93,6 +93,9 @@ func (l *ListInfo) getText() {
 	for _, key := range l.NameList {
 		name := key
 		conInfo := l.DataList.Server[key].User + "@" + l.DataList.Server[key].Addr
+		if container := l.DataList.Server[key].DockerContainer; container != "" {
+			conInfo = "docker:" + container
+		}
 		note := l.DataList.Server[key].Note
 
 		fmt.Fprintln(tabWriterBuffer, name+"\t"+conInfo+"\t"+note)
@@ -107,6 +110,39 @@ func (l *ListInfo) getText() {
 	}
 }
 
+// reload update list with l.Reload. Removed servers are unselected.
+func (l *ListInfo) reload() {
+	nameList, data, err := l.Reload()
+	l.message = ""
+	if err != nil {
+		l.message = err.Error()
+	}
+	if nameList == nil {
+		return
+	}
+
+	l.NameList = nameList
+	l.DataList = data
+
+	selected := []string{}
+	for _, name := range l.SelectName {
+		if arrayContains(nameList, name) {
+			selected = append(selected, name)
+		}
+	}
+	l.SelectName = selected
+
+	l.DataText = []string{}
+	l.getText()
+	l.getFilterText()
+	if l.CursorLine > len(l.ViewText)-2 {
+		l.CursorLine = len(l.ViewText) - 2
+	}
+	if l.CursorLine < 0 {
+		l.CursorLine = 0
+	}
+}
+
 // getFilterText updates l.ViewText with matching keyword (ignore case).
 // DataText sets ViewText if keyword is empty.
 func (l *ListInfo) getFilterText() {
@@ -146,6 +182,13 @@ func (l *ListInfo) getFilterText() {
 
 // View() display the list in TUI
 func (l *ListInfo) View() {
+	// plain text mode
+	if l.IsPlain {
+		l.getText()
+		l.viewPlain()
+		return
+	}
+
 	if err := termbox.Init(); err != nil {
 		panic(err)
 	}
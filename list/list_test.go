@@ -1,6 +1,9 @@
 package list
 
 import (
+	"bufio"
+	"io/ioutil"
+	"strings"
 	"testing"
 
 	"github.com/blacknon/lssh/conf"
@@ -277,3 +280,98 @@ func TestGetFilterText(t *testing.T) {
 		assert.Equal(t, v.expect, v.l.ViewText, v.desc)
 	}
 }
+
+func TestTableUpdate(t *testing.T) {
+	rows := []TableRow{
+		{Cells: []string{"web1", "ok", "2s"}, SortKeys: []string{"web1", "0", "02"}},
+		{Cells: []string{"db1", "failed(1)", "10s"}, SortKeys: []string{"db1", "1", "10"}},
+		{Cells: []string{"web2", "ok", "1s"}, SortKeys: []string{"web2", "0", "01"}},
+	}
+
+	type TestData struct {
+		desc   string
+		t      Table
+		expect []string
+	}
+	tds := []TestData{
+		{desc: "Sort by first column", t: Table{Header: []string{"a", "b", "c"}, Rows: rows}, expect: []string{"db1", "web1", "web2"}},
+		{desc: "Sort by sort key", t: Table{Header: []string{"a", "b", "c"}, Rows: rows, SortColumn: 2}, expect: []string{"web2", "web1", "db1"}},
+		{desc: "Sort reverse", t: Table{Header: []string{"a", "b", "c"}, Rows: rows, SortColumn: 1, SortReverse: true}, expect: []string{"db1", "web1", "web2"}},
+		{desc: "Filter by keyword", t: Table{Header: []string{"a", "b", "c"}, Rows: rows, Keyword: "OK web"}, expect: []string{"web1", "web2"}},
+	}
+	for _, v := range tds {
+		v.t.update()
+		got := []string{}
+		for _, row := range v.t.viewRows {
+			got = append(got, row.Cells[0])
+		}
+		assert.Equal(t, v.expect, got, v.desc)
+	}
+}
+
+func TestSelectPlain(t *testing.T) {
+	type TestData struct {
+		desc      string
+		multi     bool
+		input     string
+		expect    []string
+		expectRes bool
+	}
+	dataText := []string{"ServerName Connect Information Note", "dev1 user@dev1", "prd1 user@prd1", "prd2 user@prd2"}
+	tds := []TestData{
+		{desc: "Select one", input: "2\n", expect: []string{"prd1"}, expectRes: true},
+		{desc: "Filter and select", input: "/prd\n2\n", expect: []string{"prd2"}, expectRes: true},
+		{desc: "Invalid input and retry", input: "9\nx\n1\n", expect: []string{"dev1"}, expectRes: true},
+		{desc: "Multiple select is not allowed", input: "1,2\n3\n", expect: []string{"prd2"}, expectRes: true},
+		{desc: "Multiple select", multi: true, input: "1,2-3\n", expect: []string{"dev1", "prd1", "prd2"}, expectRes: true},
+		{desc: "Select all", multi: true, input: "/prd\n*\n", expect: []string{"prd1", "prd2"}, expectRes: true},
+		{desc: "Quit", input: "q\n", expectRes: false},
+		{desc: "EOF", input: "", expectRes: false},
+	}
+	for _, v := range tds {
+		l := &ListInfo{DataText: dataText, MultiFlag: v.multi}
+		res := l.selectPlain(bufio.NewReader(strings.NewReader(v.input)), ioutil.Discard)
+		assert.Equal(t, v.expectRes, res, v.desc)
+		assert.Equal(t, v.expect, l.SelectName, v.desc)
+	}
+}
+
+func TestReload(t *testing.T) {
+	data := conf.Config{Server: map[string]conf.ServerConfig{
+		"web1": conf.ServerConfig{User: "u", Addr: "10.0.0.1"},
+		"web2": conf.ServerConfig{User: "u", Addr: "10.0.0.2"},
+	}}
+	newData := conf.Config{Server: map[string]conf.ServerConfig{
+		"web1": conf.ServerConfig{User: "u", Addr: "10.0.0.1"},
+	}}
+
+	type TestData struct {
+		desc     string
+		nameList []string
+		err      error
+		expect   []string
+		selected []string
+		message  string
+	}
+	tds := []TestData{
+		{desc: "Reloaded", nameList: []string{"web1"}, expect: []string{"web1"}, selected: []string{"web1"}},
+		{desc: "Reloaded with error", nameList: []string{"web1"}, err: assert.AnError, expect: []string{"web1"}, selected: []string{"web1"}, message: assert.AnError.Error()},
+		{desc: "Error", err: assert.AnError, expect: []string{"web1", "web2"}, selected: []string{"web1", "web2"}, message: assert.AnError.Error()},
+	}
+	for _, v := range tds {
+		l := ListInfo{NameList: []string{"web1", "web2"}, DataList: data, SelectName: []string{"web1", "web2"}, CursorLine: 1}
+		l.getText()
+		l.getFilterText()
+		l.Reload = func() ([]string, conf.Config, error) { return v.nameList, newData, v.err }
+
+		l.reload()
+		got := []string{}
+		for _, line := range l.ViewText[1:] {
+			got = append(got, strings.Fields(line)[0])
+		}
+		assert.Equal(t, v.expect, got, v.desc)
+		assert.Equal(t, v.selected, l.SelectName, v.desc)
+		assert.Equal(t, v.message, l.message, v.desc)
+		assert.True(t, l.CursorLine <= len(got)-1, v.desc)
+	}
+}
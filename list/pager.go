@@ -0,0 +1,306 @@
+package list
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	termbox "github.com/nsf/termbox-go"
+)
+
+// pagerEscapeRegex match escape sequences (CSI, OSC and others) in output, that are removed at view.
+var pagerEscapeRegex = regexp.MustCompile(`\x1b(?:\[[0-9;?]*[ -/]*[@-~]|\][^\x07\x1b]*(?:\x07|\x1b\\)|[@-Z\\-_])`)
+
+// pager input mode
+const (
+	pagerView   = iota // scroll
+	pagerSearch        // input search keyword
+	pagerSave          // input file path to save
+)
+
+// Pager is pager of per-host output in TUI. Host is switched with Tab (or Left/Right key),
+// output of all hosts is searched with `/` (and `n`, `N`), and output of host is saved to file with `s`.
+type Pager struct {
+	Title   string
+	Pages   []PagerPage
+	Keyword string // search keyword (ignore case)
+
+	lines   [][]string // lines of each page (escape sequences removed)
+	tops    []int      // top line of each page
+	page    int
+	match   int // line of last match in current page (-1 is none)
+	mode    int
+	input   string
+	message string // message shown at status line (ex. save error)
+}
+
+// PagerPage is output of a host in Pager.
+type PagerPage struct {
+	Name   string
+	Status string // shown with name (ex. `ok`, `failed`)
+	Text   string
+}
+
+// init split text of pages to lines.
+func (p *Pager) init() {
+	p.lines = make([][]string, len(p.Pages))
+	p.tops = make([]int, len(p.Pages))
+	for i, page := range p.Pages {
+		text := pagerEscapeRegex.ReplaceAllString(page.Text, "")
+		text = strings.Replace(text, "\r", "", -1)
+		text = strings.Replace(text, "\t", "    ", -1)
+		p.lines[i] = strings.Split(strings.TrimRight(text, "\n"), "\n")
+	}
+	p.match = -1
+}
+
+// View display the pager in TUI, until q, Esc or Ctrl+C is pressed.
+func (p *Pager) View() {
+	if len(p.Pages) == 0 {
+		return
+	}
+
+	if err := termbox.Init(); err != nil {
+		panic(err)
+	}
+	defer termbox.Close()
+
+	p.init()
+	p.draw()
+
+	for {
+		ev := termbox.PollEvent()
+		if ev.Type == termbox.EventResize {
+			termbox.Sync()
+		}
+		if ev.Type != termbox.EventKey {
+			p.draw()
+			continue
+		}
+
+		if p.mode != pagerView {
+			p.prompt(ev)
+			p.draw()
+			continue
+		}
+
+		height := viewHeight(3)
+		p.message = ""
+
+		switch {
+		// exit
+		case ev.Key == termbox.KeyEsc, ev.Key == termbox.KeyCtrlC, ev.Ch == 'q':
+			return
+
+		// switch host
+		case ev.Key == termbox.KeyTab, ev.Key == termbox.KeyArrowRight:
+			p.setPage(p.page + 1)
+		case ev.Key == termbox.KeyArrowLeft:
+			p.setPage(p.page - 1)
+
+		// scroll
+		case ev.Key == termbox.KeyArrowUp, ev.Ch == 'k':
+			p.scroll(-1, height)
+		case ev.Key == termbox.KeyArrowDown, ev.Ch == 'j', ev.Key == termbox.KeyEnter:
+			p.scroll(1, height)
+		case ev.Key == termbox.KeyPgup, ev.Ch == 'b':
+			p.scroll(-height, height)
+		case ev.Key == termbox.KeyPgdn, ev.Key == termbox.KeySpace:
+			p.scroll(height, height)
+		case ev.Key == termbox.KeyHome, ev.Ch == 'g':
+			p.scroll(-len(p.lines[p.page]), height)
+		case ev.Key == termbox.KeyEnd, ev.Ch == 'G':
+			p.scroll(len(p.lines[p.page]), height)
+
+		// search
+		case ev.Ch == '/':
+			p.mode, p.input = pagerSearch, ""
+		case ev.Ch == 'n':
+			p.next(true)
+		case ev.Ch == 'N':
+			p.next(false)
+
+		// save output of host
+		case ev.Ch == 's':
+			p.mode, p.input = pagerSave, p.Pages[p.page].Name+".log"
+		}
+
+		p.draw()
+	}
+}
+
+// prompt handle key input of search keyword or file path.
+func (p *Pager) prompt(ev termbox.Event) {
+	switch ev.Key {
+	case termbox.KeyEsc, termbox.KeyCtrlC:
+		p.mode = pagerView
+
+	case termbox.KeyEnter:
+		mode := p.mode
+		p.mode = pagerView
+		switch mode {
+		case pagerSearch:
+			if p.input != "" {
+				p.Keyword = p.input
+			}
+			p.match = -1
+			p.next(true)
+		case pagerSave:
+			if err := p.save(p.page, p.input); err != nil {
+				p.message = fmt.Sprintf("cannot save, %v", err)
+			} else {
+				p.message = fmt.Sprintf("saved output of %s to %s", p.Pages[p.page].Name, p.input)
+			}
+		}
+
+	case termbox.KeyBackspace, termbox.KeyBackspace2:
+		if len(p.input) > 0 {
+			sc := []rune(p.input)
+			p.input = string(sc[:len(sc)-1])
+		}
+
+	case termbox.KeySpace:
+		p.input += " "
+
+	default:
+		if ev.Ch != 0 {
+			p.input += string(ev.Ch)
+		}
+	}
+}
+
+// setPage switch current page to i (wrap around).
+func (p *Pager) setPage(i int) {
+	p.page = (i%len(p.Pages) + len(p.Pages)) % len(p.Pages)
+	p.match = -1
+}
+
+// scroll current page by n lines.
+func (p *Pager) scroll(n, height int) {
+	top := p.tops[p.page] + n
+	if top > len(p.lines[p.page])-height {
+		top = len(p.lines[p.page]) - height
+	}
+	if top < 0 {
+		top = 0
+	}
+	p.tops[p.page] = top
+}
+
+// find return page and line of next (or previous) line containing keyword, from line of page (not included).
+// Search continues to other pages, and wraps around.
+func (p *Pager) find(page, line int, forward bool) (int, int, bool) {
+	keyword := strings.ToLower(p.Keyword)
+	if keyword == "" {
+		return 0, 0, false
+	}
+
+	step := 1
+	if !forward {
+		step = -1
+	}
+
+	// number of lines of all pages. each line is visited once.
+	total := 0
+	for _, lines := range p.lines {
+		total += len(lines)
+	}
+
+	for i := 0; i < total; i++ {
+		line += step
+		for line < 0 || line >= len(p.lines[page]) {
+			page = (page + step + len(p.lines)) % len(p.lines)
+			if forward {
+				line = 0
+			} else {
+				line = len(p.lines[page]) - 1
+			}
+		}
+
+		if strings.Contains(strings.ToLower(p.lines[page][line]), keyword) {
+			return page, line, true
+		}
+	}
+	return 0, 0, false
+}
+
+// next move to next (or previous) match of keyword, and scroll it to top.
+func (p *Pager) next(forward bool) {
+	from := p.match
+	if from < 0 {
+		// search from top line of page
+		from = p.tops[p.page] - 1
+		if !forward {
+			from = p.tops[p.page]
+		}
+	}
+
+	page, line, ok := p.find(p.page, from, forward)
+	if !ok {
+		p.message = fmt.Sprintf("pattern not found: %s", p.Keyword)
+		return
+	}
+
+	p.page, p.match = page, line
+	p.tops[page] = line
+	p.scroll(0, viewHeight(3))
+}
+
+// save write output text of page to file path.
+func (p *Pager) save(page int, path string) error {
+	if path == "" {
+		return fmt.Errorf("file path is empty")
+	}
+	return ioutil.WriteFile(path, []byte(p.Pages[page].Text), 0600)
+}
+
+// draw pager
+func (p *Pager) draw() {
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	termbox.HideCursor()
+
+	height := viewHeight(3)
+	lines := p.lines[p.page]
+	top := p.tops[p.page]
+
+	info := fmt.Sprintf("%s [Tab/Left/Right]host [/]search [n/N]next/prev [s]save [q]exit", p.Title)
+	drawLine(0, 0, info, 3, 255)
+
+	// host tabs
+	x := 0
+	for i, page := range p.Pages {
+		name := " " + page.Name + " "
+		if page.Status != "" {
+			name = fmt.Sprintf(" %s(%s) ", page.Name, page.Status)
+		}
+		color, backColor := 255, 255
+		if i == p.page {
+			color, backColor = 0, 2
+		}
+		drawLine(x, 1, name, color, backColor)
+		x += len([]rune(name)) + 1
+	}
+
+	for i := top; i < top+height && i < len(lines); i++ {
+		drawLine(0, i-top+2, lines[i], 255, 255)
+		if p.Keyword != "" {
+			drawFilterLine(0, i-top+2, lines[i], 0, 3, 0, p.Keyword)
+		}
+	}
+
+	status := fmt.Sprintf("-- %s %d/%d --", p.Pages[p.page].Name, top+1, len(lines))
+	switch {
+	case p.mode == pagerSearch:
+		status = "/" + p.input
+		termbox.SetCursor(len([]rune(status)), height+2)
+	case p.mode == pagerSave:
+		status = "save to>>" + p.input
+		termbox.SetCursor(len([]rune(status)), height+2)
+	case p.message != "":
+		status = p.message
+	}
+	drawLine(0, height+2, status, 3, 255)
+
+	termbox.Flush()
+}
@@ -0,0 +1,92 @@
+package list
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testPager return Pager of 3 hosts.
+func testPager() *Pager {
+	p := &Pager{
+		Pages: []PagerPage{
+			{Name: "web01", Text: "start\nERROR: disk full\nend\n"},
+			{Name: "web02", Text: "\x1b[31mstart\x1b[0m\r\nok\r\n"},
+			{Name: "db01", Text: "error: connection refused\n\tretry\n"},
+		},
+	}
+	p.init()
+	return p
+}
+
+func TestPagerInit(t *testing.T) {
+	p := testPager()
+	assert.Equal(t, []string{"start", "ERROR: disk full", "end"}, p.lines[0])
+	assert.Equal(t, []string{"start", "ok"}, p.lines[1])
+	assert.Equal(t, []string{"error: connection refused", "    retry"}, p.lines[2])
+}
+
+func TestPagerFind(t *testing.T) {
+	p := testPager()
+	p.Keyword = "Error"
+
+	tests := []struct {
+		page, line int
+		forward    bool
+		wantPage   int
+		wantLine   int
+	}{
+		{0, -1, true, 0, 1},
+		{0, 1, true, 2, 0},  // continue to other page
+		{2, 0, true, 0, 1},  // wrap around
+		{2, 0, false, 0, 1}, // backward
+		{0, 1, false, 2, 0}, // backward wrap around
+	}
+	for _, tt := range tests {
+		page, line, ok := p.find(tt.page, tt.line, tt.forward)
+		assert.True(t, ok)
+		assert.Equal(t, tt.wantPage, page)
+		assert.Equal(t, tt.wantLine, line)
+	}
+
+	// only one match, found again
+	p.Keyword = "disk"
+	page, line, ok := p.find(0, 1, true)
+	assert.True(t, ok)
+	assert.Equal(t, []int{0, 1}, []int{page, line})
+
+	p.Keyword = "not exist"
+	_, _, ok = p.find(0, 0, true)
+	assert.False(t, ok)
+
+	p.Keyword = ""
+	_, _, ok = p.find(0, 0, true)
+	assert.False(t, ok)
+}
+
+func TestPagerSetPage(t *testing.T) {
+	p := testPager()
+	p.setPage(-1)
+	assert.Equal(t, 2, p.page)
+	p.setPage(3)
+	assert.Equal(t, 0, p.page)
+}
+
+func TestPagerSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lssh_pager")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// output is saved as is (with escape sequences)
+	p := testPager()
+	path := filepath.Join(dir, "web02.log")
+	assert.NoError(t, p.save(1, path))
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, p.Pages[1].Text, string(data))
+
+	assert.Error(t, p.save(1, ""))
+}
@@ -0,0 +1,119 @@
+package list
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// viewPlain display the list with sequential prompts and plain text, instead of full-screen TUI.
+// It is for screen readers and braille terminals.
+func (l *ListInfo) viewPlain() {
+	in := io.Reader(os.Stdin)
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		defer tty.Close()
+		in = tty
+	}
+
+	if !l.selectPlain(bufio.NewReader(in), os.Stderr) {
+		os.Exit(0)
+	}
+}
+
+// selectPlain print list and read selection until servers are selected.
+// It returns false, if quit or input is closed.
+func (l *ListInfo) selectPlain(r *bufio.Reader, w io.Writer) bool {
+	l.Keyword = ""
+
+	for {
+		l.getFilterText()
+		rows := l.ViewText[1:]
+
+		// print list
+		if l.Keyword != "" {
+			fmt.Fprintf(w, "%d servers match %q.\n", len(rows), l.Keyword)
+		} else {
+			fmt.Fprintf(w, "%d servers.\n", len(rows))
+		}
+		for i, row := range rows {
+			fmt.Fprintf(w, "%d: %s\n", i+1, strings.TrimRight(row, " \n"))
+		}
+
+		// prompt
+		if l.MultiFlag {
+			fmt.Fprint(w, "Select numbers (ex. 1,3-5), * for all, /word to filter, q to quit: ")
+		} else {
+			fmt.Fprint(w, "Select number, /word to filter, q to quit: ")
+		}
+
+		line, err := r.ReadString('\n')
+		input := strings.TrimSpace(line)
+		if err != nil && input == "" {
+			fmt.Fprintln(w)
+			return false
+		}
+
+		switch {
+		case input == "":
+			continue
+
+		case input == "q":
+			return false
+
+		case strings.HasPrefix(input, "/"):
+			l.Keyword = strings.TrimSpace(input[1:])
+			continue
+
+		case input == "*" && l.MultiFlag:
+			input = fmt.Sprintf("1-%d", len(rows))
+		}
+
+		nums, err := parseSelectNumbers(input, len(rows))
+		if err == nil && !l.MultiFlag && len(nums) > 1 {
+			err = fmt.Errorf("select one server")
+		}
+		if err != nil {
+			fmt.Fprintf(w, "Invalid input. %v\n", err)
+			continue
+		}
+
+		l.SelectName = []string{}
+		for _, n := range nums {
+			l.SelectName = append(l.SelectName, strings.Fields(rows[n-1])[0])
+		}
+		fmt.Fprintf(w, "Selected: %s\n", strings.Join(l.SelectName, ", "))
+		return true
+	}
+}
+
+// parseSelectNumbers parse numbers of list (ex. `1,3-5`), and return them. Each number is 1 to max.
+func parseSelectNumbers(input string, max int) (nums []int, err error) {
+	for _, field := range strings.Split(input, ",") {
+		field = strings.TrimSpace(field)
+
+		start, end := field, field
+		if i := strings.Index(field, "-"); i > 0 {
+			start, end = field[:i], field[i+1:]
+		}
+
+		s, err := strconv.Atoi(strings.TrimSpace(start))
+		if err != nil {
+			return nil, fmt.Errorf("%s is not number", field)
+		}
+		e, err := strconv.Atoi(strings.TrimSpace(end))
+		if err != nil {
+			return nil, fmt.Errorf("%s is not number", field)
+		}
+		if s < 1 || e > max || s > e {
+			return nil, fmt.Errorf("%s is out of range (1-%d)", field, max)
+		}
+
+		for n := s; n <= e; n++ {
+			nums = append(nums, n)
+		}
+	}
+	return
+}
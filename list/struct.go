@@ -14,7 +14,14 @@ type ListInfo struct {
 	MultiFlag  bool        // multi select flag
 	Keyword    string      // input keyword
 	CursorLine int         // cursor line
+	IsPlain    bool        // plain text mode (sequential prompts, for screen readers)
 	Term       TermInfo
+
+	// Reload return new NameList and DataList, called with Ctrl+R (TUI only). If nil, Ctrl+R is ignored.
+	// If error is returned, it is shown at headline. List is updated if nameList is not nil.
+	Reload func() (nameList []string, data conf.Config, err error)
+
+	message string // message shown at headline (ex. reload error)
 }
 
 type TermInfo struct {
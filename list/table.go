@@ -0,0 +1,257 @@
+package list
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	termbox "github.com/nsf/termbox-go"
+)
+
+// Table is table view in TUI. Rows can be sorted by column, filtered by keyword,
+// and detail text of the row can be viewed with Enter key.
+type Table struct {
+	Title  string
+	Header []string
+	Rows   []TableRow
+
+	SortColumn  int
+	SortReverse bool
+	Keyword     string
+
+	viewRows []TableRow
+	cursor   int
+}
+
+// TableRow is row of Table.
+type TableRow struct {
+	Cells    []string
+	SortKeys []string // sort key of each column. if empty, Cells is used.
+	Detail   string   // detail text, view with Enter key.
+}
+
+// sortKey return sort key of column.
+func (r TableRow) sortKey(column int) string {
+	if column < len(r.SortKeys) {
+		return r.SortKeys[column]
+	}
+	if column < len(r.Cells) {
+		return r.Cells[column]
+	}
+	return ""
+}
+
+// update filter rows with keyword (ignore case, all words), and sort.
+func (t *Table) update() {
+	keywords := strings.Fields(strings.ToLower(t.Keyword))
+
+	t.viewRows = []TableRow{}
+	for _, row := range t.Rows {
+		line := strings.ToLower(strings.Join(row.Cells, " "))
+
+		match := true
+		for _, keyword := range keywords {
+			if !strings.Contains(line, keyword) {
+				match = false
+				break
+			}
+		}
+		if match {
+			t.viewRows = append(t.viewRows, row)
+		}
+	}
+
+	sort.SliceStable(t.viewRows, func(i, j int) bool {
+		a, b := t.viewRows[i].sortKey(t.SortColumn), t.viewRows[j].sortKey(t.SortColumn)
+		if t.SortReverse {
+			return a > b
+		}
+		return a < b
+	})
+
+	if t.cursor >= len(t.viewRows) {
+		t.cursor = len(t.viewRows) - 1
+	}
+	if t.cursor < 0 {
+		t.cursor = 0
+	}
+}
+
+// text return header line and row lines aligned with text/tabwriter.
+func (t *Table) text() (lines []string) {
+	buffer := &bytes.Buffer{}
+	tabWriterBuffer := new(tabwriter.Writer)
+	tabWriterBuffer.Init(buffer, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tabWriterBuffer, strings.Join(t.Header, "\t"))
+	for _, row := range t.viewRows {
+		fmt.Fprintln(tabWriterBuffer, strings.Join(row.Cells, "\t"))
+	}
+	tabWriterBuffer.Flush()
+
+	return strings.Split(strings.TrimRight(buffer.String(), "\n"), "\n")
+}
+
+// Print write table as plain text. (use when stdout is not terminal)
+func (t *Table) Print(w io.Writer) {
+	t.update()
+	for _, line := range t.text() {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// View display the table in TUI, until Esc or Ctrl+C is pressed.
+func (t *Table) View() {
+	if err := termbox.Init(); err != nil {
+		panic(err)
+	}
+	defer termbox.Close()
+
+	t.update()
+	t.draw()
+
+	for {
+		ev := termbox.PollEvent()
+		if ev.Type == termbox.EventResize {
+			termbox.Sync()
+		}
+		if ev.Type != termbox.EventKey {
+			t.draw()
+			continue
+		}
+
+		switch ev.Key {
+		// exit
+		case termbox.KeyEsc, termbox.KeyCtrlC:
+			return
+
+		case termbox.KeyArrowUp:
+			if t.cursor > 0 {
+				t.cursor--
+			}
+
+		case termbox.KeyArrowDown:
+			if t.cursor < len(t.viewRows)-1 {
+				t.cursor++
+			}
+
+		// sort by next column
+		case termbox.KeyTab:
+			t.SortColumn = (t.SortColumn + 1) % len(t.Header)
+			t.update()
+
+		// reverse sort order
+		case termbox.KeyCtrlR:
+			t.SortReverse = !t.SortReverse
+			t.update()
+
+		// view detail
+		case termbox.KeyEnter:
+			if len(t.viewRows) > 0 {
+				viewDetail(t.viewRows[t.cursor].Detail)
+			}
+
+		case termbox.KeyBackspace, termbox.KeyBackspace2:
+			if len(t.Keyword) > 0 {
+				sc := []rune(t.Keyword)
+				t.Keyword = string(sc[:len(sc)-1])
+				t.update()
+			}
+
+		case termbox.KeySpace:
+			t.Keyword += " "
+
+		default:
+			if ev.Ch != 0 {
+				t.Keyword += string(ev.Ch)
+				t.update()
+			}
+		}
+
+		t.draw()
+	}
+}
+
+// draw table
+func (t *Table) draw() {
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+
+	headline := 3
+	height := viewHeight(headline)
+
+	order := "asc"
+	if t.SortReverse {
+		order = "desc"
+	}
+	info := fmt.Sprintf("%s (sort: %s %s) [Tab]sort [Ctrl+R]reverse [Enter]view [Esc]exit", t.Title, t.Header[t.SortColumn], order)
+	drawLine(0, 0, info, 3, 255)
+
+	prompt := "filter>>"
+	drawLine(0, 1, prompt, 3, 255)
+	drawLine(len(prompt), 1, t.Keyword, 255, 255)
+
+	lines := t.text()
+	drawLine(2, 2, lines[0], 3, 255)
+
+	// view range
+	first := (t.cursor / height) * height
+	for i := first; i < first+height && i < len(t.viewRows); i++ {
+		color, backColor := 255, 255
+		if i == t.cursor {
+			color, backColor = 0, 2
+		}
+		drawLine(2, i-first+headline, fmt.Sprintf("%-1000s", lines[i+1]), color, backColor)
+	}
+
+	termbox.SetCursor(len(prompt)+len([]rune(t.Keyword)), 1)
+	termbox.Flush()
+}
+
+// viewDetail display text with scroll, until Esc, Enter or q is pressed.
+func viewDetail(text string) {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	top := 0
+
+	for {
+		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+		height := viewHeight(1)
+
+		for i := top; i < top+height && i < len(lines); i++ {
+			drawLine(0, i-top, strings.Replace(lines[i], "\t", "    ", -1), 255, 255)
+		}
+		drawLine(0, height, fmt.Sprintf("-- %d/%d -- [Up/Down/PgUp/PgDn]scroll [q]back", top+1, len(lines)), 3, 255)
+		termbox.HideCursor()
+		termbox.Flush()
+
+		ev := termbox.PollEvent()
+		if ev.Type == termbox.EventResize {
+			termbox.Sync()
+		}
+		if ev.Type != termbox.EventKey {
+			continue
+		}
+
+		switch {
+		case ev.Key == termbox.KeyEsc, ev.Key == termbox.KeyEnter, ev.Ch == 'q':
+			return
+		case ev.Key == termbox.KeyArrowUp:
+			top--
+		case ev.Key == termbox.KeyArrowDown:
+			top++
+		case ev.Key == termbox.KeyPgup, ev.Key == termbox.KeyArrowLeft:
+			top -= height
+		case ev.Key == termbox.KeyPgdn, ev.Key == termbox.KeyArrowRight, ev.Key == termbox.KeySpace:
+			top += height
+		}
+
+		if top > len(lines)-height {
+			top = len(lines) - height
+		}
+		if top < 0 {
+			top = 0
+		}
+	}
+}
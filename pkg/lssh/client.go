@@ -0,0 +1,189 @@
+package lssh
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	lsshssh "github.com/blacknon/lssh/ssh"
+	"golang.org/x/crypto/ssh"
+)
+
+// Options is options of Client.
+type Options struct {
+	Config Config
+
+	// servers to connect. Signers of key, cert and pkcs11 authentication are created for them at New.
+	// If empty, all servers of Config.
+	Servers []string
+
+	// max number of cached connections. 0 is unlimited.
+	MaxConnections int
+
+	// cached connection is closed after idle for this time. 0 is never.
+	IdleTimeout time.Duration
+
+	// max number of servers to run command or copy in parallel. 0 is unlimited.
+	MaxParallel int
+
+	// exported to remote as LSSH_RUN_ID, if not empty.
+	RunID string
+
+	// writer of warnings (ex. retry of connect, key that cannot be read). If nil, discarded.
+	Stderr io.Writer
+}
+
+// Client run commands and copy files at servers of Config, with cached connections.
+// It is safe for concurrent use.
+type Client struct {
+	opts Options
+	pool *lsshssh.ConnectPool
+}
+
+// Command is command to run at a server.
+type Command struct {
+	Command string
+	Stdin   io.Reader // if nil, empty
+	Stdout  io.Writer // if nil, discarded
+	Stderr  io.Writer // if nil, discarded
+}
+
+// Result is result of command at a server.
+type Result struct {
+	Server     string
+	ExitStatus int    // remote exit status. -1 if command is not run (connect error etc.)
+	Stdout     []byte // output of command (RunMulti)
+	Stderr     []byte
+	Duration   time.Duration
+	Err        error // connect error, *ssh.ExitError, or ctx.Err()
+}
+
+// New return Client. Passphrase of encrypted key must be set in config (key_pass), it is not prompted.
+func New(opts Options) *Client {
+	if opts.Stderr == nil {
+		opts.Stderr = ioutil.Discard
+	}
+	if len(opts.Servers) == 0 {
+		for server := range opts.Config.Server {
+			opts.Servers = append(opts.Servers, server)
+		}
+	}
+
+	authMap, err := lsshssh.NewAuthMap(opts.Config, opts.Servers)
+	if err != nil {
+		io.WriteString(opts.Stderr, err.Error()+"\n")
+	}
+
+	pool := lsshssh.NewConnectPool(opts.Config, authMap)
+	pool.MaxSize = opts.MaxConnections
+	pool.IdleTimeout = opts.IdleTimeout
+	pool.Stderr = opts.Stderr
+
+	return &Client{opts: opts, pool: pool}
+}
+
+// Close close all cached connections.
+func (c *Client) Close() {
+	c.pool.Close()
+}
+
+// Dial return new *ssh.Client to server, over proxies of config. It is not cached, and must be closed by caller.
+func (c *Client) Dial(ctx context.Context, server string) (*ssh.Client, error) {
+	con := &lsshssh.Connect{
+		Server:  server,
+		Conf:    c.opts.Config,
+		AuthMap: c.pool.AuthMap,
+		Stderr:  c.opts.Stderr,
+	}
+	if err := con.CreateClientContext(ctx); err != nil {
+		return nil, err
+	}
+	return con.Client, nil
+}
+
+// Run run cmd at server, and wait for exit. If ctx is done, command is terminated.
+func (c *Client) Run(ctx context.Context, server string, cmd Command) (res Result) {
+	res = Result{Server: server, ExitStatus: -1}
+	start := time.Now()
+	defer func() { res.Duration = time.Since(start) }()
+
+	con, err := c.pool.Get(ctx, server)
+	if err != nil {
+		res.Err = err
+		return
+	}
+	defer c.pool.Put(con)
+	con.RunID = c.opts.RunID
+
+	session, err := con.Client.NewSession()
+	if err != nil {
+		// connection is broken, reconnect at next run
+		c.pool.Discard(con)
+		res.Err = err
+		return
+	}
+
+	session.Stdin = cmd.Stdin
+	session.Stdout = ioutil.Discard
+	if cmd.Stdout != nil {
+		session.Stdout = cmd.Stdout
+	}
+	session.Stderr = ioutil.Discard
+	if cmd.Stderr != nil {
+		session.Stderr = cmd.Stderr
+	}
+
+	res.Err = con.RunCmdContext(ctx, session, []string{cmd.Command})
+	switch err := res.Err.(type) {
+	case nil:
+		res.ExitStatus = 0
+	case *ssh.ExitError:
+		res.ExitStatus = err.ExitStatus()
+	}
+	return
+}
+
+// RunMulti run command at servers in parallel (up to MaxParallel), and return results in order of servers.
+// stdin is written to command of all servers. Output of each server is collected to Result.
+func (c *Client) RunMulti(ctx context.Context, servers []string, command string, stdin []byte) (results []Result) {
+	results = make([]Result, len(servers))
+
+	c.parallel(servers, func(i int, server string) {
+		stdout := new(bytes.Buffer)
+		stderr := new(bytes.Buffer)
+		results[i] = c.Run(ctx, server, Command{
+			Command: command,
+			Stdin:   bytes.NewReader(stdin),
+			Stdout:  stdout,
+			Stderr:  stderr,
+		})
+		results[i].Stdout = stdout.Bytes()
+		results[i].Stderr = stderr.Bytes()
+	})
+	return
+}
+
+// parallel run f for servers in parallel (up to MaxParallel), and wait for all.
+func (c *Client) parallel(servers []string, f func(i int, server string)) {
+	var sem chan bool
+	if c.opts.MaxParallel > 0 {
+		sem = make(chan bool, c.opts.MaxParallel)
+	}
+
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+			if sem != nil {
+				sem <- true
+				defer func() { <-sem }()
+			}
+			f(i, server)
+		}(i, server)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,90 @@
+package lssh
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+)
+
+// Config is lssh config. (~/.lssh.conf)
+type Config = conf.Config
+
+// ServerConfig is config of a server in Config.
+type ServerConfig = conf.ServerConfig
+
+// LoadConfig load lssh config file at path. `~` of path is expanded to home directory.
+// Kubernetes nodes that cannot be got are ignored.
+func LoadConfig(path string) (Config, error) {
+	return conf.LoadConf(common.GetFullPath(path), conf.LoadOptions{})
+}
+
+// Filter is condition to select servers of Config.
+type Filter struct {
+	// server names or glob patterns (ex. `web*`). If empty, all servers.
+	Names []string
+
+	// select servers that have any of tags. If empty, not filtered by tag.
+	Tags []string
+
+	// server names and tags not to select.
+	ExcludeNames []string
+	ExcludeTags  []string
+}
+
+// Select return server names of config that match filter, in sort order of config (`[sort]`).
+// It return error if pattern of filter is malformed, or server name in filter is not found.
+func Select(config Config, filter Filter) (servers []string, err error) {
+	names := conf.GetNameList(config)
+	if err := conf.SortNameList(config, names, config.Sort); err != nil {
+		// unknown sort key, sort by name
+		sort.Strings(names)
+	}
+
+	if len(filter.Names) == 0 {
+		servers = names
+	}
+	for _, pattern := range filter.Names {
+		matched := false
+		for _, name := range names {
+			ok, err := path.Match(pattern, name)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", pattern, err)
+			}
+			if ok && !contains(servers, name) {
+				servers = append(servers, name)
+			}
+			matched = matched || ok
+		}
+		if !matched && !hasMeta(pattern) {
+			return nil, fmt.Errorf("%s: server not found", pattern)
+		}
+	}
+
+	servers = conf.FilterNameListByTag(config, servers, filter.Tags)
+	servers = conf.ExcludeNameList(config, servers, filter.ExcludeNames, filter.ExcludeTags)
+	return servers, nil
+}
+
+// contains return true if list has s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMeta return true if pattern has glob meta characters.
+func hasMeta(pattern string) bool {
+	for _, c := range pattern {
+		switch c {
+		case '*', '?', '[', '\\':
+			return true
+		}
+	}
+	return false
+}
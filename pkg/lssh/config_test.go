@@ -0,0 +1,41 @@
+package lssh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelect(t *testing.T) {
+	type TestData struct {
+		desc   string
+		filter Filter
+		expect []string
+		err    bool
+	}
+	config := Config{
+		Server: map[string]ServerConfig{
+			"web1": ServerConfig{Tags: []string{"web", "prod"}},
+			"web2": ServerConfig{Tags: []string{"web"}},
+			"db1":  ServerConfig{Tags: []string{"db", "prod"}},
+			"dev1": ServerConfig{},
+		},
+	}
+	tds := []TestData{
+		{desc: "All servers", expect: []string{"db1", "dev1", "web1", "web2"}},
+		{desc: "Names", filter: Filter{Names: []string{"web2", "db1"}}, expect: []string{"web2", "db1"}},
+		{desc: "Pattern", filter: Filter{Names: []string{"web*"}}, expect: []string{"web1", "web2"}},
+		{desc: "Pattern not matched", filter: Filter{Names: []string{"app*"}}, expect: nil},
+		{desc: "Duplicated", filter: Filter{Names: []string{"web1", "web*"}}, expect: []string{"web1", "web2"}},
+		{desc: "Tags", filter: Filter{Tags: []string{"prod"}}, expect: []string{"db1", "web1"}},
+		{desc: "Exclude", filter: Filter{Names: []string{"web*"}, ExcludeNames: []string{"web1"}}, expect: []string{"web2"}},
+		{desc: "Exclude tags", filter: Filter{ExcludeTags: []string{"prod"}}, expect: []string{"dev1", "web2"}},
+		{desc: "Not found", filter: Filter{Names: []string{"app1"}}, err: true},
+		{desc: "Malformed pattern", filter: Filter{Names: []string{"web["}}, err: true},
+	}
+	for _, v := range tds {
+		got, err := Select(config, v.filter)
+		assert.Equal(t, v.err, err != nil, v.desc)
+		assert.Equal(t, v.expect, got, v.desc)
+	}
+}
@@ -0,0 +1,91 @@
+package lssh
+
+import (
+	"context"
+	"time"
+
+	lsshssh "github.com/blacknon/lssh/ssh"
+)
+
+// CopyOptions is options of Upload and Download.
+type CopyOptions struct {
+	Permission bool     // keep permission of files
+	Verify     bool     // verify sha256 checksum after transfer
+	Include    []string // glob patterns of files to copy (recursive copy)
+	Exclude    []string // glob patterns of files and directories not to copy (recursive copy)
+	Tar        bool     // stream files as tar
+	Chunks     int      // split large files into ranges, and transfer them concurrently
+}
+
+// CopyResult is result of copy with a server.
+type CopyResult struct {
+	Server   string
+	Duration time.Duration
+	Err      error
+}
+
+// Upload copy local paths to remote path at servers in parallel (up to MaxParallel), and return results in order of servers.
+func (c *Client) Upload(ctx context.Context, servers []string, localPaths []string, remotePath string, opts CopyOptions) []CopyResult {
+	r := c.runScp(opts)
+	r.From = lsshssh.CopyConInfo{Path: localPaths}
+	r.To = lsshssh.CopyConInfo{IsRemote: true, Path: []string{remotePath}, Server: servers}
+
+	return c.copy(ctx, r, servers, "push")
+}
+
+// Download copy remote paths of servers to local path in parallel (up to MaxParallel), and return results in order of servers.
+// If servers are multiple, files of each server are put into directory of server name, next to local path.
+func (c *Client) Download(ctx context.Context, servers []string, remotePaths []string, localPath string, opts CopyOptions) []CopyResult {
+	r := c.runScp(opts)
+	r.From = lsshssh.CopyConInfo{IsRemote: true, Path: remotePaths, Server: servers}
+	r.To = lsshssh.CopyConInfo{Path: []string{localPath}}
+
+	return c.copy(ctx, r, servers, "pull")
+}
+
+// runScp return RunScp of opts.
+func (c *Client) runScp(opts CopyOptions) *lsshssh.RunScp {
+	return &lsshssh.RunScp{
+		Permission: opts.Permission,
+		Verify:     opts.Verify,
+		Include:    opts.Include,
+		Exclude:    opts.Exclude,
+		Tar:        opts.Tar,
+		Chunks:     opts.Chunks,
+		Config:     c.opts.Config,
+		Stderr:     c.opts.Stderr,
+	}
+}
+
+// copy run r with servers according to mode. If ctx is done, connection is closed to stop copy.
+func (c *Client) copy(ctx context.Context, r *lsshssh.RunScp, servers []string, mode string) (results []CopyResult) {
+	results = make([]CopyResult, len(servers))
+
+	c.parallel(servers, func(i int, server string) {
+		start := time.Now()
+		results[i] = CopyResult{Server: server}
+		defer func() { results[i].Duration = time.Since(start) }()
+
+		con, err := c.pool.Get(ctx, server)
+		if err != nil {
+			results[i].Err = err
+			return
+		}
+
+		copied := make(chan error, 1)
+		go func() {
+			copied <- r.CopyTarget(con, mode)
+		}()
+
+		select {
+		case err = <-copied:
+			c.pool.Put(con)
+		case <-ctx.Done():
+			c.pool.Discard(con)
+			<-copied
+			err = ctx.Err()
+		}
+		results[i].Err = err
+	})
+	return
+}
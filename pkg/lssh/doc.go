@@ -0,0 +1,27 @@
+/*
+Package lssh is library API of lssh, to select servers of lssh config and run commands or copy files at them from other Go programs.
+
+Unlike lssh and lscp commands, functions of this package do not prompt, print or exit.
+Errors are returned, and warnings (ex. retry of connect) are written to Options.Stderr.
+Connections are cached per server and shared between calls, so Client is safe for concurrent use.
+
+Example:
+
+	config, err := lssh.LoadConfig("~/.lssh.conf")
+	if err != nil {
+		return err
+	}
+
+	servers, err := lssh.Select(config, lssh.Filter{Tags: []string{"web"}})
+	if err != nil {
+		return err
+	}
+
+	client := lssh.New(lssh.Options{Config: config, Servers: servers, MaxParallel: 10})
+	defer client.Close()
+
+	for _, res := range client.RunMulti(ctx, servers, "uptime", nil) {
+		fmt.Printf("%s: %s (exit %d)\n", res.Server, res.Stdout, res.ExitStatus)
+	}
+*/
+package lssh
@@ -0,0 +1,235 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blacknon/lssh/common"
+)
+
+// CapabilityCacheFile is name of remote capability cache file, in state directory.
+var CapabilityCacheFile = "cache.json"
+
+// CapabilityCacheTTL is how long cached capabilities are used. After that, capabilities are detected again.
+var CapabilityCacheTTL = 7 * 24 * time.Hour
+
+// capabilityVersion is version of detection. Caches detected by other version are detected again.
+const capabilityVersion = 2
+
+var capabilityCacheMutex sync.Mutex
+
+// Capability is detected remote capabilities.
+type Capability struct {
+	// connect info at detected. If it changes, detect again.
+	Addr string `json:"addr"`
+	User string `json:"user"`
+
+	// login shell path. ex) /bin/bash
+	Shell string `json:"shell"`
+
+	// base64 type.
+	//   - coreutils ... `base64 -d`
+	//   - bsd       ... `base64 -D`
+	Base64 string `json:"base64"`
+
+	// sftp subsystem available
+	Sftp bool `json:"sftp"`
+
+	// sftp-only account (exec request is rejected, or command is forced to sftp server). ex) chroot, ForceCommand internal-sftp
+	SftpOnly bool `json:"sftp_only"`
+
+	// sudo command.
+	//   - installed ... sudo is installed (rule is not checked, `sudo -n` leave failure in auth log)
+	//   - none      ... sudo is not installed
+	Sudo string `json:"sudo"`
+
+	DetectedAt time.Time `json:"detected_at"`
+	Version    int       `json:"version"`
+}
+
+// capabilityProbeScript print capabilities as `key=value` lines. It is run with remote sh (not login shell).
+const capabilityProbeScript = `echo "shell=$SHELL";` +
+	`( (base64 --help 2>&1 | grep -q coreutils) && echo base64=coreutils || echo base64=bsd );` +
+	`( command -v sudo >/dev/null 2>&1 && echo sudo=installed || echo sudo=none )`
+
+// Base64DecodeCmd return base64 decode command of remote.
+func (capability *Capability) Base64DecodeCmd() string {
+	if capability.Base64 == "bsd" {
+		return "base64 -D"
+	}
+	return "base64 -d"
+}
+
+// GetCapability return remote capabilities of c.Server.
+// If cached in CapabilityCacheFile (within CapabilityCacheTTL), return it without detect.
+func (c *Connect) GetCapability() (capability *Capability, err error) {
+	serverConf := c.Conf.Server[c.Server]
+
+	caches, _ := readCapabilityCache()
+	if cached, ok := caches[c.Server]; ok {
+		if cached.Addr == serverConf.Addr && cached.User == serverConf.User &&
+			cached.Version == capabilityVersion && time.Since(cached.DetectedAt) < CapabilityCacheTTL {
+			return cached, nil
+		}
+	}
+
+	capability, err = c.detectCapability()
+	if err != nil {
+		return
+	}
+	capability.Addr = serverConf.Addr
+	capability.User = serverConf.User
+
+	err = writeCapabilityCache(c.Server, capability)
+	return
+}
+
+// detectCapability detect remote capabilities over ssh.
+// Probe is run with `sh -c`, and failure of it (ex. sh is not found at Windows) is not error (capabilities are left empty).
+// Server is sftp-only account, only if exec request is rejected or answered by sftp server, and sftp subsystem is available.
+func (c *Connect) detectCapability() (capability *Capability, err error) {
+	capability = &Capability{DetectedAt: time.Now(), Version: capabilityVersion}
+
+	output, execRejected, err := c.runCapabilityProbe()
+	if err != nil {
+		return
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	for sc.Scan() {
+		kv := strings.SplitN(sc.Text(), "=", 2)
+		if len(kv) < 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case "shell":
+			capability.Shell = kv[1]
+		case "base64":
+			capability.Base64 = kv[1]
+		case "sudo":
+			capability.Sudo = kv[1]
+		}
+	}
+
+	// sftp subsystem
+	session, err := c.Client.NewSession()
+	if err != nil {
+		return
+	}
+	capability.Sftp = session.RequestSubsystem("sftp") == nil
+	session.Close()
+
+	capability.SftpOnly = execRejected && capability.Sftp
+	return
+}
+
+// runCapabilityProbe run capabilityProbeScript, and return stdout.
+// execRejected is true if exec request is rejected by server, or command is forced to sftp server (ForceCommand internal-sftp).
+// The latter is detected by sending sftp init packet as stdin, which only sftp server answers.
+func (c *Connect) runCapabilityProbe() (output []byte, execRejected bool, err error) {
+	session, err := c.CreateSession()
+	if err != nil {
+		return
+	}
+	defer session.Close()
+
+	init := []byte{0, 0, 0, 5, sshFxpInit, 0, 0, 0, 3}
+	stdout := new(bytes.Buffer)
+	session.Stdin = bytes.NewReader(init)
+	session.Stdout = stdout
+
+	cmd := "sh -c " + shellQuote(capabilityProbeScript)
+	if err = session.Start(cmd); err != nil {
+		// exec request is rejected. (other errors are returned)
+		if err.Error() == fmt.Sprintf("ssh: command %v failed", cmd) {
+			return nil, true, nil
+		}
+		return
+	}
+	session.Wait()
+
+	output = stdout.Bytes()
+	if len(output) >= 5 && output[4] == sshFxpVersion && binary.BigEndian.Uint32(output) <= sftpMaxPacket {
+		return nil, true, nil
+	}
+	return output, false, nil
+}
+
+// checkSftpOnly return true if c.Server is sftp-only account (exec channel is not available).
+func (c *Connect) checkSftpOnly() bool {
+	capability, err := c.GetCapability()
+	return err == nil && capability.SftpOnly
+}
+
+// readCapabilityCache return cached capabilities by server name.
+func readCapabilityCache() (caches map[string]*Capability, err error) {
+	caches = map[string]*Capability{}
+
+	data, err := ioutil.ReadFile(common.GetStatePath(CapabilityCacheFile))
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(data, &caches)
+	return
+}
+
+// writeCapabilityCache write capability of server to cache file.
+func writeCapabilityCache(server string, capability *Capability) (err error) {
+	capabilityCacheMutex.Lock()
+	defer capabilityCacheMutex.Unlock()
+
+	caches, _ := readCapabilityCache()
+	caches[server] = capability
+
+	return saveCapabilityCache(caches)
+}
+
+// saveCapabilityCache write all caches to cache file.
+func saveCapabilityCache(caches map[string]*Capability) (err error) {
+	data, err := json.MarshalIndent(caches, "", "  ")
+	if err != nil {
+		return
+	}
+
+	return ioutil.WriteFile(common.GetStatePath(CapabilityCacheFile), data, 0600)
+}
+
+// ClearCapabilityCache delete cached capabilities of servers.
+// If servers is empty, delete all caches.
+func ClearCapabilityCache(servers []string) (err error) {
+	capabilityCacheMutex.Lock()
+	defer capabilityCacheMutex.Unlock()
+
+	path := common.GetStatePath(CapabilityCacheFile)
+	if len(servers) == 0 {
+		err = os.Remove(path)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	caches, err := readCapabilityCache()
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	for _, server := range servers {
+		delete(caches, server)
+	}
+
+	return saveCapabilityCache(caches)
+}
@@ -0,0 +1,74 @@
+package ssh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// runCapabilityProbe depends on error message of golang.org/x/crypto/ssh at rejected exec request. This test pins it.
+func TestRunCapabilityProbe(t *testing.T) {
+	type TestData struct {
+		desc         string
+		exec         bool   // accept exec request
+		output       []byte // stdout of exec
+		expectOutput []byte
+		expectReject bool
+	}
+	tds := []TestData{
+		{
+			desc:         "Exec request is rejected (sftp-only account)",
+			exec:         false,
+			expectOutput: nil,
+			expectReject: true,
+		},
+		{
+			desc:         "Command is forced to sftp server (ForceCommand internal-sftp)",
+			exec:         true,
+			output:       []byte{0, 0, 0, 5, sshFxpVersion, 0, 0, 0, 3},
+			expectOutput: nil,
+			expectReject: true,
+		},
+		{
+			desc:         "Shell is available",
+			exec:         true,
+			output:       []byte("shell=bash\nbase64=base64\n"),
+			expectOutput: []byte("shell=bash\nbase64=base64\n"),
+			expectReject: false,
+		},
+	}
+
+	for _, v := range tds {
+		v := v
+		s := newTestServer(t, func(ch ssh.Channel, reqs <-chan *ssh.Request) {
+			defer ch.Close()
+			for req := range reqs {
+				if req.Type != "exec" || !v.exec {
+					req.Reply(false, nil)
+					continue
+				}
+
+				req.Reply(true, nil)
+				ch.Write(v.output)
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				return
+			}
+		})
+
+		client, err := dialTestServer(s.Addr(), "pass")
+		if !assert.NoError(t, err, v.desc) {
+			s.Close()
+			continue
+		}
+
+		c := &Connect{Server: "test", Client: client}
+		output, execRejected, err := c.runCapabilityProbe()
+		assert.NoError(t, err, v.desc)
+		assert.Equal(t, v.expectReject, execRejected, v.desc)
+		assert.Equal(t, v.expectOutput, output, v.desc)
+
+		client.Close()
+		s.Close()
+	}
+}
@@ -1,14 +1,12 @@
 package ssh
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"net"
 	"os"
-	"os/signal"
 	"strings"
-	"syscall"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -34,12 +32,18 @@ type Connect struct {
 	sshAgent         agent.Agent
 	sshExtendedAgent agent.ExtendedAgent
 
+	// in-process ssh-agent of run (--run-agent). If set, it is used instead of ssh-agent of ssh_agent setting.
+	runAgent agent.Agent
+
 	// connect login shell flag
 	IsTerm bool
 
 	// parallel connect flag
 	IsParallel bool
 
+	// not print pre-authentication banner of servers (--no-motd)
+	IsNoMotd bool
+
 	// use local bashrc flag
 	IsLocalRc bool
 
@@ -49,15 +53,46 @@ type Connect struct {
 	// local bashrc decode command
 	LocalRcDecodeCmd string
 
+	// shell to run with local rc. bash|zsh|fish
+	LocalRcShell string
+
+	// prompt password (and keyboard-interactive questions), if other authentication methods failed.
+	// set if stdin is terminal, and by `lssh add-key`.
+	IsPasswordPrompt bool
+
 	// port forward setting.`host:port`
 	ForwardLocal  string
 	ForwardRemote string
 
 	// x11 forward setting.
-	X11 bool
+	X11        bool
+	X11Trusted bool // forward with local xauth cookie (`ssh -Y`)
+
+	// run id. exported to remote as LSSH_RUN_ID.
+	RunID string
+
+	// host key of Server, received at connect.
+	HostKey ssh.PublicKey
+
+	// stop connecting to Server after host key is received, without authentication. (audit-hostkeys)
+	HostKeyOnly bool
+
+	// current directory of remote shell, tracked from terminal output (OSC7). used by file transfer of escape sequence.
+	cwd *cwdWriter
+
+	// port forwards added at runtime
+	forwards      *ForwardManager
+	forwardsMutex sync.Mutex
 
 	// AuthMap
 	AuthMap map[AuthKey][]ssh.Signer
+
+	// writer of warnings at connect (ex. retry of connect). If nil, os.Stderr.
+	Stderr io.Writer
+
+	// authentication of server (or proxy) being connected. used to report failed methods.
+	authTrace      *authTrace
+	authTraceMutex sync.Mutex
 }
 
 type Proxy struct {
@@ -73,8 +108,17 @@ func (c *Connect) SendKeepAlive(session *ssh.Session) {
 	}
 }
 
+// stderr return writer of warnings of c.
+func (c *Connect) stderr() io.Writer {
+	if c.Stderr != nil {
+		return c.Stderr
+	}
+	return os.Stderr
+}
+
 // CheckClientAlive Check alive ssh.Client.
 func (c *Connect) CheckClientAlive() error {
+	debugf(3, "%s: send keepalive", c.Server)
 	_, _, err := c.Client.SendRequest("keepalive@lssh.com", true, nil)
 	if err == nil || err.Error() == "request failed" {
 		return nil
@@ -84,9 +128,14 @@ func (c *Connect) CheckClientAlive() error {
 
 // CreateSession return *ssh.Session
 func (c *Connect) CreateSession() (session *ssh.Session, err error) {
+	return c.CreateSessionContext(context.Background())
+}
+
+// CreateSessionContext return *ssh.Session. If client is not connected, connect with ctx.
+func (c *Connect) CreateSessionContext(ctx context.Context) (session *ssh.Session, err error) {
 	// new connect
 	if c.Client == nil {
-		err = c.CreateClient()
+		err = c.CreateClientContext(ctx)
 		if err != nil {
 			return session, err
 		}
@@ -95,13 +144,14 @@ func (c *Connect) CreateSession() (session *ssh.Session, err error) {
 	// Check ssh client alive
 	clientErr := c.CheckClientAlive()
 	if clientErr != nil {
-		err = c.CreateClient()
+		err = c.CreateClientContext(ctx)
 		if err != nil {
 			return session, err
 		}
 	}
 
 	// New session
+	debugf(2, "%s: open session channel", c.Server)
 	session, err = c.Client.NewSession()
 
 	if err != nil {
@@ -113,11 +163,30 @@ func (c *Connect) CreateSession() (session *ssh.Session, err error) {
 
 // CreateClient create ssh.Client and store in Connect.Client
 func (c *Connect) CreateClient() (err error) {
+	return c.CreateClientContext(context.Background())
+}
+
+// CreateClientContext create ssh.Client and store in Connect.Client.
+// If ctx is done while dialing, authenticating or waiting for retry, it return ctx.Err().
+func (c *Connect) CreateClientContext(ctx context.Context) (err error) {
 	// New ClientConfig
 	serverConf := c.Conf.Server[c.Server]
 
+	// use authenticated connection of running lssh (--mux), without authentication
+	if serverConf.MuxSocket != "" {
+		client, err := dialMux(serverConf.MuxSocket, c.Server)
+		if err == nil {
+			debugf(1, "%s: use connection of mux socket %s", c.Server, serverConf.MuxSocket)
+			c.Client = client
+			return nil
+		}
+		debugf(1, "%s: cannot use mux socket %s, %v", c.Server, serverConf.MuxSocket, err)
+	}
+
 	// if use ssh-agent
-	if serverConf.SSHAgentUse || serverConf.AgentAuth {
+	if c.runAgent != nil {
+		c.sshAgent = c.runAgent
+	} else if serverConf.SSHAgentUse || serverConf.AgentAuth {
 		err := c.CreateSshAgent()
 		if err != nil {
 			return err
@@ -134,98 +203,255 @@ func (c *Connect) CreateClient() (err error) {
 		serverConf.Port = "22"
 	}
 
-	// not use proxy
-	if serverConf.Proxy == "" && serverConf.ProxyCommand == "" {
-		client, err := ssh.Dial("tcp", net.JoinHostPort(serverConf.Addr, serverConf.Port), sshConf)
-		if err != nil {
+	// refuse, if recent authentication failures reach limit (avoid account lockout)
+	if !c.HostKeyOnly {
+		if err = c.checkAuthFailures(serverConf); err != nil {
 			return err
 		}
+	}
 
-		// set client
-		c.Client = client
-	} else {
-		err := c.createClientOverProxy(serverConf, sshConf)
+	// retry backoff (default 1 sec)
+	backoff := time.Duration(serverConf.RetryBackoff) * time.Second
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	for retry := 0; ; retry++ {
+		debugf(1, "%s: connecting to %s port %s", c.Server, serverConf.Addr, serverConf.Port)
+		err = c.dialClient(ctx, serverConf, sshConf)
+		if err != nil && c.HostKeyOnly && c.HostKey != nil {
+			// stopped by recordHostKey, before authentication
+			return nil
+		}
 		if err != nil {
-			return err
+			debugf(1, "%s: connect failed: %v", c.Server, err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil || retry >= serverConf.ConnectRetries || isAuthError(err) {
+			// authentication failure of proxy is recorded to proxy
+			authConf := serverConf
+			if trace := c.lastAuthTrace(); trace != nil && err != nil && isAuthError(err) {
+				authConf = c.Conf.Server[trace.server]
+			}
+			c.recordAuthResult(authConf, err)
+			break
+		}
+
+		fmt.Fprintf(c.stderr(), "%s: connect failed, retry after %v (%d/%d). %v\n", c.Server, backoff, retry+1, serverConf.ConnectRetries, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
 		}
+		backoff *= 2
 	}
+	if err != nil {
+		// report failed methods of server (or proxy) that refused authentication
+		if trace := c.lastAuthTrace(); trace != nil && isAuthError(err) {
+			rejectPassword(trace)
+			err = trace.err()
+		}
+		return err
+	}
+
+	debugf(1, "%s: connection established. remote version: %s", c.Server, c.Client.ServerVersion())
 
 	c.X11 = serverConf.X11
+	c.X11Trusted = serverConf.X11Trusted
 
 	return err
 }
 
-// createClientOverProxy create over multiple proxy ssh.Client, and store in Connect.Client
-func (c *Connect) createClientOverProxy(serverConf conf.ServerConfig, sshConf *ssh.ClientConfig) (err error) {
+// dialClient connect to server (directly or over proxy), and store in Connect.Client
+func (c *Connect) dialClient(ctx context.Context, serverConf conf.ServerConfig, sshConf *ssh.ClientConfig) (err error) {
+	var client *ssh.Client
+
+	// use proxy
+	if serverConf.Proxy != "" || serverConf.ProxyCommand != "" || serverConf.Transport != "" {
+		client, err = c.createClientOverProxyContext(ctx, serverConf, sshConf)
+	} else {
+		client, err = dialSsh(ctx, serverConf, sshConf)
+	}
+	if err != nil {
+		return err
+	}
+
+	// set client
+	c.Client = client
+	return
+}
+
+// createClientOverProxyContext run createClientOverProxy, and return ctx.Err() as soon as ctx is done.
+// Proxy hops are not cancelable, so client connected after that is closed.
+func (c *Connect) createClientOverProxyContext(ctx context.Context, serverConf conf.ServerConfig, sshConf *ssh.ClientConfig) (*ssh.Client, error) {
+	type result struct {
+		client *ssh.Client
+		err    error
+	}
+
+	connected := make(chan result, 1)
+	go func() {
+		client, err := c.createClientOverProxy(serverConf, sshConf)
+		connected <- result{client, err}
+	}()
+
+	select {
+	case res := <-connected:
+		return res.client, res.err
+	case <-ctx.Done():
+		go func() {
+			if res := <-connected; res.client != nil {
+				res.client.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// isAuthError return true if err is authentication failure. (not retry)
+func isAuthError(err error) bool {
+	return strings.Contains(err.Error(), "unable to authenticate")
+}
+
+// createClientOverProxy create over multiple proxy ssh.Client, and return it.
+func (c *Connect) createClientOverProxy(serverConf conf.ServerConfig, sshConf *ssh.ClientConfig) (client *ssh.Client, err error) {
 	// get proxy slice
 	proxyList, proxyType, err := GetProxyList(c.Server, c.Conf)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// var
 	var proxyClient *ssh.Client
 	var proxyDialer proxy.Dialer
 
-	for _, proxy := range proxyList {
+	debugf(1, "%s: proxy chain: %s", c.Server, strings.Join(append(proxyList, c.Server), " => "))
+	for i, proxy := range proxyList {
+		debugf(1, "%s: proxy hop %d: %s (%s)", c.Server, i+1, proxy, proxyType[proxy])
+
 		switch proxyType[proxy] {
 		case "http", "https":
 			proxyConf := c.Conf.Proxy[proxy]
-			proxyDialer, err = createProxyDialerHttp(proxyConf)
+			proxyDialer, err = createProxyDialerHttp(proxyConf, proxyType[proxy] == "https")
 
 		case "socks5":
 			proxyConf := c.Conf.Proxy[proxy]
 			proxyDialer, err = createProxyDialerSocks5(proxyConf)
 
 		default:
+			var proxySshConf *ssh.ClientConfig
 			proxyConf := c.Conf.Server[proxy]
-			proxySshConf, err := c.createClientConfig(proxy)
+			proxySshConf, err = c.createClientConfig(proxy)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			proxyClient, err = createClientViaProxy(proxyConf, proxySshConf, proxyClient, proxyDialer)
 
 		}
 
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	client, err := createClientViaProxy(serverConf, sshConf, proxyClient, proxyDialer)
-	if err != nil {
-		return err
-	}
-
-	// set c.client
-	c.Client = client
-
-	return
+	return createClientViaProxy(serverConf, sshConf, proxyClient, proxyDialer)
 }
 
 // createClientConfig return *ssh.ClientConfig
 func (c *Connect) createClientConfig(server string) (clientConfig *ssh.ClientConfig, err error) {
 	conf := c.Conf.Server[server]
 
-	auth, err := c.createSshAuth(server)
+	auth, trace, err := c.createSshAuth(server)
 	if err != nil {
 		if len(auth) == 0 {
 			return clientConfig, err
 		}
 	}
 
+	// connect timeout (default 30 sec)
+	timeout := time.Duration(conf.ConnectTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
 	// create ssh ClientConfig
 	clientConfig = &ssh.ClientConfig{
 		User:            conf.User,
 		Auth:            auth,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         30 * time.Second,
+		HostKeyCallback: c.traceAuth(trace, debugHostKeyCallback(server, c.recordHostKey(server))),
+		BannerCallback:  c.bannerCallback(server),
+		Timeout:         timeout,
 	}
+
+	// set algorithms
+	defaults := ssh.Config{}
+	defaults.SetDefaults()
+	clientConfig.Ciphers = algorithmList(defaults.Ciphers, conf.Ciphers)
+	clientConfig.KeyExchanges = algorithmList(defaults.KeyExchanges, conf.KexAlgorithms)
+	clientConfig.MACs = algorithmList(defaults.MACs, conf.MACs)
+	clientConfig.HostKeyAlgorithms = algorithmList(defaultHostKeyAlgorithms, conf.HostKeyAlgorithms)
+
+	// compression is passed to local ssh at system ssh mode (`ssh -C`).
+	// Like ssh to server without compression, the built-in client connects without it.
+	if conf.Compress {
+		debugf(1, "%s: compression is not supported by the built-in client, connect without compression", server)
+	}
+
+	debugf(3, "%s: offered ciphers: %v", server, clientConfig.Ciphers)
+	debugf(3, "%s: offered kex algorithms: %v", server, clientConfig.KeyExchanges)
+	debugf(3, "%s: offered macs: %v", server, clientConfig.MACs)
+	debugf(3, "%s: offered host key algorithms: %v", server, clientConfig.HostKeyAlgorithms)
+
 	return clientConfig, err
 }
 
+// defaultHostKeyAlgorithms is default host key algorithms of golang.org/x/crypto/ssh.
+var defaultHostKeyAlgorithms = []string{
+	ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01, ssh.CertAlgoECDSA256v01,
+	ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01, ssh.CertAlgoED25519v01,
+	ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+	ssh.KeyAlgoED25519,
+}
+
+// algorithmList return algorithms from config value.
+// If list is empty, return nil (use default). If the first value starts with `+`, append list to defaults.
+func algorithmList(defaults, list []string) []string {
+	if len(list) == 0 {
+		return nil
+	}
+
+	if !strings.HasPrefix(list[0], "+") {
+		return list
+	}
+
+	result := append([]string{}, defaults...)
+	exist := map[string]bool{}
+	for _, algo := range result {
+		exist[algo] = true
+	}
+
+	for _, algo := range list {
+		algo = strings.TrimPrefix(algo, "+")
+		if !exist[algo] {
+			result = append(result, algo)
+			exist[algo] = true
+		}
+	}
+
+	return result
+}
+
 // RunCmd execute command via ssh from specified session.
 func (c *Connect) RunCmd(session *ssh.Session, command []string) (err error) {
+	return c.RunCmdContext(context.Background(), session, command)
+}
+
+// RunCmdContext execute command via ssh from specified session.
+// If ctx is done before command exit, command is terminated (session is closed) and return ctx.Err().
+func (c *Connect) RunCmdContext(ctx context.Context, session *ssh.Session, command []string) (err error) {
 	defer session.Close()
 
 	// set TerminalModes
@@ -233,70 +459,73 @@ func (c *Connect) RunCmd(session *ssh.Session, command []string) (err error) {
 		return
 	}
 
-	// join command
-	execCmd := strings.Join(command, " ")
+	// join command, and wrap with remote_shell.
+	// if sshd not accept LSSH_RUN_ID (AcceptEnv), export it in command.
+	execCmd := c.remoteCmd(strings.Join(command, " "), !c.setRunIDEnv(session))
 
 	// run command
-	isExit := make(chan bool)
+	return runSessionContext(ctx, session, execCmd)
+}
+
+// runSessionContext run cmd at session, and wait for exit.
+// If ctx is done before exit, cmd is terminated (session is closed) and return ctx.Err().
+func runSessionContext(ctx context.Context, session *ssh.Session, cmd string) (err error) {
+	isExit := make(chan error, 1)
 	go func() {
-		err = session.Run(execCmd)
-		isExit <- true
+		isExit <- session.Run(cmd)
 	}()
 
-	// check command exit
-CheckCommandExit:
-	for {
-		// time.Sleep(100 * time.Millisecond)
-		select {
-		case <-isExit:
-			break CheckCommandExit
-		case <-time.After(10 * time.Millisecond):
-			continue CheckCommandExit
-		}
+	select {
+	case err = <-isExit:
+	case <-ctx.Done():
+		session.Signal(ssh.SIGTERM)
+		session.Close()
+		<-isExit
+		err = ctx.Err()
 	}
 
 	return
 }
 
 // RunCmdWithOutput execute a command via ssh from the specified session and send its output to outputchan.
-func (c *Connect) RunCmdWithOutput(session *ssh.Session, command []string, outputChan chan []byte) {
-	outputBuf := new(bytes.Buffer)
-	session.Stdout = io.MultiWriter(outputBuf)
-	session.Stderr = io.MultiWriter(outputBuf)
+// It returns error of command (*ssh.ExitError, if command exit with non-zero status).
+func (c *Connect) RunCmdWithOutput(session *ssh.Session, command []string, outputChan chan []byte) (err error) {
+	return c.RunCmdWithOutputContext(context.Background(), session, command, outputChan)
+}
 
-	// run command
-	isExit := make(chan bool)
+// RunCmdWithOutputContext execute a command via ssh from the specified session and send its output to outputchan line by line.
+// Stdout and stderr are streamed through a pipe, so that writes of session wait until lines are sent (backpressure).
+// Incomplete line is sent after outputFlushDelay (ex. prompt). If ctx is done before command exit, command is terminated and return ctx.Err().
+func (c *Connect) RunCmdWithOutputContext(ctx context.Context, session *ssh.Session, command []string, outputChan chan []byte) (err error) {
+	pr, pw := io.Pipe()
+
+	// send output line by line (and incomplete line after a while), until pipe is closed.
+	sent := make(chan bool)
 	go func() {
-		c.RunCmd(session, command)
-		isExit <- true
+		defer close(sent)
+		sendOutputLines(pr, outputChan)
 	}()
 
-GetOutputLoop:
-	for {
-		if outputBuf.Len() > 0 {
-			line, _ := outputBuf.ReadBytes('\n')
-			outputChan <- line
-		} else {
-			select {
-			case <-isExit:
-				break GetOutputLoop
-			case <-time.After(10 * time.Millisecond):
-				continue GetOutputLoop
-			}
-		}
+	// convert remote encoding (remote_encoding) to UTF-8
+	enc, encErr := getRemoteEncoding(c.Conf.Server[c.Server].RemoteEncoding)
+	if encErr != nil {
+		fmt.Fprintf(c.stderr(), "%s: %v\n", c.Server, encErr)
 	}
+	stdout := newDecodeWriter(pw, enc)
+	stderr := newDecodeWriter(pw, enc)
+	session.Stdout = stdout
+	session.Stderr = stderr
 
-	// last check
-	if outputBuf.Len() > 0 {
-		for {
-			line, err := outputBuf.ReadBytes('\n')
-			if err != io.EOF {
-				outputChan <- line
-			} else {
-				break
-			}
-		}
-	}
+	// session is closed at return, so nothing is written after that.
+	err = c.RunCmdContext(ctx, session, command)
+
+	// flush incomplete multibyte sequence, and wait for last line
+	closeDecodeWriter(stdout)
+	closeDecodeWriter(stderr)
+	pw.Close()
+	<-sent
+
+	return
 }
 
 // ConTerm connect to a shell using a terminal.
@@ -309,6 +538,10 @@ func (c *Connect) ConTerm(session *ssh.Session) (err error) {
 	}
 	defer terminal.Restore(fd, state)
 
+	// enable VT sequence processing (Windows console)
+	restoreVT := enableVirtualTerminal()
+	defer restoreVT()
+
 	// get terminal size
 	width, height, err := terminal.GetSize(fd)
 	if err != nil {
@@ -321,39 +554,27 @@ func (c *Connect) ConTerm(session *ssh.Session) (err error) {
 		ssh.TTY_OP_OSPEED: 14400,
 	}
 
-	term := os.Getenv("TERM")
-	err = session.RequestPty(term, height, width, modes)
+	err = session.RequestPty(termType(), height, width, modes)
 	if err != nil {
 		return
 	}
 
-	// start shell
-	if c.IsLocalRc {
-		session, err = c.runLocalRcShell(session)
-		if err != nil {
-			return
-		}
+	// run id (ignore, if sshd not accept it)
+	c.setRunIDEnv(session)
+
+	// start shell (with local rc, chdir and initial_cmd)
+	if cmd := c.termCmd(); cmd != "" {
+		err = session.Start(cmd)
 	} else {
 		err = session.Shell()
-		if err != nil {
-			return
-		}
+	}
+	if err != nil {
+		return
 	}
 
 	// Terminal resize
-	signal_chan := make(chan os.Signal, 1)
-	signal.Notify(signal_chan, syscall.SIGWINCH)
-	go func() {
-		for {
-			s := <-signal_chan
-			switch s {
-			case syscall.SIGWINCH:
-				fd := int(os.Stdout.Fd())
-				width, height, _ = terminal.GetSize(fd)
-				session.WindowChange(height, width)
-			}
-		}
-	}()
+	stopResize := watchTermResize(session)
+	defer stopResize()
 
 	// keep alive packet
 	go c.SendKeepAlive(session)
@@ -366,6 +587,28 @@ func (c *Connect) ConTerm(session *ssh.Session) (err error) {
 	return
 }
 
+// termType return terminal type to request pty. ($TERM, or xterm-256color if not set, ex. Windows console)
+func termType() string {
+	if term := os.Getenv("TERM"); term != "" {
+		return term
+	}
+	return "xterm-256color"
+}
+
+// setRunIDEnv send LSSH_RUN_ID to session with env request.
+// It returns false, if sshd rejected it. (not in AcceptEnv)
+func (c *Connect) setRunIDEnv(session *ssh.Session) bool {
+	if c.RunID == "" {
+		return true
+	}
+
+	if err := session.Setenv("LSSH_RUN_ID", c.RunID); err != nil {
+		debugf(2, "%s: env LSSH_RUN_ID is rejected: %v", c.Server, err)
+		return false
+	}
+	return true
+}
+
 // setIsTerm Enable tty(pesudo) when executing command over ssh.
 func (c *Connect) setIsTerm(preSession *ssh.Session) (session *ssh.Session, err error) {
 	if c.IsTerm {
@@ -452,20 +695,3 @@ func GetProxyList(server string, config conf.Config) (proxyList []string, proxyT
 
 	return
 }
-
-// runLocalRcShell connect to remote shell using local bashrc
-func (c *Connect) runLocalRcShell(preSession *ssh.Session) (session *ssh.Session, err error) {
-	session = preSession
-
-	// command
-	cmd := fmt.Sprintf("bash --rcfile <(echo %s|((base64 --help | grep -q coreutils) && base64 -d <(cat) || base64 -D <(cat) ))", c.LocalRcData)
-
-	// decode command
-	if len(c.LocalRcDecodeCmd) > 0 {
-		cmd = fmt.Sprintf("bash --rcfile <(echo %s | %s)", c.LocalRcData, c.LocalRcDecodeCmd)
-	}
-
-	err = session.Start(cmd)
-
-	return session, err
-}
@@ -1,103 +1,354 @@
 package ssh
 
 import (
+	"bufio"
 	"fmt"
 	"net"
 	"os"
+	"strings"
+	"sync"
 
+	"github.com/blacknon/lssh/common"
 	"golang.org/x/crypto/ssh"
 )
 
-// createSshAuth return the necessary ssh.AuthMethod from AuthMap and ssh-agent.
-func (c *Connect) createSshAuth(server string) (auth []ssh.AuthMethod, err error) {
+// PASSWORD_PROMPT_TRIES is number of password prompts, if other authentication methods failed.
+const PASSWORD_PROMPT_TRIES = 3
+
+// passwordPromptMutex serialize password prompts of parallel connections, and guard promptedPasswords.
+var passwordPromptMutex sync.Mutex
+
+// promptedPasswords is passwords prompted for each server (or proxy), reused for the process lifetime.
+// So a proxy shared by servers is prompted once. One-time passwords (ex. verification code) are not cached.
+var promptedPasswords = map[string]string{}
+
+// createSshAuth return the necessary ssh.AuthMethod from AuthMap and ssh-agent, and authTrace to report failures.
+//
+// golang.org/x/crypto/ssh does not try the same method again after it failed, so credentials are combined into one method per type,
+// and tried in order of publickey (key, cert, ssh-agent, pkcs11), keyboard-interactive and password.
+// Passwords are tried in keyboard-interactive and password without duplicate, and prompted if IsPasswordPrompt.
+// If server is proxy of c.Server, prompts are labeled with both names.
+func (c *Connect) createSshAuth(server string) (auth []ssh.AuthMethod, trace *authTrace, err error) {
 	conf := c.Conf.Server[server]
+	trace = &authTrace{server: server}
+	if server != c.Server {
+		trace.proxyOf = c.Server
+	}
 
-	// public key (single)
-	if conf.Key != "" {
-		authKey := AuthKey{AUTHKEY_KEY, conf.Key}
-		if _, ok := c.AuthMap[authKey]; ok {
-			for _, signer := range c.AuthMap[authKey] {
-				if signer != nil {
-					authMethod := ssh.PublicKeys(signer)
-					auth = append(auth, authMethod)
-				}
-			}
-		}
+	// ephemeral key of this run (use it only)
+	if signers, ok := c.AuthMap[AuthKey{AUTHKEY_EPHEMERAL, server}]; ok {
+		debugf(1, "%s: authenticate with ephemeral key", server)
+		trace.add(AUTH_METHOD_PUBLICKEY, "ephemeral key")
+		trace.use(AUTH_METHOD_PUBLICKEY)
+		return []ssh.AuthMethod{c.publicKeysAuth(server, trace, signers)}, trace, nil
 	}
 
-	// public key (multiple)
-	if len(conf.Keys) > 0 {
-		for _, key := range conf.Keys {
-			authKey := AuthKey{AUTHKEY_KEY, key}
-			if _, ok := c.AuthMap[authKey]; ok {
-				for _, signer := range c.AuthMap[authKey] {
-					if signer != nil {
-						authMethod := ssh.PublicKeys(signer)
-						auth = append(auth, authMethod)
-					}
-				}
+	var signers []ssh.Signer
+	added := map[AuthKey]bool{}
+	addSigners := func(authKey AuthKey, offered string) {
+		if added[authKey] {
+			return
+		}
+		added[authKey] = true
+
+		for _, signer := range c.AuthMap[authKey] {
+			if signer != nil {
+				signers = append(signers, signer)
+				trace.add(AUTH_METHOD_PUBLICKEY, offered)
 			}
 		}
 	}
 
+	// public key (single)
+	if conf.Key != "" {
+		addSigners(AuthKey{AUTHKEY_KEY, conf.Key}, conf.Key)
+	}
+
+	// public key (multiple). "keypath::passphase"
+	for _, key := range conf.Keys {
+		keyPath := strings.SplitN(key, "::", 2)[0]
+		addSigners(AuthKey{AUTHKEY_KEY, keyPath}, keyPath)
+	}
+
 	// cert
 	if conf.Cert != "" {
-		authKey := AuthKey{AUTHKEY_CERT, conf.Cert}
-		if _, ok := c.AuthMap[authKey]; ok {
-			for _, signer := range c.AuthMap[authKey] {
-				if signer != nil {
-					authMethod := ssh.PublicKeys(signer)
-					auth = append(auth, authMethod)
-				}
+		addSigners(AuthKey{AUTHKEY_CERT, conf.Cert}, conf.Cert)
+	}
+
+	// ssh agent (keys of run agent are used for all servers). keys already added are not offered again.
+	if sshAgent := c.agentOf(server); sshAgent != nil && (conf.AgentAuth || c.runAgent != nil) {
+		agentSigners, err := sshAgent.Signers()
+
+		offered := map[string]bool{}
+		for _, signer := range signers {
+			offered[string(signer.PublicKey().Marshal())] = true
+		}
+		count := 0
+		for _, signer := range agentSigners {
+			if !offered[string(signer.PublicKey().Marshal())] {
+				signers = append(signers, signer)
+				count++
 			}
 		}
+
+		switch {
+		case err != nil:
+			fmt.Fprintf(c.stderr(), "%s's create sshAgent ssh.AuthMethod err: %s\n", server, err)
+		case len(agentSigners) == 0:
+			trace.add(AUTH_METHOD_PUBLICKEY, "ssh-agent(no keys)")
+		case count > 0:
+			trace.add(AUTH_METHOD_PUBLICKEY, fmt.Sprintf("ssh-agent(%d keys)", count))
+		}
+	}
+
+	// pkcs11
+	if conf.PKCS11Use {
+		// @TODO: confのチェック時にPKCS11のProviderのPATHチェックを行う
+		addSigners(AuthKey{AUTHKEY_PKCS11, conf.PKCS11Provider}, "pkcs11")
+	}
+
+	if len(signers) > 0 {
+		trace.use(AUTH_METHOD_PUBLICKEY)
+		auth = append(auth, c.publicKeysAuth(server, trace, signers))
 	}
 
-	// ssh password (single)
+	// ssh password (single and multiple), and password prompt (if other methods failed)
+	var passwords []string
 	if conf.Pass != "" {
-		auth = append(auth, ssh.Password(conf.Pass))
+		passwords = append(passwords, conf.Pass)
 	}
+	passwords = append(passwords, conf.Passes...)
 
-	// ssh password (multiple)
-	if len(conf.Passes) > 0 {
-		for _, pass := range conf.Passes {
-			auth = append(auth, ssh.Password(pass))
-		}
+	passwordPromptMutex.Lock()
+	_, isCached := promptedPasswords[server]
+	passwordPromptMutex.Unlock()
+
+	if len(passwords) > 0 || c.IsPasswordPrompt || isCached {
+		trace.passwords = passwords
+		trace.use(AUTH_METHOD_KEYBOARD_INTERACTIVE)
+		trace.use(AUTH_METHOD_PASSWORD)
+		auth = append(auth, c.keyboardInteractiveAuth(server, trace), c.passwordAuth(server, trace))
 	}
 
-	// ssh agent
-	if conf.AgentAuth {
-		var signers []ssh.Signer
-		_, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
-		if err != nil {
-			signers, err = c.sshAgent.Signers()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "%s's create sshAgent ssh.AuthMethod err: %s\n", server, err)
-			} else {
-				auth = append(auth, ssh.PublicKeys(signers...))
+	debugf(1, "%s: %d authentication methods (key: %v, cert: %v, password: %v, agent: %v, pkcs11: %v, prompt: %v)",
+		server, len(auth), conf.Key != "" || len(conf.Keys) > 0, conf.Cert != "", len(passwords) > 0, conf.AgentAuth, conf.PKCS11Use, c.IsPasswordPrompt)
+
+	return auth, trace, err
+}
+
+// publicKeysAuth return ssh.AuthMethod of signers, that logs offered public keys.
+func (c *Connect) publicKeysAuth(server string, trace *authTrace, signers []ssh.Signer) ssh.AuthMethod {
+	return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		trace.attempt(AUTH_METHOD_PUBLICKEY)
+		for _, signer := range signers {
+			pub := signer.PublicKey()
+			debugf(2, "%s: offering public key: %s %s", server, pub.Type(), ssh.FingerprintSHA256(pub))
+		}
+		return signers, nil
+	})
+}
+
+// keyboardInteractiveAuth return ssh.AuthMethod of keyboard-interactive.
+// Password questions are answered with passwords of config and prompted password of cache, then prompted if IsPasswordPrompt.
+func (c *Connect) keyboardInteractiveAuth(server string, trace *authTrace) ssh.AuthMethod {
+	tries := c.passwordTries(trace)
+
+	return ssh.RetryableAuthMethod(ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		if len(questions) == 0 {
+			return answers, nil
+		}
+
+		trace.attempt(AUTH_METHOD_KEYBOARD_INTERACTIVE)
+		isPassword := isPasswordQuestion(questions, echos)
+		if isPassword {
+			// password is asked again, so password tried last is wrong
+			rejectPassword(trace)
+
+			if pass, ok := trace.nextPassword(); ok {
+				debugf(2, "%s: trying keyboard-interactive authentication", server)
+				fillPassword(answers, echos, pass)
+				return answers, nil
+			}
+		}
+
+		passwordPromptMutex.Lock()
+		defer passwordPromptMutex.Unlock()
+
+		if isPassword {
+			if pass, ok := cachedPassword(trace); ok {
+				debugf(2, "%s: trying keyboard-interactive authentication (prompted before)", server)
+				fillPassword(answers, echos, pass)
+				return answers, nil
 			}
-		} else {
-			signers, err = c.sshExtendedAgent.Signers()
+		}
+		if !c.IsPasswordPrompt {
+			return answers, nil
+		}
+
+		// prompt questions of server (ex. password, verification code)
+		c.printAuthFailures(trace)
+		debugf(2, "%s: trying keyboard-interactive authentication (prompt)", server)
+		if instruction != "" {
+			fmt.Fprintln(os.Stderr, instruction)
+		}
+		for i, question := range questions {
+			answer, err := promptAnswer(fmt.Sprintf("(%s) %s", trace.label(), question), echos[i])
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "%s's create sshAgent ssh.AuthMethod err: %s\n", server, err)
-			} else {
-				auth = append(auth, ssh.PublicKeys(signers...))
+				return nil, err
 			}
+			answers[i] = answer
+
+			if isPasswordQuestion(questions[i:i+1], echos[i:i+1]) {
+				cachePassword(trace, answer)
+			}
+		}
+		trace.prompt(AUTH_METHOD_KEYBOARD_INTERACTIVE)
+		return answers, nil
+	}), tries)
+}
+
+// passwordAuth return ssh.AuthMethod of password. Passwords of config not tried in keyboard-interactive and prompted password of cache are tried,
+// then password is prompted if IsPasswordPrompt and it is not prompted in keyboard-interactive.
+func (c *Connect) passwordAuth(server string, trace *authTrace) ssh.AuthMethod {
+	conf := c.Conf.Server[server]
+	tries := c.passwordTries(trace)
+
+	return ssh.RetryableAuthMethod(ssh.PasswordCallback(func() (string, error) {
+		trace.attempt(AUTH_METHOD_PASSWORD)
+		rejectPassword(trace)
+		if pass, ok := trace.nextPassword(); ok {
+			debugf(2, "%s: trying password authentication", server)
+			return pass, nil
+		}
+
+		passwordPromptMutex.Lock()
+		defer passwordPromptMutex.Unlock()
+
+		if pass, ok := cachedPassword(trace); ok {
+			debugf(2, "%s: trying password authentication (prompted before)", server)
+			return pass, nil
+		}
+
+		// no more password to try (already prompted in keyboard-interactive). stop authentication with failures.
+		if !c.IsPasswordPrompt || trace.promptsOf(AUTH_METHOD_KEYBOARD_INTERACTIVE) > 0 {
+			trace.skip(AUTH_METHOD_PASSWORD)
+			return "", trace.err()
+		}
+
+		c.printAuthFailures(trace)
+		debugf(2, "%s: trying password authentication (prompt)", server)
+		pass, err := common.GetPassPhase(fmt.Sprintf("%s@%s's password (%s): ", conf.User, conf.Addr, trace.label()))
+		trace.prompt(AUTH_METHOD_PASSWORD)
+		if err == nil {
+			cachePassword(trace, pass)
 		}
+		return pass, err
+	}), tries)
+}
+
+// passwordTries return number of tries of keyboard-interactive and password.
+func (c *Connect) passwordTries(trace *authTrace) int {
+	tries := len(trace.passwords)
+	if c.IsPasswordPrompt {
+		tries += PASSWORD_PROMPT_TRIES
 	}
 
-	if conf.PKCS11Use {
-		// @TODO: confのチェック時にPKCS11のProviderのPATHチェックを行う
-		authKey := AuthKey{AUTHKEY_PKCS11, conf.PKCS11Provider}
-		if _, ok := c.AuthMap[authKey]; ok {
-			for _, signer := range c.AuthMap[authKey] {
-				if signer != nil {
-					authMethod := ssh.PublicKeys(signer)
-					auth = append(auth, authMethod)
-				}
-			}
+	passwordPromptMutex.Lock()
+	defer passwordPromptMutex.Unlock()
+	if _, ok := promptedPasswords[trace.server]; ok {
+		tries++
+	}
+	return tries
+}
+
+// cachedPassword return password prompted for server of trace before, if it is not tried yet. passwordPromptMutex must be locked.
+func cachedPassword(trace *authTrace) (string, bool) {
+	pass, ok := promptedPasswords[trace.server]
+	if !ok || !trace.useCache() {
+		return "", false
+	}
+	trace.setPending(pass)
+	return pass, true
+}
+
+// cachePassword store prompted password of server of trace. passwordPromptMutex must be locked.
+func cachePassword(trace *authTrace, pass string) {
+	promptedPasswords[trace.server] = pass
+	trace.setPending(pass)
+}
+
+// rejectPassword remove prompted (or cached) password tried last from cache, because authentication with it failed.
+func rejectPassword(trace *authTrace) {
+	pass := trace.takePending()
+	if pass == "" {
+		return
+	}
+
+	passwordPromptMutex.Lock()
+	defer passwordPromptMutex.Unlock()
+
+	if cached, ok := promptedPasswords[trace.server]; ok && cached == pass {
+		delete(promptedPasswords, trace.server)
+	}
+}
+
+// fillPassword set pass to answers of hidden questions.
+func fillPassword(answers []string, echos []bool, pass string) {
+	for i := range answers {
+		if !echos[i] {
+			answers[i] = pass
+		}
+	}
+}
+
+// traceAuth wrap callback, and set trace as authentication being run. (host key is verified before authentication)
+func (c *Connect) traceAuth(trace *authTrace, callback ssh.HostKeyCallback) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		c.authTraceMutex.Lock()
+		c.authTrace = trace
+		c.authTraceMutex.Unlock()
+		return callback(hostname, remote, key)
+	}
+}
+
+// lastAuthTrace return trace of last authentication run.
+func (c *Connect) lastAuthTrace() *authTrace {
+	c.authTraceMutex.Lock()
+	defer c.authTraceMutex.Unlock()
+	return c.authTrace
+}
+
+// printAuthFailures print failed methods of trace before first prompt.
+func (c *Connect) printAuthFailures(trace *authTrace) {
+	if failures := trace.String(); failures != "" && trace.prompts() == 0 {
+		fmt.Fprintf(c.stderr(), "%s: authentication failed (%s)\n", trace.label(), failures)
+	}
+}
+
+// isPasswordQuestion return true if questions of keyboard-interactive ask password. (ex. `Password: `)
+func isPasswordQuestion(questions []string, echos []bool) bool {
+	for i, question := range questions {
+		if !echos[i] && strings.Contains(strings.ToLower(question), "password") {
+			return true
 		}
 	}
+	return false
+}
+
+// promptAnswer read answer of question from terminal. If echo, input is shown.
+func promptAnswer(question string, echo bool) (string, error) {
+	if !echo {
+		return common.GetPassPhase(question)
+	}
+
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return "", err
+	}
+	defer tty.Close()
 
-	return auth, err
+	fmt.Print(question)
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	return strings.TrimRight(answer, "\r\n"), err
 }
@@ -0,0 +1,149 @@
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+)
+
+// AuthFailureFile is name of file of recent authentication failures per account, in state directory. (`user@addr:port` => failure times)
+var AuthFailureFile = "auth_failures.json"
+
+// IgnoreAuthFailures connect even if recent authentication failures reach limit. (--force-auth)
+var IgnoreAuthFailures = false
+
+// default authentication failure protection setting
+const (
+	defaultAuthFailureLimit  = 3
+	defaultAuthFailureWindow = 600 // seconds
+)
+
+// authFailureMutex serialize read and write of AuthFailureFile at parallel connect.
+var authFailureMutex sync.Mutex
+
+// authFailureAccount return key of account in AuthFailureFile. ex) `admin@192.168.0.10:22`
+func authFailureAccount(serverConf conf.ServerConfig) string {
+	return serverConf.User + "@" + serverConf.Addr + ":" + serverConf.Port
+}
+
+// authFailurePolicy return limit and window of serverConf. If limit is 0, protection is disabled.
+func authFailurePolicy(serverConf conf.ServerConfig) (limit int, window time.Duration) {
+	limit = serverConf.AuthFailureLimit
+	switch {
+	case limit == 0:
+		limit = defaultAuthFailureLimit
+	case limit < 0:
+		limit = 0
+	}
+
+	window = time.Duration(serverConf.AuthFailureWindow) * time.Second
+	if window <= 0 {
+		window = defaultAuthFailureWindow * time.Second
+	}
+	return
+}
+
+// readAuthFailures return failures in AuthFailureFile, that are in window.
+func readAuthFailures(window time.Duration) (failures map[string][]time.Time) {
+	failures = map[string][]time.Time{}
+
+	data, err := ioutil.ReadFile(common.GetStatePath(AuthFailureFile))
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, &failures)
+
+	since := time.Now().Add(-window)
+	for account, times := range failures {
+		recent := []time.Time{}
+		for _, t := range times {
+			if t.After(since) {
+				recent = append(recent, t)
+			}
+		}
+
+		if len(recent) == 0 {
+			delete(failures, account)
+			continue
+		}
+		failures[account] = recent
+	}
+	return
+}
+
+// writeAuthFailures write failures to AuthFailureFile.
+func writeAuthFailures(failures map[string][]time.Time) (err error) {
+	data, err := json.Marshal(failures)
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(common.GetStatePath(AuthFailureFile), data, 0600)
+}
+
+// checkAuthFailures return error, if recent authentication failures to the account of serverConf reach limit.
+// It is not to be locked out by fail2ban or pam_tally (pam_faillock) with repeated connections.
+func (c *Connect) checkAuthFailures(serverConf conf.ServerConfig) error {
+	limit, window := authFailurePolicy(serverConf)
+	if limit == 0 || IgnoreAuthFailures {
+		return nil
+	}
+
+	authFailureMutex.Lock()
+	defer authFailureMutex.Unlock()
+
+	times := readAuthFailures(window)[authFailureAccount(serverConf)]
+	if len(times) < limit {
+		return nil
+	}
+
+	retry := times[len(times)-limit].Add(window).Sub(time.Now()).Round(time.Second)
+	return fmt.Errorf("%d authentication failures to %s in last %v, not connect to avoid account lockout. retry after %v, or use --force-auth",
+		len(times), authFailureAccount(serverConf), window, retry)
+}
+
+// recordAuthResult record authentication failure of serverConf account, or clear failures if authentication succeeded.
+// If failures is about to reach limit, print warning.
+func (c *Connect) recordAuthResult(serverConf conf.ServerConfig, err error) {
+	if err != nil && isAuthError(err) {
+		metrics.add("lssh_auth_failures_total", 1, "server", c.Server)
+	}
+
+	limit, window := authFailurePolicy(serverConf)
+	if limit == 0 {
+		return
+	}
+
+	authFailureMutex.Lock()
+	defer authFailureMutex.Unlock()
+
+	account := authFailureAccount(serverConf)
+	failures := readAuthFailures(window)
+
+	switch {
+	case err == nil:
+		if _, ok := failures[account]; !ok {
+			return
+		}
+		delete(failures, account)
+
+	case isAuthError(err):
+		failures[account] = append(failures[account], time.Now())
+		count := len(failures[account])
+		debugf(1, "%s: authentication failure %d/%d to %s", c.Server, count, limit, account)
+
+		if count >= limit-1 {
+			fmt.Fprintf(c.stderr(), "Warning       :%s: %d authentication failures to %s in last %v. further failures may lock out the account (fail2ban, pam_tally).\n",
+				c.Server, count, account, window)
+		}
+
+	default:
+		return
+	}
+
+	writeAuthFailures(failures)
+}
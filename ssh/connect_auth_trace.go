@@ -0,0 +1,210 @@
+package ssh
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// authentication method names (RFC 4252)
+const (
+	AUTH_METHOD_PUBLICKEY            = "publickey"
+	AUTH_METHOD_KEYBOARD_INTERACTIVE = "keyboard-interactive"
+	AUTH_METHOD_PASSWORD             = "password"
+)
+
+// authTrace record authentication methods tried with a server, to report which method failed and why.
+type authTrace struct {
+	server    string
+	proxyOf   string   // target server, if server is proxy of it
+	passwords []string // passwords of config, tried in keyboard-interactive and password
+
+	mu       sync.Mutex
+	methods  []string            // methods to try, in order
+	offered  map[string][]string // offered credentials of method. ex) key path, ssh-agent
+	attempts map[string]int
+	prompted map[string]int
+	skipped  map[string]bool // methods not tried because nothing to try
+	password int             // index of next password
+	cached   bool            // prompted password of cache is tried
+	pending  string          // prompted (or cached) password being tried
+}
+
+// label return server name shown in prompts and messages. ex) `bastion, proxy of web01`
+func (t *authTrace) label() string {
+	if t.proxyOf == "" {
+		return t.server
+	}
+	return fmt.Sprintf("%s, proxy of %s", t.server, t.proxyOf)
+}
+
+// add record credential offered with method.
+func (t *authTrace) add(method, offered string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.offered == nil {
+		t.offered = map[string][]string{}
+	}
+	t.offered[method] = append(t.offered[method], offered)
+}
+
+// use record method is tried if server allows it.
+func (t *authTrace) use(method string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.methods = append(t.methods, method)
+}
+
+// attempt record method is tried once.
+func (t *authTrace) attempt(method string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.attempts == nil {
+		t.attempts = map[string]int{}
+	}
+	t.attempts[method]++
+}
+
+// skip record method is not tried because nothing to try. (ex. no more password)
+func (t *authTrace) skip(method string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.skipped == nil {
+		t.skipped = map[string]bool{}
+	}
+	t.skipped[method] = true
+	t.attempts[method]--
+}
+
+// prompt record input of user is read in method.
+func (t *authTrace) prompt(method string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.prompted == nil {
+		t.prompted = map[string]int{}
+	}
+	t.prompted[method]++
+}
+
+// prompts return number of prompts in all methods.
+func (t *authTrace) prompts() (count int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, c := range t.prompted {
+		count += c
+	}
+	return
+}
+
+// promptsOf return number of prompts in method.
+func (t *authTrace) promptsOf(method string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.prompted[method]
+}
+
+// nextPassword return password of config that is not tried yet.
+func (t *authTrace) nextPassword() (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.password >= len(t.passwords) {
+		return "", false
+	}
+	t.password++
+	return t.passwords[t.password-1], true
+}
+
+// useCache return true if prompted password of cache is not tried yet, and record it is tried.
+func (t *authTrace) useCache() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cached {
+		return false
+	}
+	t.cached = true
+	return true
+}
+
+// setPending record prompted (or cached) password being tried.
+func (t *authTrace) setPending(pass string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pending = pass
+}
+
+// takePending return prompted (or cached) password tried last, and clear it.
+func (t *authTrace) takePending() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pass := t.pending
+	t.pending = ""
+	return pass
+}
+
+// String return failures of tried methods. ex) `publickey: rejected (~/.ssh/id_rsa, ssh-agent(2 keys)), password: rejected 1 time`
+func (t *authTrace) String() string {
+	return strings.Join(t.failures(false), ", ")
+}
+
+// err return authentication error with failures of all methods. Methods that are not tried are reported as not allowed by server.
+func (t *authTrace) err() error {
+	if t.proxyOf != "" {
+		return fmt.Errorf("ssh: unable to authenticate to proxy %s (%s)", t.server, strings.Join(t.failures(true), ", "))
+	}
+	return fmt.Errorf("ssh: unable to authenticate (%s)", strings.Join(t.failures(true), ", "))
+}
+
+// failures return failure message of each method. If isAll, methods that are not tried are included.
+func (t *authTrace) failures(isAll bool) (failures []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// no key to offer (ex. ssh-agent has no keys)
+	if offered, ok := t.offered[AUTH_METHOD_PUBLICKEY]; ok && !containsString(t.methods, AUTH_METHOD_PUBLICKEY) && isAll {
+		failures = append(failures, fmt.Sprintf("%s: no key to offer (%s)", AUTH_METHOD_PUBLICKEY, strings.Join(offered, ", ")))
+	}
+
+	for _, method := range t.methods {
+		count := t.attempts[method]
+		switch {
+		case t.skipped[method] && count == 0:
+			continue
+		case count == 0 && isAll:
+			failures = append(failures, method+": not allowed by server")
+		case count == 0:
+			continue
+		case method == AUTH_METHOD_PUBLICKEY:
+			failures = append(failures, fmt.Sprintf("%s: rejected (%s)", method, strings.Join(t.offered[method], ", ")))
+		case count == 1:
+			failures = append(failures, method+": rejected 1 time")
+		default:
+			failures = append(failures, fmt.Sprintf("%s: rejected %d times", method, count))
+		}
+	}
+
+	if len(failures) == 0 && isAll {
+		failures = []string{"no authentication method"}
+	}
+	return
+}
+
+// containsString return true if list has s.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blacknon/lssh/common"
+	"golang.org/x/crypto/ssh"
+)
+
+// banner setting of server. (pre-authentication banner of sshd `Banner`)
+const (
+	BANNER_SHOW = "show" // print banner to stderr (default)
+	BANNER_HIDE = "hide" // discard banner
+	BANNER_LOG  = "log"  // append banner to banner log in state directory, instead of print
+)
+
+// BannerLogFile is name of banner log, in state directory.
+var BannerLogFile = "banner.log"
+
+// bannerLogMutex serialize writes of parallel connections, so that each record is one line.
+var bannerLogMutex sync.Mutex
+
+// bannerCallback return ssh.BannerCallback of server, that print, discard or log banner by banner setting.
+// If c.IsNoMotd, banner is not printed. (it is logged, if banner is log)
+func (c *Connect) bannerCallback(server string) ssh.BannerCallback {
+	mode := c.Conf.Server[server].Banner
+
+	return func(message string) error {
+		switch {
+		case mode == BANNER_LOG:
+			if err := writeBannerLog(server, message); err != nil {
+				debugf(1, "%s: cannot write banner log, %v", server, err)
+			}
+		case mode == BANNER_HIDE || c.IsNoMotd:
+			debugf(2, "%s: banner is not printed", server)
+		default:
+			c.printBanner(server, message)
+		}
+		return nil
+	}
+}
+
+// printBanner print banner of server to stderr. At parallel run, each line is prefixed with server name.
+func (c *Connect) printBanner(server, message string) {
+	message = strings.TrimRight(message, "\r\n")
+	if c.IsParallel {
+		for _, line := range strings.Split(message, "\n") {
+			fmt.Fprintf(c.stderr(), "%s: %s\n", server, strings.TrimRight(line, "\r"))
+		}
+		return
+	}
+	fmt.Fprintln(c.stderr(), message)
+}
+
+// writeBannerLog append banner of server to banner log.
+//
+// ex) `2006/01/02 15:04:05 server=web01 banner="Authorized access only.\n"`
+func writeBannerLog(server, message string) error {
+	bannerLogMutex.Lock()
+	defer bannerLogMutex.Unlock()
+
+	f, err := os.OpenFile(common.GetStatePath(BannerLogFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s server=%s banner=%q\n", time.Now().Format("2006/01/02 15:04:05"), server, message)
+	return err
+}
@@ -0,0 +1,126 @@
+package ssh
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+)
+
+// bundleEnvs is environment variables to point tools at bundled dotfiles. (file name in bundle => env)
+var bundleEnvs = map[string]string{
+	".inputrc":  "INPUTRC",
+	".screenrc": "SCREENRC",
+}
+
+// uploadBundle upload local files and directories to remote temp directory as tar, and return remote directory.
+// Files are put at top of directory by base name. (ex. `~/dotfiles/vimrc` => `<dir>/vimrc`)
+func (c *Connect) uploadBundle(paths []string) (dir string, names []string, err error) {
+	buf, names, err := bundleTar(paths)
+	if err != nil {
+		return
+	}
+
+	script := `d=$(mktemp -d "${TMPDIR:-/tmp}/lssh-bundle.XXXXXX") && tar xf - -C "$d" && echo "$d"`
+	output, err := c.runRemoteShell(script, buf)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot upload bundle, %v", err)
+	}
+
+	dir = strings.TrimSpace(string(output))
+	return
+}
+
+// bundleTar archive local files and directories as tar, and return it with top level names.
+func bundleTar(paths []string) (buf *bytes.Buffer, names []string, err error) {
+	buf = new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+
+	for _, path := range paths {
+		root := common.GetFullPath(path)
+		base := filepath.Base(root)
+		names = append(names, base)
+
+		err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, _ := filepath.Rel(root, p)
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			header.Name = filepath.ToSlash(filepath.Join(base, rel))
+			if err = tw.WriteHeader(header); err != nil {
+				return err
+			}
+
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			data, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			_, err = tw.Write(data)
+			return err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	err = tw.Close()
+	return
+}
+
+// removeBundle remove uploaded bundle directory from remote.
+func (c *Connect) removeBundle(dir string) {
+	if _, err := c.runRemoteShell(`rm -rf `+shellQuote(dir), nil); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: cannot remove bundle %s, %v\n", c.Server, dir, err)
+	}
+}
+
+// bundleRc return rc to point shell at uploaded bundle directory.
+//   - LSSH_BUNDLE ... bundle directory
+//   - PATH        ... add `bin` in bundle
+//   - vim, tmux   ... use `.vimrc`, `.tmux.conf` in bundle
+//   - others      ... env by bundleEnvs (`.inputrc` etc.)
+func bundleRc(shell, dir string, names []string) string {
+	export := func(key, value string) string {
+		if shell == LOCALRC_FISH {
+			return "set -gx " + key + " " + value + "\n"
+		}
+		return "export " + key + "=" + value + "\n"
+	}
+
+	rc := export("LSSH_BUNDLE", shellQuote(dir))
+	for _, name := range names {
+		path := shellQuote(dir + "/" + name)
+
+		switch name {
+		case "bin":
+			if shell == LOCALRC_FISH {
+				rc += "set -gx PATH " + path + " $PATH\n"
+			} else {
+				rc += `export PATH=` + path + `:"$PATH"` + "\n"
+			}
+		case ".vimrc":
+			rc += export("VIMINIT", shellQuote("source "+dir+"/"+name))
+		case ".tmux.conf":
+			rc += "alias tmux=" + shellQuote("tmux -f "+path) + "\n"
+		default:
+			if env, ok := bundleEnvs[name]; ok {
+				rc += export(env, path)
+			}
+		}
+	}
+
+	return rc
+}
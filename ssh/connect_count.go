@@ -0,0 +1,68 @@
+package ssh
+
+import (
+	"io"
+	"sync/atomic"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// countConn is ssh.Conn that count bytes of data sent and received over channels opened by client (session, sftp and port forward).
+// It is used to report bytes transferred with server (`--report`).
+type countConn struct {
+	ssh.Conn
+	sent, received int64
+}
+
+// newClient return ssh.Client of conn, that count bytes transferred over its channels.
+func newClient(conn ssh.Conn, chans <-chan ssh.NewChannel, reqs <-chan *ssh.Request) *ssh.Client {
+	return ssh.NewClient(&countConn{Conn: conn}, chans, reqs)
+}
+
+// OpenChannel open channel, and count data of it.
+func (c *countConn) OpenChannel(name string, data []byte) (ssh.Channel, <-chan *ssh.Request, error) {
+	ch, reqs, err := c.Conn.OpenChannel(name, data)
+	if err != nil {
+		return ch, reqs, err
+	}
+	return &countChannel{Channel: ch, conn: c}, reqs, nil
+}
+
+// countChannel is ssh.Channel that count data to conn.
+type countChannel struct {
+	ssh.Channel
+	conn *countConn
+}
+
+func (ch *countChannel) Read(p []byte) (n int, err error) {
+	n, err = ch.Channel.Read(p)
+	atomic.AddInt64(&ch.conn.received, int64(n))
+	return
+}
+
+func (ch *countChannel) Write(p []byte) (n int, err error) {
+	n, err = ch.Channel.Write(p)
+	atomic.AddInt64(&ch.conn.sent, int64(n))
+	return
+}
+
+// Stderr return extended data of channel, that is also counted.
+func (ch *countChannel) Stderr() io.ReadWriter {
+	stderr := ch.Channel.Stderr()
+	return struct {
+		io.Reader
+		io.Writer
+	}{&countReader{r: stderr, n: &ch.conn.received}, &countWriter{w: stderr, n: &ch.conn.sent}}
+}
+
+// clientBytes return bytes of data sent and received over channels of client.
+// If client is nil or not created with newClient, return 0.
+func clientBytes(client *ssh.Client) (sent, received int64) {
+	if client == nil {
+		return
+	}
+	if c, ok := client.Conn.(*countConn); ok {
+		return atomic.LoadInt64(&c.sent), atomic.LoadInt64(&c.received)
+	}
+	return
+}
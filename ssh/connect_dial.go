@@ -0,0 +1,282 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/blacknon/lssh/conf"
+	"golang.org/x/crypto/ssh"
+)
+
+// bindDialer is direct dialer with address family and source address. (like OpenSSH AddressFamily, BindAddress)
+type bindDialer struct {
+	dialer net.Dialer
+	family string // tcp, tcp4 or tcp6
+}
+
+// newBindDialer return bindDialer from address_family, bind_address and bind_interface of config.
+func newBindDialer(config conf.ServerConfig, timeout time.Duration) (d *bindDialer, err error) {
+	d = &bindDialer{family: "tcp"}
+	d.dialer.Timeout = timeout
+
+	switch config.AddressFamily {
+	case "", "any":
+	case "inet":
+		d.family = "tcp4"
+	case "inet6":
+		d.family = "tcp6"
+	default:
+		return nil, fmt.Errorf("unknown address_family '%s' (any, inet or inet6)", config.AddressFamily)
+	}
+
+	bindAddress := config.BindAddress
+	if bindAddress == "" && config.BindInterface != "" {
+		bindAddress, err = interfaceAddress(config.BindInterface, d.family)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if bindAddress != "" {
+		ip := net.ParseIP(bindAddress)
+		if ip == nil {
+			addr, err := net.ResolveIPAddr("ip", bindAddress)
+			if err != nil {
+				return nil, err
+			}
+			ip = addr.IP
+		}
+
+		// source address decides address family
+		if d.family == "tcp" {
+			d.family = "tcp6"
+			if ip.To4() != nil {
+				d.family = "tcp4"
+			}
+		}
+
+		d.dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	return
+}
+
+// Dial connect to addr. network `tcp` is replaced with the address family.
+func (d *bindDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connect to addr with ctx. network `tcp` is replaced with the address family.
+func (d *bindDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network == "tcp" {
+		network = d.family
+	}
+	return d.dialer.DialContext(ctx, network, addr)
+}
+
+// interfaceAddress return first address of network interface, that matches family.
+func interfaceAddress(name, family string) (address string, err error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return
+	}
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		isV4 := ipNet.IP.To4() != nil
+		if (family == "tcp4" && !isV4) || (family == "tcp6" && isV4) {
+			continue
+		}
+
+		return ipNet.IP.String(), nil
+	}
+
+	return "", fmt.Errorf("bind_interface %s has no address", name)
+}
+
+// dialAttemptDelay is delay to start next connection attempt. (RFC 8305 Connection Attempt Delay)
+const dialAttemptDelay = 250 * time.Millisecond
+
+// DialMulti connect to addrs (host:port), and return the first established connection.
+// Each host is resolved to all A/AAAA records, and connection attempts are started
+// in order with dialAttemptDelay (or immediately when the previous attempt failed). (like Happy Eyeballs)
+// If ctx is done, attempts are canceled.
+func (d *bindDialer) DialMulti(ctx context.Context, addrs []string) (conn net.Conn, addr string, err error) {
+	targets := d.resolveTargets(ctx, addrs)
+	debugf(1, "resolved %v => %v", addrs, targets)
+	if len(targets) == 0 {
+		return nil, "", fmt.Errorf("no address to connect")
+	}
+	if len(targets) == 1 {
+		conn, err = d.DialContext(ctx, "tcp", targets[0])
+		return conn, targets[0], err
+	}
+
+	type dialResult struct {
+		conn net.Conn
+		addr string
+		err  error
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult, len(targets))
+	next, running := 0, 0
+	var wait <-chan time.Time
+
+	start := func() {
+		target := targets[next]
+		next++
+		running++
+		debugf(2, "connect attempt to %s", target)
+		go func() {
+			c, err := d.dialer.DialContext(ctx, d.family, target)
+			results <- dialResult{c, target, err}
+		}()
+
+		wait = nil
+		if next < len(targets) {
+			wait = time.After(dialAttemptDelay)
+		}
+	}
+
+	start()
+	for running > 0 {
+		select {
+		case res := <-results:
+			running--
+			if res.err == nil {
+				// close connections established later
+				go func(n int) {
+					for i := 0; i < n; i++ {
+						if r := <-results; r.err == nil {
+							r.conn.Close()
+						}
+					}
+				}(running)
+				debugf(1, "connected to %s", res.addr)
+				return res.conn, res.addr, nil
+			}
+
+			err = res.err
+			debugf(1, "connect to %s failed: %v", res.addr, res.err)
+			if next < len(targets) {
+				start()
+			}
+
+		case <-wait:
+			start()
+		}
+	}
+
+	return nil, "", err
+}
+
+// resolveTargets resolve hosts of addrs, and return host:port list of IP addresses.
+// IPv6 and IPv4 addresses are interleaved. If resolve failed, the addr is used as it is.
+func (d *bindDialer) resolveTargets(ctx context.Context, addrs []string) (targets []string) {
+	exist := map[string]bool{}
+	add := func(target string) {
+		if !exist[target] {
+			exist[target] = true
+			targets = append(targets, target)
+		}
+	}
+
+	for _, addr := range addrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			add(addr)
+			continue
+		}
+
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil || len(ips) == 0 {
+			add(addr)
+			continue
+		}
+
+		var v6, v4 []string
+		for _, ip := range ips {
+			target := net.JoinHostPort(ip.IP.String(), port)
+			if ip.IP.To4() != nil {
+				v4 = append(v4, target)
+			} else {
+				v6 = append(v6, target)
+			}
+		}
+
+		// filter by address family
+		switch d.family {
+		case "tcp4":
+			v6 = nil
+		case "tcp6":
+			v4 = nil
+		}
+
+		for i := 0; i < len(v6) || i < len(v4); i++ {
+			if i < len(v6) {
+				add(v6[i])
+			}
+			if i < len(v4) {
+				add(v4[i])
+			}
+		}
+	}
+
+	return
+}
+
+// dialSsh connect to server directly (with address family and source address), and return ssh.Client.
+// If addrs is set, connect to whichever of addr and addrs answers first.
+// If ctx is done while dialing or ssh handshake (including authentication), connection is closed.
+func dialSsh(ctx context.Context, config conf.ServerConfig, sshConf *ssh.ClientConfig) (client *ssh.Client, err error) {
+	d, err := newBindDialer(config, sshConf.Timeout)
+	if err != nil {
+		return
+	}
+
+	addrs := []string{net.JoinHostPort(config.Addr, config.Port)}
+	for _, a := range config.Addrs {
+		addrs = append(addrs, net.JoinHostPort(a, config.Port))
+	}
+
+	conn, addr, err := d.DialMulti(ctx, addrs)
+	if err != nil {
+		return
+	}
+
+	// abort handshake at ctx done
+	handshaked := make(chan bool)
+	defer close(handshaked)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-handshaked:
+		}
+	}()
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, sshConf)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return
+	}
+
+	return newClient(sshConn, chans, reqs), nil
+}
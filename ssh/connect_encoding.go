@@ -0,0 +1,99 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/transform"
+)
+
+// remoteEncodings is supported remote_encoding by name (lower case).
+var remoteEncodings = map[string]encoding.Encoding{
+	"shift_jis":    japanese.ShiftJIS,
+	"sjis":         japanese.ShiftJIS,
+	"cp932":        japanese.ShiftJIS,
+	"euc-jp":       japanese.EUCJP,
+	"iso-2022-jp":  japanese.ISO2022JP,
+	"euc-kr":       korean.EUCKR,
+	"gbk":          simplifiedchinese.GBK,
+	"gb2312":       simplifiedchinese.GBK,
+	"gb18030":      simplifiedchinese.GB18030,
+	"big5":         traditionalchinese.Big5,
+	"iso-8859-1":   charmap.ISO8859_1,
+	"latin1":       charmap.ISO8859_1,
+	"iso-8859-15":  charmap.ISO8859_15,
+	"windows-1252": charmap.Windows1252,
+	"koi8-r":       charmap.KOI8R,
+}
+
+// getRemoteEncoding return encoding of name. If name is empty or utf-8, return nil (no conversion).
+func getRemoteEncoding(name string) (enc encoding.Encoding, err error) {
+	name = strings.ToLower(name)
+	if name == "" || name == "utf-8" || name == "utf8" {
+		return nil, nil
+	}
+
+	enc, ok := remoteEncodings[name]
+	if !ok {
+		return nil, fmt.Errorf("remote_encoding %s is not supported", name)
+	}
+	return
+}
+
+// decodeWriter convert remote encoding output to UTF-8, and write to w.
+// Incomplete multibyte sequence is kept until next Write (or Close).
+type decodeWriter struct {
+	io.WriteCloser
+}
+
+// newDecodeWriter return writer that convert enc to UTF-8. If enc is nil, return w as it is.
+func newDecodeWriter(w io.Writer, enc encoding.Encoding) io.Writer {
+	if enc == nil {
+		return w
+	}
+	return &decodeWriter{transform.NewWriter(w, enc.NewDecoder())}
+}
+
+// Write convert p, and return len(p) (converted length is different from p).
+func (d *decodeWriter) Write(p []byte) (n int, err error) {
+	if _, err = d.WriteCloser.Write(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// newEncodeReader return reader that convert UTF-8 input to enc. Unsupported characters are replaced.
+// If enc is nil, return r as it is.
+func newEncodeReader(r io.Reader, enc encoding.Encoding) io.Reader {
+	if enc == nil {
+		return r
+	}
+	return transform.NewReader(r, encoding.ReplaceUnsupported(enc.NewEncoder()))
+}
+
+// decodeBytes convert data of enc to UTF-8. If enc is nil or data is invalid, return data as it is.
+func decodeBytes(data []byte, enc encoding.Encoding) []byte {
+	if enc == nil {
+		return data
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return data
+	}
+	return decoded
+}
+
+// closeDecodeWriter flush incomplete sequence kept in w, if w is decodeWriter.
+func closeDecodeWriter(w io.Writer) {
+	if d, ok := w.(*decodeWriter); ok {
+		d.Close()
+	}
+}
@@ -0,0 +1,404 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	scplib "github.com/blacknon/go-scplib"
+	"github.com/blacknon/lssh/common"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// escapeChar is escape character at the beginning of line. (like OpenSSH `~`)
+const escapeChar = '~'
+
+const escapeHelp = `Supported escape sequences:
+ ~C  - open command line
+ ~#  - list forwarded connections
+ ~u  - upload local files to remote current directory
+ ~d  - download remote files to local current directory
+ ~.  - terminate connection
+ ~?  - this message
+ ~~  - send the escape character
+(Note that escapes are only recognized immediately after newline.)
+`
+
+const escapeCommandHelp = `Commands:
+      -L[bind_address:]port:host:hostport    Request local forward
+      -R[bind_address:]port:host:hostport    Request remote forward
+      -D[bind_address:]port                  Request dynamic forward
+      -K id                                  Cancel forward
+      list                                   List forwards
+      getfile path...                        Download remote files to local current directory
+      putfile path...                        Upload local files to remote current directory
+`
+
+// bracketed paste markers. pasted text is sent as it is, escape character in it is not handled.
+var (
+	pasteStart = []byte("\x1b[200~")
+	pasteEnd   = []byte("\x1b[201~")
+)
+
+// escapeReader read stdin, and handle escape sequence at the beginning of line.
+type escapeReader struct {
+	r        io.Reader
+	handlers map[byte]func()
+
+	isLineStart bool
+	isEscape    bool
+	isPaste     bool
+	recent      []byte // last bytes, to detect bracketed paste markers across reads
+	pending     []byte
+}
+
+// newEscapeReader return io.Reader that handle escape sequences of c.
+func (c *Connect) newEscapeReader(r io.Reader) io.Reader {
+	return &escapeReader{
+		r:           r,
+		isLineStart: true,
+		handlers: map[byte]func(){
+			'?': func() { escapePrint(escapeHelp) },
+			'#': func() { c.escapeListForward() },
+			'C': func() { c.escapeCommandLine() },
+			'u': func() { c.escapeUpload() },
+			'd': func() { c.escapeDownload() },
+			'.': func() {
+				escapePrint("Connection to " + c.Server + " closed.\n")
+				c.Client.Close()
+			},
+		},
+	}
+}
+
+func (e *escapeReader) Read(p []byte) (n int, err error) {
+	for len(e.pending) == 0 {
+		buf := make([]byte, len(p))
+		n, err = e.r.Read(buf)
+		e.pending = e.filter(buf[:n])
+		if err != nil {
+			break
+		}
+	}
+
+	n = copy(p, e.pending)
+	e.pending = e.pending[n:]
+	return
+}
+
+// filter remove escape sequence from data, and run handler.
+func (e *escapeReader) filter(data []byte) (out []byte) {
+	for _, b := range data {
+		e.trackPaste(b)
+		if e.isPaste {
+			out = append(out, b)
+			continue
+		}
+
+		if e.isEscape {
+			e.isEscape = false
+			if handler, ok := e.handlers[b]; ok {
+				handler()
+				continue
+			}
+
+			// `~~` send `~`. others send as it is.
+			if b != escapeChar {
+				out = append(out, escapeChar)
+			}
+			out = append(out, b)
+			e.isLineStart = b == '\r' || b == '\n'
+			continue
+		}
+
+		if e.isLineStart && b == escapeChar {
+			e.isEscape = true
+			continue
+		}
+
+		out = append(out, b)
+		e.isLineStart = b == '\r' || b == '\n'
+	}
+
+	return
+}
+
+// trackPaste update bracketed paste state with input byte b.
+func (e *escapeReader) trackPaste(b byte) {
+	e.recent = append(e.recent, b)
+	if len(e.recent) > len(pasteStart) {
+		e.recent = e.recent[len(e.recent)-len(pasteStart):]
+	}
+
+	switch {
+	case bytes.Equal(e.recent, pasteStart):
+		e.isPaste = true
+	case bytes.Equal(e.recent, pasteEnd):
+		// pasted text is not treated as the beginning of line
+		e.isPaste = false
+		e.isLineStart = false
+	}
+}
+
+// escapePrint print message at raw mode terminal.
+func escapePrint(msg string) {
+	fmt.Fprint(os.Stderr, "\r\n"+strings.Replace(msg, "\n", "\r\n", -1))
+}
+
+// escapeListForward print active port forwards.
+func (c *Connect) escapeListForward() {
+	forwards := c.getForwardManager().List()
+
+	msg := "The following forwards are open:\n"
+	for _, f := range forwards {
+		msg += "  " + f.String() + "\n"
+	}
+	if len(forwards) == 0 {
+		msg = "No forwards are open.\n"
+	}
+	escapePrint(msg)
+}
+
+// escapeReadLine read a line at prompt.
+func escapeReadLine(prompt string) (line string, err error) {
+	escapePrint("")
+
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stderr}
+	term := terminal.NewTerminal(rw, prompt)
+
+	line, err = term.ReadLine()
+	return strings.TrimSpace(line), err
+}
+
+// escapeCommandLine read command at prompt, and add/remove port forward.
+func (c *Connect) escapeCommandLine() {
+	line, err := escapeReadLine("lssh> ")
+	if err != nil {
+		return
+	}
+
+	switch {
+	case line == "":
+		return
+
+	case line == "list":
+		c.escapeListForward()
+
+	case line == "help" || line == "?":
+		escapePrint(escapeCommandHelp)
+
+	case strings.HasPrefix(line, "getfile "):
+		c.escapeGetFile(strings.Fields(line)[1:])
+
+	case strings.HasPrefix(line, "putfile "):
+		c.escapeUploadFiles(strings.Fields(line)[1:])
+
+	case strings.HasPrefix(line, "-K"):
+		id, err := strconv.Atoi(strings.TrimSpace(line[2:]))
+		if err != nil {
+			escapePrint("Bad forwarding close id.\n")
+			return
+		}
+		if err = c.getForwardManager().Remove(id); err != nil {
+			escapePrint(err.Error() + "\n")
+			return
+		}
+		escapePrint("Canceled forwarding.\n")
+
+	case strings.HasPrefix(line, "-L"), strings.HasPrefix(line, "-R"), strings.HasPrefix(line, "-D"):
+		forwardType := map[string]string{"-L": FORWARD_LOCAL, "-R": FORWARD_REMOTE, "-D": FORWARD_DYNAMIC}[line[:2]]
+		listen, target, err := parseForwardSpec(forwardType, strings.TrimSpace(line[2:]))
+		if err != nil {
+			escapePrint(err.Error() + "\n")
+			return
+		}
+
+		f, err := c.getForwardManager().Add(forwardType, listen, target)
+		if err != nil {
+			escapePrint("Port forwarding failed. " + err.Error() + "\n")
+			return
+		}
+		escapePrint("Forwarding port. " + f.String() + "\n")
+
+	default:
+		escapePrint("Invalid command.\n" + escapeCommandHelp)
+	}
+}
+
+// escapeGetFile download remote files over the current connection, to local current directory.
+// Relative path is from remote home directory.
+func (c *Connect) escapeGetFile(paths []string) {
+	localDir, err := os.Getwd()
+	if err != nil {
+		escapePrint(err.Error() + "\n")
+		return
+	}
+
+	quoted := []string{}
+	for _, path := range paths {
+		// scp run at home directory
+		path = strings.TrimPrefix(path, "~/")
+		quoted = append(quoted, shellQuote(path))
+	}
+
+	escapePrint(fmt.Sprintf("Downloading %s to %s ...\n", strings.Join(paths, " "), localDir))
+
+	scp := &scplib.SCPClient{Connection: c.Client, Permission: true}
+	if err = scp.GetFile(quoted, localDir+"/"); err != nil {
+		escapePrint("Download failed. " + err.Error() + "\n")
+		return
+	}
+	escapePrint("Downloaded.\n")
+}
+
+// escapeUpload read local paths at prompt, and upload them to remote current directory.
+func (c *Connect) escapeUpload() {
+	line, err := escapeReadLine("upload> ")
+	if err != nil || line == "" {
+		return
+	}
+	c.escapeUploadFiles(strings.Fields(line))
+}
+
+// escapeDownload read remote paths at prompt, and download them to local current directory.
+func (c *Connect) escapeDownload() {
+	line, err := escapeReadLine("download> ")
+	if err != nil || line == "" {
+		return
+	}
+	c.escapeDownloadFiles(strings.Fields(line))
+}
+
+// escapeUploadFiles upload local files (wildcard is available) to remote current directory, over sftp channel of the current connection.
+func (c *Connect) escapeUploadFiles(paths []string) {
+	s, dir, err := c.escapeSftp()
+	if err != nil {
+		escapePrint("Upload failed. " + err.Error() + "\n")
+		return
+	}
+	defer s.Close()
+
+	files := []string{}
+	for _, p := range paths {
+		p = common.GetFullPath(p)
+		matches, _ := filepath.Glob(p)
+		if len(matches) == 0 {
+			matches = []string{p}
+		}
+		files = append(files, matches...)
+	}
+
+	escapePrint(fmt.Sprintf("Uploading %s to %s:%s ...\n", strings.Join(paths, " "), c.Server, dir))
+	for _, f := range files {
+		n, err := s.Upload(f, path.Join(dir, filepath.Base(f)))
+		if err != nil {
+			escapePrint("Upload failed. " + err.Error() + "\n")
+			continue
+		}
+		escapePrint(fmt.Sprintf("Uploaded %s (%s).\n", filepath.Base(f), formatBytes(n)))
+	}
+}
+
+// escapeDownloadFiles download remote files (wildcard is available) to local current directory, over sftp channel of the current connection.
+// Relative path is from remote current directory.
+func (c *Connect) escapeDownloadFiles(paths []string) {
+	localDir, err := os.Getwd()
+	if err != nil {
+		escapePrint(err.Error() + "\n")
+		return
+	}
+
+	s, dir, err := c.escapeSftp()
+	if err != nil {
+		escapePrint("Download failed. " + err.Error() + "\n")
+		return
+	}
+	defer s.Close()
+
+	files := []string{}
+	for _, p := range paths {
+		if !path.IsAbs(p) && p != "~" && !strings.HasPrefix(p, "~/") {
+			p = path.Join(dir, p)
+		}
+		if matches := s.glob(p); len(matches) > 0 {
+			files = append(files, matches...)
+		} else {
+			escapePrint(fmt.Sprintf("Download failed. %s: no such file\n", p))
+		}
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	escapePrint(fmt.Sprintf("Downloading %s to %s ...\n", strings.Join(paths, " "), localDir))
+	for _, f := range files {
+		if mode, err := s.Stat(sftpPath(f)); err == nil && !mode.IsRegular() {
+			escapePrint(fmt.Sprintf("Download failed. %s: not a regular file\n", f))
+			continue
+		}
+
+		n, err := s.Download(sftpPath(f), filepath.Join(localDir, path.Base(f)))
+		if err != nil {
+			escapePrint("Download failed. " + err.Error() + "\n")
+			continue
+		}
+		escapePrint(fmt.Sprintf("Downloaded %s (%s).\n", path.Base(f), formatBytes(n)))
+	}
+}
+
+// escapeSftp open sftp channel on the current connection, and return remote current directory (absolute path).
+// Current directory is reported by remote shell (OSC7), or chdir of server config. If unknown, login directory is used.
+func (c *Connect) escapeSftp() (s *sftpClient, dir string, err error) {
+	s, err = newSftpClient(c.Client)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dir = sftpPath(c.Conf.Server[c.Server].Chdir)
+	if c.cwd != nil && c.cwd.Dir() != "" {
+		dir = c.cwd.Dir()
+	}
+	if dir == "" {
+		dir = "."
+	}
+
+	if dir, err = s.RealPath(dir); err != nil {
+		s.Close()
+		return nil, "", err
+	}
+	return s, dir, nil
+}
+
+// parseForwardSpec parse OpenSSH style forward spec, return listen and target address.
+//   - local, remote ... [bind_address:]port:host:hostport
+//   - dynamic       ... [bind_address:]port
+func parseForwardSpec(forwardType, spec string) (listen, target string, err error) {
+	fields := strings.Split(spec, ":")
+
+	if forwardType == FORWARD_DYNAMIC {
+		switch len(fields) {
+		case 1:
+			return "127.0.0.1:" + fields[0], "", nil
+		case 2:
+			return fields[0] + ":" + fields[1], "", nil
+		}
+		return "", "", fmt.Errorf("Bad dynamic forwarding specification '%s'", spec)
+	}
+
+	switch len(fields) {
+	case 3:
+		return "127.0.0.1:" + fields[0], fields[1] + ":" + fields[2], nil
+	case 4:
+		return fields[0] + ":" + fields[1], fields[2] + ":" + fields[3], nil
+	}
+
+	return "", "", fmt.Errorf("Bad forwarding specification '%s'", spec)
+}
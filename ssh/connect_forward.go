@@ -1,14 +1,22 @@
 package ssh
 
 import (
+	"bytes"
+	"crypto/rand"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -16,17 +24,30 @@ import (
 // TODO(blacknon):
 //     socket forwardについても実装する
 
-func readAuthority(hostname, display string) (
-	name string, data []byte, err error) {
+// X11 auth protocol
+const x11AuthProtocol = "MIT-MAGIC-COOKIE-1"
 
-	// b is a scratch buffer to use and should be at least 256 bytes long
-	// (i.e. it should be able to hold a hostname).
-	b := make([]byte, 256)
+// x11UntrustedTimeout is lifetime of untrusted xauth cookie. (like OpenSSH `ForwardX11Timeout`)
+const x11UntrustedTimeout = 20 * time.Minute
+
+// As per /usr/include/X11/Xauth.h.
+const (
+	xauthFamilyLocal = 256
+	xauthFamilyWild  = 65535
+)
 
-	// As per /usr/include/X11/Xauth.h.
-	const familyLocal = 256
+// xauthEntry is entry of Xauthority file.
+type xauthEntry struct {
+	Family  uint16
+	Address string
+	Display string
+	Name    string
+	Data    []byte
+}
 
-	if len(hostname) == 0 || hostname == "localhost" {
+// readAuthority return auth name and data of hostname and display (number) from $XAUTHORITY (or ~/.Xauthority).
+func readAuthority(hostname, display string) (name string, data []byte, err error) {
+	if len(hostname) == 0 || hostname == "localhost" || hostname == "unix" || strings.HasPrefix(hostname, "/") {
 		hostname, err = os.Hostname()
 		if err != nil {
 			return "", nil, err
@@ -43,43 +64,89 @@ func readAuthority(hostname, display string) (
 		fname = home + "/.Xauthority"
 	}
 
-	r, err := os.Open(fname)
+	entries, err := readXauthFile(fname)
 	if err != nil {
 		return "", nil, err
 	}
+
+	for _, e := range entries {
+		if e.Family == xauthFamilyWild || (e.Family == xauthFamilyLocal && e.Address == hostname && e.Display == display) {
+			return e.Name, e.Data, nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("xauth data of display %s not found in %s", display, fname)
+}
+
+// readXauthFile return all entries of Xauthority file.
+func readXauthFile(fname string) (entries []xauthEntry, err error) {
+	r, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
 	defer r.Close()
 
+	// b is a scratch buffer to use and should be at least 256 bytes long
+	// (i.e. it should be able to hold a hostname).
+	b := make([]byte, 256)
+
 	for {
-		var family uint16
-		if err := binary.Read(r, binary.BigEndian, &family); err != nil {
-			return "", nil, err
+		var e xauthEntry
+		if err = binary.Read(r, binary.BigEndian, &e.Family); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
 		}
 
-		addr, err := getString(r, b)
-		if err != nil {
-			return "", nil, err
+		if e.Address, err = getString(r, b); err != nil {
+			return
 		}
-
-		disp, err := getString(r, b)
-		if err != nil {
-			return "", nil, err
+		if e.Display, err = getString(r, b); err != nil {
+			return
 		}
-
-		name0, err := getString(r, b)
-		if err != nil {
-			return "", nil, err
+		if e.Name, err = getString(r, b); err != nil {
+			return
 		}
 
-		data0, err := getBytes(r, b)
+		data, err := getBytes(r, b)
 		if err != nil {
-			return "", nil, err
+			return entries, err
 		}
+		e.Data = append([]byte{}, data...)
+
+		entries = append(entries, e)
+	}
+}
 
-		if family == familyLocal && addr == hostname && disp == display {
-			return name0, data0, nil
+// generateUntrustedAuthority generate untrusted xauth cookie of display with `xauth generate`.
+// X11 client connected with untrusted cookie is restricted by X security extension.
+func generateUntrustedAuthority(display string) (name string, data []byte, err error) {
+	dir, err := ioutil.TempDir("", "lssh-xauth")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "xauthfile")
+	timeout := strconv.Itoa(int(x11UntrustedTimeout.Seconds()) + 60)
+
+	cmd := exec.Command("xauth", "-q", "-f", fname, "generate", display, x11AuthProtocol, "untrusted", "timeout", timeout)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", nil, fmt.Errorf("xauth generate failed: %v %s", err, strings.TrimSpace(string(output)))
+	}
+
+	entries, err := readXauthFile(fname)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.Name == x11AuthProtocol {
+			return e.Name, e.Data, nil
 		}
 	}
-	panic("unreachable")
+
+	return "", nil, errors.New("xauth key data not generated")
 }
 
 func getBytes(r io.Reader, b []byte) ([]byte, error) {
@@ -111,44 +178,126 @@ type x11request struct {
 	ScreenNumber     uint32
 }
 
-func x11ConnectDisplay() (conn net.Conn, err error) {
-	// TODO(blacknon): Socket通信しか考慮されていないので、TCP通信での指定もできるようにする
-	// 【参考】
-	//     - https://godoc.org/golang.org/x/exp/shiny/vendor/github.com/BurntSushi/xgb#NewConn
-	display := os.Getenv("DISPLAY")
-	display0 := display
-	colonIdx := strings.LastIndex(display, ":")
-	dotIdx := strings.LastIndex(display, ".")
+// x11Display is parsed DISPLAY. (ex. `:0`, `:0.1`, `localhost:10.0`, `/tmp/launch-xxx/org.xquartz:0`)
+type x11Display struct {
+	Host   string
+	Number string
+	Screen uint32
+}
 
+// parseDisplay parse DISPLAY string.
+func parseDisplay(display string) (d x11Display, err error) {
+	colonIdx := strings.LastIndex(display, ":")
 	if colonIdx < 0 {
-		err = errors.New("bad display string: " + display0)
+		err = errors.New("bad display string: " + display)
 		return
 	}
 
-	var conDisplay string
-	if display[0] == '/' { // PATH type socket
-		conDisplay = display
-	} else { // /tmp/.X11-unix/X0
-		conDisplay = "/tmp/.X11-unix/X" + display[colonIdx+1:dotIdx]
+	d.Host = display[:colonIdx]
+	d.Number = display[colonIdx+1:]
+
+	// screen number
+	if dotIdx := strings.LastIndex(d.Number, "."); dotIdx >= 0 {
+		screen, err := strconv.ParseUint(d.Number[dotIdx+1:], 10, 32)
+		if err != nil {
+			return d, errors.New("bad display string: " + display)
+		}
+		d.Screen = uint32(screen)
+		d.Number = d.Number[:dotIdx]
+	}
+
+	if _, err = strconv.Atoi(d.Number); err != nil {
+		return d, errors.New("bad display string: " + display)
 	}
 
-	// fmt.Println(conDisplay)
-	conn, err = net.Dial("unix", conDisplay)
 	return
 }
 
-func x11SocketForward(channel ssh.Channel) {
-	conn, err := x11ConnectDisplay()
+func x11ConnectDisplay() (conn net.Conn, err error) {
+	display := os.Getenv("DISPLAY")
+	d, err := parseDisplay(display)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(display, "/"): // PATH type socket
+		conn, err = net.Dial("unix", display)
+	case d.Host == "" || d.Host == "unix": // /tmp/.X11-unix/X0
+		conn, err = net.Dial("unix", "/tmp/.X11-unix/X"+d.Number)
+	default: // tcp. port 6000 + display number
+		number, _ := strconv.Atoi(d.Number)
+		conn, err = net.Dial("tcp", net.JoinHostPort(d.Host, strconv.Itoa(6000+number)))
+	}
+
+	return
+}
+
+// x11SpoofAuth read X11 connection setup from remote, check fake cookie and replace it with real cookie.
+// It returns rewritten connection setup.
+func x11SpoofAuth(r io.Reader, fakeData, realData []byte) (setup []byte, err error) {
+	// byte-order, unused, major, minor, name length, data length, unused
+	header := make([]byte, 12)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+
+	var order binary.ByteOrder
+	switch header[0] {
+	case 'B':
+		order = binary.BigEndian
+	case 'l':
+		order = binary.LittleEndian
+	default:
+		return nil, fmt.Errorf("x11: bad byte order %#x", header[0])
+	}
+
+	nameLen := int(order.Uint16(header[6:8]))
+	dataLen := int(order.Uint16(header[8:10]))
+	pad := func(n int) int { return (n + 3) &^ 3 }
 
+	body := make([]byte, pad(nameLen)+pad(dataLen))
+	if _, err = io.ReadFull(r, body); err != nil {
+		return
+	}
+
+	name := string(body[:nameLen])
+	data := body[pad(nameLen) : pad(nameLen)+dataLen]
+	if name != x11AuthProtocol || !bytes.Equal(data, fakeData) {
+		return nil, errors.New("x11: connection with wrong authentication cookie rejected")
+	}
+
+	// real cookie length is same as fake cookie
+	copy(data, realData)
+
+	return append(header, body...), nil
+}
+
+func x11SocketForward(channel ssh.Channel, fakeData, realData []byte) {
+	defer channel.Close()
+
+	setup, err := x11SpoofAuth(channel, fakeData, realData)
 	if err != nil {
 		return
 	}
 
+	conn, err := x11ConnectDisplay()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write(setup); err != nil {
+		return
+	}
+
 	var wg sync.WaitGroup
 	wg.Add(2)
 	go func() {
 		io.Copy(conn, channel)
-		conn.(*net.UnixConn).CloseWrite()
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		}
 		wg.Done()
 	}()
 	go func() {
@@ -158,50 +307,68 @@ func x11SocketForward(channel ssh.Channel) {
 	}()
 
 	wg.Wait()
-	conn.Close()
-	channel.Close()
 }
 
+// X11Forwarder send x11-req to session, and forward x11 channel to local DISPLAY.
+// Remote get fake cookie, and it is replaced to real cookie at local (auth spoofing).
+//   - trusted   ... real cookie is local xauth cookie ($XAUTHORITY). like `ssh -Y`
+//   - untrusted ... real cookie is generated untrusted cookie by `xauth generate`. like `ssh -X`
 func (c *Connect) X11Forwarder(session *ssh.Session) {
-	// TODO(blacknon):
-	//     DISPLAY関数のパース処理用の関数を別途作成し、それを呼び出してDISPLAY番号を指定させる処理に変更が必要。
-	//     ※ 今は決め打ちになっている。
-	xAuthName, xAuthData, err := readAuthority("", "0")
+	display := os.Getenv("DISPLAY")
+	d, err := parseDisplay(display)
 	if err != nil {
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "x11 forwarding failed: %v\n", err)
+		return
 	}
 
-	var cookie string
-	fmt.Println(xAuthName)
-	for _, d := range xAuthData {
-		cookie = cookie + fmt.Sprintf("%02x", d)
+	var xAuthName string
+	var xAuthData []byte
+	if c.X11Trusted {
+		xAuthName, xAuthData, err = readAuthority(d.Host, d.Number)
+	} else {
+		xAuthName, xAuthData, err = generateUntrustedAuthority(display)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "x11 forwarding failed: %v\n", err)
+		return
+	}
+	if xAuthName != x11AuthProtocol {
+		fmt.Fprintf(os.Stderr, "x11 forwarding failed: auth protocol %s is not supported\n", xAuthName)
+		return
+	}
+
+	// generate fake cookie
+	fakeData := make([]byte, len(xAuthData))
+	if _, err = rand.Read(fakeData); err != nil {
+		fmt.Fprintf(os.Stderr, "x11 forwarding failed: %v\n", err)
+		return
 	}
 
 	// set x11-req Payload
 	payload := x11request{
 		SingleConnection: false,
-		AuthProtocol:     string("MIT-MAGIC-COOKIE-1"),
-		// AuthCookie:       string(common.NewSHA1Hash()),
-		AuthCookie:   string(cookie),
-		ScreenNumber: uint32(0),
+		AuthProtocol:     x11AuthProtocol,
+		AuthCookie:       hex.EncodeToString(fakeData),
+		ScreenNumber:     d.Screen,
 	}
 
 	// Send x11-req Request
 	ok, err := session.SendRequest("x11-req", true, ssh.Marshal(payload))
 	if err == nil && !ok {
-		fmt.Println(errors.New("ssh: x11-req failed"))
+		fmt.Fprintln(os.Stderr, errors.New("ssh: x11-req failed"))
 	} else {
 		// Open HandleChannel x11
 		x11channels := c.Client.HandleChannelOpen("x11")
 
 		go func() {
 			for ch := range x11channels {
+				debugf(2, "%s: accept x11 channel", c.Server)
 				channel, _, err := ch.Accept()
 				if err != nil {
 					continue
 				}
 
-				go x11SocketForward(channel)
+				go x11SocketForward(channel, fakeData, xAuthData)
 			}
 		}()
 	}
@@ -212,11 +379,19 @@ func (c *Connect) portForward(localConn net.Conn) {
 	// TODO(blacknon): 関数名等をちゃんと考える
 
 	// Create ssh connect
+	debugf(2, "%s: open direct-tcpip channel to %s", c.Server, c.ForwardRemote)
 	sshConn, err := c.Client.Dial("tcp", c.ForwardRemote)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Port forward connect remote failed: %v\n", err)
+		localConn.Close()
+		return
+	}
+	metrics.add("lssh_sessions_opened_total", 1, "server", c.Server, "type", "direct-tcpip")
+	tunnel := localConn.LocalAddr().String() + " => " + c.ForwardRemote
 
 	// Copy localConn.Reader to sshConn.Writer
 	go func() {
-		_, err = io.Copy(sshConn, localConn)
+		_, err = io.Copy(&metricsWriter{w: sshConn, server: c.Server, tunnel: tunnel, direction: "sent"}, localConn)
 		if err != nil {
 			fmt.Printf("Port forward local to remote failed: %v\n", err)
 		}
@@ -224,7 +399,7 @@ func (c *Connect) portForward(localConn net.Conn) {
 
 	// Copy sshConn.Reader to localConn.Writer
 	go func() {
-		_, err = io.Copy(localConn, sshConn)
+		_, err = io.Copy(&metricsWriter{w: localConn, server: c.Server, tunnel: tunnel, direction: "received"}, sshConn)
 		if err != nil {
 			fmt.Printf("Port forward remote to local failed: %v\n", err)
 		}
@@ -250,15 +425,20 @@ func (c *Connect) PortForwarder() {
 		fmt.Fprintf(os.Stdout, "local port listen failed: %v\n", err)
 	} else {
 		// start port forwarding.
-		go func() {
-			for {
-				// Setup localConn (type net.Conn)
-				localConn, err := localListener.Accept()
-				if err != nil {
-					fmt.Printf("listen.Accept failed: %v\n", err)
-				}
-				go c.portForward(localConn)
-			}
-		}()
+		go c.PortForwardAccept(localListener)
+	}
+}
+
+// PortForwardAccept accept connection from listener, and forward it to c.ForwardRemote.
+// It is used with net.Listener created by PortForwarder or inherited from systemd (socket activation).
+func (c *Connect) PortForwardAccept(listener net.Listener) {
+	for {
+		// Setup localConn (type net.Conn)
+		localConn, err := listener.Accept()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "listen.Accept failed: %v\n", err)
+			return
+		}
+		go c.portForward(localConn)
 	}
 }
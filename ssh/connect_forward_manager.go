@@ -0,0 +1,263 @@
+package ssh
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// forward type
+const (
+	FORWARD_LOCAL   = "local"
+	FORWARD_REMOTE  = "remote"
+	FORWARD_DYNAMIC = "dynamic"
+)
+
+// Forward is active port forward on the connection.
+type Forward struct {
+	ID     int
+	Type   string // local, remote or dynamic
+	Listen string // listen address. (local: at local, remote: at remote)
+	Target string // connect address. (dynamic: empty)
+
+	// transferred bytes. (use atomic)
+	BytesSent     int64 // listen side => target side
+	BytesReceived int64 // target side => listen side
+
+	listener net.Listener
+}
+
+// String return forward info. ex) `1: local 127.0.0.1:8080 => 127.0.0.1:80 (sent: 10 bytes, received: 20 bytes)`
+func (f *Forward) String() string {
+	target := f.Target
+	if f.Type == FORWARD_DYNAMIC {
+		target = "(socks5)"
+	}
+
+	return fmt.Sprintf("%d: %-7s %s => %s (sent: %d bytes, received: %d bytes)",
+		f.ID, f.Type, f.Listen, target, atomic.LoadInt64(&f.BytesSent), atomic.LoadInt64(&f.BytesReceived))
+}
+
+// ForwardManager manage port forwards added at runtime on Connect.Client.
+type ForwardManager struct {
+	c        *Connect
+	forwards []*Forward
+	nextID   int
+	mu       sync.Mutex
+}
+
+// getForwardManager return ForwardManager of c.
+func (c *Connect) getForwardManager() *ForwardManager {
+	c.forwardsMutex.Lock()
+	defer c.forwardsMutex.Unlock()
+
+	if c.forwards == nil {
+		c.forwards = &ForwardManager{c: c, nextID: 1}
+	}
+	return c.forwards
+}
+
+// Add start port forward, and return it.
+func (m *ForwardManager) Add(forwardType, listen, target string) (f *Forward, err error) {
+	f = &Forward{Type: forwardType, Listen: listen, Target: target}
+
+	switch forwardType {
+	case FORWARD_LOCAL, FORWARD_DYNAMIC:
+		f.listener, err = net.Listen("tcp", listen)
+	case FORWARD_REMOTE:
+		f.listener, err = m.c.Client.Listen("tcp", listen)
+	default:
+		err = fmt.Errorf("unknown forward type: %s", forwardType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	f.ID = m.nextID
+	m.nextID++
+	m.forwards = append(m.forwards, f)
+	m.mu.Unlock()
+
+	go m.accept(f)
+
+	return f, nil
+}
+
+// Remove stop port forward by ID.
+func (m *ForwardManager) Remove(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, f := range m.forwards {
+		if f.ID == id {
+			f.listener.Close()
+			m.forwards = append(m.forwards[:i], m.forwards[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("forward %d is not found", id)
+}
+
+// List return active port forwards.
+func (m *ForwardManager) List() []*Forward {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*Forward{}, m.forwards...)
+}
+
+// accept connection from listener until it is closed.
+func (m *ForwardManager) accept(f *Forward) {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go m.handle(f, conn)
+	}
+}
+
+// handle connect to target, and copy data.
+func (m *ForwardManager) handle(f *Forward, conn net.Conn) {
+	defer conn.Close()
+
+	var targetConn net.Conn
+	var err error
+
+	switch f.Type {
+	case FORWARD_LOCAL:
+		debugf(2, "%s: open direct-tcpip channel to %s", m.c.Server, f.Target)
+		targetConn, err = m.c.Client.Dial("tcp", f.Target)
+	case FORWARD_REMOTE:
+		targetConn, err = net.Dial("tcp", f.Target)
+	case FORWARD_DYNAMIC:
+		var target string
+		target, err = socks5Handshake(conn)
+		if err != nil {
+			return
+		}
+
+		debugf(2, "%s: open direct-tcpip channel to %s (dynamic)", m.c.Server, target)
+		targetConn, err = m.c.Client.Dial("tcp", target)
+
+		// reply to socks5 client
+		reply := []byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0}
+		if err != nil {
+			reply[1] = 0x05 // connection refused
+		}
+		conn.Write(reply)
+	}
+	if err != nil {
+		return
+	}
+	defer targetConn.Close()
+
+	// metrics (`--metrics`). direction is seen from server, so it is reversed at remote forward.
+	channelType, toTarget, toListen := "direct-tcpip", "sent", "received"
+	if f.Type == FORWARD_REMOTE {
+		channelType, toTarget, toListen = "forwarded-tcpip", "received", "sent"
+	}
+	tunnel := f.Listen + " => " + f.Target
+	if f.Type == FORWARD_DYNAMIC {
+		tunnel = f.Listen + " => (socks5)"
+	}
+	metrics.add("lssh_sessions_opened_total", 1, "server", m.c.Server, "type", channelType)
+
+	done := make(chan bool, 2)
+	go func() {
+		io.Copy(&countWriter{w: &metricsWriter{w: targetConn, server: m.c.Server, tunnel: tunnel, direction: toTarget}, n: &f.BytesSent}, conn)
+		done <- true
+	}()
+	go func() {
+		io.Copy(&countWriter{w: &metricsWriter{w: conn, server: m.c.Server, tunnel: tunnel, direction: toListen}, n: &f.BytesReceived}, targetConn)
+		done <- true
+	}()
+	<-done
+}
+
+// countWriter count written bytes to n.
+type countWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw *countWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.w.Write(p)
+	atomic.AddInt64(cw.n, int64(n))
+	return
+}
+
+// socks5Handshake do socks5 handshake (no auth, CONNECT command only), and return target address.
+func socks5Handshake(conn net.Conn) (target string, err error) {
+	// version, number of methods
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(conn, header); err != nil {
+		return
+	}
+	if header[0] != 0x05 {
+		return "", fmt.Errorf("socks version %d is not supported", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err = io.ReadFull(conn, methods); err != nil {
+		return
+	}
+
+	// no authentication required
+	if _, err = conn.Write([]byte{0x05, 0x00}); err != nil {
+		return
+	}
+
+	// request: version, command, reserved, address type
+	request := make([]byte, 4)
+	if _, err = io.ReadFull(conn, request); err != nil {
+		return
+	}
+	if request[1] != 0x01 {
+		conn.Write([]byte{0x05, 0x07, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return "", fmt.Errorf("socks command %d is not supported", request[1])
+	}
+
+	var host string
+	switch request[3] {
+	case 0x01: // IPv4
+		addr := make([]byte, 4)
+		if _, err = io.ReadFull(conn, addr); err != nil {
+			return
+		}
+		host = net.IP(addr).String()
+	case 0x03: // domain name
+		length := make([]byte, 1)
+		if _, err = io.ReadFull(conn, length); err != nil {
+			return
+		}
+		addr := make([]byte, length[0])
+		if _, err = io.ReadFull(conn, addr); err != nil {
+			return
+		}
+		host = string(addr)
+	case 0x04: // IPv6
+		addr := make([]byte, 16)
+		if _, err = io.ReadFull(conn, addr); err != nil {
+			return
+		}
+		host = net.IP(addr).String()
+	default:
+		return "", fmt.Errorf("socks address type %d is not supported", request[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err = io.ReadFull(conn, port); err != nil {
+		return
+	}
+
+	target = net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	return
+}
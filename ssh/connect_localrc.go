@@ -0,0 +1,99 @@
+package ssh
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"github.com/blacknon/lssh/common"
+)
+
+// local rc shell type
+const (
+	LOCALRC_BASH = "bash"
+	LOCALRC_ZSH  = "zsh"
+	LOCALRC_FISH = "fish"
+)
+
+// defaultLocalRcFile is local rc file by shell, used if local_rc_file is not set.
+var defaultLocalRcFile = map[string]string{
+	LOCALRC_BASH: "~/.bashrc",
+	LOCALRC_ZSH:  "~/.zshrc",
+	LOCALRC_FISH: "~/.config/fish/config.fish",
+}
+
+// localRcShell return shell to run with local rc.
+// If shell is not set in config, use remote login shell (detected capability). default is bash.
+func (c *Connect) localRcShell(shell string) string {
+	if shell == "" {
+		if capability, err := c.GetCapability(); err == nil {
+			shell = path.Base(capability.Shell)
+		}
+	}
+
+	switch shell {
+	case LOCALRC_ZSH, LOCALRC_FISH:
+		return shell
+	}
+	return LOCALRC_BASH
+}
+
+// localRcData return base64 encoded header, local rc files and snippets.
+func localRcData(header string, paths, snippets []string) (result string, err error) {
+	data := []byte(header)
+	for _, p := range paths {
+		fileData, err := ioutil.ReadFile(common.GetFullPath(p))
+		if err != nil {
+			return "", err
+		}
+
+		data = append(data, fileData...)
+		data = append(data, '\n')
+	}
+
+	for _, snippet := range snippets {
+		data = append(data, snippet...)
+		data = append(data, '\n')
+	}
+
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// localRcDecodeCmd return command to decode local rc data at remote.
+func (c *Connect) localRcDecodeCmd() string {
+	if len(c.LocalRcDecodeCmd) > 0 {
+		return c.LocalRcDecodeCmd
+	}
+
+	// use cached base64 type, not detect every connection.
+	if capability, err := c.GetCapability(); err == nil && capability.Base64 != "" {
+		return capability.Base64DecodeCmd()
+	}
+
+	return "((base64 --help | grep -q coreutils) && base64 -d || base64 -D)"
+}
+
+// localRcShellCmd return command to run c.LocalRcShell with local rc.
+//   - bash ... `bash --rcfile <(...)`
+//   - zsh  ... write rc to temp dir, and run zsh with ZDOTDIR. temp dir is removed at startup.
+//   - fish ... write rc to temp file, and source it with `--init-command` (after remote config.fish)
+func (c *Connect) localRcShellCmd() string {
+	decode := "echo " + c.LocalRcData + " | " + c.localRcDecodeCmd()
+
+	switch c.LocalRcShell {
+	case LOCALRC_ZSH:
+		script := `d=$(mktemp -d "${TMPDIR:-/tmp}/lssh-zsh.XXXXXX") || exit 1; ` +
+			`{ echo "ZDOTDIR=\$HOME; rm -rf '$d'"; ` + decode + `; } > "$d/.zshrc"; ` +
+			`ZDOTDIR=$d exec zsh -i`
+		return "sh -c " + shellQuote(script)
+
+	case LOCALRC_FISH:
+		script := `f=$(mktemp "${TMPDIR:-/tmp}/lssh-fish.XXXXXX") || exit 1; ` +
+			decode + ` > "$f"; ` +
+			`exec fish --init-command "source '$f'; rm -f '$f'"`
+		return "sh -c " + shellQuote(script)
+	}
+
+	return fmt.Sprintf("bash --rcfile <(%s)", decode)
+}
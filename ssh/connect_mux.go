@@ -0,0 +1,356 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blacknon/lssh/common"
+	"golang.org/x/crypto/ssh"
+)
+
+// muxServersRequest is global request to mux socket, that return names of servers served by it (separated by newline).
+const muxServersRequest = "servers@lssh.com"
+
+// muxDialTimeout is timeout to connect mux socket.
+const muxDialTimeout = 5 * time.Second
+
+// DefaultMuxSocket return default unix socket path of --mux, in directory of current user ($XDG_RUNTIME_DIR/lssh,
+// or mux in state directory), so lscp --mux find it without path. Directory is created with mode 0700 by lssh --mux.
+func DefaultMuxSocket() string {
+	return filepath.Join(socketDir("mux"), "mux.sock")
+}
+
+// socketDir return private directory of local unix sockets of lssh. ($XDG_RUNTIME_DIR/lssh, or name in state directory)
+func socketDir(name string) string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "lssh")
+	}
+	return common.GetStatePath(name)
+}
+
+// muxHostKeyPath return path of public host key file of mux socket path, that client pin.
+func muxHostKeyPath(path string) string {
+	return path + ".pub"
+}
+
+// muxServer share authenticated connections of lssh with other lssh and lscp over unix socket, like ControlMaster of OpenSSH.
+// Each connection to socket is ssh connection (user name is server name), and its channels and requests are forwarded
+// to the connection of the server. Socket is created with mode 0600 in directory not writable by other users,
+// and peer of connection is checked to be same user (if supported by os).
+// Public host key is written next to socket (muxHostKeyPath), and client verify it.
+type muxServer struct {
+	path     string
+	listener net.Listener
+	config   *ssh.ServerConfig
+
+	conns map[string]*Connect
+	mu    sync.Mutex
+}
+
+// newMuxServer listen unix socket at path, and serve connections of conns.
+func newMuxServer(path string, conns []*Connect) (s *muxServer, err error) {
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	if err = checkMuxDir(filepath.Dir(path)); err != nil {
+		return
+	}
+
+	// remove stale socket (previous lssh is not running)
+	if _, err = os.Lstat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is already used", path)
+		}
+		os.Remove(path)
+	}
+
+	// host key of mux socket. client verify it with public key file.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return
+	}
+
+	s = &muxServer{path: path, conns: map[string]*Connect{}}
+	for _, c := range conns {
+		s.conns[c.Server] = c
+	}
+
+	s.config = &ssh.ServerConfig{
+		// accept only servers served (and empty user to ask servers), without questions.
+		KeyboardInteractiveCallback: func(meta ssh.ConnMetadata, _ ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			if meta.User() != "" && s.get(meta.User()) == nil {
+				return nil, fmt.Errorf("%s is not connected", meta.User())
+			}
+			return nil, nil
+		},
+	}
+	s.config.AddHostKey(signer)
+
+	if s.listener, err = listenUnix(path); err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, 0600); err != nil {
+		s.listener.Close()
+		return nil, err
+	}
+
+	// write public host key (replace file of other lssh, not write through it)
+	keyPath := muxHostKeyPath(path)
+	os.Remove(keyPath)
+	f, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err == nil {
+		_, err = f.Write(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+		f.Close()
+	}
+	if err != nil {
+		s.listener.Close()
+		return nil, err
+	}
+
+	for _, server := range s.servers() {
+		metrics.add("lssh_connections_active", 1, "server", server)
+	}
+	go s.accept()
+
+	return s, nil
+}
+
+// get return Connect of server, or nil.
+func (s *muxServer) get(server string) *Connect {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns[server]
+}
+
+// servers return sorted names of servers served.
+func (s *muxServer) servers() (names []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name := range s.conns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// accept clients until listener is closed.
+func (s *muxServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		if err = checkMuxPeer(conn); err != nil {
+			debugf(1, "mux: %v", err)
+			conn.Close()
+			continue
+		}
+		go s.serve(conn)
+	}
+}
+
+// serve forward channels and global requests of client to connection of server (user name).
+func (s *muxServer) serve(conn net.Conn) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		debugf(1, "mux: handshake failed, %v", err)
+		conn.Close()
+		return
+	}
+	defer sconn.Close()
+
+	server := sconn.User()
+	debugf(1, "mux: %s connected", server)
+
+	if server != "" {
+		metrics.add("lssh_mux_clients_active", 1, "server", server)
+		defer metrics.add("lssh_mux_clients_active", -1, "server", server)
+	}
+
+	go s.forwardGlobalRequests(server, reqs)
+
+	for nc := range chans {
+		c := s.get(server)
+		if c == nil || c.Client == nil {
+			nc.Reject(ssh.Prohibited, "no server is selected")
+			continue
+		}
+		go forwardChannel(server, c.Client, nc)
+	}
+}
+
+// forwardGlobalRequests forward global requests (ex. keepalive) to server. Port forward of remote is not supported.
+func (s *muxServer) forwardGlobalRequests(server string, reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		c := s.get(server)
+		switch {
+		case req.Type == muxServersRequest:
+			req.Reply(true, []byte(strings.Join(s.servers(), "\n")))
+		case c == nil || c.Client == nil, req.Type == "tcpip-forward", req.Type == "cancel-tcpip-forward":
+			req.Reply(false, nil)
+		default:
+			ok, payload, _ := c.Client.SendRequest(req.Type, req.WantReply, req.Payload)
+			req.Reply(ok, payload)
+		}
+	}
+}
+
+// forwardChannel open same channel at client of server, and forward data and requests between them.
+func forwardChannel(server string, client *ssh.Client, nc ssh.NewChannel) {
+	remote, remoteReqs, err := client.OpenChannel(nc.ChannelType(), nc.ExtraData())
+	if err != nil {
+		if oerr, ok := err.(*ssh.OpenChannelError); ok {
+			nc.Reject(oerr.Reason, oerr.Message)
+		} else {
+			nc.Reject(ssh.ConnectionFailed, err.Error())
+		}
+		return
+	}
+	defer remote.Close()
+
+	local, localReqs, err := nc.Accept()
+	if err != nil {
+		return
+	}
+	defer local.Close()
+	metrics.add("lssh_sessions_opened_total", 1, "server", server, "type", nc.ChannelType())
+
+	go func() {
+		io.Copy(&metricsWriter{w: remote, server: server, tunnel: "mux", direction: "sent"}, local)
+		remote.CloseWrite()
+	}()
+
+	// if client close channel, close channel of server.
+	go func() {
+		forwardRequests(remote, localReqs)
+		remote.Close()
+	}()
+
+	// requests of server (ex. exit-status) are forwarded until it close channel.
+	requestsDone := make(chan bool)
+	go func() {
+		forwardRequests(local, remoteReqs)
+		close(requestsDone)
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		io.Copy(&metricsWriter{w: local.Stderr(), server: server, tunnel: "mux", direction: "received"}, remote.Stderr())
+		wg.Done()
+	}()
+	io.Copy(&metricsWriter{w: local, server: server, tunnel: "mux", direction: "received"}, remote)
+	wg.Wait()
+	local.CloseWrite()
+	<-requestsDone
+}
+
+// forwardRequests send channel requests to ch, and reply result.
+func forwardRequests(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		ok, err := ch.SendRequest(req.Type, req.WantReply, req.Payload)
+		if err != nil {
+			ok = false
+		}
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+	}
+}
+
+// Close stop serving, and remove socket.
+func (s *muxServer) Close() error {
+	for _, server := range s.servers() {
+		metrics.add("lssh_connections_active", -1, "server", server)
+	}
+
+	err := s.listener.Close()
+	os.Remove(s.path)
+	os.Remove(muxHostKeyPath(s.path))
+	return err
+}
+
+// dialMux connect to mux socket path, and return client of server in it.
+// Socket and its host key file must be owned by current user, and host key of socket is verified with the file.
+func dialMux(path, server string) (*ssh.Client, error) {
+	if err := checkMuxFile(path); err != nil {
+		return nil, err
+	}
+	keyPath := muxHostKeyPath(path)
+	if err := checkMuxFile(keyPath); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host key file %s, %v", keyPath, err)
+	}
+
+	conn, err := net.DialTimeout("unix", path, muxDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkMuxPeer(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	config := &ssh.ClientConfig{
+		User: server,
+		Auth: []ssh.AuthMethod{
+			ssh.KeyboardInteractive(func(_, _ string, questions []string, _ []bool) ([]string, error) {
+				return make([]string, len(questions)), nil
+			}),
+		},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         muxDialTimeout,
+	}
+
+	sconn, chans, reqs, err := ssh.NewClientConn(conn, "unix:"+path, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newClient(sconn, chans, reqs), nil
+}
+
+// MuxServers return names of servers served by lssh --mux at socket path.
+func MuxServers(path string) (servers []string, err error) {
+	client, err := dialMux(path, "")
+	if err != nil {
+		return
+	}
+	defer client.Close()
+
+	ok, payload, err := client.SendRequest(muxServersRequest, true, nil)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return nil, errors.New("mux socket does not return servers")
+	}
+	if len(payload) > 0 {
+		servers = strings.Split(string(payload), "\n")
+	}
+	return
+}
@@ -0,0 +1,41 @@
+//go:build linux
+// +build linux
+
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// checkMuxPeer return error if process of other side of mux (or share) socket connection is not current user (SO_PEERCRED).
+func checkMuxPeer(conn net.Conn) error {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err == nil {
+		err = credErr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot get peer of socket, %v", err)
+	}
+
+	if int(cred.Uid) != os.Getuid() {
+		return fmt.Errorf("peer of socket is other user (uid %d)", cred.Uid)
+	}
+	return nil
+}
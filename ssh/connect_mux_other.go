@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package ssh
+
+import "net"
+
+// checkMuxPeer is supported at linux only. (socket and host key file are checked at other os)
+func checkMuxPeer(conn net.Conn) error {
+	return nil
+}
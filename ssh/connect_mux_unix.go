@@ -0,0 +1,62 @@
+//go:build !windows
+// +build !windows
+
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenUnix listen unix socket at path. Socket is created with mode 0600 (umask is set while creating it).
+func listenUnix(path string) (net.Listener, error) {
+	mask := syscall.Umask(0177)
+	defer syscall.Umask(mask)
+	return net.Listen("unix", path)
+}
+
+// checkMuxDir return error if directory of mux (or share) socket can be written by other users.
+// Directory must be owned by current user (or root with sticky bit, ex. /tmp), and not writable by group and others unless sticky.
+func checkMuxDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	sticky := info.Mode()&os.ModeSticky != 0
+	switch {
+	case int(st.Uid) != os.Getuid() && !(st.Uid == 0 && sticky):
+		return fmt.Errorf("directory %s of socket is not owned by current user", dir)
+	case info.Mode().Perm()&0022 != 0 && !sticky:
+		return fmt.Errorf("directory %s of socket is writable by other users", dir)
+	}
+	return nil
+}
+
+// checkMuxFile return error if mux socket (or its host key file) is not owned by current user, or accessible by other users.
+func checkMuxFile(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	switch {
+	case int(st.Uid) != os.Getuid():
+		return fmt.Errorf("%s is not owned by current user", path)
+	case info.Mode().Perm()&0077 != 0:
+		return fmt.Errorf("%s is accessible by other users", path)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build windows
+// +build windows
+
+package ssh
+
+import "net"
+
+// listenUnix listen unix socket at path.
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
+
+// checkMuxDir is not supported at windows. (owner is not checked)
+func checkMuxDir(dir string) error {
+	return nil
+}
+
+// checkMuxFile is not supported at windows. (owner is not checked)
+func checkMuxFile(path string) error {
+	return nil
+}
@@ -0,0 +1,131 @@
+package ssh
+
+import (
+	"bytes"
+	"io"
+)
+
+// OSC52 (set clipboard) escape sequence. `ESC ] 52 ; selection ; base64 data (BEL | ESC \)`
+var (
+	osc52Prefix = []byte("\x1b]52;")
+	osc52BEL    = []byte("\x07")
+	osc52ST     = []byte("\x1b\\")
+)
+
+// osc52MaxLength is max length of OSC52 sequence to wait for terminator.
+// Longer (or broken) sequence is written as it is if enabled, or discarded until terminator if disabled.
+const osc52MaxLength = 1024 * 1024
+
+// osc52Writer filter OSC52 sequences in remote output.
+//   - enabled  ... pass through set clipboard sequence to local terminal. (query is always removed)
+//   - disabled ... remove all OSC52 sequences, so that remote can not write to local clipboard.
+type osc52Writer struct {
+	w       io.Writer
+	enabled bool
+	pending []byte
+	discard bool // discarding too long sequence, until terminator
+}
+
+// newOSC52Writer return io.Writer that filter OSC52 sequences written to w.
+func newOSC52Writer(w io.Writer, enabled bool) io.Writer {
+	return &osc52Writer{w: w, enabled: enabled}
+}
+
+func (o *osc52Writer) Write(p []byte) (n int, err error) {
+	data := append(o.pending, p...)
+	o.pending = nil
+
+	out := []byte{}
+	for len(data) > 0 {
+		if o.discard {
+			end := osc52End(data)
+			if end < 0 {
+				// keep ESC at the end, it may be beginning of ST.
+				if data[len(data)-1] == osc52ST[0] {
+					o.pending = append(o.pending, osc52ST[0])
+				}
+				break
+			}
+			data = data[end:]
+			o.discard = false
+			continue
+		}
+
+		i := bytes.Index(data, osc52Prefix)
+		if i < 0 {
+			// keep incomplete prefix at the end, it may continue at next write.
+			keep := partialPrefixLength(data, osc52Prefix)
+			out = append(out, data[:len(data)-keep]...)
+			o.pending = append(o.pending, data[len(data)-keep:]...)
+			break
+		}
+		out = append(out, data[:i]...)
+		data = data[i:]
+
+		seq, ok := cutOSC52(data)
+		if !ok {
+			switch {
+			case len(data) <= osc52MaxLength:
+				o.pending = append(o.pending, data...)
+			case o.enabled:
+				out = append(out, data...)
+			default:
+				o.discard = true
+				continue
+			}
+			break
+		}
+		data = data[len(seq):]
+
+		if o.enabled && !isOSC52Query(seq) {
+			out = append(out, seq...)
+		}
+	}
+
+	if _, err = o.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// cutOSC52 return OSC52 sequence at the beginning of data (with terminator).
+func cutOSC52(data []byte) (seq []byte, ok bool) {
+	end := osc52End(data)
+	if end < 0 {
+		return nil, false
+	}
+	return data[:end], true
+}
+
+// osc52End return index after the first terminator (BEL or ST) in data, or -1 if not found.
+func osc52End(data []byte) int {
+	end := -1
+	termLen := 0
+	if i := bytes.Index(data, osc52BEL); i >= 0 {
+		end, termLen = i, len(osc52BEL)
+	}
+	if i := bytes.Index(data, osc52ST); i >= 0 && (end < 0 || i < end) {
+		end, termLen = i, len(osc52ST)
+	}
+	if end < 0 {
+		return -1
+	}
+	return end + termLen
+}
+
+// isOSC52Query return true if seq request clipboard content. (`ESC ] 52 ; c ; ? BEL`)
+func isOSC52Query(seq []byte) bool {
+	body := bytes.TrimRight(seq[len(osc52Prefix):], "\x07\x1b\\")
+	fields := bytes.SplitN(body, []byte(";"), 2)
+	return len(fields) == 2 && bytes.Equal(fields[1], []byte("?"))
+}
+
+// partialPrefixLength return length of the longest suffix of data that is a prefix of prefix.
+func partialPrefixLength(data, prefix []byte) int {
+	for l := len(prefix) - 1; l > 0; l-- {
+		if len(data) >= l && bytes.Equal(data[len(data)-l:], prefix[:l]) {
+			return l
+		}
+	}
+	return 0
+}
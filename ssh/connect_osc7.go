@@ -0,0 +1,69 @@
+package ssh
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"regexp"
+	"sync"
+)
+
+// osc7Prefix is head of OSC7 sequence.
+var osc7Prefix = []byte("\x1b]7;")
+
+// osc7Regex match OSC7 (current directory) escape sequence. `ESC ] 7 ; file://host/path (BEL | ESC \)`
+var osc7Regex = regexp.MustCompile(`\x1b\]7;([^\x07\x1b]*)(?:\x07|\x1b\\)`)
+
+// osc7MaxLength is max length of incomplete OSC7 sequence to keep for next write.
+const osc7MaxLength = 4096
+
+// cwdWriter pass through remote output to w as it is, and track current directory of remote shell reported with OSC7.
+// Shell report it at prompt, if configured. ex) bash: `PROMPT_COMMAND='printf "\e]7;file://%s%s\a" "$HOSTNAME" "$PWD"'`
+type cwdWriter struct {
+	w    io.Writer
+	dir  string
+	tail []byte // incomplete sequence at the end of last write
+	mu   sync.Mutex
+}
+
+// newCwdWriter return cwdWriter that write to w.
+func newCwdWriter(w io.Writer) *cwdWriter {
+	return &cwdWriter{w: w}
+}
+
+func (c *cwdWriter) Write(p []byte) (n int, err error) {
+	c.mu.Lock()
+	data := append(c.tail, p...)
+	for _, m := range osc7Regex.FindAllSubmatch(data, -1) {
+		if dir := parseOSC7(string(m[1])); dir != "" {
+			c.dir = dir
+		}
+	}
+
+	// keep incomplete sequence (without terminator), it may continue at next write.
+	c.tail = nil
+	if i := bytes.LastIndex(data, osc7Prefix); i >= 0 && len(data)-i < osc7MaxLength && !osc7Regex.Match(data[i:]) {
+		c.tail = append([]byte{}, data[i:]...)
+	} else if keep := partialPrefixLength(data, osc7Prefix); keep > 0 {
+		c.tail = append([]byte{}, data[len(data)-keep:]...)
+	}
+	c.mu.Unlock()
+
+	return c.w.Write(p)
+}
+
+// Dir return current directory of remote shell. If it is not reported, return empty string.
+func (c *cwdWriter) Dir() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dir
+}
+
+// parseOSC7 return path of OSC7 parameter (`file://host/path`, percent-encoded). If it is not file url, return empty string.
+func parseOSC7(param string) string {
+	u, err := url.Parse(param)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return u.Path
+}
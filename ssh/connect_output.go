@@ -0,0 +1,64 @@
+package ssh
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+// outputFlushDelay is time to wait for rest of line, before sending incomplete line. (ex. prompt without newline, progress with `\r`)
+const outputFlushDelay = 10 * time.Millisecond
+
+// sendOutputLines read r until EOF, and send it to outputChan line by line.
+// Incomplete line is sent after outputFlushDelay, if rest of it is not read.
+func sendOutputLines(r io.Reader, outputChan chan []byte) {
+	chunks := make(chan []byte)
+	go func() {
+		defer close(chunks)
+
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				chunks <- append([]byte(nil), buf[:n]...)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var pending []byte
+	var flush <-chan time.Time
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				if len(pending) > 0 {
+					outputChan <- pending
+				}
+				return
+			}
+
+			pending = append(pending, chunk...)
+			for {
+				i := bytes.IndexByte(pending, '\n')
+				if i < 0 {
+					break
+				}
+				outputChan <- pending[: i+1 : i+1]
+				pending = pending[i+1:]
+			}
+			pending = append([]byte(nil), pending...)
+
+			flush = nil
+			if len(pending) > 0 {
+				flush = time.After(outputFlushDelay)
+			}
+
+		case <-flush:
+			outputChan <- pending
+			pending, flush = nil, nil
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/blacknon/lssh/conf"
+)
+
+// errPoolClosed is error of Get after ConnectPool is closed.
+var errPoolClosed = errors.New("connection pool is closed")
+
+// ConnectPool cache connected *ssh.Client per server, and share it between callers.
+// It is safe for concurrent use. Each Get return a new *Connect with shared Client,
+// so callers do not share fields of Connect.
+//
+// Connect returned by Get must be returned by Put, and its Client must not be closed by caller.
+type ConnectPool struct {
+	Conf    conf.Config
+	AuthMap map[AuthKey][]ssh.Signer
+
+	// max number of cached clients (servers). If reached, Get wait for a client to be idle. 0 is unlimited.
+	MaxSize int
+
+	// idle client is closed after this time. 0 is never.
+	IdleTimeout time.Duration
+
+	// writer of warnings at connect. If nil, os.Stderr.
+	Stderr io.Writer
+
+	mu       sync.Mutex
+	entries  map[string]*poolEntry
+	borrowed map[*Connect]*poolEntry
+	released chan bool // closed and renewed when client is released, to wake up waiting Get
+	closed   bool
+
+	expireOnce sync.Once
+	stop       chan bool
+}
+
+// poolEntry is cached client of server.
+type poolEntry struct {
+	con      *Connect
+	refs     int
+	lastUsed time.Time
+
+	// closed when connect is finished. err is error of it.
+	ready chan bool
+	err   error
+}
+
+// NewConnectPool return ConnectPool to servers of config. authMap is used to authenticate.
+func NewConnectPool(config conf.Config, authMap map[AuthKey][]ssh.Signer) *ConnectPool {
+	return &ConnectPool{
+		Conf:     config,
+		AuthMap:  authMap,
+		entries:  map[string]*poolEntry{},
+		borrowed: map[*Connect]*poolEntry{},
+		released: make(chan bool),
+		stop:     make(chan bool),
+	}
+}
+
+// Get return *Connect to server. Cached client is reused if it is alive, otherwise connect with ctx.
+// Concurrent Get of the same server share one connect.
+func (p *ConnectPool) Get(ctx context.Context, server string) (con *Connect, err error) {
+	p.expireOnce.Do(func() {
+		if p.IdleTimeout > 0 {
+			go p.expireLoop()
+		}
+	})
+
+	for {
+		p.mu.Lock()
+		expired := p.expire()
+		p.mu.Unlock()
+		closeClients(expired)
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, errPoolClosed
+		}
+
+		e, ok := p.entries[server]
+		if ok {
+			e.refs++
+			p.mu.Unlock()
+
+			select {
+			case <-e.ready:
+			case <-ctx.Done():
+				p.release(e)
+				return nil, ctx.Err()
+			}
+
+			if e.err != nil {
+				p.release(e)
+
+				// connect of other caller is canceled, retry with own ctx
+				if (e.err == context.Canceled || e.err == context.DeadlineExceeded) && ctx.Err() == nil {
+					continue
+				}
+				return nil, e.err
+			}
+
+			// health check
+			if err = e.con.CheckClientAlive(); err != nil {
+				debugf(1, "%s: cached connection is not alive, reconnect. %v", server, err)
+				p.discard(server, e)
+				p.release(e)
+				continue
+			}
+			return p.borrow(e), nil
+		}
+
+		// wait for idle client to be evicted, if pool is full
+		var evicted *ssh.Client
+		if p.MaxSize > 0 && len(p.entries) >= p.MaxSize {
+			evicted = p.evictIdle()
+			if evicted == nil {
+				released := p.released
+				p.mu.Unlock()
+
+				select {
+				case <-released:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				continue
+			}
+		}
+
+		// connect
+		e = &poolEntry{refs: 1, ready: make(chan bool)}
+		p.entries[server] = e
+		p.mu.Unlock()
+
+		if evicted != nil {
+			evicted.Close()
+		}
+
+		c := &Connect{Server: server, Conf: p.Conf, AuthMap: p.AuthMap, Stderr: p.Stderr}
+		err = c.CreateClientContext(ctx)
+
+		p.mu.Lock()
+		if err != nil {
+			e.err = err
+			if p.entries[server] == e {
+				delete(p.entries, server)
+			}
+		} else {
+			e.con = c
+		}
+		close(e.ready)
+		p.mu.Unlock()
+
+		if err != nil {
+			p.release(e)
+			return nil, err
+		}
+		return p.borrow(e), nil
+	}
+}
+
+// Put return con got by Get to p. If Client of con is reconnected by caller, it is closed.
+func (p *ConnectPool) Put(con *Connect) {
+	p.mu.Lock()
+	e, ok := p.borrowed[con]
+	delete(p.borrowed, con)
+	p.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	if con.Client != nil && con.Client != e.con.Client {
+		con.Client.Close()
+	}
+	p.release(e)
+}
+
+// Discard close cached client of con, e.g. after connection error. con is returned to p, as Put.
+func (p *ConnectPool) Discard(con *Connect) {
+	p.mu.Lock()
+	e, ok := p.borrowed[con]
+	p.mu.Unlock()
+
+	if ok {
+		p.discard(con.Server, e)
+	}
+	p.Put(con)
+}
+
+// Len return number of cached clients.
+func (p *ConnectPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.entries)
+}
+
+// Close close all cached clients. Connects not returned by Put are also disconnected.
+func (p *ConnectPool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.stop)
+
+	clients := []*ssh.Client{}
+	for server, e := range p.entries {
+		if e.con != nil {
+			clients = append(clients, e.con.Client)
+		}
+		delete(p.entries, server)
+	}
+	p.wake()
+	p.mu.Unlock()
+
+	closeClients(clients)
+}
+
+// borrow return new Connect with client of e.
+func (p *ConnectPool) borrow(e *poolEntry) *Connect {
+	con := &Connect{
+		Server:           e.con.Server,
+		Conf:             p.Conf,
+		Client:           e.con.Client,
+		AuthMap:          p.AuthMap,
+		Stderr:           p.Stderr,
+		HostKey:          e.con.HostKey,
+		X11:              e.con.X11,
+		X11Trusted:       e.con.X11Trusted,
+		sshAgent:         e.con.sshAgent,
+		sshExtendedAgent: e.con.sshExtendedAgent,
+	}
+
+	p.mu.Lock()
+	p.borrowed[con] = e
+	p.mu.Unlock()
+
+	return con
+}
+
+// release decrement reference count of e.
+func (p *ConnectPool) release(e *poolEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e.refs--
+	e.lastUsed = time.Now()
+	p.wake()
+}
+
+// discard remove e of server from p, and close its client.
+func (p *ConnectPool) discard(server string, e *poolEntry) {
+	p.mu.Lock()
+	if p.entries[server] == e {
+		delete(p.entries, server)
+		p.wake()
+	}
+	p.mu.Unlock()
+
+	e.con.Client.Close()
+}
+
+// wake wake up Get waiting for idle client. p.mu must be locked.
+func (p *ConnectPool) wake() {
+	close(p.released)
+	p.released = make(chan bool)
+}
+
+// evictIdle remove least recently used idle client from p, and return it. p.mu must be locked.
+func (p *ConnectPool) evictIdle() (client *ssh.Client) {
+	var oldest string
+	for server, e := range p.entries {
+		if e.refs > 0 || e.con == nil {
+			continue
+		}
+		if oldest == "" || e.lastUsed.Before(p.entries[oldest].lastUsed) {
+			oldest = server
+		}
+	}
+	if oldest == "" {
+		return nil
+	}
+
+	client = p.entries[oldest].con.Client
+	delete(p.entries, oldest)
+	return
+}
+
+// expire remove clients idle longer than IdleTimeout from p, and return them. p.mu must be locked.
+func (p *ConnectPool) expire() (clients []*ssh.Client) {
+	if p.IdleTimeout <= 0 {
+		return
+	}
+
+	for server, e := range p.entries {
+		if e.refs == 0 && e.con != nil && time.Since(e.lastUsed) > p.IdleTimeout {
+			clients = append(clients, e.con.Client)
+			delete(p.entries, server)
+		}
+	}
+	return
+}
+
+// expireLoop close idle clients periodically, until p is closed.
+func (p *ConnectPool) expireLoop() {
+	interval := p.IdleTimeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.mu.Lock()
+			clients := p.expire()
+			p.mu.Unlock()
+			closeClients(clients)
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// closeClients close clients.
+func closeClients(clients []*ssh.Client) {
+	for _, client := range clients {
+		client.Close()
+	}
+}
@@ -2,11 +2,16 @@ package ssh
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
 
+	"github.com/blacknon/lssh/common"
+
 	"github.com/blacknon/lssh/conf"
 	"golang.org/x/net/proxy"
 )
@@ -23,6 +28,9 @@ type httpProxy struct {
 	username string
 	password string
 	forward  proxy.Dialer
+
+	// if not nil, connect to proxy with tls (https proxy)
+	tlsConfig *tls.Config
 }
 
 // Dial return net.Conn via http proxy
@@ -32,6 +40,16 @@ func (s *httpProxy) Dial(network, addr string) (net.Conn, error) {
 		return nil, err
 	}
 
+	// https proxy
+	if s.tlsConfig != nil {
+		tlsConn := tls.Client(c, s.tlsConfig)
+		if err = tlsConn.Handshake(); err != nil {
+			c.Close()
+			return nil, err
+		}
+		c = tlsConn
+	}
+
 	reqURL, err := url.Parse("http://" + addr)
 	if err != nil {
 		c.Close()
@@ -58,7 +76,6 @@ func (s *httpProxy) Dial(network, addr string) (net.Conn, error) {
 
 	resp, err := http.ReadResponse(bufio.NewReader(c), req)
 	if err != nil {
-		resp.Body.Close()
 		c.Close()
 		return nil, err
 	}
@@ -81,22 +98,52 @@ func newHTTPProxy(uri *url.URL, forward proxy.Dialer) (proxy.Dialer, error) {
 		s.username = uri.User.Username()
 		s.password, _ = uri.User.Password()
 	}
+	if uri.Scheme == "https" {
+		s.tlsConfig = &tls.Config{ServerName: uri.Hostname()}
+	}
 	return s, nil
 }
 
-func createProxyDialerHttp(proxyConf conf.ProxyConfig) (proxyDialer proxy.Dialer, err error) {
+// createProxyDialerHttp return proxy.Dialer via http proxy.
+// If isTLS is true, connect to proxy with tls (https proxy).
+func createProxyDialerHttp(proxyConf conf.ProxyConfig, isTLS bool) (proxyDialer proxy.Dialer, err error) {
 	proxy.RegisterDialerType("http", newHTTPProxy)
 	proxy.RegisterDialerType("https", newHTTPProxy)
 
 	directProxy := direct{}
 
-	proxyURL := "http://" + proxyConf.Addr + ":" + proxyConf.Port
-	if proxyConf.User != "" && proxyConf.Pass != "" {
-		proxyURL = "http://" + proxyConf.User + ":" + proxyConf.Pass + "@" + proxyConf.Addr + ":" + proxyConf.Port
+	proxyURI := &url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(proxyConf.Addr, proxyConf.Port),
+	}
+	if isTLS {
+		proxyURI.Scheme = "https"
+	}
+
+	// url.UserPassword escape special characters in user and password.
+	if proxyConf.User != "" {
+		proxyURI.User = url.UserPassword(proxyConf.User, proxyConf.Pass)
 	}
 
-	proxyURI, _ := url.Parse(proxyURL)
 	proxyDialer, err = proxy.FromURL(proxyURI, directProxy)
+	if err != nil {
+		return
+	}
+
+	// set custom CA
+	if isTLS && proxyConf.CACert != "" {
+		pem, err := ioutil.ReadFile(common.GetFullPath(proxyConf.CACert))
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("cannot read ca_cert %s", proxyConf.CACert)
+		}
+
+		proxyDialer.(*httpProxy).tlsConfig.RootCAs = pool
+	}
 
 	return
 }
@@ -11,9 +11,11 @@ import (
 func createProxyDialerSocks5(proxyConf conf.ProxyConfig) (proxyDialer proxy.Dialer, err error) {
 	var proxyAuth *proxy.Auth
 
-	if proxyConf.User != "" && proxyConf.Pass != "" {
-		proxyAuth.User = proxyConf.User
-		proxyAuth.Password = proxyConf.Pass
+	if proxyConf.User != "" {
+		proxyAuth = &proxy.Auth{
+			User:     proxyConf.User,
+			Password: proxyConf.Pass,
+		}
 	}
 
 	proxyDialer, err = proxy.SOCKS5("tcp", net.JoinHostPort(proxyConf.Addr, proxyConf.Port), proxyAuth, proxy.Direct)
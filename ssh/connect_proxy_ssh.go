@@ -1,6 +1,7 @@
 package ssh
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
@@ -17,14 +18,20 @@ func createClientViaProxy(config conf.ServerConfig, sshConf *ssh.ClientConfig, p
 	switch {
 	// direct connect ssh proxy
 	case (proxyClient == nil) && (dialer == nil):
-		if config.ProxyCommand == "" || config.ProxyCommand == "none" { // not set ProxyCommand
-			client, err = ssh.Dial("tcp", net.JoinHostPort(config.Addr, config.Port), sshConf)
+		if config.Transport != "" { // websocket or tls transport
+			client, err = createClientViaTransport(config, sshConf, nil)
+		} else if config.ProxyCommand == "" || config.ProxyCommand == "none" { // not set ProxyCommand
+			client, err = dialSsh(context.Background(), config, sshConf)
 		} else { // set ProxyCommand
 			client, err = createClientViaProxyCommand(config, sshConf)
 		}
 
 	// connect ssh via proxy(http|socks5)
 	case (proxyClient == nil) && (dialer != nil):
+		if config.Transport != "" {
+			return createClientViaTransport(config, sshConf, dialer)
+		}
+
 		proxyConn, err := dialer.Dial("tcp", net.JoinHostPort(config.Addr, config.Port))
 		if err != nil {
 			return client, err
@@ -35,7 +42,7 @@ func createClientViaProxy(config conf.ServerConfig, sshConf *ssh.ClientConfig, p
 			return client, err
 		}
 
-		client = ssh.NewClient(pConnect, pChans, pReqs)
+		client = newClient(pConnect, pChans, pReqs)
 
 	// connect ssh via proxy(ssh)
 	default:
@@ -53,7 +60,7 @@ func createClientViaProxy(config conf.ServerConfig, sshConf *ssh.ClientConfig, p
 			return client, err
 		}
 
-		client = ssh.NewClient(pConnect, pChans, pReqs)
+		client = newClient(pConnect, pChans, pReqs)
 
 	}
 
@@ -63,12 +70,7 @@ func createClientViaProxy(config conf.ServerConfig, sshConf *ssh.ClientConfig, p
 // createClientViaProxyCommand return ssh.Client via ProxyCommand
 func createClientViaProxyCommand(config conf.ServerConfig, sshConf *ssh.ClientConfig) (client *ssh.Client, err error) {
 	// set
-	proxyCommand := config.ProxyCommand
-
-	// replace variable
-	proxyCommand = strings.Replace(proxyCommand, "%h", config.Addr, -1)
-	proxyCommand = strings.Replace(proxyCommand, "%p", config.Port, -1)
-	proxyCommand = strings.Replace(proxyCommand, "%r", config.User, -1)
+	proxyCommand := expandProxyCommand(config.ProxyCommand, config)
 
 	// Create net.Pipe(), and set proxyCommand
 	pipeClient, pipeServer := net.Pipe()
@@ -91,7 +93,28 @@ func createClientViaProxyCommand(config conf.ServerConfig, sshConf *ssh.ClientCo
 	}
 
 	// create ssh.Client
-	client = ssh.NewClient(conn, incomingChannels, incomingRequests)
+	client = newClient(conn, incomingChannels, incomingRequests)
 
 	return
 }
+
+// expandProxyCommand expand OpenSSH style tokens in ProxyCommand.
+//   - %h ... addr
+//   - %p ... port (default: 22)
+//   - %r ... user
+//   - %% ... `%`
+func expandProxyCommand(proxyCommand string, config conf.ServerConfig) string {
+	port := config.Port
+	if port == "" {
+		port = "22"
+	}
+
+	replacer := strings.NewReplacer(
+		"%%", "%",
+		"%h", config.Addr,
+		"%p", port,
+		"%r", config.User,
+	)
+
+	return replacer.Replace(proxyCommand)
+}
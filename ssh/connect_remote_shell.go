@@ -0,0 +1,159 @@
+package ssh
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"path"
+	"strings"
+	"unicode/utf16"
+)
+
+// remote shell type
+const (
+	REMOTESHELL_POSIX      = "posix"
+	REMOTESHELL_FISH       = "fish"
+	REMOTESHELL_POWERSHELL = "powershell"
+)
+
+// remoteShellType return type of remote_shell.
+func remoteShellType(shell string) string {
+	name := strings.ToLower(path.Base(strings.Replace(shell, `\`, "/", -1)))
+	name = strings.TrimSuffix(name, ".exe")
+
+	switch name {
+	case "fish":
+		return REMOTESHELL_FISH
+	case "powershell", "pwsh":
+		return REMOTESHELL_POWERSHELL
+	}
+	return REMOTESHELL_POSIX
+}
+
+// remoteShellCmd return command line to run command with remote_shell.
+// If dir is not empty, command is run after `cd` to dir (not run, if cd failed).
+// If runID is not empty and shell is set, LSSH_RUN_ID is exported in command (sshd not accept env).
+// Login shell syntax is unknown (fish, cmd.exe...), so it is not exported if shell is empty.
+//   - empty      ... run with remote login shell as it is (OpenSSH default)
+//   - sh, bash.. ... `<shell> -c '<command>'`
+//   - fish       ... `<shell> -c '<command>'` (fish syntax export)
+//   - powershell ... `<shell> -NoProfile -NonInteractive -EncodedCommand <base64>` (no quoting by cmd.exe at Windows OpenSSH)
+func remoteShellCmd(shell, dir, command, runID string) string {
+	shellType := remoteShellType(shell)
+
+	if dir != "" {
+		switch {
+		case shell != "" && shellType == REMOTESHELL_FISH:
+			command = "cd " + remoteDirQuote(dir) + "; or exit 1; " + command
+		case shell != "" && shellType == REMOTESHELL_POWERSHELL:
+			command = "Set-Location -Path " + powershellQuote(dir) + " -ErrorAction Stop; " + command
+		default:
+			command = "cd " + remoteDirQuote(dir) + " || exit 1; " + command
+		}
+	}
+
+	if runID != "" && shell != "" {
+		switch shellType {
+		case REMOTESHELL_FISH:
+			command = "set -gx LSSH_RUN_ID " + shellQuote(runID) + "; " + command
+		case REMOTESHELL_POWERSHELL:
+			command = "$env:LSSH_RUN_ID = " + powershellQuote(runID) + "; " + command
+		default:
+			command = "LSSH_RUN_ID=" + shellQuote(runID) + "; export LSSH_RUN_ID; " + command
+		}
+	}
+
+	switch {
+	case shell == "":
+		return command
+	case shellType == REMOTESHELL_POWERSHELL:
+		return shell + " -NoProfile -NonInteractive -EncodedCommand " + powershellEncode(command)
+	}
+	return shell + " -c " + shellQuote(command)
+}
+
+// remoteTermCmd return command line to start terminal session, with chdir and initial_cmd.
+// shellCmd is command to start shell (ex. local rc), or empty to start login shell.
+// If nothing is changed from default, return empty string (use shell request).
+//   - initial_cmd ... `cd <dir>; <initial_cmd>` (run instead of shell)
+//   - chdir       ... `cd <dir>; exec $SHELL -l`
+//   - powershell  ... `<shell> -NoExit -EncodedCommand <base64>`
+func remoteTermCmd(shell, dir, initialCmd, shellCmd string) string {
+	if dir == "" && initialCmd == "" {
+		return shellCmd
+	}
+
+	if shell != "" && remoteShellType(shell) == REMOTESHELL_POWERSHELL {
+		script := initialCmd
+		if dir != "" {
+			script = "Set-Location -Path " + powershellQuote(dir) + "; " + script
+		}
+		return shell + " -NoLogo -NoExit -EncodedCommand " + powershellEncode(script)
+	}
+
+	command := initialCmd
+	switch {
+	case command != "":
+	case shellCmd != "":
+		command = shellCmd
+	case shell != "":
+		command = "exec " + shell + " -l"
+	default:
+		command = "exec $SHELL -l"
+	}
+
+	if dir != "" {
+		command = "cd " + remoteDirQuote(dir) + "; " + command
+	}
+	return command
+}
+
+// remoteDirQuote quote directory path for remote shell. `~` at head is not quoted, to be expanded to home directory.
+func remoteDirQuote(dir string) string {
+	switch {
+	case dir == "~":
+		return dir
+	case strings.HasPrefix(dir, "~/"):
+		return "~/" + shellQuote(dir[2:])
+	}
+	return shellQuote(dir)
+}
+
+// powershellQuote quote str with single quote for PowerShell.
+func powershellQuote(str string) string {
+	return "'" + strings.Replace(str, "'", "''", -1) + "'"
+}
+
+// powershellEncode encode command for `powershell -EncodedCommand`. (base64 of UTF-16LE)
+func powershellEncode(command string) string {
+	codes := utf16.Encode([]rune(command))
+
+	data := make([]byte, len(codes)*2)
+	for i, code := range codes {
+		binary.LittleEndian.PutUint16(data[i*2:], code)
+	}
+
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// remoteCmd return command line to run command at c.Server, with remote_shell of server config.
+func (c *Connect) remoteCmd(command string, exportRunID bool) string {
+	runID := ""
+	if exportRunID {
+		runID = c.RunID
+	}
+
+	serverConf := c.Conf.Server[c.Server]
+	return remoteShellCmd(serverConf.RemoteShell, serverConf.Chdir, command, runID)
+}
+
+// termCmd return command line to start terminal session at c.Server, with local rc, chdir and initial_cmd of server config.
+// If empty, start login shell with shell request.
+func (c *Connect) termCmd() string {
+	shellCmd := ""
+	if c.IsLocalRc {
+		shellCmd = c.localRcShellCmd()
+	}
+
+	serverConf := c.Conf.Server[c.Server]
+	return remoteTermCmd(serverConf.RemoteShell, serverConf.Chdir, serverConf.InitialCmd, shellCmd)
+}
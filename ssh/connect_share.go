@@ -0,0 +1,182 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// shareBufferSize is number of pending writes per observer. If observer is slower, it is disconnected.
+const shareBufferSize = 256
+
+// DefaultShareSocket return default unix socket path of shared session, in private directory. (same as DefaultMuxSocket)
+func DefaultShareSocket() string {
+	return filepath.Join(socketDir("share"), fmt.Sprintf("share-%d.sock", os.Getpid()))
+}
+
+// shareServer send terminal output to observers attached to unix socket. (read-only, input from observers is ignored)
+type shareServer struct {
+	path      string
+	listener  net.Listener
+	observers map[net.Conn]chan []byte
+	mu        sync.Mutex
+}
+
+// newShareServer listen unix socket at path, and accept observers.
+// Socket is created with mode 0600 in directory not writable by other users, and peer of connection is checked
+// to be same user (if supported by os), so only same user can attach by default.
+func newShareServer(path string) (s *shareServer, err error) {
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	if err = checkMuxDir(filepath.Dir(path)); err != nil {
+		return
+	}
+
+	// remove stale socket (previous lssh is not running)
+	if _, err = os.Lstat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is already used", path)
+		}
+		os.Remove(path)
+	}
+
+	listener, err := listenUnix(path)
+	if err != nil {
+		return
+	}
+	if err = os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return
+	}
+
+	s = &shareServer{
+		path:      path,
+		listener:  listener,
+		observers: map[net.Conn]chan []byte{},
+	}
+	go s.accept()
+
+	return s, nil
+}
+
+// accept observers until listener is closed.
+func (s *shareServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		if err = checkMuxPeer(conn); err != nil {
+			debugf(1, "share: %v", err)
+			conn.Close()
+			continue
+		}
+
+		ch := make(chan []byte, shareBufferSize)
+		s.mu.Lock()
+		s.observers[conn] = ch
+		count := len(s.observers)
+		s.mu.Unlock()
+
+		// notify to primary user
+		escapePrint(fmt.Sprintf("[lssh] observer attached. (%d observers)\n", count))
+
+		go s.send(conn, ch)
+		go func() {
+			// input from observer is ignored. returns when observer is detached.
+			io.Copy(ioutil.Discard, conn)
+			s.remove(conn)
+		}()
+	}
+}
+
+// send write terminal output to observer.
+func (s *shareServer) send(conn net.Conn, ch chan []byte) {
+	for data := range ch {
+		if _, err := conn.Write(data); err != nil {
+			s.remove(conn)
+			return
+		}
+	}
+}
+
+// remove disconnect observer.
+func (s *shareServer) remove(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch, ok := s.observers[conn]
+	if !ok {
+		return
+	}
+	delete(s.observers, conn)
+	close(ch)
+	conn.Close()
+
+	escapePrint(fmt.Sprintf("[lssh] observer detached. (%d observers)\n", len(s.observers)))
+}
+
+// Write send p to all observers. It does not block terminal output, slow observer is disconnected.
+func (s *shareServer) Write(p []byte) (n int, err error) {
+	data := append([]byte{}, p...)
+
+	s.mu.Lock()
+	slow := []net.Conn{}
+	for conn, ch := range s.observers {
+		select {
+		case ch <- data:
+		default:
+			slow = append(slow, conn)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, conn := range slow {
+		s.remove(conn)
+	}
+	return len(p), nil
+}
+
+// Close disconnect all observers, and remove socket.
+func (s *shareServer) Close() {
+	s.listener.Close()
+
+	s.mu.Lock()
+	conns := []net.Conn{}
+	for conn := range s.observers {
+		conns = append(conns, conn)
+	}
+	s.mu.Unlock()
+
+	for _, conn := range conns {
+		s.remove(conn)
+	}
+	os.Remove(s.path)
+}
+
+// AttachShare attach to shared session as read-only observer, and print terminal output until session is closed.
+// target is unix socket path, or `host:port` (ex. socket forwarded with `ssh -L 7000:/run/user/1000/lssh/share-1234.sock`).
+func AttachShare(target string) (err error) {
+	network := "unix"
+	if _, statErr := os.Stat(target); statErr != nil && strings.Contains(target, ":") {
+		network = "tcp"
+	}
+
+	conn, err := net.Dial(network, target)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(os.Stderr, "Attached to shared session %s (read-only). Ctrl+C to detach.\n", target)
+	_, err = io.Copy(os.Stdout, conn)
+	fmt.Fprintf(os.Stderr, "\nShared session closed.\n")
+	return
+}
@@ -1,6 +1,7 @@
 package ssh
 
 import (
+	"errors"
 	"fmt"
 	sshkeys "github.com/ScaleFT/sshkeys"
 	"io/ioutil"
@@ -9,6 +10,8 @@ import (
 	"os/user"
 	"strings"
 
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 )
@@ -27,15 +30,15 @@ func (c *Connect) CreateSshAgent() (err error) {
 	//         fugafuga
 	//     }
 
-	// Get SSH_AUTH-SOCK
-	sock, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+	// Get agent socket (agent_socket or SSH_AUTH_SOCK)
+	sock, err := dialAgentSocket(conf)
 	if err != nil {
 		// declare sshAgent(Agent)
 		sshAgent := agent.NewKeyring()
 		for _, keyPathData := range sshKeys {
 			key, err := parseKeyArray(keyPathData)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "failed parse key: %v\n", err)
+				fmt.Fprintf(c.stderr(), "failed parse key: %v\n", err)
 				continue
 			}
 
@@ -46,7 +49,7 @@ func (c *Connect) CreateSshAgent() (err error) {
 				LifetimeSecs:     3000,
 			})
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "failed add key to sshAgent: %v\n", err)
+				fmt.Fprintf(c.stderr(), "failed add key to sshAgent: %v\n", err)
 				continue
 			}
 		}
@@ -58,7 +61,7 @@ func (c *Connect) CreateSshAgent() (err error) {
 		for _, keyPathData := range sshKeys {
 			key, err := parseKeyArray(keyPathData)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "failed parse key: %v\n", err)
+				fmt.Fprintf(c.stderr(), "failed parse key: %v\n", err)
 				continue
 			}
 
@@ -69,7 +72,7 @@ func (c *Connect) CreateSshAgent() (err error) {
 				LifetimeSecs:     3000,
 			})
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "failed add key to sshAgent: %v\n", err)
+				fmt.Fprintf(c.stderr(), "failed add key to sshAgent: %v\n", err)
 				continue
 			}
 		}
@@ -78,6 +81,54 @@ func (c *Connect) CreateSshAgent() (err error) {
 	return
 }
 
+// agentSocketPath return ssh-agent socket path of server. agent_socket (`~` and environment variables are expanded), or $SSH_AUTH_SOCK.
+// If agent_socket is "none", return empty.
+func agentSocketPath(serverConf conf.ServerConfig) string {
+	switch serverConf.AgentSocket {
+	case "", "SSH_AUTH_SOCK":
+		return os.Getenv("SSH_AUTH_SOCK")
+	case "none":
+		return ""
+	}
+	return common.GetFullPath(os.ExpandEnv(serverConf.AgentSocket))
+}
+
+// dialAgentSocket connect to ssh-agent socket of server.
+func dialAgentSocket(serverConf conf.ServerConfig) (net.Conn, error) {
+	path := agentSocketPath(serverConf)
+	if path == "" {
+		return nil, errors.New("ssh-agent socket is not set")
+	}
+	return net.Dial("unix", path)
+}
+
+// agentOf return ssh-agent to authenticate server (c.Server or its proxy). If proxy has other agent_socket, connect to it.
+func (c *Connect) agentOf(server string) agent.Agent {
+	if server == c.Server || c.runAgent != nil {
+		return c.getAgent()
+	}
+
+	serverConf := c.Conf.Server[server]
+	if sshAgent := c.getAgent(); sshAgent != nil && serverConf.AgentSocket == c.Conf.Server[c.Server].AgentSocket {
+		return sshAgent
+	}
+
+	sock, err := dialAgentSocket(serverConf)
+	if err != nil {
+		debugf(1, "%s: cannot connect to ssh-agent, %v", server, err)
+		return nil
+	}
+	return agent.NewClient(sock)
+}
+
+// getAgent return ssh-agent of c (run agent, or agent created by CreateSshAgent). If not created, return nil.
+func (c *Connect) getAgent() agent.Agent {
+	if c.sshExtendedAgent != nil {
+		return c.sshExtendedAgent
+	}
+	return c.sshAgent
+}
+
 func parseKeyArray(keyPathStr string) (key interface{}, err error) {
 	// parse ssh key strings
 	//    * keyPathArray[0] ... KeyPath
@@ -0,0 +1,47 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFdsStart is first file descriptor passed by systemd socket activation.
+// See also: sd_listen_fds(3)
+const listenFdsStart = 3
+
+// SystemdListeners returns net.Listener inherited from systemd socket activation (LISTEN_FDS).
+// If the process was not started by socket activation, it returns empty slice.
+func SystemdListeners() (listeners []net.Listener, err error) {
+	// check LISTEN_PID is this process
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds == 0 {
+		return nil, nil
+	}
+
+	// unset env, so that child process does not inherit.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	for fd := listenFdsStart; fd < listenFdsStart+nfds; fd++ {
+		file := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+
+		// net.FileListener duplicates the fd, so close original file.
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return listeners, fmt.Errorf("fd %d is not socket: %v", fd, err)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	return
+}
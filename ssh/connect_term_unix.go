@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+package ssh
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// watchTermResize send window-change request to session, when local terminal is resized (SIGWINCH).
+// Call returned stop func to stop watching.
+func watchTermResize(session *ssh.Session) (stop func()) {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGWINCH)
+
+	go func() {
+		for range signalChan {
+			width, height, err := terminal.GetSize(int(os.Stdout.Fd()))
+			if err == nil {
+				session.WindowChange(height, width)
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signalChan)
+		close(signalChan)
+	}
+}
+
+// enableVirtualTerminal is nothing to do at unix. (terminal process VT sequences)
+func enableVirtualTerminal() (restore func()) {
+	return func() {}
+}
@@ -0,0 +1,78 @@
+//go:build windows
+// +build windows
+
+package ssh
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/sys/windows"
+)
+
+// termResizeInterval is interval to check console size. (Windows does not have SIGWINCH)
+const termResizeInterval = 250 * time.Millisecond
+
+// watchTermResize send window-change request to session, when console is resized.
+// Windows console report resize with input event, but stdin is read by session, so poll console size.
+// Call returned stop func to stop watching.
+func watchTermResize(session *ssh.Session) (stop func()) {
+	done := make(chan bool)
+
+	go func() {
+		fd := int(os.Stdout.Fd())
+		width, height, _ := terminal.GetSize(fd)
+
+		ticker := time.NewTicker(termResizeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				w, h, err := terminal.GetSize(fd)
+				if err != nil || (w == width && h == height) {
+					continue
+				}
+				width, height = w, h
+				session.WindowChange(height, width)
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// enableVirtualTerminal enable VT sequence processing of console (Windows 10+), and return func to restore it.
+//   - stdout ... process VT sequences from remote (color, cursor move...)
+//   - stdin  ... send arrow, function keys etc. as VT sequences
+//
+// Remote pty is at server side, so local console only need VT mode (like OpenSSH for Windows).
+// ConPTY is not needed for ssh client.
+func enableVirtualTerminal() (restore func()) {
+	restores := []func(){}
+	setMode := func(f *os.File, mode uint32) {
+		handle := windows.Handle(f.Fd())
+
+		var original uint32
+		if err := windows.GetConsoleMode(handle, &original); err != nil {
+			return
+		}
+		if err := windows.SetConsoleMode(handle, original|mode); err != nil {
+			debugf(1, "cannot enable virtual terminal mode of console: %v", err)
+			return
+		}
+		restores = append(restores, func() { windows.SetConsoleMode(handle, original) })
+	}
+
+	setMode(os.Stdout, windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING|windows.DISABLE_NEWLINE_AUTO_RETURN)
+	setMode(os.Stdin, windows.ENABLE_VIRTUAL_TERMINAL_INPUT)
+
+	return func() {
+		for _, f := range restores {
+			f()
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// trackedTermModes is xterm private modes that remote application enable, and should be disabled at disconnect.
+//   - 1000, 1002, 1003 ... mouse reporting (click, drag, any motion)
+//   - 1005, 1006, 1015 ... mouse reporting encoding (utf-8, sgr, urxvt)
+//   - 2004             ... bracketed paste
+var trackedTermModes = map[string]bool{
+	"1000": true, "1002": true, "1003": true,
+	"1005": true, "1006": true, "1015": true,
+	"2004": true,
+}
+
+// termModeRegex match DEC private mode set/reset sequence. ex) `ESC [ ? 1000 ; 1006 h`
+var termModeRegex = regexp.MustCompile(`\x1b\[\?([0-9;]+)([hl])`)
+
+// termModeWriter pass through remote output to w as it is, and track terminal modes enabled by remote.
+// Remote tmux/vim enable mouse reporting and bracketed paste, and they are left enabled at local terminal
+// if remote exit without disabling them (ex. connection closed). ResetModes disable them.
+type termModeWriter struct {
+	w     io.Writer
+	modes map[string]bool
+	tail  []byte // incomplete sequence at the end of last write
+	mu    sync.Mutex
+}
+
+// newTermModeWriter return termModeWriter that write to w.
+func newTermModeWriter(w io.Writer) *termModeWriter {
+	return &termModeWriter{w: w, modes: map[string]bool{}}
+}
+
+func (t *termModeWriter) Write(p []byte) (n int, err error) {
+	t.mu.Lock()
+	data := append(t.tail, p...)
+	for _, m := range termModeRegex.FindAllSubmatch(data, -1) {
+		for _, mode := range strings.Split(string(m[1]), ";") {
+			if trackedTermModes[mode] {
+				t.modes[mode] = string(m[2]) == "h"
+			}
+		}
+	}
+
+	// keep incomplete sequence (ESC without final byte), it may continue at next write.
+	t.tail = nil
+	if i := bytes.LastIndexByte(data, 0x1b); i >= 0 && len(data)-i < 32 && !termModeRegex.Match(data[i:]) {
+		t.tail = append([]byte{}, data[i:]...)
+	}
+	t.mu.Unlock()
+
+	return t.w.Write(p)
+}
+
+// ResetModes write sequences to disable modes that remote left enabled, to w (local terminal).
+func (t *termModeWriter) ResetModes(w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for mode, enabled := range t.modes {
+		if enabled {
+			debugf(2, "reset terminal mode %s left enabled by remote", mode)
+			fmt.Fprintf(w, "\x1b[?%sl", mode)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package ssh
+
+import (
+	"crypto/rand"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is in-process ssh server for tests. It accept password `pass` only.
+// Session channels are passed to handleSession. (if nil, session channel is rejected)
+type testServer struct {
+	listener      net.Listener
+	handleSession func(ch ssh.Channel, reqs <-chan *ssh.Request)
+}
+
+// newTestServer start testServer at random port of localhost.
+func newTestServer(t *testing.T, handleSession func(ch ssh.Channel, reqs <-chan *ssh.Request)) *testServer {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) == "pass" {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testServer{listener: listener, handleSession: handleSession}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+
+	return s
+}
+
+func (s *testServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" || s.handleSession == nil {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		ch, chReqs, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.handleSession(ch, chReqs)
+	}
+}
+
+func (s *testServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *testServer) Close() {
+	s.listener.Close()
+}
+
+// dialTestServer connect to testServer with password auth.
+func dialTestServer(addr, password string) (*ssh.Client, error) {
+	return ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "test",
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+}
+
+// isAuthError depends on error message of golang.org/x/crypto/ssh. This test pins it.
+func TestIsAuthError(t *testing.T) {
+	s := newTestServer(t, nil)
+	defer s.Close()
+
+	// closed port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := l.Addr().String()
+	l.Close()
+
+	// server that close connection before handshake
+	eofListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eofListener.Close()
+	go func() {
+		for {
+			conn, err := eofListener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	type TestData struct {
+		desc     string
+		addr     string
+		password string
+		message  string // expected prefix of error message
+		expect   bool
+	}
+	tds := []TestData{
+		{
+			desc:     "Password is rejected",
+			addr:     s.Addr(),
+			password: "wrong",
+			message:  "ssh: handshake failed: ssh: unable to authenticate, attempted methods [", // order of methods is not fixed
+			expect:   true,
+		},
+		{
+			desc:     "Connection refused",
+			addr:     closedAddr,
+			password: "pass",
+			message:  "dial tcp " + closedAddr + ":",
+			expect:   false,
+		},
+		{
+			desc:     "Connection closed before handshake",
+			addr:     eofListener.Addr().String(),
+			password: "pass",
+			message:  "ssh: handshake failed: ", // EOF or connection reset
+			expect:   false,
+		},
+	}
+
+	for _, v := range tds {
+		client, err := dialTestServer(v.addr, v.password)
+		if client != nil {
+			client.Close()
+		}
+		if !assert.Error(t, err, v.desc) {
+			continue
+		}
+
+		assert.True(t, strings.HasPrefix(err.Error(), v.message), "%s: %s", v.desc, err)
+		assert.Equal(t, v.expect, isAuthError(err), v.desc)
+	}
+}
@@ -0,0 +1,370 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/trzsz"
+	"github.com/blacknon/lssh/zmodem"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// transferIdleTimeout is timeout of file transfer, if remote send nothing.
+const transferIdleTimeout = 30 * time.Second
+
+// transferDrainTime is time to discard remote output after transfer is aborted, until remote stop sending.
+const transferDrainTime = 500 * time.Millisecond
+
+var (
+	errTransferCanceled = errors.New("canceled")
+	errTransferTimeout  = errors.New("timeout")
+)
+
+// transferKind is file transfer protocol and direction started by remote.
+type transferKind int
+
+const (
+	zmodemDownload transferKind = iota + 1 // remote `sz`
+	zmodemUpload                           // remote `rz`
+	trzszTransfer                          // remote `tsz` or `trz`
+)
+
+// transferTerm detect start of file transfer (ZMODEM `sz`, `rz`, and trzsz `tsz`, `trz` at remote) in terminal output,
+// and transfer files with it instead of printing protocol data. Received files are saved in local current directory,
+// and files to send are asked at prompt.
+// It is io.Writer of remote output, and io.Reader of input to remote. (session.Stdout and session.Stdin)
+type transferTerm struct {
+	out io.Writer // terminal output
+	in  io.Reader // terminal input
+
+	zmodem bool // detect ZMODEM
+	trzsz  bool // detect trzsz
+
+	tail   []byte // incomplete start sequence at the end of last output
+	skipOO bool   // remove "OO" (over and out) of ZMODEM sender at the end of session
+
+	transfer *transferSession // active transfer
+	mu       sync.Mutex
+
+	inputOnce sync.Once
+	input     chan []byte // terminal input to remote
+	inputErr  error
+	remote    chan []byte // protocol data to remote
+	pending   []byte
+}
+
+// newTransferTerm return transferTerm that write remote output to out, and read input to remote from in.
+// zmodem and trzsz enable detection of each protocol.
+func newTransferTerm(out io.Writer, in io.Reader, zmodem, trzsz bool) *transferTerm {
+	return &transferTerm{
+		out:    out,
+		in:     in,
+		zmodem: zmodem,
+		trzsz:  trzsz,
+		input:  make(chan []byte),
+		remote: make(chan []byte),
+	}
+}
+
+func (z *transferTerm) Write(p []byte) (n int, err error) {
+	data := append(z.tail, p...)
+	z.tail = nil
+
+	for len(data) > 0 {
+		if t := z.active(); t != nil {
+			rest, done := t.feed(data)
+			if !done {
+				break
+			}
+			z.setActive(nil)
+			data = rest
+			continue
+		}
+
+		if z.skipOO {
+			z.skipOO = false
+			data = bytes.TrimPrefix(data, []byte("OO"))
+		}
+
+		i, kind, partial := z.detect(data)
+		if i < 0 {
+			// keep incomplete start sequence, it may continue at next write.
+			z.tail = append([]byte{}, data[len(data)-partial:]...)
+			if _, err = z.out.Write(data[:len(data)-partial]); err != nil {
+				return 0, err
+			}
+			break
+		}
+
+		if _, err = z.out.Write(data[:i]); err != nil {
+			return 0, err
+		}
+		z.start(kind)
+		data = data[i:]
+	}
+
+	return len(p), nil
+}
+
+// detect find first start of file transfer in data. If not found, index is -1, and partial is length of
+// incomplete start sequence at the end of data.
+func (z *transferTerm) detect(data []byte) (index int, kind transferKind, partial int) {
+	index = -1
+	if z.zmodem {
+		i, dir, p := zmodem.Detect(data)
+		switch {
+		case i >= 0 && dir == zmodem.Download:
+			index, kind = i, zmodemDownload
+		case i >= 0:
+			index, kind = i, zmodemUpload
+		}
+		partial = p
+	}
+
+	if z.trzsz {
+		i, p := trzsz.Detect(data)
+		if i >= 0 && (index < 0 || i < index) {
+			index, kind = i, trzszTransfer
+		}
+		if p > partial {
+			partial = p
+		}
+	}
+
+	if index >= 0 {
+		partial = 0
+	}
+	return
+}
+
+func (z *transferTerm) Read(p []byte) (n int, err error) {
+	z.inputOnce.Do(func() { go z.readInput() })
+
+	if len(z.pending) == 0 {
+		select {
+		case data, ok := <-z.input:
+			if !ok {
+				return 0, z.inputErr
+			}
+			z.pending = data
+		case data := <-z.remote:
+			z.pending = data
+		}
+	}
+
+	n = copy(p, z.pending)
+	z.pending = z.pending[n:]
+	return
+}
+
+// readInput read terminal input, and send it to remote. While transferring, it is sent to the transfer (prompt, cancel).
+func (z *transferTerm) readInput() {
+	for {
+		buf := make([]byte, 4096)
+		n, err := z.in.Read(buf)
+		if n > 0 {
+			if t := z.active(); t != nil {
+				t.input(buf[:n])
+			} else {
+				z.input <- buf[:n]
+			}
+		}
+		if err != nil {
+			z.inputErr = err
+			close(z.input)
+			return
+		}
+	}
+}
+
+// active return active transfer, or nil.
+func (z *transferTerm) active() *transferSession {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.transfer
+}
+
+func (z *transferTerm) setActive(t *transferSession) {
+	z.mu.Lock()
+	z.transfer = t
+	z.mu.Unlock()
+}
+
+// start start transfer of kind in background. Remote output is sent to it, until it is finished.
+func (z *transferTerm) start(kind transferKind) {
+	t := &transferSession{
+		output: make(chan []byte),
+		local:  make(chan []byte, 16),
+		done:   make(chan struct{}),
+		cancel: make(chan struct{}),
+	}
+	z.setActive(t)
+	z.skipOO = kind == zmodemDownload
+
+	go func() {
+		w := transferRemoteWriter(z.remote)
+
+		var err error
+		switch kind {
+		case zmodemDownload:
+			err = t.receiveZmodem(w)
+		case zmodemUpload:
+			err = t.sendZmodem(w)
+		case trzszTransfer:
+			err = t.trzsz(w)
+		}
+		if err != nil {
+			escapePrint(fmt.Sprintf("%s: transfer failed. %v\n", kind, err))
+
+			// trzsz remote stop at error message, and print it.
+			if kind != trzszTransfer {
+				zmodem.Abort(w)
+				t.drain()
+			}
+		}
+
+		t.finish()
+	}()
+}
+
+func (k transferKind) String() string {
+	if k == trzszTransfer {
+		return "trzsz"
+	}
+	return "ZMODEM"
+}
+
+// transferRemoteWriter is io.Writer that send data to remote, through transferTerm.Read.
+type transferRemoteWriter chan []byte
+
+func (w transferRemoteWriter) Write(p []byte) (n int, err error) {
+	w <- append([]byte{}, p...)
+	return len(p), nil
+}
+
+// transferSession is a file transfer session. It read remote output as io.ByteReader.
+type transferSession struct {
+	output chan []byte // remote output
+	buf    []byte      // remote output not read yet
+	local  chan []byte // terminal input
+	done   chan struct{}
+	rest   []byte // remote output not read at the end of transfer. set before done is closed.
+
+	cancel     chan struct{}
+	cancelOnce sync.Once
+}
+
+// feed send remote output data to transfer. If transfer is finished, it return data not read by transfer.
+func (t *transferSession) feed(data []byte) (rest []byte, done bool) {
+	select {
+	case t.output <- data:
+		return nil, false
+	case <-t.done:
+		return append(t.rest, data...), true
+	}
+}
+
+// finish finish transfer. Remote output not read is returned by feed.
+func (t *transferSession) finish() {
+	t.rest = t.buf
+	close(t.done)
+}
+
+// ReadByte read a byte of remote output.
+func (t *transferSession) ReadByte() (byte, error) {
+	for len(t.buf) == 0 {
+		select {
+		case t.buf = <-t.output:
+		case <-t.cancel:
+			return 0, errTransferCanceled
+		case <-time.After(transferIdleTimeout):
+			return 0, errTransferTimeout
+		}
+	}
+
+	b := t.buf[0]
+	t.buf = t.buf[1:]
+	return b, nil
+}
+
+// drain discard remote output, until remote stop sending.
+func (t *transferSession) drain() {
+	t.buf = nil
+	for {
+		select {
+		case <-t.output:
+		case <-time.After(transferDrainTime):
+			return
+		}
+	}
+}
+
+// input receive terminal input while transferring. Ctrl+C cancel transfer.
+func (t *transferSession) input(data []byte) {
+	if bytes.IndexByte(data, 0x03) >= 0 {
+		t.cancelOnce.Do(func() { close(t.cancel) })
+		return
+	}
+
+	select {
+	case t.local <- data:
+	default:
+	}
+}
+
+// Read read terminal input, for prompt.
+func (t *transferSession) Read(p []byte) (n int, err error) {
+	select {
+	case data := <-t.local:
+		return copy(p, data), nil
+	case <-t.cancel:
+		return 0, errTransferCanceled
+	}
+}
+
+// askUpload ask local paths to upload at prompt, with protocol name. Wildcard is expanded.
+func (t *transferSession) askUpload(name string) (paths []string, err error) {
+	escapePrint(name + ": remote is waiting for files. Enter local paths to upload (empty to cancel).\n")
+
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{t, os.Stderr}
+	line, err := terminal.NewTerminal(rw, "upload> ").ReadLine()
+	if err != nil {
+		return
+	}
+
+	for _, p := range strings.Fields(line) {
+		p = common.GetFullPath(p)
+		matches, _ := filepath.Glob(p)
+		if len(matches) == 0 {
+			matches = []string{p}
+		}
+		paths = append(paths, matches...)
+	}
+	if len(paths) == 0 {
+		return nil, errTransferCanceled
+	}
+	return
+}
+
+// newTransferProgress return progress func that print transferred bytes of file at terminal. (at most 5 times per second)
+func newTransferProgress() func(name string, n, size int64) {
+	var last time.Time
+	return func(name string, n, size int64) {
+		if n < size && time.Since(last) < 200*time.Millisecond {
+			return
+		}
+		last = time.Now()
+		fmt.Fprintf(os.Stderr, "\r%s: %s / %s\x1b[K", name, formatBytes(n), formatBytes(size))
+	}
+}
@@ -0,0 +1,306 @@
+package ssh
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/blacknon/lssh/conf"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/proxy"
+)
+
+// websocket GUID. See also: RFC 6455 1.3
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// websocket opcode
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+)
+
+// createClientViaTransport return ssh.Client over websocket or tls transport.
+// If dialer is not nil, connect to transport endpoint via dialer(http|socks5 proxy).
+func createClientViaTransport(config conf.ServerConfig, sshConf *ssh.ClientConfig, dialer proxy.Dialer) (client *ssh.Client, err error) {
+	conn, err := dialTransport(config, dialer, sshConf.Timeout)
+	if err != nil {
+		return client, err
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, net.JoinHostPort(config.Addr, config.Port), sshConf)
+	if err != nil {
+		conn.Close()
+		return client, err
+	}
+
+	client = newClient(sshConn, chans, reqs)
+	return
+}
+
+// dialTransport return net.Conn to transport endpoint.
+// If dialer is nil, connect directly with timeout (connect_timeout).
+//
+// transport type:
+//   - websocket ... transport_url is `ws://host[:port]/path` or `wss://host[:port]/path`
+//   - tls       ... transport_url is `host:port`
+func dialTransport(config conf.ServerConfig, dialer proxy.Dialer, timeout time.Duration) (conn net.Conn, err error) {
+	if dialer == nil {
+		dialer, err = newBindDialer(config, timeout)
+		if err != nil {
+			return
+		}
+	}
+
+	switch config.Transport {
+	case "websocket", "ws":
+		u, err := url.Parse(config.TransportURL)
+		if err != nil {
+			return nil, err
+		}
+
+		host := u.Host
+		if u.Port() == "" {
+			switch u.Scheme {
+			case "wss", "https":
+				host = net.JoinHostPort(u.Hostname(), "443")
+			default:
+				host = net.JoinHostPort(u.Hostname(), "80")
+			}
+		}
+
+		conn, err = dialer.Dial("tcp", host)
+		if err != nil {
+			return nil, err
+		}
+
+		if u.Scheme == "wss" || u.Scheme == "https" {
+			conn = tls.Client(conn, &tls.Config{
+				ServerName:         u.Hostname(),
+				InsecureSkipVerify: config.TransportInsecure,
+			})
+		}
+
+		return newWebsocketConn(conn, u)
+
+	case "tls":
+		host, _, err := net.SplitHostPort(config.TransportURL)
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err = dialer.Dial("tcp", config.TransportURL)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: config.TransportInsecure,
+		})
+		if err = tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return tlsConn, nil
+	}
+
+	return nil, fmt.Errorf("unknown transport: %s", config.Transport)
+}
+
+// websocketConn is net.Conn over websocket binary message.
+type websocketConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	// remaining payload of current frame
+	remain int64
+
+	writeMutex sync.Mutex
+}
+
+// newWebsocketConn do websocket opening handshake, and return net.Conn.
+func newWebsocketConn(conn net.Conn, u *url.URL) (net.Conn, error) {
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+
+	path := u.RequestURI()
+	req, err := http.NewRequest("GET", "http://"+u.Host+path, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		req.SetBasicAuth(u.User.Username(), pass)
+	}
+
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	if err = req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, fmt.Errorf("websocket handshake error, StatusCode [%d]", resp.StatusCode)
+	}
+
+	h := sha1.New()
+	io.WriteString(h, key+websocketGUID)
+	accept := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	if resp.Header.Get("Sec-WebSocket-Accept") != accept {
+		conn.Close()
+		return nil, fmt.Errorf("websocket handshake error, invalid Sec-WebSocket-Accept")
+	}
+
+	return &websocketConn{Conn: conn, reader: reader}, nil
+}
+
+// Read read payload of websocket data frame.
+func (w *websocketConn) Read(p []byte) (n int, err error) {
+	for w.remain == 0 {
+		opcode, length, err := w.readHeader()
+		if err != nil {
+			return 0, err
+		}
+
+		switch opcode {
+		case wsOpBinary, wsOpText, wsOpContinuation:
+			w.remain = length
+
+		case wsOpPing:
+			payload := make([]byte, length)
+			if _, err = io.ReadFull(w.reader, payload); err != nil {
+				return 0, err
+			}
+			if err = w.writeFrame(wsOpPong, payload); err != nil {
+				return 0, err
+			}
+
+		case wsOpClose:
+			w.writeFrame(wsOpClose, nil)
+			return 0, io.EOF
+
+		default:
+			if _, err = io.CopyN(ioutil.Discard, w.reader, length); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if int64(len(p)) > w.remain {
+		p = p[:w.remain]
+	}
+	n, err = w.reader.Read(p)
+	w.remain -= int64(n)
+	return
+}
+
+// readHeader read websocket frame header, return opcode and payload length.
+// frame from server is not masked.
+func (w *websocketConn) readHeader() (opcode byte, length int64, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(w.reader, header); err != nil {
+		return
+	}
+
+	opcode = header[0] & 0x0f
+	length = int64(header[1] & 0x7f)
+
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err = io.ReadFull(w.reader, ext); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err = io.ReadFull(w.reader, ext); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint64(ext))
+	}
+
+	// masked frame (not expected from server)
+	if header[1]&0x80 != 0 {
+		err = fmt.Errorf("websocket error, masked frame from server")
+	}
+
+	return
+}
+
+// Write send p as websocket binary frame.
+func (w *websocketConn) Write(p []byte) (n int, err error) {
+	if err = w.writeFrame(wsOpBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeFrame send masked websocket frame. frame from client must be masked.
+func (w *websocketConn) writeFrame(opcode byte, payload []byte) (err error) {
+	w.writeMutex.Lock()
+	defer w.writeMutex.Unlock()
+
+	frame := []byte{0x80 | opcode}
+
+	length := len(payload)
+	switch {
+	case length < 126:
+		frame = append(frame, 0x80|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(length))
+	default:
+		frame = append(frame, 0x80|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(length))
+	}
+
+	mask := make([]byte, 4)
+	if _, err = rand.Read(mask); err != nil {
+		return
+	}
+	frame = append(frame, mask...)
+
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err = w.Conn.Write(frame)
+	return
+}
@@ -0,0 +1,53 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/blacknon/lssh/trzsz"
+)
+
+// trzsz transfer files with remote `tsz` (download to local current directory) or `trz` (upload local files asked at prompt).
+// Remote output is read from start sequence.
+func (t *transferSession) trzsz(w io.Writer) error {
+	mode, err := trzsz.ReadMode(t)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case trzsz.Download:
+		dir, err := os.Getwd()
+		if err != nil {
+			trzsz.Cancel(w)
+			return err
+		}
+
+		escapePrint(fmt.Sprintf("trzsz: receiving files to %s ... (Ctrl+C to cancel)\n", dir))
+		paths, err := trzsz.Receive(t, w, dir, newTransferProgress())
+		for _, p := range paths {
+			escapePrint(fmt.Sprintf("Received %s.\n", p))
+		}
+		return err
+
+	case trzsz.Upload:
+		paths, err := t.askUpload("trzsz")
+		if err != nil {
+			trzsz.Cancel(w)
+			return err
+		}
+
+		escapePrint(fmt.Sprintf("trzsz: sending %s ... (Ctrl+C to cancel)\n", strings.Join(paths, " ")))
+		if err = trzsz.Send(t, w, paths, newTransferProgress()); err != nil {
+			return err
+		}
+		escapePrint("Sent.\n")
+		return nil
+
+	default:
+		trzsz.Cancel(w)
+		return fmt.Errorf("directory transfer is not supported")
+	}
+}
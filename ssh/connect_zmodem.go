@@ -0,0 +1,40 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/blacknon/lssh/zmodem"
+)
+
+// receiveZmodem receive files from remote `sz` to local current directory.
+func (t *transferSession) receiveZmodem(w io.Writer) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	escapePrint(fmt.Sprintf("ZMODEM: receiving files to %s ... (Ctrl+C to cancel)\n", dir))
+	paths, err := zmodem.Receive(t, w, dir, newTransferProgress())
+	for _, p := range paths {
+		escapePrint(fmt.Sprintf("Received %s.\n", p))
+	}
+	return err
+}
+
+// sendZmodem send local files asked at prompt to remote `rz`.
+func (t *transferSession) sendZmodem(w io.Writer) error {
+	paths, err := t.askUpload("ZMODEM")
+	if err != nil {
+		return err
+	}
+
+	escapePrint(fmt.Sprintf("ZMODEM: sending %s ... (Ctrl+C to cancel)\n", strings.Join(paths, " ")))
+	if err = zmodem.Send(t, w, paths, newTransferProgress()); err != nil {
+		return err
+	}
+	escapePrint("Sent.\n")
+	return nil
+}
@@ -0,0 +1,70 @@
+package ssh
+
+import (
+	"io"
+	"log"
+	"net"
+	"os"
+
+	"github.com/blacknon/lssh/common"
+	"golang.org/x/crypto/ssh"
+)
+
+// DebugLevel is verbosity of debug log. (-v: 1, -vv: 2, -vvv: 3)
+//   - 1 ... connection stages (dns resolution, proxy chain, auth methods, host key, errors)
+//   - 2 ... connection attempts, offered keys, channel opens
+//   - 3 ... offered algorithms, keepalive
+var DebugLevel = 0
+
+// DebugLogFile is name of file that debug log is also written to, in state directory. (included in `lssh support-bundle`)
+var DebugLogFile = "debug.log"
+
+// debugLogMaxSize is size of DebugLogFile, that it is truncated at open.
+const debugLogMaxSize = 1024 * 1024
+
+// debugLogger write debug log to stderr.
+var debugLogger = log.New(os.Stderr, "", log.Ltime|log.Lmicroseconds)
+
+// OpenDebugLog start writing debug log to DebugLogFile too, if DebugLevel is set.
+// Returned func close the file.
+func OpenDebugLog() (close func()) {
+	close = func() {}
+	if DebugLevel == 0 {
+		return
+	}
+
+	path := common.GetStatePath(DebugLogFile)
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if info, err := os.Stat(path); err == nil && info.Size() > debugLogMaxSize {
+		flag |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(path, flag, 0600)
+	if err != nil {
+		return
+	}
+
+	debugLogger.SetOutput(io.MultiWriter(os.Stderr, file))
+	return func() {
+		debugLogger.SetOutput(os.Stderr)
+		file.Close()
+	}
+}
+
+// debugf print debug log, if DebugLevel is greater than or equal to level. (like OpenSSH `debug1: ...`)
+func debugf(level int, format string, a ...interface{}) {
+	if DebugLevel < level {
+		return
+	}
+
+	prefix := []string{"", "debug1: ", "debug2: ", "debug3: "}[level]
+	debugLogger.Printf(prefix+format, a...)
+}
+
+// debugHostKeyCallback wrap callback, and log server host key.
+func debugHostKeyCallback(server string, callback ssh.HostKeyCallback) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		debugf(1, "%s: server host key: %s %s (%s)", server, key.Type(), ssh.FingerprintSHA256(key), remote)
+		return callback(hostname, remote, key)
+	}
+}
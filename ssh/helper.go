@@ -0,0 +1,178 @@
+package ssh
+
+//go:generate go run ../cmd/lssh-helper/genhelper/main.go
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/blacknon/lssh/conf"
+)
+
+// HelperVersion is version of lssh-helper. Must be same as cmd/lssh-helper Version.
+const HelperVersion = "2"
+
+// helperDir is remote directory to put lssh-helper. (expanded by remote sh)
+const helperDir = `${TMPDIR:-/tmp}/.lssh-helper-$(id -u)`
+
+// helperDirCheck is sh condition that helperDir ($d) is directory of current user (not symlink), and not accessible by other users.
+// helperDir is in shared temp dir, so helper is not reused or run, if other user created it.
+const helperDirCheck = `[ -d "$d" ] && [ ! -L "$d" ] && [ -O "$d" ] && [ "$(ls -ld "$d" | cut -c1-10)" = drwx------ ]`
+
+// helperBinaries is lssh-helper binaries by `os/arch`.
+// It is set by generated files (build with `-tags helper`, after `go generate ./ssh`).
+var helperBinaries = map[string][]byte{}
+
+// helperShellFuncs is pure-shell fallback of lssh-helper functions.
+// Output format is same as lssh-helper.
+var helperShellFuncs = map[string]string{
+	"version": `echo ` + HelperVersion,
+	"sha256":  `for f in "$@"; do (sha256sum "$f" 2>/dev/null || shasum -a 256 "$f") || exit 1; done`,
+	"facts": `echo "hostname=$(hostname)"; ` +
+		`echo "os=$(uname -s | tr A-Z a-z)"; ` +
+		`a=$(uname -m); case "$a" in x86_64) a=amd64;; aarch64) a=arm64;; i?86) a=386;; arm*) a=arm;; esac; ` +
+		`echo "arch=$a"`,
+}
+
+// RemoteHelper is lssh-helper deployed to remote server.
+type RemoteHelper struct {
+	// remote path of lssh-helper. If empty, use pure-shell fallback.
+	Path string
+}
+
+// IsBinary return true if uploaded lssh-helper binary is available.
+func (h *RemoteHelper) IsBinary() bool {
+	return h.Path != ""
+}
+
+// Command return command line to run helper function at remote.
+func (h *RemoteHelper) Command(function string, args ...string) string {
+	script := helperShellFuncs[function]
+	if h.IsBinary() {
+		script = `d=` + helperDir + `; ` + helperDirCheck + ` || exit 1; exec ` + h.Path + ` "$@"`
+		args = append([]string{function}, args...)
+	}
+
+	quoted := []string{}
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+
+	return strings.TrimSpace("sh -c " + shellQuote(script) + " lssh-helper " + strings.Join(quoted, " "))
+}
+
+// DeployHelper upload lssh-helper to remote temp dir on demand, and return RemoteHelper.
+// Uploaded helper is verified by sha256 hash, and reused across runs.
+// If helper binary is not available (no binary for remote arch, noexec tmp...), return pure-shell fallback.
+func (c *Connect) DeployHelper() (helper *RemoteHelper, err error) {
+	helper = &RemoteHelper{}
+
+	// detect remote os/arch
+	output, err := c.runRemoteShell(`uname -s; uname -m`, nil)
+	if err != nil {
+		return helper, err
+	}
+	binary, ok := helperBinaries[parseUname(string(output))]
+	if !ok {
+		return helper, nil
+	}
+
+	sum := fmt.Sprintf("%x", sha256.Sum256(binary))
+	path := helperDir + "/lssh-helper-" + sum[:16]
+	hashCmd := `d=` + helperDir + `; p=` + path + `; ` + helperDirCheck + ` && [ -x "$p" ] && (sha256sum "$p" 2>/dev/null || shasum -a 256 "$p" 2>/dev/null) | cut -d" " -f1`
+
+	// reuse, if already uploaded
+	output, _ = c.runRemoteShell(hashCmd, nil)
+	if strings.TrimSpace(string(output)) != sum {
+		uploadCmd := `d=` + helperDir + `; mkdir -p "$d" && chmod 700 "$d" && ` + helperDirCheck + ` && cat > "$d/.tmp.$$" && chmod 700 "$d/.tmp.$$" && mv "$d/.tmp.$$" ` + path
+		if _, err = c.runRemoteShell(uploadCmd, bytes.NewReader(binary)); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: cannot upload lssh-helper, use shell fallback. %v\n", c.Server, err)
+			return helper, nil
+		}
+
+		// verify (if remote has sha256sum or shasum)
+		output, _ = c.runRemoteShell(hashCmd, nil)
+		if hash := strings.TrimSpace(string(output)); hash != "" && hash != sum {
+			fmt.Fprintf(os.Stderr, "%s: uploaded lssh-helper hash mismatch, use shell fallback.\n", c.Server)
+			return helper, nil
+		}
+	}
+
+	// check executable (ex. tmp is mounted noexec)
+	output, err = c.runRemoteShell(`d=`+helperDir+`; `+helperDirCheck+` && exec `+path+` version`, nil)
+	if err != nil || strings.TrimSpace(string(output)) != HelperVersion {
+		return helper, nil
+	}
+
+	helper.Path = path
+	return helper, nil
+}
+
+// RemoveHelper remove uploaded lssh-helper from remote.
+func (c *Connect) RemoveHelper() (err error) {
+	_, err = c.runRemoteShell(`rm -rf `+helperDir, nil)
+	return
+}
+
+// runRemoteShell run script with remote sh (not depend on login shell), and return stdout.
+func (c *Connect) runRemoteShell(script string, stdin io.Reader) (output []byte, err error) {
+	session, err := c.CreateSession()
+	if err != nil {
+		return
+	}
+	defer session.Close()
+
+	session.Stdin = stdin
+	return session.Output("sh -c " + shellQuote(script))
+}
+
+// RemoveHelpers remove uploaded lssh-helper from servers.
+func RemoveHelpers(config conf.Config, servers []string) {
+	r := new(Run)
+	r.ServerList = servers
+	r.Conf = config
+	r.createAuthMap()
+
+	for _, c := range r.createConn() {
+		if err := c.RemoveHelper(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: cannot remove lssh-helper, %v\n", c.Server, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s: lssh-helper is removed.\n", c.Server)
+	}
+}
+
+// parseUname convert output of `uname -s; uname -m` to `os/arch` (GOOS/GOARCH).
+func parseUname(output string) string {
+	fields := strings.Fields(output)
+	if len(fields) < 2 {
+		return ""
+	}
+
+	goos := strings.ToLower(fields[0])
+
+	var goarch string
+	switch fields[1] {
+	case "x86_64", "amd64":
+		goarch = "amd64"
+	case "aarch64", "arm64":
+		goarch = "arm64"
+	case "i386", "i486", "i586", "i686":
+		goarch = "386"
+	default:
+		if strings.HasPrefix(fields[1], "arm") {
+			goarch = "arm"
+		}
+	}
+
+	return goos + "/" + goarch
+}
+
+// shellQuote quote str with single quote for sh.
+func shellQuote(str string) string {
+	return "'" + strings.Replace(str, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,135 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// metricDesc is description of metric exposed at metrics endpoint.
+type metricDesc struct {
+	Name string
+	Type string // counter or gauge
+	Help string
+}
+
+// metricDescs is metrics exposed at metrics endpoint, in order of output.
+var metricDescs = []metricDesc{
+	{"lssh_connections_active", "gauge", "Active ssh connections to servers (service mode and connections shared with --mux)."},
+	{"lssh_mux_clients_active", "gauge", "Clients connected to mux socket, by server."},
+	{"lssh_sessions_opened_total", "counter", "Channels opened to servers for forwarded connections and mux clients, by channel type."},
+	{"lssh_forwarded_bytes_total", "counter", "Bytes forwarded by port forward tunnels and mux socket, by direction (sent to server or received from server)."},
+	{"lssh_auth_failures_total", "counter", "Authentication failures to servers."},
+}
+
+// metrics is metrics of this process, exposed at metrics endpoint (`--metrics`).
+// It is nil if metrics endpoint is not enabled, and then nothing is recorded.
+var metrics *metricsRegistry
+
+// metricsRegistry hold values of metrics, by name and labels.
+type metricsRegistry struct {
+	values map[string]map[string]float64 // name => labels (ex. `server="web01"`) => value
+	mu     sync.Mutex
+}
+
+// newMetricsRegistry return empty metricsRegistry.
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{values: map[string]map[string]float64{}}
+}
+
+// add v to metric name with labels. labels are pairs of label name and value.
+func (m *metricsRegistry) add(name string, v float64, labels ...string) {
+	if m == nil {
+		return
+	}
+
+	pairs := []string{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], escapeMetricLabel(labels[i+1])))
+	}
+	key := strings.Join(pairs, ",")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.values[name] == nil {
+		m.values[name] = map[string]float64{}
+	}
+	m.values[name][key] += v
+}
+
+// escapeMetricLabel escape label value of Prometheus text format.
+func escapeMetricLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// WriteTo write metrics in Prometheus text format.
+func (m *metricsRegistry) WriteTo(w io.Writer) (n int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	for _, desc := range metricDescs {
+		fmt.Fprintf(&b, "# HELP %s %s\n", desc.Name, desc.Help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", desc.Name, desc.Type)
+
+		keys := []string{}
+		for key := range m.values[desc.Name] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if key == "" {
+				fmt.Fprintf(&b, "%s %v\n", desc.Name, m.values[desc.Name][key])
+			} else {
+				fmt.Fprintf(&b, "%s{%s} %v\n", desc.Name, key, m.values[desc.Name][key])
+			}
+		}
+	}
+
+	written, err := io.WriteString(w, b.String())
+	return int64(written), err
+}
+
+// ServeHTTP serve metrics.
+func (m *metricsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+// startMetrics enable metrics, and serve it at http://addr/metrics.
+func startMetrics(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("cannot listen metrics endpoint, %v", err)
+	}
+
+	metrics = newMetricsRegistry()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	go http.Serve(listener, mux)
+
+	fmt.Fprintf(os.Stderr, "Metrics       :http://%s/metrics\n", listener.Addr())
+	return nil
+}
+
+// metricsWriter is io.Writer that add written bytes to forwarded bytes of tunnel.
+type metricsWriter struct {
+	w         io.Writer
+	server    string
+	tunnel    string
+	direction string // sent or received
+}
+
+func (mw *metricsWriter) Write(p []byte) (n int, err error) {
+	n, err = mw.w.Write(p)
+	metrics.add("lssh_forwarded_bytes_total", float64(n), "server", mw.server, "tunnel", mw.tunnel, "direction", mw.direction)
+	return
+}
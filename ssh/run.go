@@ -9,11 +9,12 @@ import (
 	"os"
 	"os/exec"
 	"strings"
-	"syscall"
 	"time"
 
+	"github.com/blacknon/lssh/common"
 	"github.com/blacknon/lssh/conf"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
@@ -24,6 +25,33 @@ type Run struct {
 	IsParallel        bool
 	IsShell           bool
 	IsX11             bool
+	IsX11Trusted      bool
+	IsService         bool
+	IsMosh            bool
+	IsEphemeralKey    bool          // generate keypair for this run, and use it for the session
+	IsEphemeralPrint  bool          // print ephemeral public key for out-of-band installation, instead of installing it
+	IsRunAgent        bool          // load identity files into in-process ssh-agent, and use and forward it for all servers
+	IsNoMotd          bool          // not print banner and login message of servers at command run (for parsing output)
+	IsYes             bool          // skip confirmation of destructive command guard at lssh shell (--yes)
+	IsSystemSsh       bool          // connect terminal with local ssh command (system ssh passthrough mode)
+	SystemSshArgs     []string      // extra arguments to local ssh command at system ssh mode
+	IsDedup           bool          // collapse identical output lines from multiple servers
+	DedupWindow       time.Duration // time window to collapse lines
+	IsSummary         bool          // print per-server summary table after command run
+	IsPager           bool          // buffer per-server output, and view it with pager after command run
+	IsChanged         bool          // report servers whose output changed from previous run of same command
+	IsChangedOnly     bool          // print only diff of output of changed servers (implies IsChanged)
+	ReportPath        string        // path to write report of command run (json)
+	MaxParallel       int           // max number of servers to run command in parallel (0 is unlimited)
+	IsPlainUI         bool          // plain text output without color and TUI (for screen readers)
+	WatchInterval     time.Duration // re-run command periodically at this interval (like `watch(1)`)
+	IsWatchDiff       bool          // highlight changes from previous run at watch mode
+	ExitStatus        int           // exit status of single server command run. (remote exit status, or 255 on connect error)
+	RunID             string        // id of this run. exported to remote as LSSH_RUN_ID. (default: generated)
+	StdioTarget       string        // stdio forward target (`ssh -W`). server name or host:port
+	ShareSocket       string        // unix socket path to share terminal output with read-only observers (--share)
+	MuxSocket         string        // unix socket path to share authenticated connections with lscp (--mux)
+	MetricsAddr       string        // address of http endpoint to expose metrics in Prometheus text format (--metrics)
 	PortForwardLocal  string
 	PortForwardRemote string
 	ExecCmd           []string
@@ -31,6 +59,15 @@ type Run struct {
 	InputData         []byte        // @TODO: Delete???
 	OutputData        *bytes.Buffer // use terminal log
 	AuthMap           map[AuthKey][]ssh.Signer
+
+	// per-server results of command run (if IsSummary, IsPager, IsChanged or ReportPath is set)
+	results []*Result
+
+	// per-server start time of command run (for connection audit log)
+	starts []time.Time
+
+	// in-process ssh-agent of this run (if IsRunAgent)
+	runAgent agent.Agent
 }
 
 // Auth map key
@@ -39,6 +76,7 @@ type AuthKey struct {
 	//   - key
 	//   - cert
 	//   - pkcs11
+	//   - ephemeral
 	Type string
 
 	// auth type value:
@@ -48,6 +86,8 @@ type AuthKey struct {
 	//     ex.) ~/.ssh/id_rsa.crt
 	//   - pkcs11(libpath)
 	//     ex.) /usr/local/lib/opensc-pkcs11.so
+	//   - ephemeral(server name)
+	//     ex.) web01
 	Value string
 }
 
@@ -56,20 +96,79 @@ const (
 	AUTHKEY_KEY    = "key"
 	AUTHKEY_CERT   = "cert"
 	AUTHKEY_PKCS11 = "pkcs11"
+
+	// ephemeral key of this run (value is server name)
+	AUTHKEY_EPHEMERAL = "ephemeral"
 )
 
 // Start ssh connect
 func (r *Run) Start() {
+	if r.RunID == "" {
+		r.RunID = common.NewRunID()
+	}
+
+	// stdio forward mode (use as ProxyCommand)
+	if r.StdioTarget != "" {
+		if err := r.stdio(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// system ssh passthrough mode (connect terminal with local ssh command)
+	if r.isSystemSsh(r.ServerList[0]) {
+		if err := r.systemSshTerm(r.ServerList[0]); err != nil && r.ExitStatus == 0 {
+			fmt.Fprintln(os.Stderr, err)
+			r.ExitStatus = 255
+		}
+		return
+	}
+
 	// Get stdin data(pipe)
-	if !terminal.IsTerminal(syscall.Stdin) {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
 		r.StdinData, _ = ioutil.ReadAll(os.Stdin)
 	}
 
+	// metrics endpoint of long-running service and mux (--metrics)
+	if r.MetricsAddr != "" {
+		if err := startMetrics(r.MetricsAddr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
 	// create AuthMap
 	r.createAuthMap()
 
+	// service mode (port forward only)
+	if r.IsService {
+		if err := r.service(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// ephemeral key mode
+	if r.IsEphemeralKey {
+		if err := r.setupEphemeralKey(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		r.handleExitSignals()
+		defer runExitHooks()
+	}
+
+	// record command to history
+	if len(r.ExecCmd) > 0 {
+		r.putCmdHistory()
+	}
+
 	// connect shell
-	if len(r.ExecCmd) > 0 { // run command
+	if len(r.ExecCmd) > 0 && r.WatchInterval > 0 { // run command periodically
+		r.watch()
+	} else if len(r.ExecCmd) > 0 { // run command
 		r.cmd()
 	} else {
 		if r.IsShell { // run lssh shell
@@ -88,8 +187,12 @@ func (r *Run) createConn() (conns []*Connect) {
 		c := new(Connect)
 		c.Server = server
 		c.Conf = r.Conf
-		c.IsTerm = r.IsTerm
+		c.IsTerm = r.IsTerm && !r.Conf.Server[server].BatchMode
 		c.IsParallel = r.IsParallel
+		c.RunID = r.RunID
+		c.IsPasswordPrompt = terminal.IsTerminal(int(os.Stdin.Fd())) && !r.Conf.Server[server].BatchMode
+		c.runAgent = r.runAgent
+		c.IsNoMotd = r.IsNoMotd && len(r.ExecCmd) > 0
 		c.AuthMap = r.AuthMap // @TODO: 特に問題ないだろうが、必要なSignerだけを渡すようにしたほうがいいかも？
 		conns = append(conns, c)
 	}
@@ -107,6 +210,7 @@ func (r *Run) printSelectServer() {
 func (r *Run) printRunCommand() {
 	runCmdStr := strings.Join(r.ExecCmd, " ")
 	fmt.Fprintf(os.Stderr, "Run Command   :%s\n", runCmdStr)
+	fmt.Fprintf(os.Stderr, "Run ID        :%s\n", r.RunID)
 }
 
 // print header (port forwarding)
@@ -167,7 +271,7 @@ func (r *Run) printProxy() {
 // runCmdLocal exec command local machine.
 func runCmdLocal(cmd string) {
 	out, _ := exec.Command("sh", "-c", cmd).CombinedOutput()
-	fmt.Printf(string(out))
+	fmt.Print(string(out))
 }
 
 // send input to ssh Session Stdin
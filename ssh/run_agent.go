@@ -0,0 +1,102 @@
+package ssh
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// createRunAgent load identity files of servers (and their ssh proxies) into in-process ssh-agent of this run (r.runAgent).
+// Passphrase of encrypted key is prompted once. Loaded keys are added to r.AuthMap too, so they are not prompted again.
+// Errors are passed to report.
+func (r *Run) createRunAgent(report func(server string, err error)) {
+	keyring := agent.NewKeyring()
+	rawKeys := map[string]interface{}{}
+	added := map[string]bool{}
+
+	// add key (with certificate, if cert is set) to keyring and AuthMap
+	add := func(server, key, pass, cert string) {
+		id := key + "\x00" + cert
+		if added[id] {
+			return
+		}
+		added[id] = true
+
+		rawKey, ok := rawKeys[key]
+		if !ok {
+			var err error
+			rawKey, err = parsePrivateKey(key, pass, server, !r.Conf.Server[server].BatchMode)
+			if err != nil {
+				report(server, fmt.Errorf("cannot load %s to run agent, %v", key, err))
+				return
+			}
+			rawKeys[key] = rawKey
+		}
+
+		signer, err := ssh.NewSignerFromKey(rawKey)
+		if err != nil {
+			report(server, fmt.Errorf("cannot load %s to run agent, %v", key, err))
+			return
+		}
+
+		addedKey := agent.AddedKey{PrivateKey: rawKey, Comment: key}
+		authKey := AuthKey{AUTHKEY_KEY, key}
+		if cert != "" {
+			signer, err = createSshSignerCertificate(cert, signer)
+			if err != nil {
+				report(server, fmt.Errorf("cannot load %s to run agent, %v", cert, err))
+				return
+			}
+			addedKey.Certificate = signer.PublicKey().(*ssh.Certificate)
+			addedKey.Comment = cert
+			authKey = AuthKey{AUTHKEY_CERT, cert}
+		}
+
+		if err = keyring.Add(addedKey); err != nil {
+			report(server, fmt.Errorf("cannot load %s to run agent, %v", addedKey.Comment, err))
+			return
+		}
+		if _, ok := r.AuthMap[authKey]; !ok {
+			r.AuthMap[authKey] = []ssh.Signer{signer}
+		}
+	}
+
+	for _, server := range authHops(r.Conf, r.ServerList) {
+		config := r.Conf.Server[server]
+
+		if config.Key != "" {
+			add(server, config.Key, config.KeyPass, "")
+		}
+
+		// "keypath::passphase"
+		for _, key := range append(append([]string{}, config.Keys...), config.SSHAgentKeyPath...) {
+			keyPair := strings.SplitN(key, "::", 2)
+			keyPair = append(keyPair, "")
+			add(server, keyPair[0], keyPair[1], "")
+		}
+
+		if config.Cert != "" {
+			add(server, config.CertKey, config.CertKeyPass, config.Cert)
+		}
+	}
+
+	keys, _ := keyring.List()
+	debugf(1, "run agent: %d keys loaded", len(keys))
+	r.runAgent = keyring
+}
+
+// forwardRunAgent forward run agent of c to remote of session. It do nothing, if run agent is not used.
+func (c *Connect) forwardRunAgent(session *ssh.Session) {
+	if c.runAgent == nil {
+		return
+	}
+
+	if err := agent.ForwardToAgent(c.Client, c.runAgent); err != nil {
+		debugf(1, "%s: %v", c.Server, err)
+	}
+	if err := agent.RequestAgentForwarding(session); err != nil {
+		fmt.Fprintf(c.stderr(), "%s: agent forwarding failed, %v\n", c.Server, err)
+	}
+}
@@ -0,0 +1,91 @@
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blacknon/lssh/common"
+)
+
+// auditCommand return command string of audit log. ("interactive" at terminal)
+func (r *Run) auditCommand() string {
+	if len(r.ExecCmd) == 0 {
+		return "interactive"
+	}
+	return strings.Join(r.ExecCmd, " ")
+}
+
+// ConnectionAuditFile is name of default connection audit log, in state directory. (`[audit] path` in config)
+var ConnectionAuditFile = "audit.log"
+
+// connectionAuditMutex serialize writes of parallel runs, so that each record is one line.
+var connectionAuditMutex sync.Mutex
+
+// ConnectionAudit is record of connection. (1 line json in connection audit log)
+type ConnectionAudit struct {
+	Time       time.Time `json:"time"` // connection start time
+	User       string    `json:"user"` // local user
+	Server     string    `json:"server"`
+	RemoteUser string    `json:"remote_user"`
+	ProxyChain []string  `json:"proxy_chain,omitempty"` // ex) ["ssh://bastion", "http://proxy"]
+	Command    string    `json:"command"`               // "interactive" at terminal
+	Duration   float64   `json:"duration"`              // seconds
+	ExitStatus int       `json:"exit_status"`
+	RunID      string    `json:"run_id,omitempty"`
+}
+
+// writeConnectionAudit append connection record of server to connection audit log, if it is enabled.
+// command is "interactive" at terminal, and "sftp" at sftp shell of sftp-only account.
+// Record has run id, so that it can be correlated with remote logs (LSSH_RUN_ID).
+func (r *Run) writeConnectionAudit(server, command string, start time.Time, err error) {
+	auditConf := r.Conf.Audit
+	if !auditConf.Enable {
+		return
+	}
+
+	record := ConnectionAudit{
+		Time:       start,
+		Server:     server,
+		RemoteUser: r.Conf.Server[server].User,
+		Command:    command,
+		Duration:   time.Since(start).Round(time.Millisecond).Seconds(),
+		ExitStatus: exitStatus(err),
+		RunID:      r.RunID,
+	}
+	if u, err := user.Current(); err == nil {
+		record.User = u.Username
+	}
+	// lssh proxy is not used at system ssh mode.
+	if proxyList, proxyType, err := GetProxyList(server, r.Conf); err == nil && !r.isSystemSsh(server) {
+		for _, proxy := range proxyList {
+			record.ProxyChain = append(record.ProxyChain, proxyType[proxy]+"://"+proxy)
+		}
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	path := auditConf.Path
+	if path == "" {
+		path = common.GetStatePath(ConnectionAuditFile)
+	}
+
+	connectionAuditMutex.Lock()
+	defer connectionAuditMutex.Unlock()
+
+	f, err := os.OpenFile(common.GetFullPath(path), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot write audit log, %v\n", err)
+		return
+	}
+	defer f.Close()
+
+	f.Write(append(data, '\n'))
+}
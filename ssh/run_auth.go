@@ -1,6 +1,7 @@
 package ssh
 
 import (
+	"errors"
 	"fmt"
 	sshkeys "github.com/ScaleFT/sshkeys"
 	"io/ioutil"
@@ -10,20 +11,51 @@ import (
 	"strings"
 
 	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
 	"golang.org/x/crypto/ssh"
 )
 
 // Create ssh.Signer into r.AuthMap. Passwords is not get this function.
 func (r *Run) createAuthMap() {
 	r.AuthMap = map[AuthKey][]ssh.Signer{}
+	report := func(server string, err error) {
+		fmt.Fprintf(os.Stderr, "%s's %s\n", server, err)
+	}
+
+	// load keys into run agent first, so that passphrase is prompted once
+	if r.IsRunAgent && r.runAgent == nil {
+		r.createRunAgent(report)
+	}
+	addAuthMap(r.AuthMap, r.Conf, r.ServerList, true, report)
+}
+
+// NewAuthMap return ssh.Signer of key, cert and pkcs11 authentication of servers.
+// Unlike lssh command, it does not prompt passphrase or PIN (encrypted key without key_pass is error), and does not print.
+// Signers that created without error are returned, with error of others.
+func NewAuthMap(config conf.Config, servers []string) (authMap map[AuthKey][]ssh.Signer, err error) {
+	authMap = map[AuthKey][]ssh.Signer{}
+
+	errs := []string{}
+	addAuthMap(authMap, config, servers, false, func(server string, err error) {
+		errs = append(errs, fmt.Sprintf("%s's %s", server, err))
+	})
+	if len(errs) > 0 {
+		err = errors.New(strings.Join(errs, "\n"))
+	}
+	return
+}
 
-	for _, server := range r.ServerList {
+// addAuthMap add ssh.Signer of servers and their ssh proxies to authMap. If isPrompt, passphrase of encrypted key and PKCS11 PIN are prompted
+// (except servers of batch mode). Errors are passed to report.
+func addAuthMap(authMap map[AuthKey][]ssh.Signer, c conf.Config, servers []string, isPrompt bool, report func(server string, err error)) {
+	for _, server := range authHops(c, servers) {
 		// get server config
-		config := r.Conf.Server[server]
+		config := c.Server[server]
+		isPrompt := isPrompt && !config.BatchMode
 
 		// Public key auth (single)
 		if config.Key != "" {
-			r.registAuthMapPublicKey(server, config.Key, config.KeyPass)
+			addAuthMapPublicKey(authMap, config.Key, config.KeyPass, server, isPrompt, func(err error) { report(server, err) })
 		}
 
 		// Public keys auth (array)
@@ -31,86 +63,115 @@ func (r *Run) createAuthMap() {
 			for _, key := range config.Keys {
 				keyPair := strings.SplitN(key, "::", 2)
 				if len(keyPair) > 1 {
-					r.registAuthMapPublicKey(server, keyPair[0], keyPair[1])
+					addAuthMapPublicKey(authMap, keyPair[0], keyPair[1], server, isPrompt, func(err error) { report(server, err) })
 				} else {
-					r.registAuthMapPublicKey(server, keyPair[0], "")
+					addAuthMapPublicKey(authMap, keyPair[0], "", server, isPrompt, func(err error) { report(server, err) })
 				}
 			}
 		}
 
 		// Certificate auth
 		if config.Cert != "" {
-			r.registAuthMapCertificate(server, config.Cert, config.CertKey, config.CertKeyPass)
+			addAuthMapCertificate(authMap, config.Cert, config.CertKey, config.CertKeyPass, server, isPrompt, func(err error) { report(server, err) })
 		}
 
 		// PKCS11 Auth
 		if config.PKCS11Use {
-			r.registAuthMapPKCS11(server)
+			if err := addAuthMapPKCS11(authMap, config, isPrompt); err != nil && !isPrompt {
+				report(server, fmt.Errorf("create pkcs11 ssh.Signer err: %s", err))
+			}
+		}
+	}
+}
+
+// authHops return servers and ssh proxies to connect them, in order of connect (proxy first) without duplicate.
+func authHops(c conf.Config, servers []string) (hops []string) {
+	added := map[string]bool{}
+	for _, server := range servers {
+		proxyList, proxyType, _ := GetProxyList(server, c)
+		for _, hop := range append(proxyList, server) {
+			if added[hop] || (hop != server && proxyType[hop] != "ssh") {
+				continue
+			}
+			added[hop] = true
+			hops = append(hops, hop)
 		}
 	}
+	return
 }
 
-// registAuthMapCertificate regist publickey ssh.Signer to AuthMap
-func (r *Run) registAuthMapPublicKey(server, key, pass string) {
+// addAuthMapPublicKey add publickey ssh.Signer to authMap. server is shown in passphrase prompt.
+func addAuthMapPublicKey(authMap map[AuthKey][]ssh.Signer, key, pass, server string, isPrompt bool, report func(err error)) {
 	authKey := AuthKey{AUTHKEY_KEY, key}
 
-	if _, ok := r.AuthMap[authKey]; !ok {
-		signer, err := createSshSignerPublicKey(key, pass)
+	if _, ok := authMap[authKey]; !ok {
+		signer, err := createSshSignerPublicKey(key, pass, server, isPrompt)
 		if signer == nil {
-			fmt.Fprintf(os.Stderr, "%s's create public key ssh.Signer err: %s\n", server, err)
+			report(fmt.Errorf("create public key ssh.Signer err: %s", err))
 		}
-		r.AuthMap[authKey] = []ssh.Signer{signer}
+		authMap[authKey] = []ssh.Signer{signer}
 	}
 }
 
-// registAuthMapCertificate regist cert ssh.Signer to AuthMap
+// addAuthMapCertificate add cert ssh.Signer to authMap
 //
 // TODO(blacknon): keyで指定したPATHのファイル種別を識別し、pkcs11か秘密鍵ファイルかに応じて処理を切り替える
-func (r *Run) registAuthMapCertificate(server, cert, key, pass string) {
+func addAuthMapCertificate(authMap map[AuthKey][]ssh.Signer, cert, key, pass, server string, isPrompt bool, report func(err error)) {
 	authKey := AuthKey{AUTHKEY_CERT, cert}
 
-	if _, ok := r.AuthMap[authKey]; !ok {
-		keySigner, err := createSshSignerPublicKey(key, pass)
+	if _, ok := authMap[authKey]; !ok {
+		keySigner, err := createSshSignerPublicKey(key, pass, server, isPrompt)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s's create certificate ssh.Signer err: %s\n", server, err)
+			report(fmt.Errorf("create certificate ssh.Signer err: %s", err))
 		}
 
 		signer, err := createSshSignerCertificate(cert, keySigner)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s's create certificate ssh.Signer err: %s\n", server, err)
+			report(fmt.Errorf("create certificate ssh.Signer err: %s", err))
 		}
-		r.AuthMap[authKey] = []ssh.Signer{signer}
+		authMap[authKey] = []ssh.Signer{signer}
 	}
 }
 
-func (r *Run) registAuthMapPKCS11(server string) {
-	conf := r.Conf.Server[server]
-
-	authKey := AuthKey{AUTHKEY_PKCS11, conf.PKCS11Provider}
+// addAuthMapPKCS11 add pkcs11 ssh.Signer to authMap. If not isPrompt and PIN is not set, return error.
+func addAuthMapPKCS11(authMap map[AuthKey][]ssh.Signer, serverConf conf.ServerConfig, isPrompt bool) (err error) {
+	authKey := AuthKey{AUTHKEY_PKCS11, serverConf.PKCS11Provider}
 
-	if _, ok := r.AuthMap[authKey]; !ok {
-		conf := r.Conf.Server[server]
+	if _, ok := authMap[authKey]; !ok {
+		if serverConf.PKCS11PIN == "" && !isPrompt {
+			return errors.New("pkcs11_pin is not set")
+		}
 
 		p := new(P11)
-		p.Pkcs11Provider = conf.PKCS11Provider
-		p.PIN = conf.PKCS11PIN
+		p.Pkcs11Provider = serverConf.PKCS11Provider
+		p.PIN = serverConf.PKCS11PIN
 
 		// get crypto signers
 		cryptoSigners, err := p.Get()
 		if err != nil {
-			return
+			return err
 		}
 
 		for _, cryptoSigner := range cryptoSigners {
 			signer, _ := ssh.NewSignerFromSigner(cryptoSigner)
-			r.AuthMap[authKey] = append(r.AuthMap[authKey], signer)
+			authMap[authKey] = append(authMap[authKey], signer)
 		}
 	}
 	return
 }
 
-// create ssh.Signer from Publickey
-func createSshSignerPublicKey(key, pass string) (signer ssh.Signer, err error) {
+// create ssh.Signer from Publickey. If isPrompt, passphrase of encrypted key is prompted with server name.
+func createSshSignerPublicKey(key, pass, server string, isPrompt bool) (signer ssh.Signer, err error) {
+	rawKey, err := parsePrivateKey(key, pass, server, isPrompt)
+	if err != nil {
+		return signer, err
+	}
+
+	return ssh.NewSignerFromKey(rawKey)
+}
+
+// parsePrivateKey return raw private key of key file. If isPrompt, passphrase of encrypted key is prompted with server name.
+func parsePrivateKey(key, pass, server string, isPrompt bool) (rawKey interface{}, err error) {
 	// repeat count
 	rep := 3
 
@@ -120,29 +181,26 @@ func createSshSignerPublicKey(key, pass string) (signer ssh.Signer, err error) {
 	// Read PrivateKey file
 	keyData, err := ioutil.ReadFile(key)
 	if err != nil {
-		return signer, err
+		return rawKey, err
 	}
 
 	if pass != "" {
-		signer, err = sshkeys.ParseEncryptedPrivateKey(keyData, []byte(pass))
-	} else {
-		rgx := regexp.MustCompile(`cannot decode`)
-		signer, err = ssh.ParsePrivateKey(keyData)
-		if err != nil {
-			if rgx.MatchString(err.Error()) {
-				msg := key + "'s passphase:"
-
-				for i := 0; i < rep; i++ {
-					pass, _ = common.GetPassPhase(msg)
-					pass = strings.TrimRight(pass, "\n")
-					sshSigner, err := sshkeys.ParseEncryptedPrivateKey(keyData, []byte(pass))
-					signer = sshSigner
-					if err == nil {
-						break
-					}
-					fmt.Println("\n" + err.Error())
-				}
+		return sshkeys.ParseEncryptedRawPrivateKey(keyData, []byte(pass))
+	}
+
+	rgx := regexp.MustCompile(`cannot decode`)
+	rawKey, err = ssh.ParseRawPrivateKey(keyData)
+	if err != nil && rgx.MatchString(err.Error()) && isPrompt {
+		msg := fmt.Sprintf("%s's passphase (%s):", key, server)
+
+		for i := 0; i < rep; i++ {
+			pass, _ = common.GetPassPhase(msg)
+			pass = strings.TrimRight(pass, "\n")
+			rawKey, err = sshkeys.ParseEncryptedRawPrivateKey(keyData, []byte(pass))
+			if err == nil {
+				break
 			}
+			fmt.Println("\n" + err.Error())
 		}
 	}
 
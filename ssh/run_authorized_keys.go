@@ -0,0 +1,171 @@
+package ssh
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+	"golang.org/x/crypto/ssh"
+)
+
+// AuthorizedKeys add or remove public key at authorized_keys of servers, idempotently.
+// authorized_keys is backed up (authorized_keys.lssh-bak.YYYYmmddHHMMSS) before change, and verified after change.
+type AuthorizedKeys struct {
+	ServerList []string
+	Conf       conf.Config
+	PublicKey  ssh.PublicKey
+	Line       string // authorized_keys line (with comment)
+	IsForce    bool   // allow removing the last key
+
+	// prompt password, if key is not installed yet. (like ssh-copy-id)
+	IsPasswordPrompt bool
+}
+
+// defaultPublicKeyFiles is public key files used by AddKey, if key is not specified. (same order as ssh-copy-id)
+var defaultPublicKeyFiles = []string{
+	"~/.ssh/id_ed25519.pub",
+	"~/.ssh/id_ecdsa.pub",
+	"~/.ssh/id_rsa.pub",
+}
+
+// DefaultPublicKeyFile return the first existing file of defaultPublicKeyFiles.
+func DefaultPublicKeyFile() (path string, err error) {
+	for _, p := range defaultPublicKeyFiles {
+		if _, err := os.Stat(common.GetFullPath(p)); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("public key is not found (%s)", strings.Join(defaultPublicKeyFiles, ", "))
+}
+
+// ReadPublicKeyFile read and validate public key file, and return AuthorizedKeys of it.
+func ReadPublicKeyFile(path string) (a *AuthorizedKeys, err error) {
+	data, err := ioutil.ReadFile(common.GetFullPath(path))
+	if err != nil {
+		return
+	}
+	if strings.Contains(string(data), "PRIVATE KEY") {
+		return nil, fmt.Errorf("%s is private key, specify public key (.pub)", path)
+	}
+
+	publicKey, comment, options, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not valid public key, %v", path, err)
+	}
+
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
+	if len(options) > 0 {
+		line = strings.Join(options, ",") + " " + line
+	}
+	if comment != "" {
+		line += " " + comment
+	}
+
+	return &AuthorizedKeys{PublicKey: publicKey, Line: line}, nil
+}
+
+// authorized_keys scripts. $1 is key blob (base64), $2 is authorized_keys line.
+// Result is printed at the last line of output.
+const (
+	authorizedKeysPushScript = `d="$HOME/.ssh"; f="$d/authorized_keys"; umask 077; mkdir -p "$d" || exit 1
+if [ -f "$f" ] && grep -qF -- "$1" "$f"; then echo exists; exit 0; fi
+if [ -f "$f" ]; then cp -p "$f" "$f.lssh-bak.$(date +%Y%m%d%H%M%S)" || exit 1; fi
+if [ -s "$f" ] && [ -n "$(tail -c 1 "$f")" ]; then echo >> "$f"; fi
+printf '%s\n' "$2" >> "$f" && chmod 600 "$f" && chmod 700 "$d" || exit 1
+grep -qF -- "$1" "$f" && echo added || { echo failed; exit 1; }`
+
+	authorizedKeysRevokeScript = `f="$HOME/.ssh/authorized_keys"
+if [ ! -f "$f" ] || ! grep -qF -- "$1" "$f"; then echo absent; exit 0; fi
+n=$(grep -vF -- "$1" "$f" | grep -c '^[^#[:space:]]')
+if [ "$n" -eq 0 ] && [ "$2" != force ]; then echo last; exit 0; fi
+cp -p "$f" "$f.lssh-bak.$(date +%Y%m%d%H%M%S)" || exit 1
+t="$f.lssh.$$"; cp -p "$f" "$t" || exit 1
+grep -vF -- "$1" "$f" > "$t"; [ $? -le 1 ] || { rm -f "$t"; exit 1; }
+mv -f "$t" "$f" || { rm -f "$t"; exit 1; }
+grep -qF -- "$1" "$f" && { echo failed; exit 1; } || echo removed`
+)
+
+// authorized keys result message
+var authorizedKeysMessage = map[string]string{
+	"added":   "key is added.",
+	"exists":  "key already exists, skipped.",
+	"removed": "key is removed.",
+	"absent":  "key is not found, skipped.",
+	"last":    "key is the last key in authorized_keys, skipped (use --force to remove).",
+	"failed":  "verify failed. check authorized_keys (backup: authorized_keys.lssh-bak.*).",
+}
+
+// Push add public key to authorized_keys of servers, if not exists.
+func (a *AuthorizedKeys) Push() (failed int) {
+	return a.run(authorizedKeysPushScript, a.Line)
+}
+
+// Revoke remove public key from authorized_keys of servers.
+func (a *AuthorizedKeys) Revoke() (failed int) {
+	arg := ""
+	if a.IsForce {
+		arg = "force"
+	}
+	return a.run(authorizedKeysRevokeScript, arg)
+}
+
+// run script at servers in parallel, print result of each server, and return number of failed servers.
+func (a *AuthorizedKeys) run(script, arg string) (failed int) {
+	fmt.Fprintf(os.Stderr, "Public Key    :%s\n", ssh.FingerprintSHA256(a.PublicKey))
+
+	r := new(Run)
+	r.ServerList = a.ServerList
+	r.Conf = a.Conf
+	r.createAuthMap()
+
+	blob := base64.StdEncoding.EncodeToString(a.PublicKey.Marshal())
+	command := "sh -c " + shellQuote(script) + " lssh " + shellQuote(blob) + " " + shellQuote(arg)
+
+	results := make([]string, len(a.ServerList))
+	var wg sync.WaitGroup
+	for i, c := range r.createConn() {
+		c.IsPasswordPrompt = a.IsPasswordPrompt
+
+		wg.Add(1)
+		go func(i int, c *Connect) {
+			defer wg.Done()
+			results[i] = c.runAuthorizedKeysCommand(command)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for i, server := range a.ServerList {
+		msg, ok := authorizedKeysMessage[results[i]]
+		if !ok {
+			msg = results[i]
+		}
+		if !ok || results[i] == "failed" {
+			failed++
+		}
+		fmt.Printf("%s: %s\n", server, msg)
+	}
+	return
+}
+
+// runAuthorizedKeysCommand run command, and return the last line of output (or error message).
+func (c *Connect) runAuthorizedKeysCommand(command string) string {
+	session, err := c.CreateSession()
+	if err != nil {
+		return fmt.Sprintf("cannot connect, %v", err)
+	}
+	defer c.Client.Close()
+	defer session.Close()
+
+	output, err := session.CombinedOutput(command)
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	result := strings.TrimSpace(lines[len(lines)-1])
+	if err != nil && result != "failed" {
+		return fmt.Sprintf("error, %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return result
+}
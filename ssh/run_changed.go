@@ -0,0 +1,167 @@
+package ssh
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// CmdCacheDir is name of directory of command outputs in previous runs, in state directory. (json file per command)
+var CmdCacheDir = "cmd_cache"
+
+// cmdCache is outputs of a command in previous runs, by server.
+type cmdCache struct {
+	Command []string                 `json:"command"`
+	Servers map[string]cmdCacheEntry `json:"servers"`
+}
+
+// cmdCacheEntry is output of command at a server in the last run.
+type cmdCacheEntry struct {
+	Time   time.Time `json:"time"`
+	Hash   string    `json:"hash"` // sha256 of output
+	Exit   int       `json:"exit"`
+	Output string    `json:"output"`
+}
+
+// cmdCachePath return path of cache file of command. (keyed by hash of command line)
+func cmdCachePath(command []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(command, " ")))
+	return filepath.Join(common.GetStatePath(CmdCacheDir), hex.EncodeToString(sum[:8])+".json")
+}
+
+// readCmdCache return cache of command. If it does not exist, empty cache is returned.
+func readCmdCache(command []string) (cache cmdCache, err error) {
+	cache = cmdCache{Command: command, Servers: map[string]cmdCacheEntry{}}
+
+	data, err := ioutil.ReadFile(cmdCachePath(command))
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(data, &cache); err != nil {
+		return
+	}
+	if cache.Servers == nil {
+		cache.Servers = map[string]cmdCacheEntry{}
+	}
+	return
+}
+
+// writeCmdCache write cache of command.
+func writeCmdCache(cache cmdCache) (err error) {
+	path := cmdCachePath(cache.Command)
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// printChanged compare output of each server with previous run of same command, and print changed and unchanged servers.
+// If r.IsChangedOnly, diff of output is printed for changed servers. Output of servers connected is stored for next run.
+func (r *Run) printChanged() {
+	for _, res := range r.results {
+		<-res.done
+	}
+
+	cache, err := readCmdCache(r.ExecCmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot read previous result, %v\n", err)
+		cache = cmdCache{Command: r.ExecCmd, Servers: map[string]cmdCacheEntry{}}
+	}
+
+	var changed, unchanged, added, failed []string
+	for _, res := range r.results {
+		// command is not run, keep previous result.
+		if res.ExitCode() == -1 {
+			failed = append(failed, res.Server)
+			continue
+		}
+
+		output := res.Output.String()
+		sum := sha256.Sum256([]byte(output))
+		entry := cmdCacheEntry{Time: time.Now(), Hash: hex.EncodeToString(sum[:]), Exit: res.ExitCode(), Output: output}
+
+		prev, ok := cache.Servers[res.Server]
+		switch {
+		case !ok:
+			added = append(added, res.Server)
+		case prev.Hash == entry.Hash && prev.Exit == entry.Exit:
+			unchanged = append(unchanged, res.Server)
+		default:
+			changed = append(changed, res.Server)
+			if r.IsChangedOnly {
+				r.printChangedDiff(res.Server, prev, entry)
+			}
+		}
+
+		cache.Servers[res.Server] = entry
+	}
+
+	if err = writeCmdCache(cache); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot save result, %v\n", err)
+	}
+
+	fmt.Println("------------------------------")
+	for _, s := range []struct {
+		label   string
+		servers []string
+	}{
+		{"changed", changed},
+		{"unchanged", unchanged},
+		{"new", added},
+		{"error", failed},
+	} {
+		if len(s.servers) > 0 {
+			fmt.Printf("%-10s(%d): %s\n", s.label, len(s.servers), strings.Join(s.servers, ", "))
+		}
+	}
+}
+
+// printChangedDiff print unified diff of output of server, from previous run.
+func (r *Run) printChangedDiff(server string, prev, current cmdCacheEntry) {
+	fmt.Printf("==> %s (changed since %s) <==\n", server, prev.Time.Format("2006/01/02 15:04:05"))
+	if prev.Exit != current.Exit {
+		fmt.Printf("exit status: %d -> %d\n", prev.Exit, current.Exit)
+	}
+
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(strings.TrimSuffix(prev.Output, "\n")),
+		B:        difflib.SplitLines(strings.TrimSuffix(current.Output, "\n")),
+		FromFile: server,
+		FromDate: prev.Time.Format("2006/01/02 15:04:05"),
+		ToFile:   server,
+		ToDate:   current.Time.Format("2006/01/02 15:04:05"),
+		Context:  3,
+	})
+
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		switch {
+		case r.IsPlainUI, strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+			fmt.Print(line)
+		case strings.HasPrefix(line, "-"):
+			fmt.Printf("\x1b[31m%s\x1b[0m\n", strings.TrimSuffix(line, "\n"))
+		case strings.HasPrefix(line, "+"):
+			fmt.Printf("\x1b[32m%s\x1b[0m\n", strings.TrimSuffix(line, "\n"))
+		default:
+			fmt.Print(line)
+		}
+	}
+	fmt.Println()
+}
@@ -5,6 +5,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 var (
@@ -30,6 +35,54 @@ func (r *Run) cmd() {
 	// create ssh connect
 	conns := r.createConn()
 
+	// start time of each server, for connection audit log
+	r.starts = make([]time.Time, len(conns))
+
+	// per-server results for summary, pager, changed report and run report
+	if r.IsSummary || r.IsPager || r.IsChanged || r.IsChangedOnly || r.ReportPath != "" {
+		r.results = make([]*Result, len(conns))
+	}
+
+	// line edited input, when broadcasting input to parallel sessions.
+	var editor *lineEditor
+	if r.IsParallel && len(conns) > 1 && len(r.StdinData) == 0 && !r.IsPager && !r.IsPlainUI && terminal.IsTerminal(int(os.Stdin.Fd())) {
+		var err error
+		editor, err = newLineEditor()
+		if err != nil {
+			editor = nil
+		} else {
+			editor.IsTerm = r.IsTerm
+			defer editor.Close()
+		}
+	}
+
+	// limit number of parallel run
+	var sem chan bool
+	if r.MaxParallel > 0 {
+		sem = make(chan bool, r.MaxParallel)
+	}
+	cmdRun := func(c *Connect, count int, outputChan chan []byte) {
+		if sem != nil {
+			sem <- true
+			defer func() { <-sem }()
+		}
+		r.cmdRun(c, count, inputWriter, outputChan)
+	}
+
+	// wait print output of parallel run, before return
+	var printWg sync.WaitGroup
+
+	// collapse identical output lines from multiple servers
+	var dedup *dedupOutput
+	var dedupWg sync.WaitGroup
+	if r.IsDedup {
+		var w io.Writer
+		if editor != nil {
+			w = editor
+		}
+		dedup = newDedupOutput(r.DedupWindow, w)
+	}
+
 	// Create session, Get writer
 	for i, conn := range conns {
 		c := conn
@@ -41,7 +94,10 @@ func (r *Run) cmd() {
 			Count:      0,
 			ServerList: r.ServerList,
 			Conf:       r.Conf.Server[c.Server],
-			AutoColor:  true,
+			AutoColor:  !r.IsPlainUI,
+		}
+		if editor != nil {
+			o.Writer = editor
 		}
 		o.Create(c.Server)
 
@@ -49,19 +105,68 @@ func (r *Run) cmd() {
 		outputChan := make(chan []byte)
 
 		// create session, and run command
-		go func() {
-			r.cmdRun(c, count, inputWriter, outputChan)
-			finished <- true
-		}()
+		printChan := outputChan
+		if r.results != nil {
+			res := newResult(c.Server)
+			r.results[count] = res
+
+			var teeDone chan bool
+			printChan, teeDone = res.tee(outputChan)
+
+			go func() {
+				start := time.Now()
+				cmdRun(c, count, outputChan)
+				<-teeDone
+				res.Duration = time.Since(start)
+				res.Sent, res.Received = clientBytes(c.Client)
+				close(res.done)
+				finished <- true
+			}()
+		} else {
+			go func() {
+				cmdRun(c, count, outputChan)
+				finished <- true
+			}()
+		}
 
 		// print command output
-		if r.IsParallel || len(conns) == 1 {
+		if r.IsPager || r.IsChangedOnly {
+			// output is buffered to result, and viewed with pager (or diff is printed) after all commands finished
+			res := r.results[count]
+			name := res.Server
+			if !r.IsPlainUI {
+				name = outColorStrings(count, name)
+			}
+			discard := func() {
+				for range printChan {
+				}
+				fmt.Fprintf(os.Stderr, "%s finished (%s, %d lines)\n", name, res.Status(), strings.Count(res.Output.String(), "\n"))
+			}
+
+			if r.IsParallel || len(conns) == 1 {
+				printWg.Add(1)
+				go func() {
+					discard()
+					printWg.Done()
+				}()
+			} else {
+				discard()
+			}
+		} else if dedup != nil {
+			dedupWg.Add(1)
+			go func() {
+				dedup.Read(o, printChan)
+				dedupWg.Done()
+			}()
+		} else if r.IsParallel || len(conns) == 1 {
+			printWg.Add(1)
 			go func() {
-				printOutput(o, outputChan)
+				printOutput(o, printChan)
+				printWg.Done()
 			}()
 		} else {
 			// r.cmdPrintOutput(c, count, outputChan)
-			printOutput(o, outputChan)
+			printOutput(o, printChan)
 		}
 	}
 
@@ -70,7 +175,7 @@ func (r *Run) cmd() {
 		// create Input
 		// @TODO: 関数化する
 		go func() {
-			if len(r.StdinData) == 0 {
+			if len(r.StdinData) == 0 && !r.IsPager {
 				// create MultipleWriter
 				writers := []io.Writer{}
 				for i := 0; i < len(r.ServerList); i++ {
@@ -78,6 +183,11 @@ func (r *Run) cmd() {
 					writers = append(writers, writer)
 				}
 
+				if editor != nil {
+					go pushInputLineEdit(editor, writers)
+					return
+				}
+
 				stdinWriter := io.MultiWriter(writers...)
 				go pushInput(exitInput, stdinWriter)
 			}
@@ -87,30 +197,88 @@ func (r *Run) cmd() {
 			<-finished
 		}
 	}
+	printWg.Wait()
+
+	// wait all output, and print pending dedup lines
+	if dedup != nil {
+		if !(r.IsParallel || len(r.ServerList) == 1) {
+			for i := 0; i < len(r.ServerList); i++ {
+				<-finished
+			}
+		}
+		dedupWg.Wait()
+		dedup.Close()
+	}
 
 	close(exitInput)
 
+	// view output with pager
+	if r.IsPager {
+		r.viewPager()
+	}
+
+	// print servers whose output changed from previous run
+	if r.IsChanged || r.IsChangedOnly {
+		r.printChanged()
+	}
+
+	// print summary table
+	if r.IsSummary {
+		r.printSummary()
+	}
+
+	// write run report
+	if r.ReportPath != "" {
+		r.writeReport()
+	}
+
 	return
 }
 
 // cmdRun ssh connect and run command.
 func (r *Run) cmdRun(conn *Connect, serverListIndex int, inputWriter chan io.Writer, outputChan chan []byte) {
+	r.starts[serverListIndex] = time.Now()
+
+	// docker container
+	if r.Conf.Server[conn.Server].DockerContainer != "" {
+		r.dockerCmdRun(conn, serverListIndex, inputWriter, outputChan)
+		return
+	}
+
 	// create session
 	session, err := conn.CreateSession()
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "cannot connect session %v, %v\n", outColorStrings(serverListIndex, conn.Server), err)
+		r.setResultErr(serverListIndex, err)
 		close(outputChan)
 		return
 	}
 
+	// sftp-only account can not exec command
+	if conn.checkSftpOnly() {
+		session.Close()
+		err = fmt.Errorf("%s is sftp-only account, command can not be run. use lscp to copy files", conn.Server)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		r.setResultErr(serverListIndex, err)
+		close(outputChan)
+		return
+	}
+
+	// forward run agent
+	conn.forwardRunAgent(session)
+
 	// x11
-	if r.IsX11 || conn.X11 {
+	if r.IsX11Trusted {
+		conn.X11Trusted = true
+	}
+	if r.IsX11 || r.IsX11Trusted || conn.X11 {
 		conn.X11Forwarder(session)
 	}
 
 	// set stdin
-	if len(r.StdinData) > 0 { // if stdin from pipe
+	// at pager mode, terminal is used by pager after run, so input is not sent.
+	if len(r.StdinData) > 0 || !terminal.IsTerminal(int(os.Stdin.Fd())) || r.IsPager { // if stdin from pipe (or /dev/null at cron), send EOF after data
 		session.Stdin = bytes.NewReader(r.StdinData)
 	} else { // if not stdin from pipe
 		if r.IsParallel || len(r.ServerList) == 1 {
@@ -122,7 +290,8 @@ func (r *Run) cmdRun(conn *Connect, serverListIndex int, inputWriter chan io.Wri
 	// run command and get output data to outputChan
 	isExit := make(chan bool)
 	go func() {
-		conn.RunCmdWithOutput(session, r.ExecCmd, outputChan)
+		err := conn.RunCmdWithOutput(session, r.ExecCmd, outputChan)
+		r.setResultErr(serverListIndex, err)
 		isExit <- true
 	}()
 
@@ -0,0 +1,84 @@
+package ssh
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/blacknon/lssh/common"
+)
+
+// CmdHistoryFile is name of history file of executed remote commands, in state directory.
+var CmdHistoryFile = "cmd_history"
+
+// CmdHistory is record of executed remote command. (1 line json in CmdHistoryFile)
+type CmdHistory struct {
+	Time       time.Time `json:"time"`
+	Servers    []string  `json:"servers"`
+	Command    []string  `json:"command"`
+	IsParallel bool      `json:"parallel,omitempty"`
+	IsTerm     bool      `json:"term,omitempty"`
+	RunID      string    `json:"run_id,omitempty"`
+}
+
+// ReadCmdHistory return records in CmdHistoryFile, oldest first.
+func ReadCmdHistory() (history []CmdHistory, err error) {
+	file, err := os.Open(common.GetStatePath(CmdHistoryFile))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	sc := bufio.NewScanner(file)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var h CmdHistory
+		if json.Unmarshal(sc.Bytes(), &h) != nil || len(h.Command) == 0 {
+			continue
+		}
+		history = append(history, h)
+	}
+	return history, sc.Err()
+}
+
+// LastCmdHistory return the last record in CmdHistoryFile.
+func LastCmdHistory() (h CmdHistory, ok bool) {
+	history, _ := ReadCmdHistory()
+	if len(history) == 0 {
+		return
+	}
+	return history[len(history)-1], true
+}
+
+// putCmdHistory append command run of r to CmdHistoryFile.
+func (r *Run) putCmdHistory() (err error) {
+	h := CmdHistory{
+		Time:       time.Now(),
+		Servers:    r.ServerList,
+		Command:    r.ExecCmd,
+		IsParallel: r.IsParallel,
+		IsTerm:     r.IsTerm,
+		RunID:      r.RunID,
+	}
+
+	data, err := json.Marshal(h)
+	if err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(common.GetStatePath(CmdHistoryFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return
+}
+
+// String return command line of h.
+func (h CmdHistory) String() string {
+	return strings.Join(h.Command, " ")
+}
@@ -0,0 +1,107 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/blacknon/lssh/conf"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const defaultContainerRuntime = "docker"
+
+// ContainerExec run `docker exec` (or nerdctl, podman) at remote server via ssh.
+type ContainerExec struct {
+	Server    string
+	Conf      conf.Config
+	Container string
+	Runtime   string   // docker (default), nerdctl, podman... overwrite container_runtime setting
+	User      string   // user in container (exec -u)
+	Command   []string // default: docker_shell setting or /bin/sh
+	IsTerm    bool     // allocate tty
+}
+
+// Start run command in the container, and return error of remote command (*ssh.ExitError).
+func (e *ContainerExec) Start() (err error) {
+	serverConf := e.Conf.Server[e.Server]
+
+	runtime := e.Runtime
+	if runtime == "" {
+		runtime = serverConf.ContainerRuntime
+	}
+	if runtime == "" {
+		runtime = defaultContainerRuntime
+	}
+
+	command := e.Command
+	if len(command) == 0 {
+		shell := serverConf.DockerShell
+		if shell == "" {
+			shell = defaultDockerShell
+		}
+		command = []string{shell}
+	}
+
+	// create exec command line
+	execCmd := []string{runtime, "exec", "-i"}
+	if e.IsTerm {
+		execCmd = append(execCmd, "-t")
+	}
+	if e.User != "" {
+		execCmd = append(execCmd, "-u", shellQuote(e.User))
+	}
+	execCmd = append(execCmd, shellQuote(e.Container))
+	execCmd = append(execCmd, command...)
+
+	r := new(Run)
+	r.ServerList = []string{e.Server}
+	r.Conf = e.Conf
+	r.createAuthMap()
+
+	c := r.createConn()[0]
+	if err = c.CreateClient(); err != nil {
+		return fmt.Errorf("cannot connect %v, %v", c.Server, err)
+	}
+	defer c.Client.Close()
+
+	session, err := c.CreateSession()
+	if err != nil {
+		return fmt.Errorf("cannot connect %v, %v", c.Server, err)
+	}
+	defer session.Close()
+
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	if e.IsTerm {
+		fd := int(os.Stdin.Fd())
+		state, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer terminal.Restore(fd, state)
+
+		width, height, err := terminal.GetSize(fd)
+		if err != nil {
+			return err
+		}
+
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err = session.RequestPty(termType(), height, width, modes); err != nil {
+			return err
+		}
+
+		// Terminal resize
+		stopResize := watchTermResize(session)
+		defer stopResize()
+	}
+
+	return session.Run(strings.Join(execCmd, " "))
+}
@@ -0,0 +1,203 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/blacknon/lssh/conf"
+)
+
+// dbDefaults is default port and client command by db type.
+var dbDefaults = map[string]struct {
+	Port   string
+	Client string
+}{
+	"postgres": {"5432", "psql"},
+	"mysql":    {"3306", "mysql"},
+	"redis":    {"6379", "redis-cli"},
+}
+
+// DBTunnel create port forward to database of server, and exec local db client if needed.
+type DBTunnel struct {
+	Server     string
+	Conf       conf.Config
+	Type       string // db type. if empty and server has only one db setting, use it.
+	LocalPort  string // overwrite local_port setting
+	ExecClient bool   // exec local db client pointed at the tunnel
+	ClientArgs []string
+}
+
+// Start create tunnel, and exec local client or wait until interrupted.
+func (d *DBTunnel) Start() (err error) {
+	dbType, dbConf, err := d.getDBConfig()
+	if err != nil {
+		return err
+	}
+
+	if dbConf.Addr == "" {
+		dbConf.Addr = "127.0.0.1"
+	}
+	if dbConf.Port == "" {
+		dbConf.Port = dbDefaults[dbType].Port
+	}
+	if dbConf.Client == "" {
+		dbConf.Client = dbDefaults[dbType].Client
+	}
+	if d.LocalPort != "" {
+		dbConf.LocalPort = d.LocalPort
+	}
+	if dbConf.LocalPort == "" {
+		dbConf.LocalPort = "0"
+	}
+
+	r := new(Run)
+	r.ServerList = []string{d.Server}
+	r.Conf = d.Conf
+	r.createAuthMap()
+
+	c := r.createConn()[0]
+	if err = c.CreateClient(); err != nil {
+		return fmt.Errorf("cannot connect %v, %v", c.Server, err)
+	}
+	defer c.Client.Close()
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", dbConf.LocalPort))
+	if err != nil {
+		return err
+	}
+
+	c.ForwardRemote = net.JoinHostPort(dbConf.Addr, dbConf.Port)
+	go c.PortForwardAccept(listener)
+
+	localPort := fmt.Sprint(listener.Addr().(*net.TCPAddr).Port)
+	r.printSelectServer()
+	r.printPortForward(listener.Addr().String(), c.ForwardRemote)
+
+	if !d.ExecClient {
+		fmt.Fprintf(os.Stderr, "DB Tunnel     :%s (press Ctrl+C to close)\n", strings.Join(dbClientCommand(dbType, dbConf, localPort, nil), " "))
+
+		// wait interrupt or connection close
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		closed := make(chan error, 1)
+		go func() { closed <- c.Client.Wait() }()
+
+		select {
+		case <-sig:
+		case <-closed:
+			err = fmt.Errorf("connection closed %v", c.Server)
+		}
+		return err
+	}
+
+	// exec local client
+	command := dbClientCommand(dbType, dbConf, localPort, d.ClientArgs)
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), dbClientEnv(dbType, dbConf)...)
+
+	// interrupt is handled by client. lssh wait client exit, without being terminated.
+	// (signal.Ignore is not used, because ignored signal is inherited by client)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer func() {
+		signal.Stop(sig)
+		close(sig)
+	}()
+	go func() {
+		for range sig {
+		}
+	}()
+
+	return cmd.Run()
+}
+
+// getDBConfig return db type and DBConfig of d.Server.
+func (d *DBTunnel) getDBConfig() (dbType string, dbConf conf.DBConfig, err error) {
+	dbs := d.Conf.Server[d.Server].DB
+
+	types := []string{}
+	for t := range dbs {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	dbType = d.Type
+	if dbType == "" {
+		if len(types) != 1 {
+			return "", dbConf, fmt.Errorf("%s: specify db type (%s)", d.Server, strings.Join(types, ", "))
+		}
+		dbType = types[0]
+	}
+
+	dbConf, ok := dbs[dbType]
+	if !ok {
+		return "", dbConf, fmt.Errorf("%s: db setting of %s is not found in config", d.Server, dbType)
+	}
+
+	if _, ok := dbDefaults[dbType]; !ok && (dbConf.Port == "" || dbConf.Client == "") {
+		return "", dbConf, fmt.Errorf("%s: unknown db type %s, need port and client setting", d.Server, dbType)
+	}
+
+	return
+}
+
+// dbClientCommand return local client command line pointed at the tunnel.
+func dbClientCommand(dbType string, dbConf conf.DBConfig, localPort string, args []string) (command []string) {
+	command = []string{dbConf.Client}
+
+	switch dbType {
+	case "postgres":
+		command = append(command, "-h", "127.0.0.1", "-p", localPort)
+		if dbConf.User != "" {
+			command = append(command, "-U", dbConf.User)
+		}
+		if dbConf.Name != "" {
+			command = append(command, "-d", dbConf.Name)
+		}
+	case "mysql":
+		command = append(command, "-h", "127.0.0.1", "-P", localPort)
+		if dbConf.User != "" {
+			command = append(command, "-u", dbConf.User)
+		}
+		if dbConf.Name != "" {
+			command = append(command, dbConf.Name)
+		}
+	case "redis":
+		command = append(command, "-h", "127.0.0.1", "-p", localPort)
+		if dbConf.User != "" {
+			command = append(command, "--user", dbConf.User)
+		}
+		if dbConf.Name != "" {
+			command = append(command, "-n", dbConf.Name)
+		}
+	}
+
+	return append(command, args...)
+}
+
+// dbClientEnv return environment variables to pass password to local client.
+func dbClientEnv(dbType string, dbConf conf.DBConfig) (env []string) {
+	if dbConf.Pass == "" {
+		return
+	}
+
+	switch dbType {
+	case "postgres":
+		env = append(env, "PGPASSWORD="+dbConf.Pass)
+	case "mysql":
+		env = append(env, "MYSQL_PWD="+dbConf.Pass)
+	case "redis":
+		env = append(env, "REDISCLI_AUTH="+dbConf.Pass)
+	}
+
+	return
+}
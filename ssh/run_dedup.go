@@ -0,0 +1,125 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dedupOutput collapse identical output lines arriving from multiple servers within window,
+// and print it as `message (x42 hosts)`.
+type dedupOutput struct {
+	window time.Duration
+	w      io.Writer
+
+	mu      sync.Mutex
+	pending []*dedupLine
+	lines   map[string]*dedupLine // pending line by text
+
+	stop chan bool
+	done chan bool
+}
+
+// dedupLine is output line that waiting for same lines from other servers.
+type dedupLine struct {
+	text    string
+	first   time.Time
+	outputs []*Output
+}
+
+// newDedupOutput return dedupOutput, and start printing in background.
+func newDedupOutput(window time.Duration, w io.Writer) *dedupOutput {
+	if w == nil {
+		w = os.Stdout
+	}
+	if window <= 0 {
+		window = time.Second
+	}
+
+	d := &dedupOutput{
+		window: window,
+		w:      w,
+		lines:  map[string]*dedupLine{},
+		stop:   make(chan bool),
+		done:   make(chan bool),
+	}
+
+	go d.run()
+	return d
+}
+
+// Read read output lines of o from output channel until closed.
+func (d *dedupOutput) Read(o *Output, output chan []byte) {
+	for data := range output {
+		d.add(o, strings.TrimRight(string(data), "\n"))
+	}
+}
+
+// add output line of o.
+func (d *dedupOutput) add(o *Output, text string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if line, ok := d.lines[text]; ok {
+		line.outputs = append(line.outputs, o)
+		return
+	}
+
+	line := &dedupLine{text: text, first: time.Now(), outputs: []*Output{o}}
+	d.lines[text] = line
+	d.pending = append(d.pending, line)
+}
+
+// run print lines that window has passed.
+func (d *dedupOutput) run() {
+	ticker := time.NewTicker(d.window / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.flush(false)
+		case <-d.stop:
+			d.flush(true)
+			close(d.done)
+			return
+		}
+	}
+}
+
+// flush print pending lines in the order of arrival. If force is false, print only lines that window has passed.
+func (d *dedupOutput) flush(force bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for len(d.pending) > 0 {
+		line := d.pending[0]
+		if !force && now.Sub(line.first) < d.window {
+			break
+		}
+
+		if len(line.outputs) == 1 {
+			o := line.outputs[0]
+			if len(o.ServerList) > 1 {
+				fmt.Fprintf(d.w, "%s %s\n", o.GetPrompt(), line.text)
+			} else {
+				fmt.Fprintf(d.w, "%s\n", line.text)
+			}
+		} else {
+			fmt.Fprintf(d.w, "%s (x%d hosts)\n", line.text, len(line.outputs))
+		}
+
+		d.pending = d.pending[1:]
+		delete(d.lines, line.text)
+	}
+}
+
+// Close print all pending lines, and stop.
+func (d *dedupOutput) Close() {
+	close(d.stop)
+	<-d.done
+}
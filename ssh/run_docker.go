@@ -0,0 +1,216 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	defaultDockerSocket = "/var/run/docker.sock"
+	defaultDockerShell  = "/bin/sh"
+)
+
+// dockerCommand return `docker exec` (or `docker-compose exec`) command to the container of server.
+// If docker_server is set, the docker socket of that server is forwarded to local over ssh,
+// and the returned closer must be called after the command finished.
+func (r *Run) dockerCommand(server string, isTerm bool, args ...string) (cmd *exec.Cmd, closer func(), err error) {
+	serverConf := r.Conf.Server[server]
+	closer = func() {}
+
+	command := "docker"
+	execArgs := []string{"exec", "-i"}
+	if isTerm {
+		execArgs = append(execArgs, "-t")
+	}
+
+	// docker-compose exec allocate tty by default.
+	if serverConf.DockerCompose != "" {
+		command = "docker-compose"
+		execArgs = []string{"-f", common.GetFullPath(serverConf.DockerCompose), "exec"}
+		if !isTerm {
+			execArgs = append(execArgs, "-T")
+		}
+	}
+
+	execArgs = append(execArgs, serverConf.DockerContainer)
+	execArgs = append(execArgs, args...)
+
+	cmd = exec.Command(command, execArgs...)
+	cmd.Env = os.Environ()
+
+	dockerHost := serverConf.DockerHost
+	if serverConf.DockerServer != "" {
+		dockerHost, closer, err = r.dockerForwardSocket(serverConf.DockerServer, serverConf.DockerSocket)
+		if err != nil {
+			return cmd, closer, err
+		}
+	}
+
+	if dockerHost != "" {
+		cmd.Env = append(cmd.Env, "DOCKER_HOST="+dockerHost)
+	}
+
+	return
+}
+
+// dockerForwardSocket forward docker socket at remote server to local unix socket.
+// The socket is created in temporary directory accessible by current user only (docker socket is root equivalent at remote server).
+// return DOCKER_HOST value for the forwarded socket.
+func (r *Run) dockerForwardSocket(server, socket string) (dockerHost string, closer func(), err error) {
+	closer = func() {}
+	if socket == "" {
+		socket = defaultDockerSocket
+	}
+
+	c := new(Connect)
+	c.Server = server
+	c.Conf = r.Conf
+	c.AuthMap = r.AuthMap
+
+	if err = c.CreateClient(); err != nil {
+		return "", closer, fmt.Errorf("cannot connect %v, %v", server, err)
+	}
+
+	// ioutil.TempDir create directory with permission 0700.
+	dir, err := ioutil.TempDir("", "lssh-docker")
+	if err != nil {
+		c.Client.Close()
+		return "", closer, err
+	}
+
+	path := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		c.Client.Close()
+		os.RemoveAll(dir)
+		return "", closer, err
+	}
+
+	go func() {
+		for {
+			localConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			remoteConn, err := c.Client.Dial("unix", socket)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "docker socket forward error %v, %v\n", server, err)
+				localConn.Close()
+				continue
+			}
+
+			go func() {
+				defer localConn.Close()
+				defer remoteConn.Close()
+				go io.Copy(remoteConn, localConn)
+				io.Copy(localConn, remoteConn)
+			}()
+		}
+	}()
+
+	closer = func() {
+		listener.Close()
+		c.Client.Close()
+		os.RemoveAll(dir)
+	}
+
+	dockerHost = "unix://" + path
+	return
+}
+
+// dockerTerm connect to the shell in docker container.
+func (r *Run) dockerTerm(server string) (err error) {
+	serverConf := r.Conf.Server[server]
+
+	// print header
+	r.printSelectServer()
+	fmt.Fprintf(os.Stderr, "Docker        :%s\n", serverConf.DockerContainer)
+
+	shell := serverConf.DockerShell
+	if shell == "" {
+		shell = defaultDockerShell
+	}
+
+	isTerm := terminal.IsTerminal(int(os.Stdin.Fd()))
+	cmd, closer, err := r.dockerCommand(server, isTerm, shell)
+	defer closer()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot connect %v, %v \n", server, err)
+		return err
+	}
+
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// run pre local command
+	if serverConf.PreCmd != "" {
+		runCmdLocal(serverConf.PreCmd)
+	}
+
+	// defer run post local command
+	if serverConf.PostCmd != "" {
+		defer runCmdLocal(serverConf.PostCmd)
+	}
+
+	// print newline
+	fmt.Println("------------------------------")
+
+	return cmd.Run()
+}
+
+// dockerCmdRun run command in docker container, and send output to outputChan.
+func (r *Run) dockerCmdRun(conn *Connect, serverListIndex int, inputWriter chan io.Writer, outputChan chan []byte) {
+	defer close(outputChan)
+
+	execCmd := strings.Join(r.ExecCmd, " ")
+	cmd, closer, err := r.dockerCommand(conn.Server, r.IsTerm, "sh", "-c", execCmd)
+	defer closer()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot connect session %v, %v\n", outColorStrings(serverListIndex, conn.Server), err)
+		r.setResultErr(serverListIndex, err)
+		return
+	}
+
+	// set stdin
+	if len(r.StdinData) > 0 || r.IsPager { // if stdin from pipe (input is not sent at pager mode)
+		cmd.Stdin = bytes.NewReader(r.StdinData)
+	} else { // if not stdin from pipe
+		if r.IsParallel || len(r.ServerList) == 1 {
+			writer, _ := cmd.StdinPipe()
+			inputWriter <- writer
+		}
+	}
+
+	// set output
+	outputReader, outputWriter := io.Pipe()
+	cmd.Stdout = outputWriter
+	cmd.Stderr = outputWriter
+
+	if err = cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot run docker %v, %v\n", outColorStrings(serverListIndex, conn.Server), err)
+		r.setResultErr(serverListIndex, err)
+		return
+	}
+
+	isExit := make(chan bool)
+	go func() {
+		r.setResultErr(serverListIndex, cmd.Wait())
+		outputWriter.Close()
+		close(isExit)
+	}()
+	defer func() { <-isExit }()
+
+	sendOutputLines(outputReader, outputChan)
+}
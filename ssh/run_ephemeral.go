@@ -0,0 +1,96 @@
+package ssh
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+)
+
+// ephemeralKeyComment is comment of ephemeral public key in authorized_keys. (followed by run id)
+const ephemeralKeyComment = "lssh-ephemeral-"
+
+// setupEphemeralKey generate keypair for this run, and install public key to servers.
+// Public key is installed with existing credentials, or printed for out-of-band installation (r.IsEphemeralPrint).
+// After setup, servers are authenticated with ephemeral key only (AuthMap key AUTHKEY_EPHEMERAL).
+func (r *Run) setupEphemeralKey() (err error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return
+	}
+
+	comment := ephemeralKeyComment + r.RunID
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))) + " " + comment
+	fmt.Fprintf(os.Stderr, "Ephemeral Key :%s %s\n", ssh.FingerprintSHA256(signer.PublicKey()), comment)
+
+	if r.IsEphemeralPrint {
+		if err = waitEphemeralKeyInstall(line, r.ServerList); err != nil {
+			return
+		}
+	} else {
+		installCmd := `umask 077; mkdir -p "$HOME/.ssh" && printf '%s\n' ` + shellQuote(line) + ` >> "$HOME/.ssh/authorized_keys"`
+		for _, c := range r.createConn() {
+			debugf(1, "%s: install ephemeral key", c.Server)
+			if _, err = c.runRemoteShell(installCmd, nil); err != nil {
+				err = fmt.Errorf("cannot install ephemeral key to %s, %v", c.Server, err)
+				r.removeEphemeralKey() // remove from servers that already installed
+				return
+			}
+			c.Client.Close()
+		}
+	}
+
+	for _, server := range r.ServerList {
+		r.AuthMap[AuthKey{AUTHKEY_EPHEMERAL, server}] = []ssh.Signer{signer}
+	}
+
+	// remove key at exit, even if exited by lssh shell or interrupted (see handleExitSignals)
+	addExitHook(r.removeEphemeralKey)
+
+	return
+}
+
+// removeEphemeralKey remove ephemeral public key of this run from servers.
+// It connect with ephemeral key itself (or existing credentials, if not installed yet).
+func (r *Run) removeEphemeralKey() {
+	comment := ephemeralKeyComment + r.RunID
+	// authorized_keys is replaced (rename of temp file in same directory) only if temp file is written completely,
+	// and previous one is kept as authorized_keys.lssh-bak.
+	removeCmd := `f="$HOME/.ssh/authorized_keys"; [ -f "$f" ] || exit 0; grep -qF -- ` + shellQuote(comment) + ` "$f" || exit 0; ` +
+		`cp -p "$f" "$f.lssh-bak" || exit 1; t="$f.lssh.$$"; cp -p "$f" "$t" || exit 1; ` +
+		`grep -vF -- ` + shellQuote(comment) + ` "$f" > "$t"; [ $? -le 1 ] || { rm -f "$t"; exit 1; }; ` +
+		`mv -f "$t" "$f" || { rm -f "$t"; exit 1; }`
+
+	for _, c := range r.createConn() {
+		debugf(1, "%s: remove ephemeral key", c.Server)
+		if _, err := c.runRemoteShell(removeCmd, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: cannot remove ephemeral key (%s) from authorized_keys, %v\n", c.Server, comment, err)
+			continue
+		}
+		c.Client.Close()
+	}
+}
+
+// waitEphemeralKeyInstall print public key, and wait until user install it to servers.
+func waitEphemeralKeyInstall(line string, servers []string) (err error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("cannot open terminal, %v", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "Add the following line to ~/.ssh/authorized_keys of %s:\n\n", strings.Join(servers, ","))
+	fmt.Fprintf(tty, "%s\n\n", line)
+	fmt.Fprint(tty, "Press Enter when installed: ")
+
+	_, err = bufio.NewReader(tty).ReadString('\n')
+	return
+}
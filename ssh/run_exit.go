@@ -0,0 +1,72 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// exitHooks is cleanup run before lssh exits (ex. remove ephemeral key from servers).
+// It is run at return of Run.Start, exitWithHooks and termination by signal (handleExitSignals).
+var (
+	exitHooks      []func()
+	exitHooksMutex sync.Mutex
+)
+
+// addExitHook add f to exitHooks.
+func addExitHook(f func()) {
+	exitHooksMutex.Lock()
+	defer exitHooksMutex.Unlock()
+	exitHooks = append(exitHooks, f)
+}
+
+// runExitHooks run exitHooks in reverse order of added, and clear them. (each hook is run once)
+func runExitHooks() {
+	exitHooksMutex.Lock()
+	hooks := exitHooks
+	exitHooks = nil
+	exitHooksMutex.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+}
+
+// exitWithHooks run exitHooks, and exit with code. It is used instead of os.Exit, after lssh connected to servers.
+func exitWithHooks(code int) {
+	runExitHooks()
+	os.Exit(code)
+}
+
+// handleExitSignals run exitHooks and exit, if lssh is terminated by signal.
+// Interrupt (Ctrl+C) is handled at command run only, because lssh shell send it to remote (and terminal is raw mode).
+// Second interrupt exit immediately, without waiting for exitHooks.
+func (r *Run) handleExitSignals() {
+	sigs := []os.Signal{syscall.SIGTERM, syscall.SIGHUP}
+	if len(r.ExecCmd) > 0 {
+		sigs = append(sigs, os.Interrupt)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, sigs...)
+
+	go func() {
+		s := <-sig
+		code := 1
+		if n, ok := s.(syscall.Signal); ok {
+			code = 128 + int(n)
+		}
+
+		if s == os.Interrupt {
+			fmt.Fprintln(os.Stderr, "\nlssh: interrupted, clean up servers. (press Ctrl+C again to exit now)")
+			go func() {
+				<-sig
+				os.Exit(code)
+			}()
+		}
+
+		exitWithHooks(code)
+	}()
+}
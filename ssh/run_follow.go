@@ -0,0 +1,170 @@
+package ssh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/blacknon/lssh/conf"
+	"golang.org/x/crypto/ssh"
+)
+
+// Follow run long-running command (tail -F, journalctl -f...) on servers in parallel,
+// merge output with server name prefix, and reconnect when the connection is dropped.
+type Follow struct {
+	ServerList []string
+	Conf       conf.Config
+
+	// Command return command line to run.
+	// since is time of last received output before reconnect (zero at first run).
+	Command func(server string, since time.Time) string
+
+	// Reconnect when the connection is dropped. (not when the command exited)
+	Reconnect     bool
+	RetryInterval time.Duration // default: 5 sec
+
+	// Merge output lines of all servers into a single stream ordered by received time, with timestamp.
+	IsMerge bool
+}
+
+// Start run command on all servers, and wait all finished.
+func (f *Follow) Start() {
+	r := new(Run)
+	r.ServerList = f.ServerList
+	r.Conf = f.Conf
+	r.createAuthMap()
+
+	if f.RetryInterval <= 0 {
+		f.RetryInterval = 5 * time.Second
+	}
+
+	r.printSelectServer()
+
+	conns := r.createConn()
+	outputs := []*Output{}
+	for _, c := range conns {
+		o := &Output{
+			Templete:   cmdOPROMPT,
+			ServerList: f.ServerList,
+			Conf:       f.Conf.Server[c.Server],
+			AutoColor:  true,
+		}
+		o.Create(c.Server)
+		outputs = append(outputs, o)
+	}
+
+	var merger *followMerger
+	if f.IsMerge {
+		merger = newFollowMerger(outputs)
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range conns {
+		o := outputs[i]
+		index := i
+
+		outputChan := make(chan []byte)
+		printed := make(chan bool)
+		go func() {
+			if merger != nil {
+				merger.Read(index, outputChan)
+			} else {
+				printOutput(o, outputChan)
+			}
+			close(printed)
+		}()
+
+		wg.Add(1)
+		go func(c *Connect) {
+			defer wg.Done()
+			f.run(c, outputChan)
+			close(outputChan)
+			<-printed
+		}(c)
+	}
+
+	if merger != nil {
+		merger.Print()
+	}
+	wg.Wait()
+}
+
+// run command on c, and reconnect if needed.
+func (f *Follow) run(c *Connect, outputChan chan []byte) {
+	var since time.Time
+
+	for {
+		lastSeen, err := f.runOnce(c, f.Command(c.Server, since), outputChan)
+		if !lastSeen.IsZero() {
+			since = lastSeen
+		}
+
+		// command exited
+		if _, ok := err.(*ssh.ExitError); ok || err == nil {
+			return
+		}
+
+		if !f.Reconnect {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.Server, err)
+			return
+		}
+
+		fmt.Fprintf(os.Stderr, "%s: connection lost, reconnect after %v. %v\n", c.Server, f.RetryInterval, err)
+		if c.Client != nil {
+			c.Client.Close()
+			c.Client = nil
+		}
+		time.Sleep(f.RetryInterval)
+	}
+}
+
+// runOnce run command once, send output lines to outputChan, and return time of last output.
+func (f *Follow) runOnce(c *Connect, command string, outputChan chan []byte) (lastSeen time.Time, err error) {
+	session, err := c.CreateSession()
+	if err != nil {
+		return
+	}
+	defer session.Close()
+
+	pr, pw := io.Pipe()
+	session.Stdout = pw
+	session.Stderr = pw
+
+	done := make(chan bool)
+	go func() {
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			lastSeen = time.Now()
+			outputChan <- append([]byte{}, scanner.Bytes()...)
+		}
+		io.Copy(ioutil.Discard, pr)
+		close(done)
+	}()
+
+	// keep alive. close client when the connection is dropped.
+	stop := make(chan bool)
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(15 * time.Second):
+				if err := c.CheckClientAlive(); err != nil {
+					c.Client.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	err = session.Run(command)
+	pw.Close()
+	<-done
+
+	return
+}
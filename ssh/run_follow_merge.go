@@ -0,0 +1,110 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// followQueueSize is max number of buffered lines per server at merge mode.
+// If the queue is full, reading output of that server is blocked (and remote is flow-controlled by ssh channel window),
+// so that one chatty server can not starve the others.
+const followQueueSize = 256
+
+// followLine is output line received from server.
+type followLine struct {
+	at   time.Time
+	data []byte
+}
+
+// followMerger merge output lines of servers into a single stream, ordered by received time.
+type followMerger struct {
+	outputs []*Output
+	queues  []chan followLine
+	notify  chan bool
+
+	// output writer. if nil, write to os.Stdout.
+	Writer io.Writer
+}
+
+// newFollowMerger return followMerger for outputs.
+func newFollowMerger(outputs []*Output) *followMerger {
+	m := &followMerger{
+		outputs: outputs,
+		notify:  make(chan bool, 1),
+	}
+	for range outputs {
+		m.queues = append(m.queues, make(chan followLine, followQueueSize))
+	}
+	return m
+}
+
+// Read receive output lines of server i from output, until output is closed.
+func (m *followMerger) Read(i int, output chan []byte) {
+	for data := range output {
+		m.queues[i] <- followLine{at: time.Now(), data: data}
+		m.ping()
+	}
+	close(m.queues[i])
+	m.ping()
+}
+
+// ping notify printer that queue is updated.
+func (m *followMerger) ping() {
+	select {
+	case m.notify <- true:
+	default:
+	}
+}
+
+// Print print lines of all servers in received time order, until all queues are closed.
+func (m *followMerger) Print() {
+	w := m.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+
+	heads := make([]*followLine, len(m.queues))
+	closed := make([]bool, len(m.queues))
+
+	for {
+		// fill heads
+		remain := 0
+		for i, q := range m.queues {
+			if heads[i] == nil && !closed[i] {
+				select {
+				case line, ok := <-q:
+					if ok {
+						heads[i] = &line
+					} else {
+						closed[i] = true
+					}
+				default:
+				}
+			}
+			if !closed[i] || heads[i] != nil {
+				remain++
+			}
+		}
+		if remain == 0 {
+			return
+		}
+
+		// print oldest line
+		oldest := -1
+		for i, head := range heads {
+			if head != nil && (oldest < 0 || head.at.Before(heads[oldest].at)) {
+				oldest = i
+			}
+		}
+		if oldest < 0 {
+			<-m.notify
+			continue
+		}
+
+		line := heads[oldest]
+		heads[oldest] = nil
+		fmt.Fprintf(w, "%s %s %s\n", line.at.Format("15:04:05.000"), m.outputs[oldest].GetPrompt(), line.data)
+	}
+}
@@ -0,0 +1,257 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+	"golang.org/x/crypto/ssh"
+)
+
+// HostKeyBaselineFile is name of host key baseline file of `lssh audit-hostkeys`, in state directory.
+var HostKeyBaselineFile = "hostkeys.json"
+
+// host key audit status
+const (
+	HOSTKEY_OK      = "ok"
+	HOSTKEY_CHANGED = "changed"
+	HOSTKEY_UNKNOWN = "unknown"
+)
+
+// HostKeyRecord is host key of server, stored at HostKeyBaselineFile.
+type HostKeyRecord struct {
+	Addr        string    `json:"addr"`
+	Port        string    `json:"port"`
+	Type        string    `json:"type"`
+	Fingerprint string    `json:"fingerprint"` // SHA256
+	CheckedAt   time.Time `json:"checked_at"`
+}
+
+// HostKeyAudit get current host keys of servers, and compare with known_hosts and stored baseline.
+type HostKeyAudit struct {
+	ServerList []string
+	Conf       conf.Config
+	KnownHosts string // known_hosts path (default: ~/.ssh/known_hosts)
+	IsUpdate   bool   // store current host keys as baseline
+}
+
+// hostKeyResult is audit result of server.
+type hostKeyResult struct {
+	key        ssh.PublicKey
+	err        error
+	baseline   string
+	knownHosts string
+}
+
+// errHostKeyRecorded is returned by recordHostKey to stop connection before authentication, if c.HostKeyOnly.
+var errHostKeyRecorded = errors.New("host key is recorded, stop before authentication")
+
+// recordHostKey return ssh.HostKeyCallback that store host key of c.Server to c.HostKey. (host key is not verified)
+// If c.HostKeyOnly, connection is stopped with errHostKeyRecorded. (no password prompt and authentication failure)
+func (c *Connect) recordHostKey(server string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if server == c.Server {
+			c.HostKey = key
+			if c.HostKeyOnly {
+				return errHostKeyRecorded
+			}
+		}
+		return nil
+	}
+}
+
+// Start connect to servers in parallel, print audit report, and return number of changed keys.
+func (a *HostKeyAudit) Start() (changed int) {
+	if a.KnownHosts == "" {
+		a.KnownHosts = "~/.ssh/known_hosts"
+	}
+	knownHostsData, _ := ioutil.ReadFile(common.GetFullPath(a.KnownHosts))
+	baseline, err := readHostKeyBaseline()
+	if err != nil && !a.IsUpdate {
+		fmt.Fprintf(os.Stderr, "Baseline is not found, store current host keys with --update.\n")
+	}
+
+	r := new(Run)
+	r.ServerList = a.ServerList
+	r.Conf = a.Conf
+	r.createAuthMap()
+
+	results := make([]hostKeyResult, len(a.ServerList))
+	var wg sync.WaitGroup
+	sem := make(chan bool, 10)
+	for i, c := range r.createConn() {
+		wg.Add(1)
+		sem <- true
+
+		go func(i int, c *Connect) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			// connection is stopped after host key is received, server is not authenticated. (proxies are)
+			c.HostKeyOnly = true
+			err := c.CreateClient()
+			if c.Client != nil {
+				c.Client.Close()
+			}
+			if c.HostKey == nil {
+				results[i].err = err
+				return
+			}
+			results[i].key = c.HostKey
+		}(i, c)
+	}
+	wg.Wait()
+
+	// print report
+	fmt.Fprintf(os.Stderr, "Known Hosts   :%s\n", a.KnownHosts)
+	fmt.Fprintf(os.Stderr, "Baseline      :%s\n", common.GetStatePath(HostKeyBaselineFile))
+	fmt.Printf("%-20s %-20s %-52s %-10s %s\n", "SERVER", "TYPE", "FINGERPRINT", "BASELINE", "KNOWN_HOSTS")
+
+	for i, server := range a.ServerList {
+		res := results[i]
+		if res.err != nil {
+			fmt.Printf("%-20s error: %v\n", server, res.err)
+			continue
+		}
+
+		serverConf := a.Conf.Server[server]
+		port := serverConf.Port
+		if port == "" {
+			port = "22"
+		}
+		fingerprint := ssh.FingerprintSHA256(res.key)
+
+		res.baseline = HOSTKEY_UNKNOWN
+		if record, ok := baseline[server]; ok {
+			res.baseline = HOSTKEY_OK
+			if record.Fingerprint != fingerprint {
+				res.baseline = HOSTKEY_CHANGED + " (" + record.Fingerprint + ")"
+			}
+		}
+		res.knownHosts = checkKnownHosts(knownHostsData, serverConf.Addr, port, res.key)
+
+		if strings.HasPrefix(res.baseline, HOSTKEY_CHANGED) || res.knownHosts == HOSTKEY_CHANGED {
+			changed++
+		}
+
+		fmt.Printf("%-20s %-20s %-52s %-10s %s\n", server, res.key.Type(), fingerprint, res.baseline, res.knownHosts)
+
+		baseline[server] = HostKeyRecord{
+			Addr:        serverConf.Addr,
+			Port:        port,
+			Type:        res.key.Type(),
+			Fingerprint: fingerprint,
+			CheckedAt:   time.Now(),
+		}
+	}
+
+	if a.IsUpdate {
+		if err := writeHostKeyBaseline(baseline); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot write baseline, %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Baseline is updated.\n")
+		}
+	}
+
+	return
+}
+
+// checkKnownHosts return status of key in known_hosts data.
+//   - ok      ... key is in known_hosts
+//   - changed ... other key of same type is in known_hosts
+//   - unknown ... host (or key type) is not in known_hosts
+func checkKnownHosts(data []byte, addr, port string, key ssh.PublicKey) string {
+	host := addr
+	if port != "22" {
+		host = "[" + addr + "]:" + port
+	}
+
+	status := HOSTKEY_UNKNOWN
+	for len(data) > 0 {
+		marker, hosts, knownKey, _, rest, err := ssh.ParseKnownHosts(data)
+		if err != nil {
+			break
+		}
+		data = rest
+
+		if marker != "" || !matchKnownHost(hosts, host) {
+			continue
+		}
+
+		if bytes.Equal(knownKey.Marshal(), key.Marshal()) {
+			return HOSTKEY_OK
+		}
+		if knownKey.Type() == key.Type() {
+			status = HOSTKEY_CHANGED
+		}
+	}
+
+	return status
+}
+
+// matchKnownHost return true if host is in host patterns of known_hosts line. (plain or hashed. wildcards are not supported)
+func matchKnownHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		// hashed host. `|1|<salt>|<hash>`
+		if strings.HasPrefix(pattern, "|1|") {
+			fields := strings.Split(pattern, "|")
+			if len(fields) != 4 {
+				continue
+			}
+
+			salt, err := base64.StdEncoding.DecodeString(fields[2])
+			if err != nil {
+				continue
+			}
+			mac := hmac.New(sha1.New, salt)
+			mac.Write([]byte(host))
+			if base64.StdEncoding.EncodeToString(mac.Sum(nil)) == fields[3] {
+				return true
+			}
+			continue
+		}
+
+		if pattern == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readHostKeyBaseline return stored host keys by server name.
+func readHostKeyBaseline() (baseline map[string]HostKeyRecord, err error) {
+	baseline = map[string]HostKeyRecord{}
+
+	data, err := ioutil.ReadFile(common.GetStatePath(HostKeyBaselineFile))
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(data, &baseline)
+	return
+}
+
+// writeHostKeyBaseline write host keys to HostKeyBaselineFile.
+func writeHostKeyBaseline(baseline map[string]HostKeyRecord) (err error) {
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return
+	}
+
+	return ioutil.WriteFile(common.GetStatePath(HostKeyBaselineFile), data, 0600)
+}
@@ -0,0 +1,52 @@
+package ssh
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Journal is option of `journalctl` run on servers.
+type Journal struct {
+	Units    []string // -u
+	Since    string   // --since
+	Until    string   // --until
+	Priority string   // -p
+	Lines    int      // -n
+	IsFollow bool     // -f
+	IsSudo   bool     // run with `sudo -n`
+}
+
+// Command return journalctl command line.
+// If since is not zero (reconnected), entries since that time are printed.
+func (j *Journal) Command(server string, since time.Time) string {
+	cmd := []string{"journalctl", "--no-pager", "-o", "short-iso"}
+	if j.IsSudo {
+		cmd = append([]string{"sudo", "-n"}, cmd...)
+	}
+
+	for _, unit := range j.Units {
+		cmd = append(cmd, "-u", shellQuote(unit))
+	}
+
+	switch {
+	case !since.IsZero():
+		cmd = append(cmd, "--since", shellQuote(fmt.Sprintf("@%d", since.Unix())))
+	case j.Since != "":
+		cmd = append(cmd, "--since", shellQuote(j.Since))
+	case j.Lines > 0:
+		cmd = append(cmd, "-n", fmt.Sprint(j.Lines))
+	}
+
+	if j.Until != "" {
+		cmd = append(cmd, "--until", shellQuote(j.Until))
+	}
+	if j.Priority != "" {
+		cmd = append(cmd, "-p", shellQuote(j.Priority))
+	}
+	if j.IsFollow {
+		cmd = append(cmd, "-f")
+	}
+
+	return strings.Join(cmd, " ")
+}
@@ -0,0 +1,228 @@
+package ssh
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	lineEditPrompt = "[line] > "
+
+	keyCtrlC      = 3
+	keyCtrlR      = 18
+	keyToggleMode = 29 // Ctrl-]
+)
+
+// lineEditor is local line editing input, used when broadcasting input to parallel sessions.
+// The input line is sent to remote only after pressing Enter, so it can be fixed before sending.
+//
+// Supported keys:
+//   - Left/Right/Home/End, Ctrl-U, Ctrl-W ... edit line
+//   - Up/Down ... history
+//   - Ctrl-R  ... reverse search history (press again to search older entry)
+//   - Ctrl-D  ... send EOF
+//   - Ctrl-]  ... toggle line-buffered / character broadcast mode
+//
+// In character mode, each keystroke is sent to remote as it is (for full-screen remote programs).
+type lineEditor struct {
+	term  *terminal.Terminal
+	fd    int
+	state *terminal.State
+
+	// input to term (line mode)
+	input *io.PipeWriter
+
+	// character broadcast mode flag
+	isRaw bool
+	mu    sync.Mutex
+
+	// remote has pty. if false, convert CR to LF at character mode.
+	IsTerm bool
+
+	history []string
+
+	// reverse search (Ctrl-R) state
+	isSearch    bool
+	searchQuery string
+	searchIndex int
+}
+
+// newLineEditor set the terminal to raw mode, and return lineEditor.
+// Call Close() to restore terminal.
+func newLineEditor() (l *lineEditor, err error) {
+	l = &lineEditor{fd: int(os.Stdin.Fd())}
+
+	l.state, err = terminal.MakeRaw(l.fd)
+	if err != nil {
+		return
+	}
+
+	var pr *io.PipeReader
+	pr, l.input = io.Pipe()
+
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{pr, os.Stdout}
+
+	l.term = terminal.NewTerminal(rw, lineEditPrompt)
+	l.term.AutoCompleteCallback = l.keyHandler
+
+	if width, height, err := terminal.GetSize(l.fd); err == nil {
+		l.term.SetSize(width, height)
+	}
+
+	return
+}
+
+// Write output data with keep input line.
+func (l *lineEditor) Write(p []byte) (n int, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.isRaw {
+		// terminal is raw mode, so need CR.
+		_, err = os.Stdout.Write(bytes.Replace(p, []byte("\n"), []byte("\r\n"), -1))
+		return len(p), err
+	}
+	return l.term.Write(p)
+}
+
+// toggleMode switch line-buffered / character broadcast mode, and print current mode.
+func (l *lineEditor) toggleMode() {
+	l.mu.Lock()
+	isRaw := !l.isRaw
+	l.mu.Unlock()
+
+	if isRaw {
+		l.term.SetPrompt("")
+		l.term.Write([]byte("[lssh] character broadcast mode. (Ctrl-] to line mode)\n"))
+	} else {
+		l.term.SetPrompt(lineEditPrompt)
+	}
+
+	l.mu.Lock()
+	l.isRaw = isRaw
+	l.mu.Unlock()
+
+	if !isRaw {
+		l.term.Write([]byte("\n[lssh] line broadcast mode. (Ctrl-] to character mode)\n"))
+	}
+}
+
+// readInput read stdin, and dispatch to term (line mode) or writer (character mode).
+func (l *lineEditor) readInput(writer io.Writer) {
+	buf := make([]byte, 1024)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			l.input.CloseWithError(err)
+			return
+		}
+
+		data := buf[:n]
+		for len(data) > 0 {
+			i := bytes.IndexByte(data, keyToggleMode)
+			chunk := data
+			if i >= 0 {
+				chunk = data[:i]
+			}
+
+			if len(chunk) > 0 {
+				l.mu.Lock()
+				isRaw := l.isRaw
+				l.mu.Unlock()
+
+				if isRaw {
+					if !l.IsTerm {
+						chunk = bytes.Replace(chunk, []byte("\r"), []byte("\n"), -1)
+					}
+					writer.Write(chunk)
+				} else {
+					l.input.Write(chunk)
+				}
+			}
+
+			if i < 0 {
+				break
+			}
+
+			l.toggleMode()
+			data = data[i+1:]
+		}
+	}
+}
+
+// Close restore terminal.
+func (l *lineEditor) Close() {
+	terminal.Restore(l.fd, l.state)
+}
+
+// keyHandler handle key that is not handled by terminal.Terminal.
+func (l *lineEditor) keyHandler(line string, pos int, key rune) (newLine string, newPos int, ok bool) {
+	switch key {
+	case keyCtrlC:
+		l.Write([]byte("^C\n"))
+		l.Close()
+		exitWithHooks(130)
+
+	case keyCtrlR:
+		// first Ctrl-R, search by current line
+		if !l.isSearch {
+			l.isSearch = true
+			l.searchQuery = line
+			l.searchIndex = len(l.history)
+		}
+
+		for i := l.searchIndex - 1; i >= 0; i-- {
+			if strings.Contains(l.history[i], l.searchQuery) {
+				l.searchIndex = i
+				return l.history[i], len(l.history[i]), true
+			}
+		}
+		return line, pos, true
+	}
+
+	// reset search state
+	l.isSearch = false
+
+	return
+}
+
+// readLine read line, and add to history.
+func (l *lineEditor) readLine() (line string, err error) {
+	line, err = l.term.ReadLine()
+
+	l.isSearch = false
+
+	if err == nil && line != "" {
+		l.history = append(l.history, line)
+	}
+	return
+}
+
+// pushInputLineEdit send line edited input to writers.
+// When the input is EOF (Ctrl-D), close writers.
+func pushInputLineEdit(l *lineEditor, writers []io.Writer) {
+	writer := io.MultiWriter(writers...)
+	go l.readInput(writer)
+
+	for {
+		line, err := l.readLine()
+		if err != nil {
+			for _, w := range writers {
+				if c, ok := w.(io.Closer); ok {
+					c.Close()
+				}
+			}
+			return
+		}
+
+		writer.Write([]byte(line + "\n"))
+	}
+}
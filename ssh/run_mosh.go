@@ -0,0 +1,125 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	defaultMoshServer = "mosh-server"
+	defaultMoshClient = "mosh-client"
+)
+
+// moshTerm start mosh-server at remote over ssh, and connect to it with local mosh-client.
+func (r *Run) moshTerm(server string) (err error) {
+	c := new(Connect)
+	c.Server = server
+	c.Conf = r.Conf
+	c.AuthMap = r.AuthMap
+	serverConf := c.Conf.Server[c.Server]
+
+	// print header
+	r.printSelectServer()
+	r.printProxy()
+
+	// mosh use udp, so can not connect over proxy.
+	if serverConf.Proxy != "" || serverConf.ProxyCommand != "" {
+		fmt.Fprintf(os.Stderr, "Warning       :mosh connect directly to %s over udp (proxy is not used).\n", serverConf.Addr)
+	}
+
+	// create ssh session
+	session, err := c.CreateSession()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot connect %v, %v \n", c.Server, err)
+		return err
+	}
+
+	// start mosh-server
+	lang := os.Getenv("LANG")
+	if lang == "" {
+		lang = "en_US.UTF-8"
+	}
+	moshServerCmd := fmt.Sprintf("%s new -s -c 256 -l LANG=%s", defaultMoshServer, lang)
+
+	output, err := session.CombinedOutput(moshServerCmd)
+	if err != nil {
+		return fmt.Errorf("cannot start mosh-server %v, %v: %s", c.Server, err, output)
+	}
+
+	// mosh-client accept ip address only. use address of the connection (address answered, if addrs is set).
+	// over proxy, remote address of the connection is proxy, so addr is resolved.
+	remote := c.Client.RemoteAddr()
+	if serverConf.Proxy != "" || serverConf.ProxyCommand != "" {
+		remote = nil
+	}
+	host, err := moshHost(remote, serverConf.Addr)
+	c.Client.Close()
+	if err != nil {
+		return fmt.Errorf("%v, %v", c.Server, err)
+	}
+
+	port, key, err := parseMoshConnect(output)
+	if err != nil {
+		return fmt.Errorf("%v, %v", c.Server, err)
+	}
+
+	// run pre local command
+	if serverConf.PreCmd != "" {
+		runCmdLocal(serverConf.PreCmd)
+	}
+
+	// defer run post local command
+	if serverConf.PostCmd != "" {
+		defer runCmdLocal(serverConf.PostCmd)
+	}
+
+	// print newline
+	fmt.Println("------------------------------")
+
+	// exec mosh-client
+	cmd := exec.Command(defaultMoshClient, host, port)
+	cmd.Env = append(os.Environ(), "MOSH_KEY="+key)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// moshHost return ip address of server for mosh-client, from remote address of ssh connection.
+// If remote is nil or not ip address, addr is resolved.
+func moshHost(remote net.Addr, addr string) (string, error) {
+	if remote != nil {
+		host, _, err := net.SplitHostPort(remote.String())
+		if err == nil {
+			if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() {
+				return ip.String(), nil
+			}
+		}
+	}
+
+	ip, err := net.ResolveIPAddr("ip", addr)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve address for mosh-client, %v", err)
+	}
+	return ip.String(), nil
+}
+
+// parseMoshConnect get port and key from mosh-server output.
+// ex) `MOSH CONNECT 60001 4NeCCgvZFe2RnPgrcU1PQw`
+func parseMoshConnect(output []byte) (port, key string, err error) {
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 4 && fields[0] == "MOSH" && fields[1] == "CONNECT" {
+			return fields[2], fields[3], nil
+		}
+	}
+
+	return "", "", fmt.Errorf("mosh-server output does not have `MOSH CONNECT` line")
+}
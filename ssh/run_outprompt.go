@@ -2,6 +2,8 @@ package ssh
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strconv"
 	"strings"
 
@@ -33,6 +35,9 @@ type Output struct {
 	ServerList []string
 	Conf       conf.ServerConfig
 	AutoColor  bool
+
+	// output writer. if nil, write to os.Stdout.
+	Writer io.Writer
 }
 
 // Create template, set variable value.
@@ -46,7 +51,10 @@ func (o *Output) Create(server string) {
 
 	// get color num
 	n := common.GetOrderNumber(server, o.ServerList)
-	colorServerName := outColorStrings(n, server)
+	colorServerName := server
+	if o.AutoColor {
+		colorServerName = outColorStrings(n, server)
+	}
 
 	// set templete
 	p := o.Templete
@@ -70,14 +78,19 @@ func (o *Output) GetPrompt() (p string) {
 }
 
 func printOutput(o *Output, output chan []byte) {
+	w := o.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+
 	// print output
 	for data := range output {
 		str := strings.TrimRight(string(data), "\n")
 		if len(o.ServerList) > 1 {
 			oPrompt := o.GetPrompt()
-			fmt.Printf("%s %s\n", oPrompt, str)
+			fmt.Fprintf(w, "%s %s\n", oPrompt, str)
 		} else {
-			fmt.Printf("%s\n", str)
+			fmt.Fprintf(w, "%s\n", str)
 		}
 	}
 }
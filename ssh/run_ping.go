@@ -0,0 +1,211 @@
+package ssh
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blacknon/lssh/conf"
+)
+
+// ping status
+const (
+	PING_OK          = "ok"
+	PING_UNREACHABLE = "unreachable"
+	PING_NO_BANNER   = "no-banner"
+	PING_SKIPPED     = "skipped"
+)
+
+// Ping check reachability of servers in parallel. (tcp connect, ssh banner and optional authentication)
+type Ping struct {
+	ServerList []string
+	Conf       conf.Config
+	Parallel   int           // number of parallel check (default: 10)
+	Timeout    time.Duration // timeout of each server
+	IsAuth     bool          // try authentication
+	SortKey    string        // name (config order), latency or status
+}
+
+// PingResult is result of server.
+type PingResult struct {
+	Server  string
+	Addr    string
+	Status  string
+	Latency time.Duration // tcp connect time (or ssh connect time over proxy)
+	Banner  string        // ssh version banner. ex) SSH-2.0-OpenSSH_8.9p1
+	Auth    string        // ok, failed or `-` (not tried)
+	Err     error
+}
+
+// Start check servers, print result table, and return number of not ok servers.
+func (p *Ping) Start() (failed int) {
+	if p.Parallel <= 0 {
+		p.Parallel = 10
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = 5 * time.Second
+	}
+
+	r := new(Run)
+	r.ServerList = p.ServerList
+	r.Conf = p.Conf
+	if p.IsAuth {
+		r.createAuthMap()
+	}
+
+	results := make([]PingResult, len(p.ServerList))
+	var wg sync.WaitGroup
+	sem := make(chan bool, p.Parallel)
+	for i, c := range r.createConn() {
+		wg.Add(1)
+		sem <- true
+
+		go func(i int, c *Connect) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = p.ping(c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	sortPingResults(results, p.SortKey)
+
+	fmt.Printf("%-20s %-24s %-12s %-10s %-30s %s\n", "SERVER", "ADDR", "STATUS", "LATENCY", "BANNER", "AUTH")
+	for _, res := range results {
+		latency := "-"
+		if res.Latency > 0 {
+			latency = fmt.Sprintf("%.1fms", float64(res.Latency)/float64(time.Millisecond))
+		}
+		banner := res.Banner
+		if banner == "" {
+			banner = "-"
+		}
+
+		fmt.Printf("%-20s %-24s %-12s %-10s %-30s %s\n", res.Server, res.Addr, res.Status, latency, banner, res.Auth)
+		if res.Err != nil {
+			debugf(1, "%s: %v", res.Server, res.Err)
+		}
+		if (res.Status != PING_OK && res.Status != PING_SKIPPED) || strings.HasPrefix(res.Auth, "failed") {
+			failed++
+		}
+	}
+
+	return
+}
+
+// ping check server of c.
+// Server over proxy is checked with ssh connection through proxies (with authentication).
+func (p *Ping) ping(c *Connect) (res PingResult) {
+	serverConf := c.Conf.Server[c.Server]
+	port := serverConf.Port
+	if port == "" {
+		port = "22"
+	}
+	res = PingResult{Server: c.Server, Addr: net.JoinHostPort(serverConf.Addr, port), Auth: "-"}
+
+	if serverConf.Proxy != "" || serverConf.ProxyCommand != "" || serverConf.Transport != "" {
+		if !p.IsAuth {
+			res.Status = PING_SKIPPED
+			res.Auth = "via proxy (use --auth)"
+			return
+		}
+
+		start := time.Now()
+		err := p.connect(c, &res)
+		if err == nil || isAuthError(err) {
+			res.Status = PING_OK
+			res.Latency = time.Since(start)
+		} else {
+			res.Status = PING_UNREACHABLE
+		}
+		return
+	}
+
+	// tcp connect
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", res.Addr, p.Timeout)
+	if err != nil {
+		res.Status = PING_UNREACHABLE
+		res.Err = err
+		return
+	}
+	res.Latency = time.Since(start)
+
+	// ssh banner
+	conn.SetReadDeadline(time.Now().Add(p.Timeout))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	conn.Close()
+	res.Banner = strings.TrimSpace(line)
+	if err != nil || !strings.HasPrefix(res.Banner, "SSH-") {
+		res.Status = PING_NO_BANNER
+		res.Err = err
+		return
+	}
+	res.Status = PING_OK
+
+	if p.IsAuth {
+		p.connect(c, &res)
+	}
+	return
+}
+
+// connect create ssh client of c with timeout, and set authentication result to res.
+func (p *Ping) connect(c *Connect, res *PingResult) (err error) {
+	done := make(chan error, 1)
+	go func() {
+		done <- c.CreateClient()
+	}()
+
+	select {
+	case err = <-done:
+	case <-time.After(p.Timeout):
+		err = fmt.Errorf("timeout")
+		go func() {
+			if <-done == nil {
+				c.Client.Close()
+			}
+		}()
+		res.Auth = "failed (timeout)"
+		res.Err = err
+		return
+	}
+
+	if err != nil {
+		res.Auth = "failed"
+		if !isAuthError(err) {
+			res.Auth = "failed (" + err.Error() + ")"
+		}
+		res.Err = err
+		return
+	}
+
+	res.Auth = "ok"
+	if res.Banner == "" {
+		res.Banner = string(c.Client.ServerVersion())
+	}
+	c.Client.Close()
+	return
+}
+
+// sortPingResults sort results by key. (name is config order)
+func sortPingResults(results []PingResult, key string) {
+	switch key {
+	case "latency":
+		sort.SliceStable(results, func(i, j int) bool {
+			if results[i].Latency == 0 || results[j].Latency == 0 {
+				return results[j].Latency == 0 && results[i].Latency != 0
+			}
+			return results[i].Latency < results[j].Latency
+		})
+	case "status":
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Status < results[j].Status
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+)
+
+// DryRun print execution plan of r to w, without connecting.
+// (mode, servers, proxy route and auth methods of each server, and command)
+func (r *Run) DryRun(w io.Writer) {
+	runID := r.RunID
+	if runID == "" {
+		runID = "(generated at run)"
+	}
+
+	servers := r.ServerList
+	if len(r.ExecCmd) == 0 && !r.IsShell && len(servers) > 1 {
+		// terminal connect to the first server only
+		servers = servers[:1]
+	}
+
+	fmt.Fprintf(w, "Dry Run       :nothing is connected\n")
+	fmt.Fprintf(w, "Mode          :%s\n", r.planMode())
+	fmt.Fprintf(w, "Select Server :%s\n", strings.Join(servers, ","))
+	if len(r.ExecCmd) > 0 {
+		fmt.Fprintf(w, "Run Command   :%s\n", strings.Join(r.ExecCmd, " "))
+		if r.MaxParallel > 0 {
+			fmt.Fprintf(w, "Max Parallel  :%d\n", r.MaxParallel)
+		}
+	}
+	fmt.Fprintf(w, "Run ID        :%s\n", runID)
+	if r.PortForwardLocal != "" && r.PortForwardRemote != "" {
+		fmt.Fprintf(w, "Port Forward  :local[%s] <=> remote[%s]\n", r.PortForwardLocal, r.PortForwardRemote)
+	}
+
+	for _, server := range servers {
+		fmt.Fprintf(w, "\n%s:\n", server)
+		planServer(w, server, r.Conf)
+
+		switch {
+		case r.isSystemSsh(server):
+			serverConf := r.Conf.Server[server]
+			fmt.Fprintf(w, "  Local Cmd   :%s %s\n", defaultSystemSsh, strings.Join(systemSshArgs(serverConf, r.SystemSshArgs), " "))
+		case len(r.ExecCmd) > 0:
+			// same as Connect.RunCmd (env is exported in command, if sshd not accept LSSH_RUN_ID)
+			serverConf := r.Conf.Server[server]
+			fmt.Fprintf(w, "  Remote Cmd  :%s\n", remoteShellCmd(serverConf.RemoteShell, serverConf.Chdir, strings.Join(r.ExecCmd, " "), ""))
+		case !r.IsShell:
+			// terminal with chdir and initial_cmd (local rc is not shown)
+			serverConf := r.Conf.Server[server]
+			if cmd := remoteTermCmd(serverConf.RemoteShell, serverConf.Chdir, serverConf.InitialCmd, ""); cmd != "" {
+				fmt.Fprintf(w, "  Remote Cmd  :%s\n", cmd)
+			}
+		}
+	}
+}
+
+// DryRun print copy plan of r to w, without copying.
+// (servers, proxy route and auth methods of each server, and file transfer manifest)
+// Only from servers are connected, to list remote files.
+func (r *RunScp) DryRun(w io.Writer) {
+	fmt.Fprintf(w, "Dry Run       :nothing is copied\n")
+	fmt.Fprintf(w, "Permission    :%v\n", r.Permission)
+	if r.Tar {
+		compress := r.TarCompress
+		if compress == TAR_COMPRESS_NONE {
+			compress = "none"
+		}
+		fmt.Fprintf(w, "Tar           :compress=%s\n", compress)
+	}
+	if r.Chunks > 1 {
+		conn := "channel"
+		if r.ChunkConn {
+			conn = "connection"
+		}
+		fmt.Fprintf(w, "Chunks        :%d (%s per chunk)\n", r.Chunks, conn)
+	}
+	if r.Direct {
+		fmt.Fprintf(w, "Direct        :%s copies to destination servers (relay via local if failed)\n", strings.Join(r.From.Server, ","))
+	}
+	if r.Delta {
+		fmt.Fprintf(w, "Delta         :%v\n", r.Delta)
+	}
+	if len(r.Include) > 0 {
+		fmt.Fprintf(w, "Include       :%s\n", strings.Join(r.Include, ","))
+	}
+	if len(r.Exclude) > 0 {
+		fmt.Fprintf(w, "Exclude       :%s\n", strings.Join(r.Exclude, ","))
+	}
+
+	servers := append(append([]string{}, r.From.Server...), r.To.Server...)
+	for _, server := range servers {
+		fmt.Fprintf(w, "\n%s:\n", server)
+		planServer(w, server, r.Config)
+	}
+
+	fmt.Fprintf(w, "\nManifest:\n")
+	printManifest(w, r.ResolveManifest())
+}
+
+// planMode return description of what Start will do.
+func (r *Run) planMode() string {
+	serverConf := r.Conf.Server[r.ServerList[0]]
+
+	switch {
+	case r.StdioTarget != "":
+		return "stdio forward to " + r.StdioTarget
+	case r.IsService:
+		return "port forward service"
+	case r.isSystemSsh(r.ServerList[0]):
+		return "terminal (system ssh)"
+	case len(r.ExecCmd) > 0 && r.WatchInterval > 0:
+		return fmt.Sprintf("command (watch every %s)", r.WatchInterval)
+	case len(r.ExecCmd) > 0 && r.IsParallel:
+		return "command (parallel)"
+	case len(r.ExecCmd) > 0:
+		return "command"
+	case r.IsShell:
+		return "lssh shell"
+	case serverConf.DockerContainer != "":
+		return "terminal (docker exec " + serverConf.DockerContainer + ")"
+	case r.IsMosh || serverConf.UseMosh:
+		return "terminal (mosh)"
+	}
+	return "terminal"
+}
+
+// isSystemSsh return true if r connect terminal of server with local ssh command.
+func (r *Run) isSystemSsh(server string) bool {
+	return len(r.ExecCmd) == 0 && !r.IsShell && (r.IsSystemSsh || r.Conf.Server[server].UseSystemSsh)
+}
+
+// planServer print address, proxy route and auth methods of server.
+func planServer(w io.Writer, server string, config conf.Config) {
+	serverConf := config.Server[server]
+
+	port := serverConf.Port
+	if port == "" {
+		port = "22"
+	}
+	fmt.Fprintf(w, "  Address     :%s@%s:%s\n", serverConf.User, serverConf.Addr, port)
+	if len(serverConf.Addrs) > 0 {
+		fmt.Fprintf(w, "  Addresses   :%s\n", strings.Join(serverConf.Addrs, ","))
+	}
+
+	route, err := planProxyRoute(server, config)
+	if err != nil {
+		fmt.Fprintf(w, "  Proxy       :error, %v\n", err)
+	} else if route != "" {
+		fmt.Fprintf(w, "  Proxy       :%s\n", route)
+	}
+
+	fmt.Fprintf(w, "  Auth        :%s\n", strings.Join(planAuthMethods(serverConf), ", "))
+}
+
+// planProxyRoute return proxy route of server. ex) `localhost => [ssh://bastion:22] => web01`
+// If server is connected directly, return empty string.
+func planProxyRoute(server string, config conf.Config) (route string, err error) {
+	serverConf := config.Server[server]
+
+	proxyList, proxyType, err := GetProxyList(server, config)
+	if err != nil {
+		return
+	}
+
+	hops := []string{}
+	if serverConf.Transport != "" {
+		hops = append(hops, "["+serverConf.Transport+":"+serverConf.TransportURL+"]")
+	}
+
+	if serverConf.ProxyCommand != "" {
+		hops = append(hops, "[ProxyCommand:"+serverConf.ProxyCommand+"]")
+	} else {
+		for _, proxy := range proxyList {
+			port := config.Server[proxy].Port
+			switch proxyType[proxy] {
+			case "http", "https", "socks5":
+				port = config.Proxy[proxy].Port
+			}
+			if port == "" {
+				port = "22"
+			}
+			hops = append(hops, "["+proxyType[proxy]+"://"+proxy+":"+port+"]")
+		}
+	}
+
+	if len(hops) == 0 {
+		return "", nil
+	}
+
+	hops = append([]string{"localhost"}, hops...)
+	return strings.Join(append(hops, server), " => "), nil
+}
+
+// planAuthMethods return auth methods that would be attempted, in the order of createSshAuth.
+// Passwords and passphrases are not shown.
+func planAuthMethods(serverConf conf.ServerConfig) (methods []string) {
+	if serverConf.Key != "" {
+		methods = append(methods, "key("+common.GetFullPath(serverConf.Key)+")")
+	}
+	for _, key := range serverConf.Keys {
+		methods = append(methods, "key("+common.GetFullPath(strings.SplitN(key, "::", 2)[0])+")")
+	}
+	if serverConf.Cert != "" {
+		methods = append(methods, "cert("+common.GetFullPath(serverConf.Cert)+")")
+	}
+	if serverConf.AgentAuth {
+		methods = append(methods, "ssh-agent("+agentSocketPath(serverConf)+")")
+	}
+	if serverConf.PKCS11Use {
+		methods = append(methods, "pkcs11("+serverConf.PKCS11Provider+")")
+	}
+
+	// passwords are tried in keyboard-interactive and password
+	passwords := len(serverConf.Passes)
+	if serverConf.Pass != "" {
+		passwords++
+	}
+	switch {
+	case passwords == 1:
+		methods = append(methods, "keyboard-interactive/password")
+	case passwords > 1:
+		methods = append(methods, fmt.Sprintf("keyboard-interactive/password(x%d)", passwords))
+	}
+
+	if len(methods) == 0 {
+		methods = []string{"(none)"}
+	}
+	return
+}
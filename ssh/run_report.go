@@ -0,0 +1,73 @@
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// RunResult is result of command run on a server, in RunReport.
+type RunResult struct {
+	Server   string  `json:"server"`
+	Status   string  `json:"status"`    // ok, failed or error
+	ExitCode int     `json:"exit_code"` // -1 if command is not run (connect error etc.)
+	Duration float64 `json:"duration"`  // seconds
+	Sent     int64   `json:"sent"`      // bytes sent to server
+	Received int64   `json:"received"`  // bytes received from server
+	Error    string  `json:"error,omitempty"`
+}
+
+// RunReport is report of lssh command run (`lssh --report FILE`), for tools that wrap lssh.
+type RunReport struct {
+	Time    time.Time   `json:"time"`
+	RunID   string      `json:"run_id"`
+	Command []string    `json:"command"`
+	Servers []string    `json:"servers"` // servers attempted
+	Result  string      `json:"result"`  // ok (command succeeded on all servers) or failed
+	Results []RunResult `json:"results"`
+}
+
+// report return RunReport of results of command run.
+func (r *Run) report() RunReport {
+	report := RunReport{
+		Time:    time.Now(),
+		RunID:   r.RunID,
+		Command: r.ExecCmd,
+		Servers: r.ServerList,
+		Result:  "ok",
+	}
+
+	for _, res := range r.results {
+		result := RunResult{
+			Server:   res.Server,
+			Status:   res.Status(),
+			ExitCode: res.ExitCode(),
+			Duration: res.Duration.Seconds(),
+			Sent:     res.Sent,
+			Received: res.Received,
+		}
+		if res.Err != nil {
+			result.Error = res.Err.Error()
+		}
+		if result.Status != "ok" {
+			report.Result = "failed"
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	return report
+}
+
+// writeReport write report of command run to r.ReportPath, after all commands finished.
+func (r *Run) writeReport() {
+	for _, res := range r.results {
+		<-res.done
+	}
+
+	data, _ := json.MarshalIndent(r.report(), "", "  ")
+	if err := ioutil.WriteFile(r.ReportPath, append(data, '\n'), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot write report %s, %v\n", r.ReportPath, err)
+	}
+}
@@ -0,0 +1,179 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/blacknon/lssh/list"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Result is result of command run on server.
+type Result struct {
+	Server   string
+	Err      error // connect error or *ssh.ExitError
+	Duration time.Duration
+	Output   bytes.Buffer
+	Sent     int64 // bytes sent to server
+	Received int64 // bytes received from server
+
+	done chan bool
+}
+
+// newResult return Result of server.
+func newResult(server string) *Result {
+	return &Result{Server: server, done: make(chan bool)}
+}
+
+// ExitCode return exit code of command. If command is not run (connect error etc.), return -1.
+func (res *Result) ExitCode() int {
+	switch err := res.Err.(type) {
+	case nil:
+		return 0
+	case *ssh.ExitError:
+		return err.ExitStatus()
+	}
+	return -1
+}
+
+// exitStatus return exit status of err, same as OpenSSH.
+//   - nil             ... 0
+//   - *ssh.ExitError  ... remote exit status
+//   - *exec.ExitError ... exit status of local command (docker etc.)
+//   - others          ... 255 (connect error etc.)
+func exitStatus(err error) int {
+	switch err := err.(type) {
+	case nil:
+		return 0
+	case *ssh.ExitError:
+		return err.ExitStatus()
+	case *exec.ExitError:
+		if code := err.ExitCode(); code >= 0 {
+			return code
+		}
+	}
+	return 255
+}
+
+// Status return `ok`, `failed` or `error`.
+func (res *Result) Status() string {
+	switch res.ExitCode() {
+	case 0:
+		return "ok"
+	case -1:
+		return "error"
+	}
+	return "failed"
+}
+
+// tee copy output data to Result.Output, and return channel that receives same data.
+// Returned channel is closed when output is closed.
+func (res *Result) tee(output chan []byte) (teeOutput chan []byte, teeDone chan bool) {
+	teeOutput = make(chan []byte)
+	teeDone = make(chan bool)
+
+	go func() {
+		for data := range output {
+			res.Output.Write(data)
+			teeOutput <- data
+		}
+		close(teeOutput)
+		close(teeDone)
+	}()
+
+	return
+}
+
+// setResultErr set err to result of server, if results is enabled.
+// If run on single server, also set exit status to r.ExitStatus. (like OpenSSH)
+// It is called once per server when command run is finished, and write audit log.
+func (r *Run) setResultErr(serverListIndex int, err error) {
+	if serverListIndex < len(r.starts) {
+		r.writeConnectionAudit(r.ServerList[serverListIndex], r.auditCommand(), r.starts[serverListIndex], err)
+	}
+
+	if len(r.ServerList) == 1 {
+		r.ExitStatus = exitStatus(err)
+	}
+
+	if r.results != nil && err != nil {
+		r.results[serverListIndex].Err = err
+	}
+}
+
+// printSummary print per-server summary table after all commands finished.
+// If stdout is terminal (and not plain ui), show interactive table (sort, filter and view output).
+func (r *Run) printSummary() {
+	for _, res := range r.results {
+		<-res.done
+	}
+
+	t := &list.Table{
+		Title:  "lssh summary",
+		Header: []string{"ServerName", "Status", "ExitCode", "Duration", "Lines"},
+	}
+
+	for _, res := range r.results {
+		output := res.Output.String()
+		lines := strings.Count(output, "\n")
+		if res.Err != nil && res.ExitCode() == -1 {
+			output += fmt.Sprintf("\n[lssh] %v\n", res.Err)
+		}
+
+		duration := res.Duration.Round(time.Millisecond)
+		t.Rows = append(t.Rows, list.TableRow{
+			Cells: []string{res.Server, res.Status(), fmt.Sprint(res.ExitCode()), duration.String(), fmt.Sprint(lines)},
+			SortKeys: []string{
+				res.Server,
+				fmt.Sprintf("%s%04d", map[string]string{"error": "2", "failed": "1", "ok": "0"}[res.Status()], res.ExitCode()+1),
+				fmt.Sprintf("%04d", res.ExitCode()+1),
+				fmt.Sprintf("%020d", res.Duration),
+				fmt.Sprintf("%020d", lines),
+			},
+			Detail: output,
+		})
+	}
+
+	if terminal.IsTerminal(int(os.Stdout.Fd())) && !r.IsPlainUI {
+		t.View()
+		return
+	}
+
+	fmt.Println("------------------------------")
+	t.Print(os.Stdout)
+}
+
+// viewPager view per-server output with pager after all commands finished.
+// If stdout is not terminal (or plain ui), output is printed grouped by server.
+func (r *Run) viewPager() {
+	for _, res := range r.results {
+		<-res.done
+	}
+
+	p := &list.Pager{Title: "lssh pager"}
+	for _, res := range r.results {
+		output := res.Output.String()
+		if res.Err != nil && res.ExitCode() == -1 {
+			output += fmt.Sprintf("\n[lssh] %v\n", res.Err)
+		}
+		p.Pages = append(p.Pages, list.PagerPage{Name: res.Server, Status: res.Status(), Text: output})
+	}
+
+	if terminal.IsTerminal(int(os.Stdout.Fd())) && !r.IsPlainUI {
+		p.View()
+		return
+	}
+
+	for _, page := range p.Pages {
+		fmt.Printf("==> %s (%s) <==\n", page.Name, page.Status)
+		fmt.Print(page.Text)
+		if page.Text != "" && !strings.HasSuffix(page.Text, "\n") {
+			fmt.Println()
+		}
+	}
+}
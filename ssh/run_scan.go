@@ -0,0 +1,139 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/blacknon/lssh/conf"
+	"golang.org/x/crypto/ssh"
+)
+
+// port scan result
+const (
+	PORT_OPEN     = "open"
+	PORT_CLOSED   = "closed"
+	PORT_FILTERED = "filtered"
+)
+
+// PortScan check tcp ports of target from the remote host's perspective, via direct-tcpip channels.
+type PortScan struct {
+	Server   string
+	Conf     conf.Config
+	Target   string // scan target host (from server). default: 127.0.0.1
+	Ports    []int
+	Parallel int           // number of parallel connection
+	Timeout  time.Duration // timeout of each port
+	ShowAll  bool          // print closed and filtered ports
+}
+
+// Start run port scan, and print result.
+func (p *PortScan) Start() (err error) {
+	r := new(Run)
+	r.ServerList = []string{p.Server}
+	r.Conf = p.Conf
+	r.createAuthMap()
+
+	c := r.createConn()[0]
+	if err = c.CreateClient(); err != nil {
+		return fmt.Errorf("cannot connect %v, %v", c.Server, err)
+	}
+	defer c.Client.Close()
+
+	if p.Target == "" {
+		p.Target = "127.0.0.1"
+	}
+	if p.Parallel <= 0 {
+		p.Parallel = 10
+	}
+
+	fmt.Fprintf(os.Stderr, "Scan Ports    :%s => %s (%d ports)\n", p.Server, p.Target, len(p.Ports))
+
+	// scan
+	results := map[int]string{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan bool, p.Parallel)
+
+	for _, port := range p.Ports {
+		wg.Add(1)
+		sem <- true
+
+		go func(port int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			state := scanPort(c.Client, net.JoinHostPort(p.Target, strconv.Itoa(port)), p.Timeout)
+
+			mu.Lock()
+			results[port] = state
+			mu.Unlock()
+		}(port)
+	}
+	wg.Wait()
+
+	// print result
+	ports := []int{}
+	for port := range results {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+
+	count := map[string]int{}
+	for _, port := range ports {
+		state := results[port]
+		count[state]++
+
+		if state == PORT_OPEN || p.ShowAll {
+			fmt.Printf("%d/tcp\t%s\n", port, state)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "open: %d, closed: %d, filtered: %d\n", count[PORT_OPEN], count[PORT_CLOSED], count[PORT_FILTERED])
+	return
+}
+
+// scanPort return port state of addr.
+//   - open     ... direct-tcpip channel opened
+//   - closed   ... remote returned connect failed
+//   - filtered ... timeout, or other error
+func scanPort(client *ssh.Client, addr string, timeout time.Duration) string {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := client.Dial("tcp", addr)
+		ch <- result{conn, err}
+	}()
+
+	select {
+	case res := <-ch:
+		if res.err == nil {
+			res.conn.Close()
+			return PORT_OPEN
+		}
+
+		if openErr, ok := res.err.(*ssh.OpenChannelError); ok && openErr.Reason == ssh.ConnectionFailed {
+			return PORT_CLOSED
+		}
+		return PORT_FILTERED
+
+	case <-time.After(timeout):
+		// close connection, if it is opened after timeout.
+		go func() {
+			if res := <-ch; res.err == nil {
+				res.conn.Close()
+			}
+		}()
+		return PORT_FILTERED
+	}
+}
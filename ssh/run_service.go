@@ -0,0 +1,92 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// service run lssh as service mode.
+// Do not connect to remote shell, and keep port forwarding until the ssh connection is closed.
+//
+// When started by systemd socket activation, the inherited sockets are used as local port.
+// Return error when the connection is lost, so that it can be restarted by service manager.
+func (r *Run) service() (err error) {
+	server := r.ServerList[0]
+	c := new(Connect)
+	c.Server = server
+	c.Conf = r.Conf
+	c.AuthMap = r.AuthMap
+	serverConf := c.Conf.Server[c.Server]
+
+	// print header
+	r.printSelectServer()
+	r.printProxy()
+
+	// Overwrite port forward option.
+	if len(r.PortForwardLocal) > 0 {
+		serverConf.PortForwardLocal = r.PortForwardLocal
+	}
+	if len(r.PortForwardRemote) > 0 {
+		serverConf.PortForwardRemote = r.PortForwardRemote
+	}
+
+	if serverConf.PortForwardRemote == "" {
+		return fmt.Errorf("service mode need port forward remote setting")
+	}
+	c.ForwardLocal = serverConf.PortForwardLocal
+	c.ForwardRemote = serverConf.PortForwardRemote
+
+	// get listener (socket activation)
+	listeners, err := SystemdListeners()
+	if err != nil {
+		return err
+	}
+
+	// not socket activation
+	if len(listeners) == 0 {
+		if c.ForwardLocal == "" {
+			return fmt.Errorf("service mode need port forward local setting or socket activation")
+		}
+
+		listener, err := net.Listen("tcp", c.ForwardLocal)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, listener)
+	}
+
+	// create ssh client
+	err = c.CreateClient()
+	if err != nil {
+		return fmt.Errorf("cannot connect %v, %v", c.Server, err)
+	}
+	metrics.add("lssh_connections_active", 1, "server", c.Server)
+	defer metrics.add("lssh_connections_active", -1, "server", c.Server)
+
+	for _, listener := range listeners {
+		r.printPortForward(listener.Addr().String(), c.ForwardRemote)
+		go c.PortForwardAccept(listener)
+	}
+
+	// keep alive packet
+	go func() {
+		for {
+			time.Sleep(15 * time.Second)
+			if err := c.CheckClientAlive(); err != nil {
+				fmt.Fprintf(os.Stderr, "keepalive failed %v, %v\n", c.Server, err)
+				c.Client.Close()
+				return
+			}
+		}
+	}()
+
+	// wait ssh connection close
+	err = c.Client.Wait()
+	if err == nil {
+		err = fmt.Errorf("connection closed %v", c.Server)
+	}
+
+	return err
+}
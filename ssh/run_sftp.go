@@ -0,0 +1,341 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// sftpShellHelp is help of sftpShell commands.
+const sftpShellHelp = `ls [dir]              list remote directory
+cd dir                change remote directory
+pwd                   print remote directory
+mkdir dir             create remote directory
+get remote... [local] download remote files (wildcard of remote is expanded)
+put local... [remote] upload local files (wildcard of local is expanded)
+lcd dir               change local directory
+lpwd                  print local directory
+exit                  exit
+`
+
+// sftpShell start interactive sftp shell at c.Server, instead of login shell.
+// It is used for sftp-only account (exec and shell are not available).
+func (r *Run) sftpShell(c *Connect) (err error) {
+	s, err := newSftpClient(c.Client)
+	if err != nil {
+		return fmt.Errorf("cannot start sftp %v, %v", c.Server, err)
+	}
+	defer s.Close()
+
+	dir, err := s.RealPath(".")
+	if err != nil {
+		return fmt.Errorf("cannot start sftp %v, %v", c.Server, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Information   :%s is sftp-only account, start sftp shell. (`help` to show commands)\n", c.Server)
+	fmt.Println("------------------------------")
+
+	// commands from pipe are already read to StdinData.
+	var stdin io.Reader = os.Stdin
+	if len(r.StdinData) > 0 {
+		stdin = bytes.NewReader(r.StdinData)
+	}
+
+	rd := bufio.NewReader(stdin)
+	for {
+		fmt.Printf("sftp(%s):%s> ", c.Server, dir)
+		line, rerr := rd.ReadString('\n')
+		if rerr != nil && line == "" {
+			fmt.Println()
+			return nil
+		}
+
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "exit", "quit", "bye":
+			return nil
+		case "help", "?":
+			fmt.Print(sftpShellHelp)
+		default:
+			dir, err = sftpShellCmd(s, dir, args, os.Stdout)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}
+}
+
+// sftpShellCmd run command of sftpShell at remote directory dir, and return remote directory after command.
+func sftpShellCmd(s *sftpClient, dir string, args []string, w io.Writer) (string, error) {
+	// remote path of argument
+	remote := func(p string) string {
+		switch {
+		case strings.HasPrefix(p, "/"):
+			return p
+		case p == "~" || strings.HasPrefix(p, "~/"):
+			return sftpPath(p)
+		}
+		return path.Join(dir, p)
+	}
+
+	switch args[0] {
+	case "pwd":
+		fmt.Fprintln(w, dir)
+
+	case "lpwd":
+		wd, err := os.Getwd()
+		if err != nil {
+			return dir, err
+		}
+		fmt.Fprintln(w, wd)
+
+	case "cd":
+		target := "~"
+		if len(args) > 1 {
+			target = args[1]
+		}
+		p, err := s.RealPath(remote(target))
+		if err != nil {
+			return dir, fmt.Errorf("cd %s: %v", target, err)
+		}
+		if mode, err := s.Stat(p); err != nil || !mode.IsDir() {
+			return dir, fmt.Errorf("cd %s: not a directory", target)
+		}
+		return p, nil
+
+	case "lcd":
+		if len(args) < 2 {
+			return dir, fmt.Errorf("usage: lcd dir")
+		}
+		return dir, os.Chdir(args[1])
+
+	case "ls":
+		target := dir
+		if len(args) > 1 {
+			target = remote(args[1])
+		}
+		entries, err := s.ReadDir(target)
+		if err != nil {
+			return dir, fmt.Errorf("ls %s: %v", target, err)
+		}
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name, ".") {
+				continue
+			}
+			if e.Mode.IsDir() {
+				fmt.Fprintln(w, e.Name+"/")
+			} else {
+				fmt.Fprintln(w, e.Name)
+			}
+		}
+
+	case "mkdir":
+		if len(args) < 2 {
+			return dir, fmt.Errorf("usage: mkdir dir")
+		}
+		return dir, s.Mkdir(remote(args[1]), 0755)
+
+	case "get":
+		if len(args) < 2 {
+			return dir, fmt.Errorf("usage: get remote... [local]")
+		}
+		local, paths := ".", args[1:]
+		if len(paths) > 1 {
+			if info, err := os.Stat(paths[len(paths)-1]); err == nil && info.IsDir() {
+				local, paths = paths[len(paths)-1], paths[:len(paths)-1]
+			}
+		}
+		for _, p := range paths {
+			matches := s.glob(remote(p))
+			if len(matches) == 0 {
+				fmt.Fprintf(w, "%s: no such file\n", p)
+			}
+			for _, m := range matches {
+				n, err := s.download(m, local)
+				if err != nil {
+					fmt.Fprintf(w, "get %s: %v\n", m, err)
+					continue
+				}
+				fmt.Fprintf(w, "Downloaded %s (%s).\n", path.Base(m), formatBytes(n))
+			}
+		}
+
+	case "put":
+		if len(args) < 2 {
+			return dir, fmt.Errorf("usage: put local... [remote]")
+		}
+		target, paths := dir, args[1:]
+		if len(paths) > 1 {
+			if mode, err := s.Stat(remote(paths[len(paths)-1])); err == nil && mode.IsDir() {
+				target, paths = remote(paths[len(paths)-1]), paths[:len(paths)-1]
+			}
+		}
+		for _, p := range paths {
+			matches, _ := filepath.Glob(p)
+			if len(matches) == 0 {
+				fmt.Fprintf(w, "%s: no such file\n", p)
+			}
+			for _, m := range matches {
+				n, err := s.upload(m, target)
+				if err != nil {
+					fmt.Fprintf(w, "put %s: %v\n", m, err)
+					continue
+				}
+				fmt.Fprintf(w, "Uploaded %s (%s).\n", filepath.Base(m), formatBytes(n))
+			}
+		}
+
+	default:
+		return dir, fmt.Errorf("%s: unknown command (`help` to show commands)", args[0])
+	}
+
+	return dir, nil
+}
+
+// upload copy local file or directory (recursive) to remote path with sftp.
+// If remote is existing directory, it is copied into the directory. It return number of copied bytes.
+func (s *sftpClient) upload(local, remote string) (n int64, err error) {
+	if mode, err := s.Stat(remote); err == nil && mode.IsDir() {
+		remote = path.Join(remote, filepath.Base(local))
+	}
+
+	err = filepath.Walk(local, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(local, p)
+		if err != nil {
+			return err
+		}
+		target := path.Join(remote, filepath.ToSlash(rel))
+
+		switch {
+		case info.IsDir():
+			if mode, err := s.Stat(target); err == nil && mode.IsDir() {
+				return nil
+			}
+			return s.Mkdir(target, info.Mode())
+		case info.Mode().IsRegular():
+			size, err := s.Upload(p, target)
+			n += size
+			return err
+		}
+		return nil // skip special file
+	})
+	return
+}
+
+// download copy remote file or directory (recursive) to local path with sftp.
+// If local is existing directory, it is copied into the directory. It return number of copied bytes.
+func (s *sftpClient) download(remote, local string) (n int64, err error) {
+	if info, err := os.Stat(local); err == nil && info.IsDir() {
+		local = filepath.Join(local, path.Base(remote))
+	}
+
+	mode, err := s.Stat(remote)
+	if err != nil {
+		return
+	}
+	if !mode.IsDir() {
+		return s.Download(remote, local)
+	}
+
+	if err = os.MkdirAll(local, mode.Perm()|0700); err != nil {
+		return
+	}
+	entries, err := s.ReadDir(remote)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		// symbolic link to directory is not followed (may loop)
+		if e.Mode&os.ModeSymlink != 0 {
+			if target, err := s.Stat(path.Join(remote, e.Name)); err != nil || target.IsDir() {
+				continue
+			}
+		}
+
+		size, err := s.download(path.Join(remote, e.Name), filepath.Join(local, e.Name))
+		n += size
+		if err != nil {
+			return n, err
+		}
+	}
+	return
+}
+
+// copySftp copy files over con with sftp, instead of scp. It is used for sftp-only account.
+// Options that need exec channel (tar, chunks, delta, include/exclude, verify) and remote to remote copy are not available.
+func (r *RunScp) copySftp(con *Connect, mode string) (err error) {
+	target := con.Server
+
+	var option string
+	switch {
+	case r.From.IsRemote && r.To.IsRemote:
+		option = "remote to remote copy"
+	case r.Tar:
+		option = "--tar"
+	case r.Chunks > 1:
+		option = "--chunks"
+	case r.Delta:
+		option = "--delta"
+	case r.isFiltered():
+		option = "--include/--exclude"
+	case r.Verify:
+		option = "--verify"
+	}
+	if option != "" {
+		return fmt.Errorf("%s is sftp-only account, %s is not available", target, option)
+	}
+
+	s, err := newSftpClient(con.Client)
+	if err != nil {
+		return fmt.Errorf("cannot start sftp %v, %v", target, err)
+	}
+	defer s.Close()
+
+	switch mode {
+	case "push":
+		toPath := sftpPath(unescapeRemotePath(r.To.Path[0]))
+		for _, p := range r.From.Path {
+			if _, err = s.upload(p, toPath); err != nil {
+				return
+			}
+		}
+
+	case "pull":
+		fromPaths := []string{}
+		for _, p := range r.From.Path {
+			matches := s.glob(sftpPath(unescapeRemotePath(p)))
+			if len(matches) == 0 {
+				return fmt.Errorf("%s: no such file", p)
+			}
+			fromPaths = append(fromPaths, matches...)
+		}
+
+		// multiple files are put into directory, like scp.
+		toPath := r.createServersDir(target, r.From.Server, r.To.Path[0])
+		if len(fromPaths) > 1 {
+			if err = os.MkdirAll(toPath, 0755); err != nil {
+				return
+			}
+		}
+
+		for _, p := range fromPaths {
+			if _, err = s.download(p, toPath); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
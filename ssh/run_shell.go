@@ -11,6 +11,8 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
 	"github.com/c-bata/go-prompt"
 	"github.com/c-bata/go-prompt/completer"
 )
@@ -44,6 +46,10 @@ func (r *Run) shell() {
 	s.PreCmd = shellConf.PreCmd
 	s.PostCmd = shellConf.PostCmd
 
+	// destructive command guard
+	s.Guard = r.Conf.Guard
+	s.IsYes = r.IsYes
+
 	// set prompt templete
 	s.PROMPT = shellConf.Prompt
 	s.OPROMPT = shellConf.OPrompt
@@ -66,10 +72,27 @@ func (r *Run) shell() {
 		return
 	}
 
+	// share authenticated connections with lscp (--mux)
+	if r.MuxSocket != "" {
+		conns := []*Connect{}
+		for _, sc := range s.Connects {
+			conns = append(conns, sc.Connect)
+		}
+		mux, err := newMuxServer(r.MuxSocket, conns)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cannot share connections, %v\n", err)
+			return
+		}
+		s.mux = mux
+		defer mux.Close()
+
+		fmt.Fprintf(os.Stderr, "Mux Socket    :%s (copy with `lscp --mux`)\n", r.MuxSocket)
+	}
+
 	// history file
 	s.HistoryFile = shellConf.HistoryFile
 	if s.HistoryFile == "" {
-		s.HistoryFile = "~/.lssh_history"
+		s.HistoryFile = common.GetStatePath("history")
 	}
 
 	// create history list
@@ -81,6 +104,9 @@ func (r *Run) shell() {
 		}
 	}
 
+	// create Ctrl+R search list (lssh shell history and cmd_history in state directory)
+	s.SearchList = createSearchList(histList)
+
 	// create complete data
 	s.GetCompleteData()
 
@@ -97,6 +123,7 @@ func (r *Run) shell() {
 		prompt.OptionInputTextColor(prompt.Green),
 		prompt.OptionPrefixTextColor(prompt.Blue),
 		prompt.OptionCompletionWordSeparator(completer.FilePathCompletionSeparator), // test
+		prompt.OptionAddKeyBind(prompt.KeyBind{Key: prompt.ControlR, Fn: s.ReverseSearch}),
 	)
 
 	// run go-prompt
@@ -116,6 +143,19 @@ type shell struct {
 	Count       int
 	ExecHistory map[int]string
 	Complete    []prompt.Suggest
+
+	// Ctrl+R history search
+	SearchList  []string
+	searchQuery string
+	searchMatch string
+	searchIndex int
+
+	// destructive command guard. If not IsYes, matched command require confirmation.
+	Guard conf.GuardConfig
+	IsYes bool
+
+	// shared connections (--mux). closed at exit.
+	mux *muxServer
 }
 
 // variable
@@ -164,7 +204,10 @@ func (s *shell) Executor(cmd string) {
 	case cmd == "exit", cmd == "quit":
 		runCmdLocal(s.PostCmd)
 		s.PutHistory(cmd)
-		os.Exit(0)
+		if s.mux != nil {
+			s.mux.Close()
+		}
+		exitWithHooks(0)
 
 	// clear
 	case cmd == "clear":
@@ -177,6 +220,11 @@ func (s *shell) Executor(cmd string) {
 		s.localCmd_history()
 		return
 
+	// %list
+	case cmd == "%list":
+		s.localCmd_list()
+		return
+
 	// !out [num]
 	case localCmdRegex_out.MatchString(cmd):
 		cmdSlice := strings.SplitN(cmd, " ", 2)
@@ -196,6 +244,24 @@ func (s *shell) Executor(cmd string) {
 
 	// put history
 	s.PutHistory(cmd)
+	s.SearchList = append(s.SearchList, cmd)
+
+	// target connects. `%host` run command at specified servers only.
+	connects := s.Connects
+	if strings.HasPrefix(cmd, "%host") {
+		var err error
+		connects, cmd, err = s.parseHostCmd(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+	}
+
+	// destructive command guard
+	if !s.confirmGuard(connects, cmd) {
+		fmt.Fprintln(os.Stderr, "Canceled.")
+		return
+	}
 
 	// create chanel
 	isExit := make(chan bool)
@@ -211,7 +277,7 @@ func (s *shell) Executor(cmd string) {
 
 	// create writers
 	writers := []io.Writer{}
-	for _, c := range s.Connects {
+	for _, c := range connects {
 		// TODO(blacknon): エラーハンドリングする
 		session, _ := c.CreateSession()
 		c.Session = session
@@ -227,7 +293,7 @@ func (s *shell) Executor(cmd string) {
 	go pushInput(isInputExit, multiWriter)
 
 	// run command
-	for _, c := range s.Connects {
+	for _, c := range connects {
 		c.Count = s.Count
 		go c.SshShellCmdRun(cmd, isExit)
 	}
@@ -235,7 +301,7 @@ func (s *shell) Executor(cmd string) {
 	// get command exit
 	go func() {
 		// get command exit
-		for i := 0; i < len(s.Connects); i++ {
+		for i := 0; i < len(connects); i++ {
 			<-isExit
 		}
 		isFinished <- true
@@ -252,7 +318,7 @@ func (s *shell) Executor(cmd string) {
 		case <-isSignalExit:
 			return
 		}
-	}(s.Signal, isSignalExit, s.Connects)
+	}(s.Signal, isSignalExit, connects)
 
 wait:
 	for {
@@ -271,3 +337,26 @@ wait:
 	s.Count += 1
 	return
 }
+
+// confirmGuard check cmd with destructive command guard, and ask confirmation if matched.
+// Return true if cmd can be run. (not matched, IsYes, or answered `yes` explicitly)
+func (s *shell) confirmGuard(connects []*shellConn, cmd string) bool {
+	pattern, err := conf.MatchGuard(s.Guard, cmd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	if pattern == "" || s.IsYes {
+		return true
+	}
+
+	servers := []string{}
+	for _, c := range connects {
+		servers = append(servers, c.Server)
+	}
+
+	fmt.Fprintf(os.Stderr, "WARNING: `%s` looks like a destructive command.\n", cmd)
+	fmt.Fprintf(os.Stderr, "You are about to run this on %d hosts: %s\n", len(servers), strings.Join(servers, ", "))
+	answer, _ := promptAnswer("Type 'yes' to continue: ", true)
+	return strings.TrimSpace(answer) == "yes"
+}
@@ -30,6 +30,11 @@ func (s *shell) localCmd_out(num int) {
 	fmt.Printf("%d :%s \n", num, cmd)
 
 	for _, c := range s.Connects {
+		// skip server that not run the command (`%host`)
+		if _, ok := c.ExecHistory[num]; !ok {
+			continue
+		}
+
 		// Create Output
 		o := &Output{
 			Templete:   c.OutputPrompt,
@@ -55,3 +60,42 @@ func (s *shell) localCmd_out(num int) {
 		time.Sleep(10 * time.Millisecond)
 	}
 }
+
+// localCmd_list is print target servers of lssh-shell
+// example:
+//
+//	%list
+func (s *shell) localCmd_list() {
+	for _, c := range s.Connects {
+		serverConf := c.Conf.Server[c.Server]
+		fmt.Printf("%s\t%s@%s\n", c.Server, serverConf.User, serverConf.Addr)
+	}
+}
+
+// parseHostCmd parse `%host` local command, and return target connects and command to run.
+// example:
+//
+//	%host server1 uptime
+//	%host server1,server2 uptime
+func (s *shell) parseHostCmd(cmd string) (connects []*shellConn, command string, err error) {
+	fields := strings.SplitN(cmd, " ", 3)
+	if fields[0] != "%host" || len(fields) < 3 || strings.TrimSpace(fields[2]) == "" {
+		return nil, "", fmt.Errorf("usage: %%host server[,server...] command")
+	}
+
+	for _, server := range strings.Split(fields[1], ",") {
+		found := false
+		for _, c := range s.Connects {
+			if c.Server == server {
+				connects = append(connects, c)
+				found = true
+			}
+		}
+		if !found {
+			return nil, "", fmt.Errorf("%s is not connected. see %%list", server)
+		}
+	}
+
+	command = strings.TrimSpace(fields[2])
+	return
+}
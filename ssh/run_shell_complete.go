@@ -3,6 +3,7 @@ package ssh
 import (
 	"bufio"
 	"bytes"
+	"strings"
 
 	"github.com/c-bata/go-prompt"
 )
@@ -25,6 +26,8 @@ func (s *shell) Completer(t prompt.Document) []prompt.Suggest {
 		{Text: "clear", Description: "clear screen"},
 		{Text: "history", Description: "show history"},
 		{Text: "%out", Description: "%out [num], show history result."},
+		{Text: "%list", Description: "%list, show target servers."},
+		{Text: "%host", Description: "%host server[,server...] command, run command at specified servers only."},
 
 		// outのリストを出力ためのローカルコマンド
 		// {Text: "%outlist", Description: "%outlist, show history result list."},
@@ -40,6 +43,21 @@ func (s *shell) Completer(t prompt.Document) []prompt.Suggest {
 
 	}
 
+	// server name suggest of `%host`
+	if fields := strings.Fields(t.TextBeforeCursor()); len(fields) > 0 && fields[0] == "%host" {
+		if len(fields) == 1 || (len(fields) == 2 && !strings.HasSuffix(t.TextBeforeCursor(), " ")) {
+			// complete last server of comma separated list
+			word := t.GetWordBeforeCursor()
+			prefix := word[:strings.LastIndex(word, ",")+1]
+
+			serverSuggest := []prompt.Suggest{}
+			for _, c := range s.Connects {
+				serverSuggest = append(serverSuggest, prompt.Suggest{Text: prefix + c.Server, Description: "Server."})
+			}
+			return prompt.FilterHasPrefix(serverSuggest, word, false)
+		}
+	}
+
 	// get complete data
 	ps := s.Complete
 	ps = append(ps, localCmdSuggest...)
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"os"
 	"os/user"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/c-bata/go-prompt"
 )
 
 // History struct
@@ -72,3 +75,59 @@ func (s *shell) PutHistory(cmd string) (err error) {
 
 	return
 }
+
+// createSearchList return commands for Ctrl+R search, merged lssh shell history
+// and CmdHistoryFile by time (oldest first).
+func createSearchList(histList []History) (list []string) {
+	type entry struct {
+		time    time.Time
+		command string
+	}
+
+	entries := []entry{}
+	for _, hist := range histList {
+		t, _ := time.ParseInLocation("2006/01/02_15:04:05", hist.Timestamp, time.Local)
+		entries = append(entries, entry{t, hist.Command})
+	}
+
+	cmdHistory, _ := ReadCmdHistory()
+	for _, h := range cmdHistory {
+		entries = append(entries, entry{h.Time, h.String()})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].time.Before(entries[j].time) })
+	for _, e := range entries {
+		list = append(list, e.command)
+	}
+	return
+}
+
+// ReverseSearch is Ctrl+R key binding. Replace input with the newest history
+// contains input text. Press again to search older one.
+func (s *shell) ReverseSearch(buf *prompt.Buffer) {
+	text := buf.Text()
+
+	// start new search, if input is changed after the last match
+	start := len(s.SearchList) - 1
+	if text == s.searchMatch && s.searchMatch != "" {
+		start = s.searchIndex - 1
+	} else {
+		s.searchQuery = text
+		s.searchMatch = ""
+	}
+
+	for i := start; i >= 0; i-- {
+		cmd := s.SearchList[i]
+		if cmd == s.searchMatch || !strings.Contains(cmd, s.searchQuery) {
+			continue
+		}
+
+		s.searchMatch = cmd
+		s.searchIndex = i
+
+		buf.Delete(len([]rune(buf.Document().TextAfterCursor())))
+		buf.DeleteBeforeCursor(len([]rune(buf.Document().TextBeforeCursor())))
+		buf.InsertText(cmd, false, true)
+		return
+	}
+}
@@ -0,0 +1,215 @@
+package ssh
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/blacknon/lssh/common"
+)
+
+// SessionHistoryFile is name of history file of terminal sessions, in state directory.
+var SessionHistoryFile = "session_history"
+
+// SessionHistory is record of terminal session. (1 line json in SessionHistoryFile)
+type SessionHistory struct {
+	Server   string    `json:"server"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Sent     int64     `json:"sent"`     // bytes of local input
+	Received int64     `json:"received"` // bytes of remote output
+	RunID    string    `json:"run_id,omitempty"`
+}
+
+// ReadSessionHistory return records in SessionHistoryFile, oldest first.
+func ReadSessionHistory() (history []SessionHistory, err error) {
+	file, err := os.Open(common.GetStatePath(SessionHistoryFile))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		var h SessionHistory
+		if json.Unmarshal(sc.Bytes(), &h) != nil || h.Server == "" {
+			continue
+		}
+		history = append(history, h)
+	}
+	return history, sc.Err()
+}
+
+// putSessionHistory append h to SessionHistoryFile.
+func putSessionHistory(h SessionHistory) (err error) {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(common.GetStatePath(SessionHistoryFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return
+}
+
+// countReader count read bytes to n.
+type countReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (cr *countReader) Read(p []byte) (n int, err error) {
+	n, err = cr.r.Read(p)
+	atomic.AddInt64(cr.n, int64(n))
+	return
+}
+
+// Stats is usage statistics summarized from local history files.
+type Stats struct {
+	First, Last time.Time
+
+	Commands int // number of command runs
+	Sessions int // number of terminal sessions
+
+	SessionTime time.Duration // total length of sessions
+	Sent        int64
+	Received    int64
+
+	Hosts []StatsCount // most used first
+	Days  []StatsCount // busiest first
+}
+
+// StatsCount is usage count of host or day.
+type StatsCount struct {
+	Name     string
+	Commands int
+	Sessions int
+}
+
+// Total return number of command runs and sessions.
+func (s StatsCount) Total() int {
+	return s.Commands + s.Sessions
+}
+
+// GetStats summarize CmdHistoryFile and SessionHistoryFile.
+// Nothing is sent to network, it only read local files.
+func GetStats() (stats Stats) {
+	cmdHistory, _ := ReadCmdHistory()
+	sessionHistory, _ := ReadSessionHistory()
+
+	hosts := map[string]*StatsCount{}
+	days := map[string]*StatsCount{}
+	count := func(m map[string]*StatsCount, name string) *StatsCount {
+		if m[name] == nil {
+			m[name] = &StatsCount{Name: name}
+		}
+		return m[name]
+	}
+	period := func(t time.Time) {
+		if stats.First.IsZero() || t.Before(stats.First) {
+			stats.First = t
+		}
+		if t.After(stats.Last) {
+			stats.Last = t
+		}
+	}
+
+	for _, h := range cmdHistory {
+		stats.Commands++
+		period(h.Time)
+		count(days, h.Time.Format("2006/01/02")).Commands++
+		for _, server := range h.Servers {
+			count(hosts, server).Commands++
+		}
+	}
+
+	for _, h := range sessionHistory {
+		stats.Sessions++
+		period(h.Start)
+		count(days, h.Start.Format("2006/01/02")).Sessions++
+		count(hosts, h.Server).Sessions++
+
+		if h.End.After(h.Start) {
+			stats.SessionTime += h.End.Sub(h.Start)
+		}
+		stats.Sent += h.Sent
+		stats.Received += h.Received
+	}
+
+	stats.Hosts = sortStatsCount(hosts)
+	stats.Days = sortStatsCount(days)
+	return
+}
+
+// sortStatsCount return counts in m, sorted by total (desc) and name.
+func sortStatsCount(m map[string]*StatsCount) (list []StatsCount) {
+	for _, c := range m {
+		list = append(list, *c)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Total() != list[j].Total() {
+			return list[i].Total() > list[j].Total()
+		}
+		return list[i].Name < list[j].Name
+	})
+	return
+}
+
+// AverageSession return average length of terminal sessions.
+func (s Stats) AverageSession() time.Duration {
+	if s.Sessions == 0 {
+		return 0
+	}
+	return (s.SessionTime / time.Duration(s.Sessions)).Round(time.Second)
+}
+
+// Print write summary of s to w. top is number of hosts and days to show.
+func (s Stats) Print(w io.Writer, top int) {
+	if s.Commands == 0 && s.Sessions == 0 {
+		fmt.Fprintln(w, "No history.")
+		return
+	}
+
+	fmt.Fprintf(w, "Period        :%s - %s\n", s.First.Format("2006/01/02"), s.Last.Format("2006/01/02"))
+	fmt.Fprintf(w, "Commands      :%d\n", s.Commands)
+	fmt.Fprintf(w, "Sessions      :%d (average %s)\n", s.Sessions, s.AverageSession())
+	fmt.Fprintf(w, "Transferred   :sent %s, received %s\n", formatBytes(s.Sent), formatBytes(s.Received))
+
+	printCounts := func(title string, list []StatsCount) {
+		fmt.Fprintf(w, "\n%s:\n", title)
+		for i, c := range list {
+			if i >= top {
+				break
+			}
+			fmt.Fprintf(w, "  %-20s %5d  (commands: %d, sessions: %d)\n", c.Name, c.Total(), c.Commands, c.Sessions)
+		}
+	}
+	printCounts("Most used hosts", s.Hosts)
+	printCounts("Busiest days", s.Days)
+}
+
+// formatBytes return human readable size of n. ex) `1.5 MiB`
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
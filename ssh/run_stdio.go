@@ -0,0 +1,125 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+
+	"github.com/blacknon/lssh/conf"
+)
+
+// stdio connect stdin/stdout to the target tcp port, like `ssh -W`.
+// It can be used as ProxyCommand of other tools (ssh, git, rsync...).
+//
+// r.StdioTarget:
+//   - server name ... connect to addr:port of the server, via proxy of the server config.
+//   - host:port   ... connect via ssh connection of r.ServerList[0].
+func (r *Run) stdio() (err error) {
+	target := r.StdioTarget
+
+	var conn net.Conn
+	if serverConf, ok := r.Conf.Server[target]; ok {
+		conn, err = r.dialServerViaProxy(target, serverConf)
+	} else {
+		if len(r.ServerList) == 0 {
+			return fmt.Errorf("%s is not found in server list. If forward to host:port, specify server with -H", target)
+		}
+
+		r.createAuthMap()
+		c := new(Connect)
+		c.Server = r.ServerList[0]
+		c.Conf = r.Conf
+		c.AuthMap = r.AuthMap
+
+		if err = c.CreateClient(); err != nil {
+			return fmt.Errorf("cannot connect %v, %v", c.Server, err)
+		}
+		conn, err = c.Client.Dial("tcp", target)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// stdin => conn
+	go func() {
+		io.Copy(conn, os.Stdin)
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		}
+	}()
+
+	// conn => stdout
+	_, err = io.Copy(os.Stdout, conn)
+	return
+}
+
+// dialServerViaProxy return net.Conn to addr:port of server, via proxy of server config.
+func (r *Run) dialServerViaProxy(server string, serverConf conf.ServerConfig) (conn net.Conn, err error) {
+	port := serverConf.Port
+	if port == "" {
+		port = "22"
+	}
+	addr := net.JoinHostPort(serverConf.Addr, port)
+
+	// ProxyCommand
+	if serverConf.ProxyCommand != "" && serverConf.ProxyCommand != "none" {
+		proxyCommand := expandProxyCommand(serverConf.ProxyCommand, serverConf)
+
+		pipeClient, pipeServer := net.Pipe()
+		cmd := exec.Command("sh", "-c", proxyCommand)
+		cmd.Stdin = pipeServer
+		cmd.Stdout = pipeServer
+		cmd.Stderr = os.Stderr
+
+		if err = cmd.Start(); err != nil {
+			return nil, err
+		}
+		return pipeClient, nil
+	}
+
+	// not use proxy
+	if serverConf.Proxy == "" {
+		return net.Dial("tcp", addr)
+	}
+
+	proxyList, proxyType, err := GetProxyList(server, r.Conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// last proxy connect to server
+	lastProxy := proxyList[len(proxyList)-1]
+	switch proxyType[lastProxy] {
+	case "http", "https":
+		dialer, err := createProxyDialerHttp(r.Conf.Proxy[lastProxy], proxyType[lastProxy] == "https")
+		if err != nil {
+			return nil, err
+		}
+		return dialer.Dial("tcp", addr)
+
+	case "socks5":
+		dialer, err := createProxyDialerSocks5(r.Conf.Proxy[lastProxy])
+		if err != nil {
+			return nil, err
+		}
+		return dialer.Dial("tcp", addr)
+	}
+
+	// ssh proxy
+	r.ServerList = proxyList
+	r.createAuthMap()
+
+	c := new(Connect)
+	c.Server = lastProxy
+	c.Conf = r.Conf
+	c.AuthMap = r.AuthMap
+
+	if err = c.CreateClient(); err != nil {
+		return nil, fmt.Errorf("cannot connect %v, %v", c.Server, err)
+	}
+
+	return c.Client.Dial("tcp", addr)
+}
@@ -0,0 +1,295 @@
+package ssh
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+)
+
+// redacted value of credential in support bundle.
+const redacted = "<redacted>"
+
+// supportCredentialKeys is config keys of credentials. (redacted unless KeepCredential)
+var supportCredentialKeys = map[string]bool{
+	"pass":        true,
+	"passes":      true,
+	"keypass":     true,
+	"certkeypass": true,
+	"pkcs11pin":   true,
+}
+
+// supportPassphraseKeys is config keys of `path::passphrase` values. Only passphrase is redacted.
+var supportPassphraseKeys = map[string]bool{
+	"keys":          true,
+	"ssh_agent_key": true,
+}
+
+// supportAddressKeys is config keys of addresses and user names. (redacted unless KeepAddress)
+var supportAddressKeys = map[string]bool{
+	"addr":                true,
+	"addrs":               true,
+	"user":                true,
+	"bind_address":        true,
+	"port_forward_local":  true,
+	"port_forward_remote": true,
+	"docker_host":         true,
+}
+
+// ipv4Regexp match IPv4 address in logs, that is not in config.
+var ipv4Regexp = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+
+// SupportBundle collect version, sanitized config, recent debug log and last run summary to tar.gz, for bug reports.
+type SupportBundle struct {
+	Conf           conf.Config
+	Version        string // lssh version
+	LogLines       int    // number of last lines of debug log
+	KeepAddress    bool   // not redact addresses and user names
+	KeepCredential bool   // not redact passwords, passphrases and PINs
+
+	// replacement of redacted values, applied to logs and history too.
+	replaces  map[string]string
+	addrCount int
+}
+
+// supportLastRun is last run summary in support bundle.
+type supportLastRun struct {
+	Command  *CmdHistory      `json:"command,omitempty"`
+	Sessions []SessionHistory `json:"sessions,omitempty"`
+}
+
+// Write create support bundle at path.
+func (b *SupportBundle) Write(path string) (err error) {
+	b.replaces = map[string]string{}
+	if b.LogLines <= 0 {
+		b.LogLines = 500
+	}
+
+	// config first, to collect redacted values.
+	config, err := b.config()
+	if err != nil {
+		return fmt.Errorf("cannot encode config, %v", err)
+	}
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"version.txt", b.version()},
+		{"config.toml", config},
+		{"debug.log", b.sanitize(b.debugLog())},
+		{"last_run.json", b.sanitize(b.lastRun())},
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	gw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gw)
+
+	dir := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".gz"), ".tar")
+	now := time.Now()
+	for _, f := range files {
+		header := &tar.Header{Name: dir + "/" + f.name, Mode: 0600, Size: int64(len(f.data)), ModTime: now}
+		if err = tw.WriteHeader(header); err != nil {
+			return
+		}
+		if _, err = tw.Write(f.data); err != nil {
+			return
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return
+	}
+	return gw.Close()
+}
+
+// version return version info of lssh and local environment.
+func (b *SupportBundle) version() []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "lssh          :%s\n", b.Version)
+	fmt.Fprintf(buf, "go            :%s\n", runtime.Version())
+	fmt.Fprintf(buf, "os/arch       :%s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(buf, "term          :%s\n", os.Getenv("TERM"))
+	fmt.Fprintf(buf, "created       :%s\n", time.Now().Format(time.RFC3339))
+	return buf.Bytes()
+}
+
+// config return config as toml, that credentials and addresses are redacted.
+func (b *SupportBundle) config() (data []byte, err error) {
+	buf := new(bytes.Buffer)
+	if err = toml.NewEncoder(buf).Encode(b.Conf); err != nil {
+		return
+	}
+
+	// re-decode to generic map, to redact values by key.
+	var m map[string]interface{}
+	if _, err = toml.Decode(buf.String(), &m); err != nil {
+		return
+	}
+	b.redactMap(m)
+
+	buf.Reset()
+	err = toml.NewEncoder(buf).Encode(m)
+	return buf.Bytes(), err
+}
+
+// redactMap redact values of credential and address keys in m recursively.
+func (b *SupportBundle) redactMap(m map[string]interface{}) {
+	// sorted, so that placeholders are same at each run.
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := m[key]
+		switch v := value.(type) {
+		case map[string]interface{}:
+			b.redactMap(v)
+			continue
+		case []map[string]interface{}:
+			for _, child := range v {
+				b.redactMap(child)
+			}
+			continue
+		}
+
+		switch {
+		case supportCredentialKeys[key] && !b.KeepCredential:
+			m[key] = b.redactValue(value, b.redactCredential)
+		case supportPassphraseKeys[key] && !b.KeepCredential:
+			m[key] = b.redactValue(value, b.redactPassphrase)
+		case supportAddressKeys[key] && !b.KeepAddress:
+			m[key] = b.redactValue(value, b.redactAddress)
+		}
+	}
+}
+
+// redactValue apply f to string or strings value.
+func (b *SupportBundle) redactValue(value interface{}, f func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return f(v)
+	case []interface{}:
+		list := []interface{}{}
+		for _, e := range v {
+			list = append(list, b.redactValue(e, f))
+		}
+		return list
+	}
+	return value
+}
+
+// redactCredential redact credential value.
+func (b *SupportBundle) redactCredential(value string) string {
+	if value == "" {
+		return value
+	}
+	b.addReplace(value, redacted)
+	return redacted
+}
+
+// redactPassphrase redact passphrase of `path::passphrase`.
+func (b *SupportBundle) redactPassphrase(value string) string {
+	parts := strings.SplitN(value, "::", 2)
+	if len(parts) < 2 {
+		return value
+	}
+	b.addReplace(parts[1], redacted)
+	return parts[0] + "::" + redacted
+}
+
+// redactAddress replace address with placeholder. Same address is same placeholder. (ex. `<addr-1>`)
+func (b *SupportBundle) redactAddress(value string) string {
+	if value == "" {
+		return value
+	}
+	if r, ok := b.replaces[value]; ok {
+		return r
+	}
+
+	b.addrCount++
+	r := fmt.Sprintf("<addr-%d>", b.addrCount)
+	b.addReplace(value, r)
+	return r
+}
+
+// addReplace register value to be replaced in logs and history.
+func (b *SupportBundle) addReplace(value, r string) {
+	// too short value will break unrelated text.
+	if len(value) < 3 {
+		return
+	}
+	b.replaces[value] = r
+}
+
+// sanitize replace redacted values in data. IPv4 addresses not in config are also redacted, unless KeepAddress.
+func (b *SupportBundle) sanitize(data []byte) []byte {
+	// longer value first, so that substring does not break it.
+	values := []string{}
+	for value := range b.replaces {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	args := []string{}
+	for _, value := range values {
+		args = append(args, value, b.replaces[value])
+	}
+	text := strings.NewReplacer(args...).Replace(string(data))
+
+	if !b.KeepAddress {
+		text = ipv4Regexp.ReplaceAllString(text, "<ip>")
+	}
+	return []byte(text)
+}
+
+// debugLog return last lines of DebugLogFile.
+func (b *SupportBundle) debugLog() []byte {
+	data, err := ioutil.ReadFile(common.GetStatePath(DebugLogFile))
+	if err != nil {
+		return []byte("(no debug log. run lssh with -v to record it.)\n")
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	if len(lines) > b.LogLines {
+		lines = lines[len(lines)-b.LogLines:]
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+// lastRun return last command run and recent terminal sessions as json.
+func (b *SupportBundle) lastRun() []byte {
+	lastRun := supportLastRun{}
+	if h, ok := LastCmdHistory(); ok {
+		lastRun.Command = &h
+	}
+
+	sessions, _ := ReadSessionHistory()
+	if len(sessions) > 10 {
+		sessions = sessions[len(sessions)-10:]
+	}
+	lastRun.Sessions = sessions
+
+	data, _ := json.MarshalIndent(lastRun, "", "  ")
+	return append(data, '\n')
+}
@@ -0,0 +1,136 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+)
+
+// defaultSystemSsh is ssh command used at system ssh passthrough mode.
+const defaultSystemSsh = "ssh"
+
+// systemSshTerm connect to server with local ssh command (OpenSSH), instead of built-in ssh client.
+// It is escape-hatch for corner-case options that built-in client does not support.
+// Server setting is converted to ssh options, and extra_ssh_args (and r.SystemSshArgs) are appended.
+func (r *Run) systemSshTerm(server string) (err error) {
+	serverConf := r.Conf.Server[server]
+
+	// overwrite with command line options
+	serverConf.X11 = serverConf.X11 || r.IsX11
+	serverConf.X11Trusted = serverConf.X11Trusted || r.IsX11Trusted
+	if r.PortForwardLocal != "" && r.PortForwardRemote != "" {
+		serverConf.PortForwardLocal = r.PortForwardLocal
+		serverConf.PortForwardRemote = r.PortForwardRemote
+	}
+
+	// print header
+	r.printSelectServer()
+
+	// lssh proxy setting can not be converted to ssh option.
+	if serverConf.Proxy != "" {
+		fmt.Fprintf(os.Stderr, "Warning       :proxy %s is not used at system ssh mode. use proxy_cmd or extra_ssh_args.\n", serverConf.Proxy)
+	}
+
+	args := systemSshArgs(serverConf, r.SystemSshArgs)
+	fmt.Fprintf(os.Stderr, "System SSH    :%s %s\n", defaultSystemSsh, strings.Join(args, " "))
+
+	// run pre local command
+	if serverConf.PreCmd != "" {
+		runCmdLocal(serverConf.PreCmd)
+	}
+
+	// defer run post local command
+	if serverConf.PostCmd != "" {
+		defer runCmdLocal(serverConf.PostCmd)
+	}
+
+	// print newline
+	fmt.Println("------------------------------")
+
+	cmd := exec.Command(defaultSystemSsh, args...)
+	cmd.Env = append(os.Environ(), "LSSH_RUN_ID="+r.RunID)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	start := time.Now()
+	err = cmd.Run()
+	r.ExitStatus = exitStatus(err)
+	r.writeConnectionAudit(server, "interactive", start, err)
+	return
+}
+
+// systemSshArgs convert serverConf to ssh command arguments.
+// Password and passphrase are not converted, ssh ask them.
+func systemSshArgs(serverConf conf.ServerConfig, extraArgs []string) (args []string) {
+	if serverConf.Port != "" {
+		args = append(args, "-p", serverConf.Port)
+	}
+	if serverConf.User != "" {
+		args = append(args, "-l", serverConf.User)
+	}
+
+	// keys ("keypath::passphase")
+	keys := serverConf.Keys
+	if serverConf.Key != "" {
+		keys = append([]string{serverConf.Key}, keys...)
+	}
+	for _, key := range keys {
+		args = append(args, "-i", common.GetFullPath(strings.SplitN(key, "::", 2)[0]))
+	}
+	if serverConf.Cert != "" {
+		args = append(args, "-o", "CertificateFile="+common.GetFullPath(serverConf.Cert))
+	}
+
+	switch serverConf.AddressFamily {
+	case "inet":
+		args = append(args, "-4")
+	case "inet6":
+		args = append(args, "-6")
+	}
+	if serverConf.BindAddress != "" {
+		args = append(args, "-b", serverConf.BindAddress)
+	}
+	if serverConf.ConnectTimeout > 0 {
+		args = append(args, "-o", "ConnectTimeout="+strconv.Itoa(serverConf.ConnectTimeout))
+	}
+	if serverConf.ProxyCommand != "" {
+		args = append(args, "-o", "ProxyCommand="+serverConf.ProxyCommand)
+	}
+
+	if serverConf.Compress {
+		args = append(args, "-C")
+	}
+	if serverConf.SSHAgentUse {
+		args = append(args, "-A")
+	}
+	if serverConf.BatchMode {
+		args = append(args, "-o", "BatchMode=yes", "-T")
+	}
+	if serverConf.Banner == BANNER_HIDE || serverConf.Banner == BANNER_LOG {
+		args = append(args, "-o", "LogLevel=ERROR") // banner is printed at LogLevel INFO or more
+	}
+	if serverConf.AgentSocket != "" {
+		args = append(args, "-o", "IdentityAgent="+serverConf.AgentSocket)
+	}
+	if serverConf.X11Trusted {
+		args = append(args, "-Y")
+	} else if serverConf.X11 {
+		args = append(args, "-X")
+	}
+	if serverConf.PortForwardLocal != "" && serverConf.PortForwardRemote != "" {
+		args = append(args, "-L", serverConf.PortForwardLocal+":"+serverConf.PortForwardRemote)
+	}
+
+	// escape-hatch options (config, then command line)
+	args = append(args, serverConf.ExtraSshArgs...)
+	args = append(args, extraArgs...)
+
+	return append(args, serverConf.Addr)
+}
@@ -0,0 +1,34 @@
+package ssh
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Tail is option of `tail -F` run on servers.
+type Tail struct {
+	Paths  []string
+	Lines  int  // -n
+	IsSudo bool // run with `sudo -n`
+}
+
+// Command return tail command line.
+// If since is not zero (reconnected), only new lines are printed, not to print duplicated lines.
+func (t *Tail) Command(server string, since time.Time) string {
+	lines := t.Lines
+	if !since.IsZero() {
+		lines = 0
+	}
+
+	cmd := []string{"tail", "-n", fmt.Sprint(lines), "-F"}
+	if t.IsSudo {
+		cmd = append([]string{"sudo", "-n"}, cmd...)
+	}
+
+	for _, path := range t.Paths {
+		cmd = append(cmd, shellQuote(path))
+	}
+
+	return strings.Join(cmd, " ")
+}
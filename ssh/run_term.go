@@ -4,23 +4,36 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"net"
 	"os"
 	"os/user"
 	"strings"
 	"time"
 
-	"github.com/blacknon/lssh/common"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 func (r *Run) term() (err error) {
 	server := r.ServerList[0]
+
+	// docker container
+	if r.Conf.Server[server].DockerContainer != "" {
+		return r.dockerTerm(server)
+	}
+
+	// mosh
+	if r.IsMosh || r.Conf.Server[server].UseMosh {
+		return r.moshTerm(server)
+	}
+
 	c := new(Connect)
 	c.Server = server
 	c.Conf = r.Conf
+	c.runAgent = r.runAgent
 	c.AuthMap = r.AuthMap // TODO(blacknon): 特に問題ないだろうが、必要なSignerだけを渡すようにしたほうがいいかも？要検討。
+	c.RunID = r.RunID
+	c.IsPasswordPrompt = terminal.IsTerminal(int(os.Stdin.Fd())) && !r.Conf.Server[server].BatchMode
 	serverConf := c.Conf.Server[c.Server]
 
 	// print header
@@ -28,13 +41,26 @@ func (r *Run) term() (err error) {
 	r.printProxy()
 
 	// create ssh session
+	start := time.Now()
 	session, err := c.CreateSession()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "cannot connect %v, %v \n", c.Server, err)
+		r.writeConnectionAudit(c.Server, "interactive", start, err)
+		return err
+	}
+
+	// sftp-only account can not use shell, start sftp shell instead.
+	if c.checkSftpOnly() {
+		session.Close()
+		err = r.sftpShell(c)
+		r.writeConnectionAudit(c.Server, "sftp", start, err)
 		return err
 	}
 
-	if r.IsX11 || c.X11 {
+	if r.IsX11Trusted {
+		c.X11Trusted = true
+	}
+	if r.IsX11 || r.IsX11Trusted || c.X11 {
 		c.X11Forwarder(session)
 	}
 
@@ -45,6 +71,31 @@ func (r *Run) term() (err error) {
 		return err
 	}
 
+	// escape sequence (`~C` etc.)
+	session.Stdin = c.newEscapeReader(os.Stdin)
+
+	// remote clipboard (OSC52). removed, if not enabled at server config.
+	session.Stdout = newOSC52Writer(session.Stdout, serverConf.Clipboard)
+
+	// track current directory reported by remote shell (OSC7), for file transfer of escape sequence (`~u`, `~d`).
+	c.cwd = newCwdWriter(session.Stdout)
+	session.Stdout = c.cwd
+
+	// track mouse reporting and bracketed paste modes enabled by remote, to reset them at disconnect.
+	termModes := newTermModeWriter(session.Stdout)
+	session.Stdout = termModes
+
+	// convert remote encoding (remote_encoding) to UTF-8, and input to remote encoding.
+	enc, err := getRemoteEncoding(serverConf.RemoteEncoding)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Server, err)
+		return err
+	}
+	session.Stdout = newDecodeWriter(session.Stdout, enc)
+	session.Stderr = newDecodeWriter(session.Stderr, enc)
+	session.Stdin = newEncodeReader(session.Stdin, enc)
+	decodeStdout, decodeStderr := session.Stdout, session.Stderr
+
 	preCmd := serverConf.PreCmd
 	postCmd := serverConf.PostCmd
 
@@ -53,22 +104,38 @@ func (r *Run) term() (err error) {
 	case "yes", "Yes", "YES", "y":
 		c.IsLocalRc = true
 	default:
+		c.IsLocalRc = len(serverConf.LocalRcBundle) > 0
+	}
+
+	// initial_cmd is run instead of shell, so local rc is not used.
+	if serverConf.InitialCmd != "" {
 		c.IsLocalRc = false
 	}
 
 	if c.IsLocalRc {
-		fmt.Fprintf(os.Stderr, "Information   :This connect use local bashrc. \n")
-		if len(serverConf.LocalRcPath) > 0 {
-			c.LocalRcData, err = common.GetFilesBase64(serverConf.LocalRcPath)
-			if err != nil {
-				return err
-			}
-		} else {
-			rcfile := []string{"~/.bashrc"}
-			c.LocalRcData, err = common.GetFilesBase64(rcfile)
+		c.LocalRcShell = c.localRcShell(serverConf.LocalRcShell)
+		fmt.Fprintf(os.Stderr, "Information   :This connect use local %src. \n", c.LocalRcShell)
+
+		// upload bootstrap bundle to remote temp dir. removed at session end.
+		header := ""
+		if len(serverConf.LocalRcBundle) > 0 {
+			dir, names, err := c.uploadBundle(serverConf.LocalRcBundle)
 			if err != nil {
 				return err
 			}
+			defer c.removeBundle(dir)
+
+			fmt.Fprintf(os.Stderr, "Bundle        :%s\n", dir)
+			header = bundleRc(c.LocalRcShell, dir, names)
+		}
+
+		rcfile := serverConf.LocalRcPath
+		if len(rcfile) == 0 {
+			rcfile = []string{defaultLocalRcFile[c.LocalRcShell]}
+		}
+		c.LocalRcData, err = localRcData(header, rcfile, serverConf.LocalRcSnippet)
+		if err != nil {
+			return err
 		}
 		c.LocalRcDecodeCmd = serverConf.LocalRcDecodeCmd
 	}
@@ -98,35 +165,78 @@ func (r *Run) term() (err error) {
 
 		r.printPortForward(c.ForwardLocal, c.ForwardRemote)
 
-		go func() {
-			c.PortForwarder()
-		}()
+		// add to ForwardManager, so that it can be listed and canceled by escape command line.
+		if _, err := c.getForwardManager().Add(FORWARD_LOCAL, c.ForwardLocal, c.ForwardRemote); err != nil {
+			fmt.Fprintf(os.Stderr, "local port listen failed: %v\n", err)
+		}
 	}
 
 	// ssh-agent
-	if serverConf.SSHAgentUse {
+	if serverConf.SSHAgentUse || c.runAgent != nil {
 		fmt.Fprintf(os.Stderr, "Information   :This connect use ssh agent. \n")
 
 		// forward agent
-		_, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+		agent.ForwardToAgent(c.Client, c.getAgent())
+		agent.RequestAgentForwarding(session)
+	}
+
+	// share terminal output with read-only observers (--share)
+	if r.ShareSocket != "" {
+		share, err := newShareServer(r.ShareSocket)
 		if err != nil {
-			agent.ForwardToAgent(c.Client, c.sshAgent)
-		} else {
-			agent.ForwardToAgent(c.Client, c.sshExtendedAgent)
+			fmt.Fprintf(os.Stderr, "cannot share session, %v\n", err)
+			return err
 		}
-		agent.RequestAgentForwarding(session)
+		defer share.Close()
+
+		fmt.Fprintf(os.Stderr, "Share Socket  :%s (attach with `lssh attach %s`)\n", r.ShareSocket, r.ShareSocket)
+		session.Stdout = io.MultiWriter(session.Stdout, share)
+		session.Stderr = io.MultiWriter(session.Stderr, share)
+	}
+
+	// share authenticated connection with lscp (--mux)
+	if r.MuxSocket != "" {
+		mux, err := newMuxServer(r.MuxSocket, []*Connect{c})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cannot share connection, %v\n", err)
+			return err
+		}
+		defer mux.Close()
+
+		fmt.Fprintf(os.Stderr, "Mux Socket    :%s (copy with `lscp --mux`)\n", r.MuxSocket)
+	}
+
+	// file transfer with `sz`, `rz` (ZMODEM) and `tsz`, `trz` (trzsz) at remote. protocol data is not passed to terminal (and encoding conversion).
+	if !serverConf.DisableZmodem || !serverConf.DisableTrzsz {
+		tt := newTransferTerm(session.Stdout, session.Stdin, !serverConf.DisableZmodem, !serverConf.DisableTrzsz)
+		session.Stdout = tt
+		session.Stdin = tt
 	}
 
 	// print newline
 	fmt.Println("------------------------------")
 
+	// count transferred bytes for session history (`lssh stats`)
+	hist := SessionHistory{Server: c.Server, Start: time.Now(), RunID: r.RunID}
+	session.Stdin = &countReader{r: session.Stdin, n: &hist.Sent}
+	session.Stdout = &countWriter{w: session.Stdout, n: &hist.Received}
+	session.Stderr = &countWriter{w: session.Stderr, n: &hist.Received}
+
 	// Connect ssh terminal
 	finished := make(chan bool)
+	var termErr error
 	go func() {
-		c.ConTerm(session)
+		termErr = c.ConTerm(session)
 		finished <- true
 	}()
 	<-finished
+	closeDecodeWriter(decodeStdout)
+	closeDecodeWriter(decodeStderr)
+	termModes.ResetModes(os.Stdout)
+
+	hist.End = time.Now()
+	putSessionHistory(hist)
+	r.writeConnectionAudit(c.Server, "interactive", start, termErr)
 
 	return
 }
@@ -182,7 +292,7 @@ func (r *Run) writeTimestampTerminalLog(logPath string) {
 				continue
 			} else {
 				timestamp := time.Now().Format("2006/01/02 15:04:05 ") // yyyy/mm/dd HH:MM:SS
-				fmt.Fprintf(logWriter, timestamp+string(append(preLine, line...)))
+				fmt.Fprint(logWriter, timestamp+string(append(preLine, line...)))
 				preLine = []byte{}
 			}
 		} else {
@@ -0,0 +1,131 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// watchResult is output of command at a server, in a watch cycle.
+type watchResult struct {
+	lines  []string
+	status int   // exit status of command
+	err    error // connect error etc.
+}
+
+// watch run command on all servers periodically, and redraw output. (like `watch(1)`)
+// If r.IsWatchDiff, highlight lines changed from previous run.
+// Connections are kept in pool between runs, and reconnected if it is not alive.
+func (r *Run) watch() {
+	pool := NewConnectPool(r.Conf, r.AuthMap)
+	defer pool.Close()
+
+	command := strings.Join(r.ExecCmd, " ")
+
+	var prev map[string]watchResult
+	for {
+		start := time.Now()
+		results := r.watchRun(pool)
+
+		// redraw
+		if !r.IsPlainUI {
+			fmt.Print("\033[H\033[2J")
+		}
+		fmt.Printf("Every %s: %s\t%s\n\n", r.WatchInterval, command, start.Format("2006/01/02 15:04:05"))
+
+		for _, server := range r.ServerList {
+			res := results[server]
+			if res.status != 0 {
+				fmt.Printf("==> %s <== (exit %d)\n", server, res.status)
+			} else {
+				fmt.Printf("==> %s <==\n", server)
+			}
+
+			if res.err != nil {
+				fmt.Printf("[error] %v\n", res.err)
+			}
+
+			prevLines := prev[server].lines
+			for i, line := range res.lines {
+				if r.IsWatchDiff && !r.IsPlainUI && prev != nil && (i >= len(prevLines) || prevLines[i] != line) {
+					line = "\x1b[7m" + line + "\x1b[0m"
+				}
+				fmt.Println(line)
+			}
+			fmt.Println()
+		}
+		prev = results
+
+		// wait next run
+		if wait := r.WatchInterval - time.Since(start); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+}
+
+// watchRun run command on servers in parallel with connection of pool, and return outputs by server.
+func (r *Run) watchRun(pool *ConnectPool) (results map[string]watchResult) {
+	results = map[string]watchResult{}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, server := range r.ServerList {
+		wg.Add(1)
+		go func(server string) {
+			defer wg.Done()
+
+			res := r.watchRunServer(pool, server)
+
+			mu.Lock()
+			results[server] = res
+			mu.Unlock()
+		}(server)
+	}
+	wg.Wait()
+
+	return
+}
+
+// watchRunServer run command on server with connection of pool.
+func (r *Run) watchRunServer(pool *ConnectPool, server string) (res watchResult) {
+	c, err := pool.Get(context.Background(), server)
+	if err != nil {
+		res.err = err
+		return
+	}
+	c.RunID = r.RunID
+
+	session, err := c.Client.NewSession()
+	if err != nil {
+		// connection is broken, reconnect at next run
+		pool.Discard(c)
+		res.err = err
+		return
+	}
+	defer pool.Put(c)
+
+	execCmd := c.remoteCmd(strings.Join(r.ExecCmd, " "), !c.setRunIDEnv(session))
+
+	output, err := session.CombinedOutput(execCmd)
+	session.Close()
+
+	// convert remote encoding (remote_encoding) to UTF-8
+	enc, _ := getRemoteEncoding(c.Conf.Server[c.Server].RemoteEncoding)
+	output = decodeBytes(output, enc)
+
+	text := strings.TrimRight(string(output), "\n")
+	if text != "" {
+		res.lines = strings.Split(text, "\n")
+	}
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		res.status = exitErr.ExitStatus()
+	} else {
+		res.err = err
+	}
+
+	return
+}
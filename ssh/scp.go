@@ -2,9 +2,14 @@ package ssh
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	scplib "github.com/blacknon/go-scplib"
 	"github.com/blacknon/lssh/conf"
@@ -18,41 +23,130 @@ type CopyConInfo struct {
 }
 
 type RunScp struct {
-	From       CopyConInfo
-	To         CopyConInfo
-	CopyData   *bytes.Buffer
-	Permission bool
-	Config     conf.Config
+	From        CopyConInfo
+	To          CopyConInfo
+	CopyData    *bytes.Buffer
+	Permission  bool
+	Verify      bool     // verify sha256 checksum after transfer
+	Include     []string // glob patterns of files to copy (recursive copy)
+	Exclude     []string // glob patterns of files and directories not to copy (recursive copy)
+	Delta       bool     // send only changed blocks of existing remote files (local to remote)
+	Tar         bool     // stream files as tar (local to remote, remote to local)
+	TarCompress string   // compression of tar stream. (TAR_COMPRESS_*)
+	Chunks      int      // split large files into ranges, and transfer them concurrently (local to remote, remote to local)
+	ChunkConn   bool     // use new ssh connection for each range
+	Direct      bool     // copy remote to remote directly from source server (not relay via local)
+	Retry       int      // max count to retry failed target
+	ReportPath  string   // path to write report of results (default: ScpReportFile in state directory)
+	Args        []string // command line args, saved to report
+	Config      conf.Config
+	Stderr      io.Writer // writer of progress messages. If nil, os.Stderr
+
+	// AuthMap of from and to servers (see createAuthMap)
+	authMap map[AuthKey][]ssh.Signer
+
+	// results of targets
+	results  []ScpResult
+	resultMu sync.Mutex
+
+	// targets in progress, to stop them at interrupt
+	transfers   map[*scpTransfer]bool
+	interrupted bool
+	transferMu  sync.Mutex
 }
 
-// Start scp, switching process.
+// Start scp, switching process. Interrupt (Ctrl+C) stop copy, see StartContext.
 func (r *RunScp) Start() {
-	// Create AuthMap
-	slist := append(r.To.Server, r.From.Server...)
-	run := new(Run)
-	run.ServerList = slist
-	run.Conf = r.Config
-	run.createAuthMap()
-	authMap := run.AuthMap
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stop := r.handleInterrupt(cancel)
+	defer stop()
+
+	r.StartContext(ctx)
+}
+
+// StartContext scp, switching process.
+// If ctx is done, copy with all servers is stopped, partially written files are removed,
+// and servers in progress are reported as interrupted.
+func (r *RunScp) StartContext(ctx context.Context) {
+	authMap := r.createAuthMap()
+
+	stop := r.watchCancel(ctx)
 
 	switch {
+	// local stdin to remote
+	case r.isStdin():
+		r.pushStdin(ctx, authMap)
+
+	// remote to local stdout
+	case r.isStdout():
+		r.pullStdout(ctx, authMap)
+
 	// remote to remote
 	case r.From.IsRemote && r.To.IsRemote:
-		r.run("pull", authMap)
-		r.run("push", authMap)
+		toServers := r.To.Server
+		if r.Direct {
+			// relay via local, only to servers that direct copy failed
+			r.To.Server = r.runDirect(ctx, authMap)
+			if len(r.To.Server) == 0 || ctx.Err() != nil {
+				break
+			}
+			fmt.Fprintf(r.stderr(), "relay via local: %s\n", strings.Join(r.To.Server, ","))
+		}
+
+		r.run(ctx, "pull", authMap)
+		if len(r.FailedServers()) == 0 {
+			r.run(ctx, "push", authMap)
+		}
+		r.To.Server = toServers
 
 	// remote to local
 	case r.From.IsRemote && !r.To.IsRemote:
-		r.run("pull", authMap)
+		r.run(ctx, "pull", authMap)
 
 	// local to remote
 	case !r.From.IsRemote && r.To.IsRemote:
-		r.run("push", authMap)
+		r.run(ctx, "push", authMap)
+	}
+
+	stop()
+	r.finish()
+}
+
+// stderr return writer of progress messages of r.
+func (r *RunScp) stderr() io.Writer {
+	if r.Stderr != nil {
+		return r.Stderr
+	}
+	return os.Stderr
+}
+
+// createAuthMap create AuthMap of from and to servers. It is created once, so that passphrase is not prompted again.
+func (r *RunScp) createAuthMap() map[AuthKey][]ssh.Signer {
+	if r.authMap != nil {
+		return r.authMap
+	}
+
+	// servers connected through mux socket are not authenticated
+	servers := []string{}
+	for _, server := range append(append([]string{}, r.To.Server...), r.From.Server...) {
+		if r.Config.Server[server].MuxSocket == "" {
+			servers = append(servers, server)
+		}
 	}
+
+	run := new(Run)
+	run.ServerList = servers
+	run.Conf = r.Config
+	run.createAuthMap()
+	r.authMap = run.AuthMap
+	return r.authMap
 }
 
 // Run execute scp according to mode.
-func (r *RunScp) run(mode string, authMap map[AuthKey][]ssh.Signer) {
+// Failed targets are retried up to r.Retry times with backoff, and results are recorded for summary.
+func (r *RunScp) run(ctx context.Context, mode string, authMap map[AuthKey][]ssh.Signer) {
 	finished := make(chan bool)
 
 	// set target list
@@ -68,35 +162,35 @@ func (r *RunScp) run(mode string, authMap map[AuthKey][]ssh.Signer) {
 		target := value
 
 		go func() {
-			// create ssh connect
-			con := new(Connect)
-			con.Server = target
-			con.Conf = r.Config
-			con.AuthMap = authMap
-
-			// create ssh session
-			session, err := con.CreateSession()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "cannot connect %v, %v \n", target, err)
-				finished <- true
+			defer func() { finished <- true }()
+
+			t, ok := r.beginTransfer(mode, target)
+			if !ok {
 				return
 			}
-			defer session.Close()
-
-			// create scp client
-			scp := new(scplib.SCPClient)
-			scp.Permission = r.Permission
-			scp.Session = session
-
-			switch mode {
-			case "push":
-				r.push(target, scp)
-			case "pull":
-				r.pull(target, scp)
+
+			// retry backoff (default 1 sec), doubled at each retry
+			backoff := time.Duration(r.Config.Server[target].RetryBackoff) * time.Second
+			if backoff <= 0 {
+				backoff = time.Second
+			}
+
+			var err error
+			for attempts := 1; ; attempts++ {
+				err = r.runTarget(ctx, t, authMap)
+				if err == nil || attempts > r.Retry || isAuthError(err) || ctx.Err() != nil {
+					break
+				}
+
+				fmt.Fprintf(r.stderr(), "%v(%v): failed, retry after %v (%d/%d). %v\n", target, mode, backoff, attempts, r.Retry, err)
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+				}
+				backoff *= 2
 			}
 
-			fmt.Fprintf(os.Stderr, "%v(%v) is finished.\n", target, mode)
-			finished <- true
+			r.endTransfer(t, err)
 		}()
 	}
 
@@ -105,57 +199,141 @@ func (r *RunScp) run(mode string, authMap map[AuthKey][]ssh.Signer) {
 	}
 }
 
-// push file scp
-func (r *RunScp) push(target string, scp *scplib.SCPClient) {
-	var err error
-	if r.From.IsRemote && r.To.IsRemote {
-		err = scp.PutData(r.CopyData, r.To.Path[0])
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to run %v \n", err)
-		}
-	} else {
-		err = scp.PutFile(r.From.Path, r.To.Path[0])
+// runTarget execute scp with target of t according to mode.
+func (r *RunScp) runTarget(ctx context.Context, t *scpTransfer, authMap map[AuthKey][]ssh.Signer) (err error) {
+	// create ssh connect
+	con := new(Connect)
+	con.Server = t.Target
+	con.Conf = r.Config
+	con.AuthMap = authMap
+	con.Stderr = r.Stderr
+
+	if err = con.CreateClientContext(ctx); err != nil {
+		return fmt.Errorf("cannot connect %v, %v", t.Target, err)
+	}
+	defer con.Client.Close()
+
+	if err = r.setTransferConn(t, con); err != nil {
+		return
+	}
+
+	return r.CopyTarget(con, t.Mode)
+}
+
+// CopyTarget copy files over connected con according to mode ("push" to con.Server, or "pull" from con.Server).
+// It does not retry, and result is not recorded.
+func (r *RunScp) CopyTarget(con *Connect, mode string) (err error) {
+	target := con.Server
+
+	// scp use exec channel, so copy with sftp at sftp-only account.
+	if con.checkSftpOnly() {
+		fmt.Fprintf(r.stderr(), "Information   :%s is sftp-only account, copy with sftp.\n", target)
+		return r.copySftp(con, mode)
+	}
+
+	// expand wildcard of remote from path (ex. `/var/log/*.gz`)
+	fromPaths := r.From.Path
+	if mode == "pull" {
+		fromPaths, err = con.expandRemoteGlob(r.From.Path)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to run %v \n", err)
+			return
 		}
 	}
+
+	// create ssh session
+	session, err := con.CreateSession()
+	if err != nil {
+		return fmt.Errorf("cannot connect %v, %v", target, err)
+	}
+	defer session.Close()
+
+	// create scp client
+	scp := new(scplib.SCPClient)
+	scp.Permission = r.Permission
+	scp.Session = session
+
+	switch {
+	case r.Tar && mode == "push":
+		err = r.pushTar(con)
+	case r.Tar && mode == "pull":
+		err = r.pullTar(con, fromPaths, r.createServersDir(target, r.From.Server, r.To.Path[0]))
+	case r.Chunks > 1 && mode == "push":
+		err = r.pushChunked(con)
+	case r.Chunks > 1 && mode == "pull":
+		err = r.pullChunked(con, fromPaths, r.createServersDir(target, r.From.Server, r.To.Path[0]))
+	case r.Delta && mode == "push":
+		err = r.pushDelta(con)
+	case r.isFiltered() && mode == "push":
+		err = r.pushFiltered(con)
+	case r.isFiltered() && mode == "pull":
+		err = r.pullFiltered(con, fromPaths, r.createServersDir(target, r.From.Server, r.To.Path[0]))
+	case mode == "push":
+		err = r.push(target, scp)
+	case mode == "pull":
+		err = r.pull(target, scp, fromPaths)
+	}
+	if err != nil {
+		return
+	}
+
+	// verify checksum (end-to-end, not each hop of proxy)
+	if r.Verify && !(r.From.IsRemote && r.To.IsRemote) {
+		err = r.verify(con, target, mode, fromPaths)
+	}
+	return
 }
 
-// pull file scp
-func (r *RunScp) pull(target string, scp *scplib.SCPClient) {
-	var err error
+// push file scp
+func (r *RunScp) push(target string, scp *scplib.SCPClient) (err error) {
+	if r.From.IsRemote && r.To.IsRemote {
+		return scp.PutData(r.CopyData, r.To.Path[0])
+	}
+	return scp.PutFile(r.From.Path, r.To.Path[0])
+}
 
+// pull file scp
+func (r *RunScp) pull(target string, scp *scplib.SCPClient, fromPaths []string) (err error) {
 	// scp pull
 	if r.From.IsRemote && r.To.IsRemote {
-		r.CopyData, err = scp.GetData(r.From.Path)
-	} else {
-		toPath := createServersDir(target, r.From.Server, r.To.Path[0])
-		err = scp.GetFile(r.From.Path, toPath)
+		r.CopyData, err = scp.GetData(fromPaths)
+		return
 	}
 
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to run %v \n", err.Error())
-	}
+	toPath := r.createServersDir(target, r.From.Server, r.To.Path[0])
+	return scp.GetFile(fromPaths, toPath)
 }
 
-func createServersDir(target string, serverList []string, toPath string) (path string) {
+// isFiltered return true if include or exclude patterns are set.
+func (r *RunScp) isFiltered() bool {
+	return len(r.Include) > 0 || len(r.Exclude) > 0
+}
+
+func (r *RunScp) createServersDir(target string, serverList []string, toPath string) (path string) {
 	if len(serverList) > 1 {
-		toDir := filepath.Dir(toPath)
-		toBase := filepath.Base(toPath)
-		serverDir := toDir + "/" + target
+		serverDir := filepath.Dir(toPath) + "/" + target
 
 		err := os.Mkdir(serverDir, os.FileMode(uint32(0755)))
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Failed to run: "+err.Error())
+			fmt.Fprintln(r.stderr(), "Failed to run: "+err.Error())
 		}
+	}
 
-		if toDir != toBase {
-			toPath = serverDir + "/" + toBase
-		} else {
-			toPath = serverDir + "/"
-		}
+	return serversDirPath(target, serverList, toPath)
+}
+
+// serversDirPath return local path to put files pulled from target.
+// If pull from multiple servers, files are put into per-server directory.
+func serversDirPath(target string, serverList []string, toPath string) string {
+	if len(serverList) <= 1 {
+		return toPath
 	}
 
-	path = toPath
-	return
+	toDir := filepath.Dir(toPath)
+	toBase := filepath.Base(toPath)
+	serverDir := toDir + "/" + target
+
+	if toDir != toBase {
+		return serverDir + "/" + toBase
+	}
+	return serverDir + "/"
 }
@@ -0,0 +1,130 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/blacknon/lssh/list"
+)
+
+// BrowseMissingFrom check remote from paths of r at first from server with sftp. If some paths match nothing
+// (not found, or no file matches wildcard), file browser of the server is opened in TUI to pick files and directories instead.
+// It return missing paths and picked paths (absolute, not escaped). If browser is cancelled, error is returned.
+// If server cannot be connected or sftp is not available, paths are not checked. (copy report the error)
+func (r *RunScp) BrowseMissingFrom() (missing, picked []string, err error) {
+	server := r.From.Server[0]
+
+	con := new(Connect)
+	con.Server = server
+	con.Conf = r.Config
+	con.AuthMap = r.createAuthMap()
+	con.Stderr = r.Stderr
+
+	if err := con.CreateClient(); err != nil {
+		debugf(1, "%s: cannot check remote from paths, %v", server, err)
+		return nil, nil, nil
+	}
+	defer con.Client.Close()
+
+	s, err := newSftpClient(con.Client)
+	if err != nil {
+		debugf(1, "%s: cannot check remote from paths, %v", server, err)
+		return nil, nil, nil
+	}
+	defer s.Close()
+
+	for _, p := range r.From.Path {
+		if !s.exists(p) {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	fmt.Fprintf(r.stderr(), "%s: no match %s\n", server, strings.Join(missing, " "))
+
+	// start at directory of first missing path, or login directory
+	dir, err := s.RealPath(sftpPath(path.Dir(unescapeRemotePath(missing[0]))))
+	if err != nil {
+		if dir, err = s.RealPath("."); err != nil {
+			return
+		}
+	}
+
+	b := &list.Browser{
+		Title: fmt.Sprintf("lscp(%s)", server),
+		Dir:   dir,
+		ReadDir: func(dir string) (entries []list.BrowserEntry, err error) {
+			sftpEntries, err := s.ReadDir(dir)
+			for _, e := range sftpEntries {
+				mode := e.Mode
+				if mode&os.ModeSymlink != 0 {
+					if target, err := s.Stat(path.Join(dir, e.Name)); err == nil {
+						mode = target
+					}
+				}
+				entries = append(entries, list.BrowserEntry{Name: e.Name, IsDir: mode.IsDir()})
+			}
+			return
+		},
+	}
+	picked = b.View()
+	if len(picked) == 0 {
+		return nil, nil, errors.New("remote path not selected")
+	}
+
+	return
+}
+
+// exists return true if remote path p (escaped) exists. If last element of p has wildcard, return true if any file matches.
+func (s *sftpClient) exists(p string) bool {
+	p = unescapeRemotePath(p)
+
+	if !isGlob(path.Base(p)) {
+		_, err := s.Stat(sftpPath(p))
+		return err == nil
+	}
+	return len(s.glob(p)) > 0
+}
+
+// glob return remote paths that match wildcard of last element of p (not escaped). If p has no wildcard, p is returned as it is.
+// Names starting with `.` are matched only if pattern starts with `.`, like expandRemoteGlob.
+func (s *sftpClient) glob(p string) (matches []string) {
+	dir, pattern := path.Split(p)
+	if !isGlob(pattern) {
+		return []string{p}
+	}
+
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := s.ReadDir(sftpPath(dir))
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name, ".") && !strings.HasPrefix(pattern, ".") {
+			continue
+		}
+		if ok, _ := path.Match(pattern, e.Name); ok {
+			matches = append(matches, path.Join(dir, e.Name))
+		}
+	}
+	sort.Strings(matches)
+	return
+}
+
+// sftpPath convert `~` of remote path to login directory of sftp. (relative path)
+func sftpPath(p string) string {
+	switch {
+	case p == "~":
+		return "."
+	case strings.HasPrefix(p, "~/"):
+		return "./" + p[2:]
+	}
+	return p
+}
@@ -0,0 +1,320 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	scplib "github.com/blacknon/go-scplib"
+)
+
+// chunkUnit is unit of range offset and size. (block size of remote dd)
+const chunkUnit = 1024 * 1024
+
+// chunkMinSize is min size of file transferred in chunks. Smaller files are copied as usual.
+const chunkMinSize = 64 * chunkUnit
+
+// scpChunk is range of file.
+type scpChunk struct {
+	Offset int64
+	Size   int64
+}
+
+// splitChunks split file of size into count ranges. Offset of range is multiple of chunkUnit.
+func splitChunks(size int64, count int) (chunks []scpChunk) {
+	if count < 1 {
+		count = 1
+	}
+
+	chunkSize := (size + int64(count) - 1) / int64(count)
+	chunkSize = (chunkSize + chunkUnit - 1) / chunkUnit * chunkUnit
+	if chunkSize == 0 {
+		chunkSize = chunkUnit
+	}
+
+	for offset := int64(0); offset < size; offset += chunkSize {
+		chunk := scpChunk{Offset: offset, Size: chunkSize}
+		if offset+chunkSize > size {
+			chunk.Size = size - offset
+		}
+		chunks = append(chunks, chunk)
+	}
+	return
+}
+
+// chunkConns return connections to transfer chunks. If ChunkConn, open new connection for each chunk.
+// Returned close function close opened connections.
+func (r *RunScp) chunkConns(con *Connect) (cons []*Connect, closeConns func(), err error) {
+	cons = []*Connect{con}
+	closeConns = func() {
+		for _, c := range cons[1:] {
+			c.Client.Close()
+		}
+	}
+
+	if !r.ChunkConn {
+		return
+	}
+
+	for i := 1; i < r.Chunks; i++ {
+		c := &Connect{Server: con.Server, Conf: con.Conf, AuthMap: con.AuthMap}
+		if err = c.CreateClient(); err != nil {
+			closeConns()
+			return nil, nil, err
+		}
+		cons = append(cons, c)
+	}
+	return
+}
+
+// runChunks run f for each chunk concurrently over cons, and return first error.
+func runChunks(cons []*Connect, chunks []scpChunk, f func(con *Connect, chunk scpChunk) error) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, len(chunks))
+
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func(con *Connect, chunk scpChunk) {
+			defer wg.Done()
+			if err := f(con, chunk); err != nil {
+				errs <- err
+			}
+		}(cons[i%len(cons)], chunk)
+	}
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+// printChunkResult print transferred size and speed of file.
+func (r *RunScp) printChunkResult(server, path string, size int64, count int, start time.Time) {
+	elapsed := time.Since(start)
+	speed := int64(float64(size) / elapsed.Seconds())
+	fmt.Fprintf(r.stderr(), "%v: %s %s in %d chunks, %v (%s/s)\n",
+		server, path, formatBytes(size), count, elapsed.Round(time.Millisecond), formatBytes(speed))
+}
+
+// pushChunked push local files. Large files are split into ranges, and transferred concurrently.
+// Ranges are written to temp file at remote, and it is renamed to to path when all ranges are transferred.
+func (r *RunScp) pushChunked(con *Connect) (err error) {
+	files, err := r.verifyFiles(con, con.Server, "push", nil)
+	if err != nil {
+		return
+	}
+
+	// directories and small files are copied as usual
+	large := []scpVerifyFile{}
+	for _, f := range files {
+		if info, err := os.Stat(f.Local); err == nil && info.Size() >= chunkMinSize {
+			large = append(large, f)
+		}
+	}
+	others := []string{}
+	for _, from := range r.From.Path {
+		isLarge := false
+		for _, f := range large {
+			isLarge = isLarge || f.Local == from
+		}
+		if !isLarge {
+			others = append(others, from)
+		}
+	}
+	if len(others) > 0 {
+		scp := &scplib.SCPClient{Connection: con.Client, Permission: r.Permission}
+		if err = scp.PutFile(others, r.To.Path[0]); err != nil {
+			return
+		}
+	}
+	if len(large) == 0 {
+		return
+	}
+
+	cons, closeConns, err := r.chunkConns(con)
+	if err != nil {
+		return
+	}
+	defer closeConns()
+
+	for _, f := range large {
+		if err = r.pushChunkedFile(con, cons, f); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// pushChunkedFile push large local file in chunks.
+func (r *RunScp) pushChunkedFile(con *Connect, cons []*Connect, f scpVerifyFile) (err error) {
+	file, err := os.Open(f.Local)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+
+	tmp := filepath.ToSlash(filepath.Join(filepath.Dir(f.Remote), "."+filepath.Base(f.Remote)+".lssh-part"))
+	if _, err = con.runRemoteShell(`: > `+shellQuote(tmp), nil); err != nil {
+		return fmt.Errorf("cannot create %s, %v", tmp, err)
+	}
+
+	start := time.Now()
+	chunks := splitChunks(info.Size(), r.Chunks)
+	err = runChunks(cons, chunks, func(c *Connect, chunk scpChunk) error {
+		script := fmt.Sprintf(`dd of=%s bs=%d seek=%d conv=notrunc 2>/dev/null`, shellQuote(tmp), chunkUnit, chunk.Offset/chunkUnit)
+		_, err := c.runRemoteShell(script, io.NewSectionReader(file, chunk.Offset, chunk.Size))
+		return err
+	})
+
+	// check size and rename
+	script := fmt.Sprintf(`t=%s; [ "$(wc -c < "$t" | tr -d ' ')" = %d ]`, shellQuote(tmp), info.Size())
+	if r.Permission {
+		script += fmt.Sprintf(` && chmod %o "$t"`, info.Mode().Perm())
+	}
+	script += ` && mv "$t" ` + shellQuote(f.Remote)
+	if err == nil {
+		_, err = con.runRemoteShell(script, nil)
+	}
+	if err != nil {
+		con.runRemoteShell(`rm -f `+shellQuote(tmp), nil)
+		return fmt.Errorf("chunked transfer of %s failed, %v", f.Local, err)
+	}
+
+	r.printChunkResult(con.Server, f.Remote, info.Size(), len(chunks), start)
+	return
+}
+
+// pullChunked pull remote files to toPath. Large files are split into ranges, and transferred concurrently.
+// Ranges are written to local temp file, and it is renamed when all ranges are transferred.
+func (r *RunScp) pullChunked(con *Connect, fromPaths []string, toPath string) (err error) {
+	// size of remote regular files. `<index> <size> <path>`
+	script := `i=0; for f in ` + strings.Join(fromPaths, " ") + `; do ` +
+		`if [ -f "$f" ]; then printf '%s %s %s\n' "$i" "$(wc -c < "$f" | tr -d ' ')" "$f"; fi; i=$((i+1)); done`
+	output, err := con.runRemoteShell(script, nil)
+	if err != nil {
+		return
+	}
+
+	large := map[int]bool{}
+	files := []scpVerifyFile{}
+	sizes := []int64{}
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	for sc.Scan() {
+		fields := strings.SplitN(sc.Text(), " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		index, _ := strconv.Atoi(fields[0])
+		size, _ := strconv.ParseInt(fields[1], 10, 64)
+		if size < chunkMinSize {
+			continue
+		}
+
+		local := toPath
+		if info, err := os.Stat(toPath); err == nil && info.IsDir() {
+			local = filepath.Join(toPath, filepath.Base(fields[2]))
+		}
+		large[index] = true
+		files = append(files, scpVerifyFile{Local: local, Remote: fields[2]})
+		sizes = append(sizes, size)
+	}
+
+	// directories and small files are copied as usual
+	others := []string{}
+	for i, from := range fromPaths {
+		if !large[i] {
+			others = append(others, from)
+		}
+	}
+	if len(others) > 0 {
+		scp := &scplib.SCPClient{Connection: con.Client, Permission: r.Permission}
+		if err = scp.GetFile(others, toPath); err != nil {
+			return
+		}
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	cons, closeConns, err := r.chunkConns(con)
+	if err != nil {
+		return
+	}
+	defer closeConns()
+
+	for i, f := range files {
+		if err = r.pullChunkedFile(con, cons, f, sizes[i]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// pullChunkedFile pull large remote file of size in chunks.
+func (r *RunScp) pullChunkedFile(con *Connect, cons []*Connect, f scpVerifyFile, size int64) (err error) {
+	tmp := filepath.Join(filepath.Dir(f.Local), "."+filepath.Base(f.Local)+".lssh-part")
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp)
+	defer file.Close()
+
+	start := time.Now()
+	chunks := splitChunks(size, r.Chunks)
+	err = runChunks(cons, chunks, func(c *Connect, chunk scpChunk) error {
+		session, err := c.CreateSession()
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+
+		session.Stdout = &offsetWriter{w: file, offset: chunk.Offset}
+		script := fmt.Sprintf(`dd if=%s bs=%d skip=%d count=%d 2>/dev/null`,
+			shellQuote(f.Remote), chunkUnit, chunk.Offset/chunkUnit, (chunk.Size+chunkUnit-1)/chunkUnit)
+		return session.Run("sh -c " + shellQuote(script))
+	})
+	if err != nil {
+		return fmt.Errorf("chunked transfer of %s failed, %v", f.Remote, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+	if info.Size() != size {
+		return fmt.Errorf("chunked transfer of %s failed, size mismatch (%d/%d)", f.Remote, info.Size(), size)
+	}
+	if err = file.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tmp, f.Local); err != nil {
+		return
+	}
+
+	r.printChunkResult(con.Server, f.Local, size, len(chunks), start)
+	return
+}
+
+// offsetWriter write data to w sequentially from offset.
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (o *offsetWriter) Write(p []byte) (n int, err error) {
+	n, err = o.w.WriteAt(p, o.offset)
+	o.offset += int64(n)
+	return
+}
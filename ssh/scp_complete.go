@@ -0,0 +1,87 @@
+package ssh
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blacknon/lssh/conf"
+)
+
+// RemotePathCompletionTimeout is timeout of CompleteRemotePath (connect and list), so that shell completion does not hang.
+var RemotePathCompletionTimeout = 5 * time.Second
+
+// CompleteRemotePath return remote paths of server that start with prefix, for shell completion of lscp.
+// Directory has trailing `/`. Relative path and `~/` are relative to login directory.
+// Paths are listed with sftp session. Passphrase and password are never prompted, and banner is not printed.
+func CompleteRemotePath(config conf.Config, server, prefix string) (paths []string, err error) {
+	authMap, _ := NewAuthMap(config, []string{server})
+	c := &Connect{
+		Server:   server,
+		Conf:     config,
+		AuthMap:  authMap,
+		Stderr:   ioutil.Discard,
+		IsNoMotd: true,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), RemotePathCompletionTimeout)
+	defer cancel()
+
+	if err = c.CreateClientContext(ctx); err != nil {
+		return
+	}
+	defer c.Client.Close()
+
+	// close connection at timeout, to stop sftp requests
+	go func() {
+		<-ctx.Done()
+		c.Client.Close()
+	}()
+
+	s, err := newSftpClient(c.Client)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+
+	dir, base := path.Split(prefix)
+	listDir := sftpPath(dir)
+	if dir == "" {
+		listDir = "."
+	}
+
+	entries, err := s.ReadDir(listDir)
+	if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name, base) {
+			continue
+		}
+		// hidden files are completed only if prefix starts with `.`
+		if strings.HasPrefix(e.Name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+
+		mode := e.Mode
+		if mode&os.ModeSymlink != 0 {
+			if target, err := s.Stat(path.Join(listDir, e.Name)); err == nil {
+				mode = target
+			}
+		}
+
+		p := dir + e.Name
+		if mode.IsDir() {
+			p += "/"
+		}
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
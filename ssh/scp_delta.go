@@ -0,0 +1,364 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	scplib "github.com/blacknon/go-scplib"
+)
+
+// range of block size of delta transfer.
+const (
+	deltaMinBlockSize = 2 * 1024
+	deltaMaxBlockSize = 128 * 1024
+)
+
+// deltaMaxData is max size of data operation. Longer data is split.
+const deltaMaxData = 1 << 20
+
+// deltaBlock is block of remote file.
+type deltaBlock struct {
+	Index  uint32
+	Strong [md5.Size]byte
+}
+
+// deltaBlockSize return block size for file of size. (square root of size, like rsync)
+func deltaBlockSize(size int64) int {
+	blockSize := int(math.Sqrt(float64(size))) &^ 7
+	switch {
+	case blockSize < deltaMinBlockSize:
+		return deltaMinBlockSize
+	case blockSize > deltaMaxBlockSize:
+		return deltaMaxBlockSize
+	}
+	return blockSize
+}
+
+// weakSum return rsync style rolling checksum of block. Must be same as weakSum in cmd/lssh-helper.
+func weakSum(block []byte) uint32 {
+	var a, b uint32
+	l := uint32(len(block))
+	for i, c := range block {
+		a += uint32(c)
+		b += (l - uint32(i)) * uint32(c)
+	}
+	return (a & 0xffff) | (b&0xffff)<<16
+}
+
+// rollWeakSum return weak checksum of block of blockSize, that out is removed from the head and in is added to the tail.
+func rollWeakSum(sum uint32, out, in byte, blockSize int) uint32 {
+	a := sum & 0xffff
+	b := sum >> 16
+	a = a - uint32(out) + uint32(in)
+	b = b - uint32(blockSize)*uint32(out) + a
+	return (a & 0xffff) | (b&0xffff)<<16
+}
+
+// parseBlockSums parse output of `lssh-helper blocksums`, and return blocks by weak checksum.
+func parseBlockSums(output []byte) (blocks map[uint32][]deltaBlock, err error) {
+	blocks = map[uint32][]deltaBlock{}
+
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	for index := uint32(0); sc.Scan(); index++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid block checksum: %s", sc.Text())
+		}
+
+		weak, err := strconv.ParseUint(fields[0], 16, 32)
+		if err != nil {
+			return nil, err
+		}
+		strong, err := hex.DecodeString(fields[1])
+		if err != nil || len(strong) != md5.Size {
+			return nil, fmt.Errorf("invalid block checksum: %s", sc.Text())
+		}
+
+		block := deltaBlock{Index: index}
+		copy(block.Strong[:], strong)
+		blocks[uint32(weak)] = append(blocks[uint32(weak)], block)
+	}
+
+	return blocks, sc.Err()
+}
+
+// deltaWriter write delta operations of `lssh-helper patch`.
+type deltaWriter struct {
+	w    *bufio.Writer
+	data []byte
+
+	// bytes of data operations
+	Sent int64
+}
+
+func newDeltaWriter(w io.Writer) *deltaWriter {
+	return &deltaWriter{w: bufio.NewWriter(w)}
+}
+
+// Copy write operation to copy block of remote file.
+func (d *deltaWriter) Copy(index uint32) (err error) {
+	if err = d.flushData(); err != nil {
+		return
+	}
+
+	d.w.WriteByte('C')
+	return binary.Write(d.w, binary.BigEndian, index)
+}
+
+// Data add data to be written.
+func (d *deltaWriter) Data(p ...byte) (err error) {
+	d.data = append(d.data, p...)
+	if len(d.data) >= deltaMaxData {
+		return d.flushData()
+	}
+	return
+}
+
+// End write end operation with sha256 checksum of new file.
+func (d *deltaWriter) End(sum []byte) (err error) {
+	if err = d.flushData(); err != nil {
+		return
+	}
+
+	d.w.WriteByte('E')
+	d.w.Write(sum)
+	return d.w.Flush()
+}
+
+// flushData write pending data as data operation.
+func (d *deltaWriter) flushData() (err error) {
+	if len(d.data) == 0 {
+		return
+	}
+
+	d.w.WriteByte('D')
+	binary.Write(d.w, binary.BigEndian, uint32(len(d.data)))
+	if _, err = d.w.Write(d.data); err != nil {
+		return
+	}
+
+	d.Sent += int64(len(d.data))
+	d.data = d.data[:0]
+	return
+}
+
+// writeDelta find blocks of remote file in src with rolling checksum, and write delta to d.
+func writeDelta(src io.Reader, blockSize int, blocks map[uint32][]deltaBlock, d *deltaWriter) (err error) {
+	h := sha256.New()
+	r := io.TeeReader(src, h)
+
+	// buf[start:end] is data read from src. window is buf[start:start+blockSize].
+	buf := make([]byte, blockSize+deltaMaxData)
+	start, end, eof := 0, 0, false
+
+	// read src until n bytes are available from start
+	fill := func(n int) error {
+		if end-start >= n || eof {
+			return nil
+		}
+
+		copy(buf, buf[start:end])
+		end -= start
+		start = 0
+
+		m, err := io.ReadFull(r, buf[end:])
+		end += m
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			eof = true
+			return nil
+		}
+		return err
+	}
+	windowSize := func() int {
+		if end-start < blockSize {
+			return end - start
+		}
+		return blockSize
+	}
+
+	if err = fill(blockSize); err != nil {
+		return
+	}
+	size := windowSize()
+	weak := weakSum(buf[start : start+size])
+
+	for size > 0 {
+		window := buf[start : start+size]
+
+		// find same block at remote (last block of remote may be shorter)
+		if index, ok := findBlock(blocks, weak, window); ok {
+			if err = d.Copy(index); err != nil {
+				return
+			}
+
+			start += size
+			if err = fill(blockSize); err != nil {
+				return
+			}
+			size = windowSize()
+			weak = weakSum(buf[start : start+size])
+			continue
+		}
+
+		// not found, slide window 1 byte
+		if err = fill(blockSize + 1); err != nil {
+			return
+		}
+		if end-start <= blockSize {
+			// end of src
+			err = d.Data(buf[start:end]...)
+			if err != nil {
+				return
+			}
+			break
+		}
+
+		out, in := buf[start], buf[start+blockSize]
+		if err = d.Data(out); err != nil {
+			return
+		}
+		start++
+		weak = rollWeakSum(weak, out, in, blockSize)
+	}
+
+	return d.End(h.Sum(nil))
+}
+
+// findBlock return index of remote block that is same as window.
+func findBlock(blocks map[uint32][]deltaBlock, weak uint32, window []byte) (index uint32, ok bool) {
+	candidates, ok := blocks[weak]
+	if !ok {
+		return
+	}
+
+	strong := md5.Sum(window)
+	for _, block := range candidates {
+		if block.Strong == strong {
+			return block.Index, true
+		}
+	}
+	return 0, false
+}
+
+// pushDelta push local files with delta transfer. Remote files that already exist are compared block by block,
+// and only changed parts are sent (like rsync). New files and directories are copied as usual.
+func (r *RunScp) pushDelta(con *Connect) (err error) {
+	scp := &scplib.SCPClient{Connection: con.Client, Permission: r.Permission}
+
+	helper, _ := con.DeployHelper()
+	if !helper.IsBinary() {
+		fmt.Fprintf(r.stderr(), "%v: lssh-helper is not available, copy whole files.\n", con.Server)
+		return scp.PutFile(r.From.Path, r.To.Path[0])
+	}
+
+	// directories are copied as usual
+	dirs := []string{}
+	for _, from := range r.From.Path {
+		if info, err := os.Stat(from); err == nil && !info.Mode().IsRegular() {
+			dirs = append(dirs, from)
+		}
+	}
+	if len(dirs) > 0 {
+		if err = scp.PutFile(dirs, r.To.Path[0]); err != nil {
+			return
+		}
+	}
+
+	files, err := r.verifyFiles(con, con.Server, "push", nil)
+	if err != nil {
+		return
+	}
+
+	var total, sent int64
+	for _, f := range files {
+		info, err := os.Stat(f.Local)
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+
+		n, err := r.pushDeltaFile(con, helper, f, info)
+		if err != nil {
+			// new file, or failed to patch
+			debugf(1, "%s: delta transfer of %s is not available, %v", con.Server, f.Remote, err)
+			if err = scp.PutFile([]string{f.Local}, shellQuote(f.Remote)); err != nil {
+				return err
+			}
+			n = info.Size()
+		}
+		sent += n
+	}
+
+	fmt.Fprintf(r.stderr(), "%v: delta transfer %d files, sent %s of %s.\n", con.Server, len(files), formatBytes(sent), formatBytes(total))
+	return
+}
+
+// pushDeltaFile send delta of local file to remote file, and return bytes of sent data.
+func (r *RunScp) pushDeltaFile(con *Connect, helper *RemoteHelper, f scpVerifyFile, info os.FileInfo) (sent int64, err error) {
+	blockSize := deltaBlockSize(info.Size())
+
+	// checksums of blocks of current remote file
+	session, err := con.CreateSession()
+	if err != nil {
+		return
+	}
+	output, err := session.Output(helper.Command("blocksums", strconv.Itoa(blockSize), f.Remote))
+	session.Close()
+	if err != nil {
+		return
+	}
+	blocks, err := parseBlockSums(output)
+	if err != nil {
+		return
+	}
+
+	file, err := os.Open(f.Local)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	// rebuild remote file with delta
+	session, err = con.CreateSession()
+	if err != nil {
+		return
+	}
+	defer session.Close()
+
+	args := []string{strconv.Itoa(blockSize), f.Remote}
+	if r.Permission {
+		args = append(args, fmt.Sprintf("%o", info.Mode().Perm()))
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return
+	}
+	stderr := new(bytes.Buffer)
+	session.Stderr = stderr
+	if err = session.Start(helper.Command("patch", args...)); err != nil {
+		return
+	}
+
+	d := newDeltaWriter(stdin)
+	err = writeDelta(file, blockSize, blocks, d)
+	stdin.Close()
+	if err != nil {
+		return
+	}
+
+	if err = session.Wait(); err != nil {
+		return 0, fmt.Errorf("%v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return d.Sent, nil
+}
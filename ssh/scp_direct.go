@@ -0,0 +1,126 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// runDirect copy files from source server to destination servers directly, with scp run at source server.
+// Destination must be reachable from source server with address in config, and its host key must be known there.
+// Local ssh-agent is forwarded to source server for authentication to destination.
+// It return destination servers that direct copy failed. If ctx is done, scp at source server is stopped.
+func (r *RunScp) runDirect(ctx context.Context, authMap map[AuthKey][]ssh.Signer) (failed []string) {
+	source := r.From.Server[0]
+
+	con := new(Connect)
+	con.Server = source
+	con.Conf = r.Config
+	con.AuthMap = authMap
+	if err := con.CreateClientContext(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot connect %v, %v \n", source, err)
+		return r.To.Server
+	}
+	defer con.Client.Close()
+
+	// close connection at ctx done, so that scp at source server is stopped.
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			con.Client.Close()
+		case <-done:
+		}
+	}()
+
+	fromPaths, err := con.expandRemoteGlob(r.From.Path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", source, err)
+		return r.To.Server
+	}
+
+	isAgent := con.forwardAgent()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, target := range r.To.Server {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+
+			if err := r.copyDirect(con, target, fromPaths, isAgent); err != nil {
+				fmt.Fprintf(os.Stderr, "%v => %v: direct copy failed, %v\n", source, target, err)
+				mu.Lock()
+				failed = append(failed, target)
+				mu.Unlock()
+				return
+			}
+			fmt.Fprintf(os.Stderr, "%v => %v(direct) is finished.\n", source, target)
+		}(target)
+	}
+	wg.Wait()
+
+	return
+}
+
+// copyDirect run scp at source server con, to copy fromPaths to target.
+func (r *RunScp) copyDirect(con *Connect, target string, fromPaths []string, isAgent bool) (err error) {
+	targetConf := r.Config.Server[target]
+
+	port := targetConf.Port
+	if port == "" {
+		port = "22"
+	}
+	addr := targetConf.Addr
+	if strings.Contains(addr, ":") {
+		addr = "[" + addr + "]"
+	}
+
+	// not prompt at source server (no terminal)
+	cmd := "scp -r -o BatchMode=yes -P " + shellQuote(port)
+	if r.Permission {
+		cmd += " -p"
+	}
+	cmd += " " + strings.Join(fromPaths, " ") + " " + shellQuote(targetConf.User+"@"+addr) + ":" + r.To.Path[0]
+	debugf(1, "%s: run `%s`", con.Server, cmd)
+
+	session, err := con.CreateSession()
+	if err != nil {
+		return
+	}
+	defer session.Close()
+
+	if isAgent {
+		agent.RequestAgentForwarding(session)
+	}
+
+	stderr := new(bytes.Buffer)
+	session.Stderr = stderr
+	if err = session.Run(cmd); err != nil {
+		return fmt.Errorf("%v, %s", err, strings.Join(strings.Fields(stderr.String()), " "))
+	}
+	return
+}
+
+// forwardAgent set ssh-agent forwarding of c (agent of ssh_agent setting, or local SSH_AUTH_SOCK).
+// It return false if no agent is available.
+func (c *Connect) forwardAgent() bool {
+	switch {
+	case c.getAgent() != nil:
+		agent.ForwardToAgent(c.Client, c.getAgent())
+	default:
+		sock, err := dialAgentSocket(c.Conf.Server[c.Server])
+		if err != nil {
+			return false
+		}
+		agent.ForwardToAgent(c.Client, agent.NewClient(sock))
+	}
+	return true
+}
@@ -0,0 +1,215 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	scplib "github.com/blacknon/go-scplib"
+)
+
+// matchScpFilter return true if file at relative path rel should be copied with include and exclude glob patterns.
+// Pattern without `/` is matched against each name in rel (file or parent directory), pattern with `/` against rel.
+// Exclude has priority. If include is empty, all files not excluded are copied.
+func matchScpFilter(rel string, include, exclude []string) bool {
+	rel = filepath.ToSlash(rel)
+
+	match := func(pattern string, isFileOnly bool) bool {
+		if strings.Contains(pattern, "/") {
+			ok, _ := path.Match(pattern, rel)
+			return ok
+		}
+
+		names := strings.Split(rel, "/")
+		if isFileOnly {
+			names = names[len(names)-1:]
+		}
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, pattern := range exclude {
+		if match(pattern, false) {
+			return false
+		}
+	}
+
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		if match(pattern, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGlob return true if path has wildcard characters.
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// unescapeRemotePath revert check.EscapePath.
+func unescapeRemotePath(path string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, `;`, `\ `, ` `).Replace(path)
+}
+
+// expandRemoteGlob expand wildcard of last element of remote paths (ex. `/var/log/*.gz`), by listing remote directory.
+// Paths without wildcard are returned as it is. Names starting with `.` are matched only if pattern starts with `.`.
+func (c *Connect) expandRemoteGlob(paths []string) (expanded []string, err error) {
+	for _, p := range paths {
+		dir, pattern := "", p
+		if i := strings.LastIndex(p, "/"); i >= 0 {
+			dir, pattern = p[:i+1], p[i+1:]
+		}
+		if !isGlob(pattern) {
+			expanded = append(expanded, p)
+			continue
+		}
+
+		cd := ""
+		if dir != "" {
+			cd = "cd " + dir + " && "
+		}
+		output, err := c.runRemoteShell(cd+"ls -1A", nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list remote directory %s, %v", dir, err)
+		}
+
+		pattern = unescapeRemotePath(pattern)
+		matched := []string{}
+		for _, name := range strings.Split(string(output), "\n") {
+			if name == "" || (strings.HasPrefix(name, ".") && !strings.HasPrefix(pattern, ".")) {
+				continue
+			}
+			if ok, _ := path.Match(pattern, name); ok {
+				matched = append(matched, dir+shellQuote(name))
+			}
+		}
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("no match %s", p)
+		}
+
+		sort.Strings(matched)
+		expanded = append(expanded, matched...)
+	}
+
+	return
+}
+
+// groupScpFiles group files by directory of relative path. (relative directory => files)
+func groupScpFiles(files, rels []string) (groups map[string][]string, dirs []string) {
+	groups = map[string][]string{}
+	for i, file := range files {
+		dir := path.Dir(filepath.ToSlash(rels[i]))
+		if _, ok := groups[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		groups[dir] = append(groups[dir], file)
+	}
+	sort.Strings(dirs)
+	return
+}
+
+// pushFiltered push local files that match include and exclude patterns, keeping directory structure.
+func (r *RunScp) pushFiltered(con *Connect) (err error) {
+	files, rels := []string{}, []string{}
+	for _, from := range r.From.Path {
+		base := filepath.Dir(from)
+		err = filepath.Walk(from, func(p string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+
+			rel, _ := filepath.Rel(base, p)
+			if matchScpFilter(rel, r.Include, r.Exclude) {
+				files = append(files, p)
+				rels = append(rels, rel)
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	toPath := unescapeRemotePath(r.To.Path[0])
+	groups, dirs := groupScpFiles(files, rels)
+	for _, dir := range dirs {
+		scp := &scplib.SCPClient{Connection: con.Client, Permission: r.Permission}
+
+		// files at top level are copied to to path as it is.
+		if dir == "." {
+			if err = scp.PutFile(groups[dir], r.To.Path[0]); err != nil {
+				return
+			}
+			continue
+		}
+
+		remoteDir := toPath + "/" + dir
+		if _, err = con.runRemoteShell("mkdir -p "+shellQuote(remoteDir), nil); err != nil {
+			return fmt.Errorf("cannot create remote directory %s, %v", remoteDir, err)
+		}
+		if err = scp.PutFile(groups[dir], remoteDir+"/."); err != nil {
+			return
+		}
+	}
+
+	fmt.Fprintf(r.stderr(), "%v: %d files matched.\n", con.Server, len(files))
+	return
+}
+
+// pullFiltered pull remote files that match include and exclude patterns to toPath, keeping directory structure.
+func (r *RunScp) pullFiltered(con *Connect, fromPaths []string, toPath string) (err error) {
+	files, rels := []string{}, []string{}
+	for _, from := range fromPaths {
+		// print from path expanded at remote, and regular files under it.
+		output, err := con.runRemoteShell(`p=`+from+`; printf '%s\n' "$p"; find "$p" -type f`, nil)
+		if err != nil {
+			return fmt.Errorf("cannot list remote files %s, %v", from, err)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+		base := strings.TrimSuffix(path.Dir(strings.TrimSuffix(lines[0], "/")), "/") + "/"
+		for _, file := range lines[1:] {
+			rel := strings.TrimPrefix(file, base)
+			if file == "" || !matchScpFilter(rel, r.Include, r.Exclude) {
+				continue
+			}
+			files = append(files, shellQuote(file))
+			rels = append(rels, rel)
+		}
+	}
+
+	groups, dirs := groupScpFiles(files, rels)
+	for _, dir := range dirs {
+		scp := &scplib.SCPClient{Connection: con.Client, Permission: r.Permission}
+
+		// files at top level are copied to to path as it is.
+		if dir == "." {
+			if err = scp.GetFile(groups[dir], toPath); err != nil {
+				return
+			}
+			continue
+		}
+
+		localDir := filepath.Join(toPath, filepath.FromSlash(dir))
+		if err = os.MkdirAll(localDir, 0755); err != nil {
+			return
+		}
+		if err = scp.GetFile(groups[dir], localDir+"/"); err != nil {
+			return
+		}
+	}
+
+	fmt.Fprintf(r.stderr(), "%v: %d files matched.\n", con.Server, len(files))
+	return
+}
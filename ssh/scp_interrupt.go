@@ -0,0 +1,276 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// errScpInterrupted is error of copy stopped by interrupt (Ctrl+C).
+var errScpInterrupted = errors.New("interrupted")
+
+// scpTransfer is copy with target in progress.
+type scpTransfer struct {
+	Mode   string // push or pull
+	Target string
+	Start  time.Time
+
+	// connection and count of current attempt
+	con      *Connect
+	attempts int
+
+	// bytes transferred at previous attempts
+	sent, received int64
+}
+
+// beginTransfer register copy with target in progress. It return false if already interrupted.
+func (r *RunScp) beginTransfer(mode, target string) (t *scpTransfer, ok bool) {
+	r.transferMu.Lock()
+	defer r.transferMu.Unlock()
+
+	if r.interrupted {
+		return nil, false
+	}
+	if r.transfers == nil {
+		r.transfers = map[*scpTransfer]bool{}
+	}
+
+	t = &scpTransfer{Mode: mode, Target: target, Start: time.Now()}
+	r.transfers[t] = true
+	return t, true
+}
+
+// setTransferConn set connection of current attempt of t. If already interrupted, con is closed and return error.
+func (r *RunScp) setTransferConn(t *scpTransfer, con *Connect) error {
+	r.transferMu.Lock()
+	defer r.transferMu.Unlock()
+
+	if r.interrupted {
+		con.Client.Close()
+		return errScpInterrupted
+	}
+	if t.con != nil {
+		sent, received := clientBytes(t.con.Client)
+		t.sent += sent
+		t.received += received
+	}
+	t.con = con
+	t.attempts++
+	return nil
+}
+
+// bytes return bytes sent and received at all attempts of t.
+func (t *scpTransfer) bytes() (sent, received int64) {
+	if t.con != nil {
+		sent, received = clientBytes(t.con.Client)
+	}
+	return t.sent + sent, t.received + received
+}
+
+// endTransfer unregister t, and record result of it. Result is not recorded if interrupted, it is recorded by interrupt.
+func (r *RunScp) endTransfer(t *scpTransfer, err error) {
+	r.transferMu.Lock()
+	defer r.transferMu.Unlock()
+
+	if r.interrupted {
+		return
+	}
+	delete(r.transfers, t)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v(%v) is failed. %v\n", t.Target, t.Mode, err)
+	} else {
+		fmt.Fprintf(os.Stderr, "%v(%v) is finished.\n", t.Target, t.Mode)
+	}
+	r.addResult(t, err)
+}
+
+// Interrupted return true if copy is interrupted (ctx of StartContext is done).
+func (r *RunScp) Interrupted() bool {
+	r.transferMu.Lock()
+	defer r.transferMu.Unlock()
+
+	return r.interrupted
+}
+
+// handleInterrupt call cancel at interrupt (Ctrl+C). Second interrupt exit immediately.
+// Returned function stop handling.
+func (r *RunScp) handleInterrupt(cancel func()) (stop func()) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	done := make(chan bool)
+
+	go func() {
+		select {
+		case <-sig:
+		case <-done:
+			return
+		}
+
+		fmt.Fprintln(os.Stderr, "\nlscp: interrupted, stop copy and remove partially written files. (press Ctrl+C again to exit now)")
+		cancel()
+
+		select {
+		case <-sig:
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(sig)
+		close(done)
+	}
+}
+
+// watchCancel stop copy at ctx done. Returned function stop watching, and wait for cleanup if ctx was done.
+func (r *RunScp) watchCancel(ctx context.Context) (stop func()) {
+	done := make(chan bool)
+	cleaned := make(chan bool)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.interrupt()
+		case <-done:
+		}
+		close(cleaned)
+	}()
+
+	return func() {
+		close(done)
+		<-cleaned
+	}
+}
+
+// interrupt close connections of transfers in progress, so that no more data is written,
+// and remove partially written destination files of them.
+func (r *RunScp) interrupt() {
+	r.transferMu.Lock()
+	r.interrupted = true
+	transfers := []*scpTransfer{}
+	for t := range r.transfers {
+		transfers = append(transfers, t)
+	}
+	r.transferMu.Unlock()
+
+	for _, t := range transfers {
+		if t.con != nil && t.con.Client != nil {
+			t.con.Client.Close()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, t := range transfers {
+		wg.Add(1)
+		go func(t *scpTransfer) {
+			defer wg.Done()
+
+			if err := r.removePartial(t); err != nil {
+				fmt.Fprintf(os.Stderr, "%v: cannot remove partially written files, %v\n", t.Target, err)
+			}
+			r.addResult(t, errScpInterrupted)
+		}(t)
+	}
+	wg.Wait()
+}
+
+// removePartial remove destination files of t that were written after start of t, and size differ from source.
+// Temp files of chunked and delta transfer are also removed.
+func (r *RunScp) removePartial(t *scpTransfer) (err error) {
+	if t.con == nil {
+		return
+	}
+
+	// reconnect, current connection is closed
+	con := &Connect{Server: t.Target, Conf: r.Config, AuthMap: t.con.AuthMap}
+
+	switch t.Mode {
+	case "push":
+		if r.From.IsRemote {
+			// remote to remote copy, data is in memory
+			return
+		}
+
+		sources, isSingleFile, _ := r.localSources()
+		script := fmt.Sprintf(`s=$(($(date +%%s) - %d)); `, int(time.Since(t.Start).Seconds())+2)
+		for _, src := range sources {
+			for _, dest := range r.manifestDests("local", src, isSingleFile) {
+				if dest[0] != t.Target {
+					continue
+				}
+
+				f := remoteShellPath(dest[1])
+				tmp := remoteShellPath(path.Join(path.Dir(dest[1]), "."+path.Base(dest[1])))
+				script += fmt.Sprintf(`rm -f %[1]s.lssh-part %[1]s.lssh-patch; f=%[2]s; n=%[3]d; `+
+					`if [ -f "$f" ] && { [ "$n" -lt 0 ] || [ "$(wc -c < "$f" | tr -d ' ')" != "$n" ]; } && `+
+					`[ "$(stat -c %%Y "$f" 2>/dev/null || stat -f %%m "$f")" -ge "$s" ]; then rm -f "$f" && printf '%%s\n' "$f"; fi; `,
+					tmp, f, src.Size)
+			}
+		}
+
+		if err = con.CreateClient(); err != nil {
+			return
+		}
+		defer con.Client.Close()
+
+		output, err := con.runRemoteShell(script, nil)
+		if err != nil {
+			return err
+		}
+		for _, removed := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			if removed != "" {
+				fmt.Fprintf(os.Stderr, "%v: removed partially written %s\n", t.Target, removed)
+			}
+		}
+
+	case "pull":
+		if r.To.IsRemote || r.isStdout() {
+			return
+		}
+
+		if err = con.CreateClient(); err != nil {
+			return
+		}
+		defer con.Client.Close()
+
+		sources, isSingleFile, err := r.remoteSources(con)
+		if err != nil {
+			return err
+		}
+
+		for _, src := range sources {
+			for _, dest := range r.manifestDests(t.Target, src, isSingleFile) {
+				local := dest[1]
+				tmp := filepath.Join(filepath.Dir(local), "."+filepath.Base(local)+".lssh-part")
+				os.Remove(tmp)
+
+				info, err := os.Stat(local)
+				if err != nil || !info.Mode().IsRegular() || info.Size() == src.Size || info.ModTime().Before(t.Start.Add(-time.Second)) {
+					continue
+				}
+				if os.Remove(local) == nil {
+					fmt.Fprintf(os.Stderr, "%v: removed partially written %s\n", t.Target, local)
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// remoteShellPath return shell word of remote path. `~/` is expanded by remote shell.
+func remoteShellPath(p string) string {
+	if strings.HasPrefix(p, "~/") {
+		return `"$HOME"/` + shellQuote(p[2:])
+	}
+	return shellQuote(p)
+}
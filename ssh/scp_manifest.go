@@ -0,0 +1,212 @@
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ScpManifestEntry is file to be copied.
+type ScpManifestEntry struct {
+	Host     string `json:"host"` // source server, or `local`
+	Source   string `json:"source"`
+	Size     int64  `json:"size"` // -1 if unknown (stdin)
+	DestHost string `json:"dest_host"`
+	Dest     string `json:"dest"`
+}
+
+// ScpManifest is list of files to be copied, resolved by local stat or remote listing (lscp --dry-run).
+type ScpManifest struct {
+	Files  []ScpManifestEntry `json:"files"`
+	Count  int                `json:"count"`
+	Size   int64              `json:"size"`
+	Errors []string           `json:"errors,omitempty"` // sources that cannot be resolved
+}
+
+// scpSource is regular file of from path. Rel is relative path from parent directory of from path.
+type scpSource struct {
+	Path string
+	Rel  string
+	Size int64
+}
+
+// ResolveManifest resolve source files of r, and return files with destination.
+// Remote from paths are listed at each from server. Nothing is copied.
+// Destination of push assume that to path is directory, unless single file is copied to path not ending with `/`.
+func (r *RunScp) ResolveManifest() (manifest ScpManifest) {
+	add := func(host string, sources []scpSource, isSingleFile bool) {
+		for _, src := range sources {
+			for _, dest := range r.manifestDests(host, src, isSingleFile) {
+				manifest.Files = append(manifest.Files, ScpManifestEntry{
+					Host:     host,
+					Source:   src.Path,
+					Size:     src.Size,
+					DestHost: dest[0],
+					Dest:     dest[1],
+				})
+			}
+			manifest.Count++
+			if src.Size > 0 {
+				manifest.Size += src.Size
+			}
+		}
+	}
+
+	if !r.From.IsRemote {
+		sources, isSingleFile, errs := r.localSources()
+		for _, err := range errs {
+			manifest.Errors = append(manifest.Errors, fmt.Sprintf("local:%v", err))
+		}
+		add("local", sources, isSingleFile)
+		return
+	}
+
+	authMap := r.createAuthMap()
+	for _, server := range r.From.Server {
+		con := &Connect{Server: server, Conf: r.Config, AuthMap: authMap}
+		if err := con.CreateClient(); err != nil {
+			manifest.Errors = append(manifest.Errors, fmt.Sprintf("%s: cannot connect, %v", server, err))
+			continue
+		}
+
+		sources, isSingleFile, err := r.remoteSources(con)
+		con.Client.Close()
+		if err != nil {
+			manifest.Errors = append(manifest.Errors, fmt.Sprintf("%s: %v", server, err))
+			continue
+		}
+		add(server, sources, isSingleFile)
+	}
+
+	return
+}
+
+// localSources return regular files of local from paths (or stdin), that match include and exclude patterns.
+// Paths that cannot be read are returned as errs.
+func (r *RunScp) localSources() (sources []scpSource, isSingleFile bool, errs []error) {
+	if r.isStdin() {
+		return []scpSource{{Path: "stdin", Rel: "stdin", Size: -1}}, true, nil
+	}
+
+	for _, from := range r.From.Path {
+		base := filepath.Dir(from)
+		err := filepath.Walk(from, func(p string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+
+			rel, _ := filepath.Rel(base, p)
+			if matchScpFilter(rel, r.Include, r.Exclude) {
+				sources = append(sources, scpSource{Path: p, Rel: filepath.ToSlash(rel), Size: info.Size()})
+			}
+			isSingleFile = len(r.From.Path) == 1 && p == from
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", from, err))
+		}
+	}
+	return
+}
+
+// remoteSources list regular files of remote from paths at server of con, that match include and exclude patterns.
+func (r *RunScp) remoteSources(con *Connect) (sources []scpSource, isSingleFile bool, err error) {
+	fromPaths, err := con.expandRemoteGlob(r.From.Path)
+	if err != nil {
+		return
+	}
+
+	for _, from := range fromPaths {
+		// print from path expanded at remote, and `<size> <path>` of regular files under it.
+		script := `p=` + from + `; printf '%s\n' "$p"; ` +
+			`find "$p" -type f | while IFS= read -r f; do printf '%s %s\n' "$(wc -c < "$f" | tr -d ' ')" "$f"; done`
+		output, err := con.runRemoteShell(script, nil)
+		if err != nil {
+			return nil, false, fmt.Errorf("cannot list remote files %s, %v", from, err)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+		top := strings.TrimSuffix(lines[0], "/")
+		base := strings.TrimSuffix(path.Dir(top), "/") + "/"
+		for _, line := range lines[1:] {
+			fields := strings.SplitN(line, " ", 2)
+			if len(fields) != 2 {
+				continue
+			}
+			size, _ := strconv.ParseInt(fields[0], 10, 64)
+
+			rel := strings.TrimPrefix(fields[1], base)
+			if !matchScpFilter(rel, r.Include, r.Exclude) {
+				continue
+			}
+			sources = append(sources, scpSource{Path: fields[1], Rel: rel, Size: size})
+			isSingleFile = len(fromPaths) == 1 && fields[1] == top
+		}
+	}
+
+	return
+}
+
+// manifestDests return destinations ([host, path]) of source file src from host.
+func (r *RunScp) manifestDests(host string, src scpSource, isSingleFile bool) (dests [][2]string) {
+	if r.isStdout() {
+		return [][2]string{{"local", "stdout"}}
+	}
+
+	if !r.To.IsRemote {
+		// pulled files are put into per-server directory, if from servers are multiple.
+		toPath := serversDirPath(host, r.From.Server, r.To.Path[0])
+		if info, err := os.Stat(toPath); err == nil && info.IsDir() {
+			toPath = filepath.Join(toPath, filepath.FromSlash(src.Rel))
+		} else if !isSingleFile {
+			// copied directory is created as to path
+			parts := strings.SplitN(src.Rel, "/", 2)
+			toPath = filepath.Join(toPath, filepath.FromSlash(parts[len(parts)-1]))
+		}
+		return [][2]string{{"local", toPath}}
+	}
+
+	toPath := unescapeRemotePath(r.To.Path[0])
+	if !isSingleFile || strings.HasSuffix(toPath, "/") {
+		toPath = strings.TrimSuffix(toPath, "/") + "/" + src.Rel
+	}
+	for _, server := range r.To.Server {
+		dests = append(dests, [2]string{server, toPath})
+	}
+	return
+}
+
+// printManifest print files of manifest to w.
+func printManifest(w io.Writer, manifest ScpManifest) {
+	for _, f := range manifest.Files {
+		size := "-"
+		if f.Size >= 0 {
+			size = formatBytes(f.Size)
+		}
+		fmt.Fprintf(w, "  %s:%s => %s:%s (%s)\n", f.Host, f.Source, f.DestHost, f.Dest, size)
+	}
+	for _, e := range manifest.Errors {
+		fmt.Fprintf(w, "  error, %s\n", e)
+	}
+	fmt.Fprintf(w, "  total %d files, %s\n", manifest.Count, formatBytes(manifest.Size))
+}
+
+// DryRunJSON print manifest of r to w as JSON, without copying.
+func (r *RunScp) DryRunJSON(w io.Writer) error {
+	manifest := r.ResolveManifest()
+	if manifest.Files == nil {
+		manifest.Files = []ScpManifestEntry{}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
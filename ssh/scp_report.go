@@ -0,0 +1,163 @@
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/list"
+)
+
+// ScpReportFile is name of file of last lscp report, in state directory.
+var ScpReportFile = "lscp_report.json"
+
+// ScpResult is result of copy with a server.
+type ScpResult struct {
+	Server   string  `json:"server"`
+	Mode     string  `json:"mode"`   // push or pull
+	Status   string  `json:"status"` // ok, failed or interrupted
+	Attempts int     `json:"attempts"`
+	Duration float64 `json:"duration"` // seconds
+	Sent     int64   `json:"sent"`     // bytes sent to server
+	Received int64   `json:"received"` // bytes received from server
+	Error    string  `json:"error,omitempty"`
+}
+
+// ScpReport is report of lscp run. It is used to retry only failed servers (`lscp --retry-failed-from`).
+type ScpReport struct {
+	Time    time.Time   `json:"time"`
+	Args    []string    `json:"args"`    // command line args (from and to paths)
+	Servers []string    `json:"servers"` // servers attempted
+	Result  string      `json:"result"`  // ok (all servers succeeded), failed or interrupted
+	Results []ScpResult `json:"results"`
+}
+
+// ReadScpReport read report written by lscp.
+func ReadScpReport(path string) (report ScpReport, err error) {
+	data, err := ioutil.ReadFile(common.GetFullPath(path))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &report)
+	return
+}
+
+// newScpReport return report of results, with servers attempted and overall result.
+func newScpReport(args []string, results []ScpResult) ScpReport {
+	report := ScpReport{Time: time.Now(), Args: args, Result: "ok", Results: results}
+
+	servers := map[string]bool{}
+	for _, result := range results {
+		if !servers[result.Server] {
+			servers[result.Server] = true
+			report.Servers = append(report.Servers, result.Server)
+		}
+
+		switch {
+		case result.Status == "interrupted":
+			report.Result = "interrupted"
+		case result.Status != "ok" && report.Result == "ok":
+			report.Result = "failed"
+		}
+	}
+	sort.Strings(report.Servers)
+
+	return report
+}
+
+// FailedServers return servers that copy failed.
+func (report ScpReport) FailedServers() (servers []string) {
+	for _, result := range report.Results {
+		if result.Status != "ok" {
+			servers = append(servers, result.Server)
+		}
+	}
+	return
+}
+
+// FailedServers return servers that copy failed.
+func (r *RunScp) FailedServers() []string {
+	r.resultMu.Lock()
+	defer r.resultMu.Unlock()
+
+	return ScpReport{Results: r.results}.FailedServers()
+}
+
+// addResult record result of copy t.
+func (r *RunScp) addResult(t *scpTransfer, err error) {
+	result := ScpResult{
+		Server:   t.Target,
+		Mode:     t.Mode,
+		Status:   "ok",
+		Attempts: t.attempts,
+		Duration: time.Since(t.Start).Seconds(),
+	}
+	result.Sent, result.Received = t.bytes()
+	switch {
+	case err == errScpInterrupted:
+		result.Status = "interrupted"
+	case err != nil:
+		result.Status = "failed"
+		result.Error = err.Error()
+	}
+
+	r.resultMu.Lock()
+	r.results = append(r.results, result)
+	r.resultMu.Unlock()
+}
+
+// finish print summary of results and write report, if copied with multiple servers or failed (or ReportPath is set).
+func (r *RunScp) finish() {
+	failed := r.FailedServers()
+	if len(r.results) == 0 {
+		return
+	}
+
+	if len(r.results) > 1 || len(failed) > 0 {
+		r.printSummary()
+	} else if r.ReportPath == "" {
+		return
+	}
+
+	path := r.ReportPath
+	if path == "" {
+		path = common.GetStatePath(ScpReportFile)
+	}
+	report := newScpReport(r.Args, r.results)
+	data, _ := json.MarshalIndent(report, "", "  ")
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot write report %s, %v\n", path, err)
+		return
+	}
+
+	if len(failed) > 0 {
+		fmt.Fprintf(os.Stderr, "retry failed servers with `lscp --retry-failed-from %s`\n", path)
+	}
+}
+
+// printSummary print table of results to stderr.
+func (r *RunScp) printSummary() {
+	t := &list.Table{
+		Title:  "lscp summary",
+		Header: []string{"ServerName", "Mode", "Status", "Attempts", "Duration", "Error"},
+	}
+	count := map[string]int{}
+	for _, result := range r.results {
+		count[result.Status]++
+		duration := time.Duration(result.Duration * float64(time.Second)).Round(time.Millisecond)
+		t.Rows = append(t.Rows, list.TableRow{
+			Cells: []string{result.Server, result.Mode, result.Status, fmt.Sprint(result.Attempts), duration.String(), result.Error},
+		})
+	}
+	fmt.Fprintln(os.Stderr, "------------------------------")
+	t.Print(os.Stderr)
+	if count["interrupted"] > 0 {
+		fmt.Fprintf(os.Stderr, "succeeded %d, failed %d, interrupted %d.\n", count["ok"], count["failed"], count["interrupted"])
+		return
+	}
+	fmt.Fprintf(os.Stderr, "succeeded %d, failed %d.\n", count["ok"], count["failed"])
+}
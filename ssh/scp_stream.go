@@ -0,0 +1,180 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// STDIO_PATH is local path of lscp, that read from stdin (from) or write to stdout (to).
+const STDIO_PATH = "-"
+
+// isStdin return true if r read from local stdin.
+func (r *RunScp) isStdin() bool {
+	return !r.From.IsRemote && len(r.From.Path) == 1 && r.From.Path[0] == STDIO_PATH
+}
+
+// isStdout return true if r write to local stdout.
+func (r *RunScp) isStdout() bool {
+	return !r.To.IsRemote && len(r.To.Path) == 1 && r.To.Path[0] == STDIO_PATH
+}
+
+// pushStdin write local stdin to to path of all to servers at the same time.
+// If writing to a server failed, others are continued.
+func (r *RunScp) pushStdin(ctx context.Context, authMap map[AuthKey][]ssh.Signer) {
+	fanout := &stdinFanout{}
+	sessions := map[*scpTransfer]*ssh.Session{}
+
+	for _, target := range r.To.Server {
+		t, ok := r.beginTransfer("push", target)
+		if !ok {
+			return
+		}
+
+		session, stdin, err := r.startStdinSession(ctx, t, authMap)
+		if err != nil {
+			r.endTransfer(t, err)
+			continue
+		}
+		defer session.Close()
+
+		fanout.add(target, stdin)
+		sessions[t] = session
+	}
+
+	if len(sessions) == 0 {
+		return
+	}
+
+	// stdin may not be closed, so stop reading at ctx done
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(fanout, os.Stdin)
+		copied <- err
+	}()
+	select {
+	case err := <-copied:
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cannot read stdin, %v\n", err)
+		}
+		fanout.Close()
+	case <-ctx.Done():
+		return
+	}
+
+	var wg sync.WaitGroup
+	for t, session := range sessions {
+		wg.Add(1)
+		go func(t *scpTransfer, session *ssh.Session) {
+			defer wg.Done()
+
+			err := session.Wait()
+			if err != nil {
+				err = fmt.Errorf("failed to write %s, %v", r.To.Path[0], err)
+			}
+			r.endTransfer(t, err)
+		}(t, session)
+	}
+	wg.Wait()
+}
+
+// startStdinSession connect to target of t, and start `cat` to write stdin to to path.
+func (r *RunScp) startStdinSession(ctx context.Context, t *scpTransfer, authMap map[AuthKey][]ssh.Signer) (session *ssh.Session, stdin io.WriteCloser, err error) {
+	con := &Connect{Server: t.Target, Conf: r.Config, AuthMap: authMap}
+	session, err = con.CreateSessionContext(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot connect %v, %v", t.Target, err)
+	}
+	if err = r.setTransferConn(t, con); err != nil {
+		return nil, nil, err
+	}
+
+	if stdin, err = session.StdinPipe(); err == nil {
+		session.Stderr = os.Stderr
+		err = session.Start("sh -c " + shellQuote("cat > "+r.To.Path[0]))
+	}
+	if err != nil {
+		session.Close()
+		return nil, nil, err
+	}
+	return
+}
+
+// pullStdout write remote files to local stdout. Files of from servers are written in order of servers.
+func (r *RunScp) pullStdout(ctx context.Context, authMap map[AuthKey][]ssh.Signer) {
+	for _, target := range r.From.Server {
+		if ctx.Err() != nil {
+			return
+		}
+		con := &Connect{Server: target, Conf: r.Config, AuthMap: authMap}
+		if err := con.CreateClientContext(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot connect %v, %v \n", target, err)
+			continue
+		}
+
+		fromPaths, err := con.expandRemoteGlob(r.From.Path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", target, err)
+			continue
+		}
+
+		session, err := con.CreateSession()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cannot connect %v, %v \n", target, err)
+			con.Client.Close()
+			continue
+		}
+
+		session.Stdout = os.Stdout
+		session.Stderr = os.Stderr
+		err = runSessionContext(ctx, session, "sh -c "+shellQuote("cat "+strings.Join(fromPaths, " ")))
+		session.Close()
+		con.Client.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: failed to read %s, %v\n", target, strings.Join(r.From.Path, " "), err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%v(pull) is finished.\n", target)
+	}
+}
+
+// stdinFanout write data to all writers. Failed writer is removed, and others are continued.
+type stdinFanout struct {
+	names   []string
+	writers []io.WriteCloser
+}
+
+func (f *stdinFanout) add(name string, w io.WriteCloser) {
+	f.names = append(f.names, name)
+	f.writers = append(f.writers, w)
+}
+
+func (f *stdinFanout) Write(p []byte) (n int, err error) {
+	for i := 0; i < len(f.writers); i++ {
+		if _, err := f.writers[i].Write(p); err != nil {
+			fmt.Fprintf(os.Stderr, "%v: cannot write, %v\n", f.names[i], err)
+			f.writers[i].Close()
+			f.names = append(f.names[:i], f.names[i+1:]...)
+			f.writers = append(f.writers[:i], f.writers[i+1:]...)
+			i--
+		}
+	}
+
+	// stop reading stdin, if all writers are failed
+	if len(f.writers) == 0 {
+		return 0, fmt.Errorf("no server to write")
+	}
+	return len(p), nil
+}
+
+// Close close all writers. (send EOF to remote)
+func (f *stdinFanout) Close() {
+	for _, w := range f.writers {
+		w.Close()
+	}
+}
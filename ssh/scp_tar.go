@@ -0,0 +1,334 @@
+package ssh
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// compression of tar stream (lscp --tar-compress)
+const (
+	TAR_COMPRESS_NONE = ""
+	TAR_COMPRESS_GZIP = "gzip"
+	TAR_COMPRESS_ZSTD = "zstd"
+)
+
+// tarCompressCommands is remote commands to compress and decompress tar stream.
+var tarCompressCommands = map[string][2]string{
+	TAR_COMPRESS_NONE: {"cat", "cat"},
+	TAR_COMPRESS_GZIP: {"gzip -c", "gzip -dc"},
+	TAR_COMPRESS_ZSTD: {"zstd -q -c", "zstd -q -dc"},
+}
+
+// IsTarCompress return true if compress is supported compression of tar stream.
+func IsTarCompress(compress string) bool {
+	_, ok := tarCompressCommands[compress]
+	return ok
+}
+
+// pushTar stream local files as tar to remote `tar xf -`, and extract them at to path (directory).
+// It is much faster than scp for directory trees with many small files.
+func (r *RunScp) pushTar(con *Connect) (err error) {
+	session, err := con.CreateSession()
+	if err != nil {
+		return
+	}
+	defer session.Close()
+
+	tarOpt := "xf"
+	if r.Permission {
+		tarOpt = "xpf"
+	}
+	script := `t=` + r.To.Path[0] + `; mkdir -p "$t" && cd "$t" && ` + tarCompressCommands[r.TarCompress][1] + ` | tar ` + tarOpt + ` -`
+
+	pr, pw := io.Pipe()
+	session.Stdin = pr
+	stderr := new(bytes.Buffer)
+	session.Stderr = stderr
+
+	type result struct {
+		count int
+		err   error
+	}
+	finished := make(chan result, 1)
+	go func() {
+		count, err := r.writeTar(pw)
+		pw.CloseWithError(err)
+		finished <- result{count, err}
+	}()
+
+	err = session.Run("sh -c " + shellQuote(script))
+	pr.Close()
+	written := <-finished
+	switch {
+	case err != nil:
+		return fmt.Errorf("%v %s", err, strings.TrimSpace(stderr.String()))
+	case written.err != nil:
+		return written.err
+	}
+
+	fmt.Fprintf(r.stderr(), "%v: %d files sent with tar.\n", con.Server, written.count)
+	return
+}
+
+// writeTar write local from paths as compressed tar to w, and return number of files.
+// Files are put by base name of from path. (ex. `/path/to/dir/a` => `dir/a`)
+func (r *RunScp) writeTar(w io.Writer) (count int, err error) {
+	cw, err := tarCompressWriter(w, r.TarCompress)
+	if err != nil {
+		return
+	}
+	tw := tar.NewWriter(cw)
+
+	for _, from := range r.From.Path {
+		base := filepath.Dir(from)
+		err = filepath.Walk(from, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, _ := filepath.Rel(base, p)
+			if info.IsDir() {
+				// directory entry is written if all files are copied, to keep permission of it.
+				if !matchScpFilter(rel, nil, r.Exclude) {
+					return filepath.SkipDir
+				}
+				if len(r.Include) > 0 {
+					return nil
+				}
+			} else if !matchScpFilter(rel, r.Include, r.Exclude) {
+				return nil
+			}
+
+			link := ""
+			if info.Mode()&os.ModeSymlink != 0 {
+				if link, err = os.Readlink(p); err != nil {
+					return err
+				}
+			}
+
+			header, err := tar.FileInfoHeader(info, link)
+			if err != nil {
+				return err
+			}
+			header.Name = filepath.ToSlash(rel)
+			if err = tw.WriteHeader(header); err != nil {
+				return err
+			}
+
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			count++
+
+			file, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			_, err = io.Copy(tw, file)
+			return err
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return
+	}
+	err = cw.Close()
+	return
+}
+
+// pullTar stream remote from paths as tar from remote `tar cf -`, and extract them at local toPath (directory).
+// Include and exclude patterns are applied at extracting.
+func (r *RunScp) pullTar(con *Connect, fromPaths []string, toPath string) (err error) {
+	session, err := con.CreateSession()
+	if err != nil {
+		return
+	}
+	defer session.Close()
+
+	// `tar cf - -C <dir> <base>...`
+	script := `set --; for p in ` + strings.Join(fromPaths, " ") + `; do set -- "$@" -C "$(dirname "$p")" "$(basename "$p")"; done; ` +
+		`tar cf - "$@" | ` + tarCompressCommands[r.TarCompress][0]
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return
+	}
+	stderr := new(bytes.Buffer)
+	session.Stderr = stderr
+	if err = session.Start("sh -c " + shellQuote(script)); err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(toPath, 0755); err != nil {
+		return
+	}
+	count, err := r.readTar(stdout, toPath)
+	if err != nil {
+		return
+	}
+
+	if err = session.Wait(); err != nil {
+		return fmt.Errorf("%v %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	fmt.Fprintf(r.stderr(), "%v: %d files received with tar.\n", con.Server, count)
+	return
+}
+
+// readTar extract compressed tar read from rd to toPath, and return number of files.
+func (r *RunScp) readTar(rd io.Reader, toPath string) (count int, err error) {
+	cr, err := tarDecompressReader(rd, r.TarCompress)
+	if err != nil {
+		return
+	}
+	defer cr.Close()
+	tr := tar.NewReader(cr)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+
+		// entries out of toPath are not extracted. (ex. `../a`, `/etc/passwd`)
+		name := path.Clean(header.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return count, fmt.Errorf("invalid path in tar: %s", header.Name)
+		}
+
+		isDir := header.Typeflag == tar.TypeDir
+		if !matchScpFilter(name, nil, r.Exclude) || (!isDir && !matchScpFilter(name, r.Include, nil)) {
+			continue
+		}
+		local := filepath.Join(toPath, filepath.FromSlash(name))
+		mode := os.FileMode(header.Mode).Perm()
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(local, mode|0700)
+		case tar.TypeReg, tar.TypeRegA:
+			count++
+			err = extractTarFile(tr, local, mode)
+		case tar.TypeSymlink:
+			os.MkdirAll(filepath.Dir(local), 0755)
+			os.Remove(local)
+			err = os.Symlink(header.Linkname, local)
+		default:
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+
+		if r.Permission && header.Typeflag != tar.TypeSymlink {
+			os.Chmod(local, mode)
+			os.Chtimes(local, header.ModTime, header.ModTime)
+		}
+	}
+
+	return
+}
+
+// extractTarFile write data of tar entry to local file.
+func extractTarFile(r io.Reader, local string, mode os.FileMode) (err error) {
+	if err = os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(local, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(file, r); err != nil {
+		file.Close()
+		return
+	}
+	return file.Close()
+}
+
+// tarCompressWriter return writer that compress data to w. zstd use local zstd command.
+func tarCompressWriter(w io.Writer, compress string) (io.WriteCloser, error) {
+	switch compress {
+	case TAR_COMPRESS_GZIP:
+		return gzip.NewWriter(w), nil
+	case TAR_COMPRESS_ZSTD:
+		cmd := exec.Command("zstd", "-q", "-c")
+		cmd.Stdout = w
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err = cmd.Start(); err != nil {
+			return nil, fmt.Errorf("cannot run local zstd, %v", err)
+		}
+		return &tarCommandWriter{WriteCloser: stdin, cmd: cmd}, nil
+	}
+	return nopWriteCloser{w}, nil
+}
+
+// tarDecompressReader return reader that decompress data read from r. zstd use local zstd command.
+func tarDecompressReader(r io.Reader, compress string) (io.ReadCloser, error) {
+	switch compress {
+	case TAR_COMPRESS_GZIP:
+		return gzip.NewReader(r)
+	case TAR_COMPRESS_ZSTD:
+		cmd := exec.Command("zstd", "-q", "-dc")
+		cmd.Stdin = r
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err = cmd.Start(); err != nil {
+			return nil, fmt.Errorf("cannot run local zstd, %v", err)
+		}
+		return &tarCommandReader{ReadCloser: stdout, cmd: cmd}, nil
+	}
+	return ioutil.NopCloser(r), nil
+}
+
+// tarCommandWriter is stdin of local compress command. Close wait for end of command.
+type tarCommandWriter struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (w *tarCommandWriter) Close() error {
+	w.WriteCloser.Close()
+	return w.cmd.Wait()
+}
+
+// tarCommandReader is stdout of local decompress command. Close wait for end of command.
+type tarCommandReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r *tarCommandReader) Close() error {
+	// read rest of output, so that command can exit.
+	io.Copy(ioutil.Discard, r.ReadCloser)
+	return r.cmd.Wait()
+}
+
+// nopWriteCloser is io.WriteCloser that Close do nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,189 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	scplib "github.com/blacknon/go-scplib"
+)
+
+// scpVerifyRetry is max count to transfer again, if checksum is mismatched.
+const scpVerifyRetry = 3
+
+// scpVerifyFile is pair of local and remote path of transferred file.
+type scpVerifyFile struct {
+	Local  string
+	Remote string
+}
+
+// verify compare sha256 checksum of local and remote files after transfer (end-to-end),
+// and transfer mismatched files again. Directories and remote to remote copy are not verified.
+// It return error if checksum is still mismatched after retries.
+func (r *RunScp) verify(con *Connect, target, mode string, fromPaths []string) error {
+	files, err := r.verifyFiles(con, target, mode, fromPaths)
+	if err != nil {
+		fmt.Fprintf(r.stderr(), "%v: cannot verify checksum, %v\n", target, err)
+		return nil
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	helper, _ := con.DeployHelper()
+
+	for i := 0; ; i++ {
+		mismatch, err := verifyChecksum(con, helper, files)
+		if err != nil {
+			fmt.Fprintf(r.stderr(), "%v: cannot verify checksum, %v\n", target, err)
+			return nil
+		}
+
+		if len(mismatch) == 0 {
+			fmt.Fprintf(r.stderr(), "%v: checksum verified (%d files).\n", target, len(files))
+			return nil
+		}
+
+		for _, f := range mismatch {
+			fmt.Fprintf(r.stderr(), "%v: checksum mismatch %s\n", target, f.Remote)
+		}
+		if i >= scpVerifyRetry {
+			return fmt.Errorf("checksum mismatch after %d retries", scpVerifyRetry)
+		}
+
+		// transfer mismatched files again
+		fmt.Fprintf(r.stderr(), "%v: transfer again (%d/%d)\n", target, i+1, scpVerifyRetry)
+		scp := &scplib.SCPClient{Connection: con.Client, Permission: r.Permission}
+		for _, f := range mismatch {
+			switch mode {
+			case "push":
+				err = scp.PutFile([]string{f.Local}, shellQuote(f.Remote))
+			case "pull":
+				err = scp.GetFile([]string{shellQuote(f.Remote)}, f.Local)
+			}
+			if err != nil {
+				fmt.Fprintf(r.stderr(), "Failed to run %v \n", err)
+			}
+		}
+		files = mismatch
+	}
+}
+
+// verifyFiles return transferred regular files of target. fromPaths is remote paths expanded at target (pull).
+func (r *RunScp) verifyFiles(con *Connect, target, mode string, fromPaths []string) (files []scpVerifyFile, err error) {
+	switch mode {
+	case "push":
+		// resolve remote path at remote (to path may be directory)
+		locals := []string{}
+		script := ""
+		for _, local := range r.From.Path {
+			if info, err := os.Stat(local); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+
+			locals = append(locals, local)
+			script += `t=` + r.To.Path[0] + `; if [ -d "$t" ]; then t="$t"/` + shellQuote(filepath.Base(local)) + `; fi; printf '%s\n' "$t"; `
+		}
+		if len(locals) == 0 {
+			return
+		}
+
+		output, err := con.runRemoteShell(script, nil)
+		if err != nil {
+			return nil, err
+		}
+		remotes := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+		if len(remotes) != len(locals) {
+			return nil, fmt.Errorf("cannot resolve remote path")
+		}
+
+		for i := range locals {
+			files = append(files, scpVerifyFile{Local: locals[i], Remote: remotes[i]})
+		}
+
+	case "pull":
+		// remote regular files
+		script := ""
+		for _, remote := range fromPaths {
+			script += `f=` + remote + `; if [ -f "$f" ]; then printf '%s\n' "$f"; fi; `
+		}
+
+		output, err := con.runRemoteShell(script, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		toPath := serversDirPath(target, r.From.Server, r.To.Path[0])
+		for _, remote := range strings.Split(string(output), "\n") {
+			if remote == "" {
+				continue
+			}
+
+			local := toPath
+			if info, err := os.Stat(toPath); err == nil && info.IsDir() {
+				local = filepath.Join(toPath, filepath.Base(remote))
+			}
+			files = append(files, scpVerifyFile{Local: local, Remote: remote})
+		}
+	}
+
+	return
+}
+
+// verifyChecksum return files that sha256 checksum of local and remote is mismatched.
+func verifyChecksum(con *Connect, helper *RemoteHelper, files []scpVerifyFile) (mismatch []scpVerifyFile, err error) {
+	remotes := []string{}
+	for _, f := range files {
+		remotes = append(remotes, f.Remote)
+	}
+
+	session, err := con.CreateSession()
+	if err != nil {
+		return
+	}
+	output, err := session.Output(helper.Command("sha256", remotes...))
+	session.Close()
+	if err != nil {
+		return
+	}
+
+	// output format: `<hash>  <path>` (same as sha256sum)
+	remoteSums := []string{}
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	for sc.Scan() {
+		remoteSums = append(remoteSums, strings.SplitN(sc.Text(), " ", 2)[0])
+	}
+	if len(remoteSums) != len(files) {
+		return nil, fmt.Errorf("cannot get remote checksum")
+	}
+
+	for i, f := range files {
+		localSum, err := fileSha256(f.Local)
+		if err != nil || localSum != remoteSums[i] {
+			mismatch = append(mismatch, f)
+		}
+	}
+
+	return
+}
+
+// fileSha256 return sha256 checksum of local file as hex string.
+func fileSha256(path string) (sum string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, file); err != nil {
+		return
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
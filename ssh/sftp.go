@@ -0,0 +1,450 @@
+package ssh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sftp packet types and status code. (SFTP version 3, draft-ietf-secsh-filexfer-02)
+const (
+	sshFxpInit     = 1
+	sshFxpVersion  = 2
+	sshFxpOpen     = 3
+	sshFxpClose    = 4
+	sshFxpRead     = 5
+	sshFxpWrite    = 6
+	sshFxpOpendir  = 11
+	sshFxpReaddir  = 12
+	sshFxpMkdir    = 14
+	sshFxpRealpath = 16
+	sshFxpStat     = 17
+	sshFxpStatus   = 101
+	sshFxpHandle   = 102
+	sshFxpData     = 103
+	sshFxpName     = 104
+	sshFxpAttrs    = 105
+
+	sshFxOK  = 0
+	sshFxEOF = 1
+)
+
+// sftp open flags.
+const (
+	sshFxfRead  = 0x00000001
+	sshFxfWrite = 0x00000002
+	sshFxfCreat = 0x00000008
+	sshFxfTrunc = 0x00000010
+)
+
+// sftp file attribute flags.
+const (
+	sshFileXferAttrSize        = 0x00000001
+	sshFileXferAttrUIDGID      = 0x00000002
+	sshFileXferAttrPermissions = 0x00000004
+	sshFileXferAttrACModTime   = 0x00000008
+	sshFileXferAttrExtended    = 0x80000000
+)
+
+// sftpMaxPacket is max length of sftp packet to read.
+const sftpMaxPacket = 256 * 1024
+
+// sftpChunkSize is length of data of a read/write request.
+const sftpChunkSize = 32 * 1024
+
+// sftpClient is minimal sftp client, that can read directory and read/write file.
+// It is used where exec channel is not needed (or not available), ex) completion of remote path.
+type sftpClient struct {
+	session *ssh.Session
+	w       io.WriteCloser
+	r       io.Reader
+	id      uint32
+}
+
+// sftpEntry is an entry of remote directory.
+type sftpEntry struct {
+	Name string
+	Mode os.FileMode // only type bits (directory, symlink) and permission
+}
+
+// newSftpClient open sftp subsystem on client.
+func newSftpClient(client *ssh.Client) (s *sftpClient, err error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return
+	}
+
+	s = &sftpClient{session: session}
+	if s.w, err = session.StdinPipe(); err == nil {
+		s.r, err = session.StdoutPipe()
+	}
+	if err == nil {
+		err = session.RequestSubsystem("sftp")
+	}
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	// version 3
+	if err = s.send(sshFxpInit, uint32(3)); err != nil {
+		s.Close()
+		return nil, err
+	}
+	typ, _, err := s.recv()
+	if err == nil && typ != sshFxpVersion {
+		err = fmt.Errorf("unexpected sftp packet type %d", typ)
+	}
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close close sftp session.
+func (s *sftpClient) Close() error {
+	s.w.Close()
+	return s.session.Close()
+}
+
+// ReadDir return entries of remote directory dir, without `.` and `..`.
+// Relative dir is relative to login directory.
+func (s *sftpClient) ReadDir(dir string) (entries []sftpEntry, err error) {
+	data, err := s.request(sshFxpOpendir, sshFxpHandle, dir)
+	if err != nil {
+		return
+	}
+	handle, _, err := sftpString(data)
+	if err != nil {
+		return
+	}
+	defer s.request(sshFxpClose, sshFxpStatus, handle)
+
+	for {
+		data, err = s.request(sshFxpReaddir, sshFxpName, handle)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return
+		}
+
+		var count uint32
+		if count, data, err = sftpUint32(data); err != nil {
+			return
+		}
+		for i := uint32(0); i < count; i++ {
+			var e sftpEntry
+			if e.Name, data, err = sftpString(data); err != nil {
+				return
+			}
+			if _, data, err = sftpString(data); err != nil { // longname
+				return
+			}
+			if e.Mode, data, err = sftpAttrsMode(data); err != nil {
+				return
+			}
+
+			if e.Name != "." && e.Name != ".." {
+				entries = append(entries, e)
+			}
+		}
+	}
+}
+
+// Stat return mode of remote path. Symbolic link is followed.
+func (s *sftpClient) Stat(path string) (mode os.FileMode, err error) {
+	data, err := s.request(sshFxpStat, sshFxpAttrs, path)
+	if err != nil {
+		return
+	}
+	mode, _, err = sftpAttrsMode(data)
+	return
+}
+
+// RealPath return absolute path of remote path. Relative path is relative to login directory.
+func (s *sftpClient) RealPath(path string) (realPath string, err error) {
+	data, err := s.request(sshFxpRealpath, sshFxpName, path)
+	if err != nil {
+		return
+	}
+
+	count, data, err := sftpUint32(data)
+	if err == nil && count != 1 {
+		err = fmt.Errorf("unexpected sftp name count %d", count)
+	}
+	if err != nil {
+		return
+	}
+	realPath, _, err = sftpString(data)
+	return
+}
+
+// Mkdir create remote directory with permission perm.
+func (s *sftpClient) Mkdir(path string, perm os.FileMode) (err error) {
+	_, err = s.request(sshFxpMkdir, sshFxpStatus, path, uint32(sshFileXferAttrPermissions), uint32(perm.Perm()))
+	return
+}
+
+// Upload copy local file to remote path (created or truncated, with permission of local file).
+// It return number of copied bytes.
+func (s *sftpClient) Upload(local, remote string) (n int64, err error) {
+	f, err := os.Open(local)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	if !info.Mode().IsRegular() {
+		return 0, fmt.Errorf("%s: not a regular file", local)
+	}
+
+	handle, err := s.open(remote, sshFxfWrite|sshFxfCreat|sshFxfTrunc, info.Mode().Perm())
+	if err != nil {
+		return
+	}
+	defer s.request(sshFxpClose, sshFxpStatus, handle)
+
+	buf := make([]byte, sftpChunkSize)
+	for {
+		l, rerr := f.Read(buf)
+		if l > 0 {
+			if _, err = s.request(sshFxpWrite, sshFxpStatus, handle, uint64(n), string(buf[:l])); err != nil {
+				return
+			}
+			n += int64(l)
+		}
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// Download copy remote file to local path (created or truncated).
+// It return number of copied bytes.
+func (s *sftpClient) Download(remote, local string) (n int64, err error) {
+	handle, err := s.open(remote, sshFxfRead, 0)
+	if err != nil {
+		return
+	}
+	defer s.request(sshFxpClose, sshFxpStatus, handle)
+
+	f, err := os.OpenFile(local, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	for {
+		data, err := s.request(sshFxpRead, sshFxpData, handle, uint64(n), uint32(sftpChunkSize))
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		chunk, _, err := sftpString(data)
+		if err != nil {
+			return n, err
+		}
+		if _, err = f.WriteString(chunk); err != nil {
+			return n, err
+		}
+		n += int64(len(chunk))
+	}
+}
+
+// open open remote file with pflags, and return handle. If perm is not 0, it is set to created file.
+func (s *sftpClient) open(path string, pflags uint32, perm os.FileMode) (handle string, err error) {
+	attrs := []interface{}{uint32(0)}
+	if perm != 0 {
+		attrs = []interface{}{uint32(sshFileXferAttrPermissions), uint32(perm)}
+	}
+
+	data, err := s.request(sshFxpOpen, sshFxpHandle, append([]interface{}{path, pflags}, attrs...)...)
+	if err != nil {
+		return
+	}
+	handle, _, err = sftpString(data)
+	return
+}
+
+// request send packet of typ with new request id and fields, and return payload of response (after request id).
+// If response is status, it is returned as error. (nil, if ok. io.EOF, if end of file)
+func (s *sftpClient) request(typ byte, expect byte, fields ...interface{}) (data []byte, err error) {
+	s.id++
+	id := s.id
+	if err = s.send(typ, append([]interface{}{id}, fields...)...); err != nil {
+		return
+	}
+
+	respType, data, err := s.recv()
+	if err != nil {
+		return
+	}
+	respID, data, err := sftpUint32(data)
+	if err != nil {
+		return
+	}
+	if respID != id {
+		return nil, fmt.Errorf("unexpected sftp request id %d", respID)
+	}
+
+	switch respType {
+	case sshFxpStatus:
+		code, data, err := sftpUint32(data)
+		if err != nil {
+			return nil, err
+		}
+		switch code {
+		case sshFxOK:
+			return nil, nil
+		case sshFxEOF:
+			return nil, io.EOF
+		}
+		msg, _, _ := sftpString(data)
+		return nil, fmt.Errorf("sftp: %s (code %d)", msg, code)
+	case expect:
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unexpected sftp packet type %d", respType)
+	}
+}
+
+// send write sftp packet. fields are uint32, uint64 or string.
+func (s *sftpClient) send(typ byte, fields ...interface{}) error {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(typ)
+	for _, f := range fields {
+		switch v := f.(type) {
+		case uint32, uint64:
+			binary.Write(buf, binary.BigEndian, v)
+		case string:
+			binary.Write(buf, binary.BigEndian, uint32(len(v)))
+			buf.WriteString(v)
+		}
+	}
+
+	packet := make([]byte, 4, 4+buf.Len())
+	binary.BigEndian.PutUint32(packet, uint32(buf.Len()))
+	_, err := s.w.Write(append(packet, buf.Bytes()...))
+	return err
+}
+
+// recv read sftp packet, and return type and payload.
+func (s *sftpClient) recv() (typ byte, data []byte, err error) {
+	var length uint32
+	if err = binary.Read(s.r, binary.BigEndian, &length); err != nil {
+		return
+	}
+	if length == 0 || length > sftpMaxPacket {
+		return 0, nil, fmt.Errorf("invalid sftp packet length %d", length)
+	}
+
+	data = make([]byte, length)
+	if _, err = io.ReadFull(s.r, data); err != nil {
+		return
+	}
+	return data[0], data[1:], nil
+}
+
+var errSftpShortPacket = errors.New("sftp packet too short")
+
+// sftpUint32 return uint32 at head of data, and rest.
+func sftpUint32(data []byte) (uint32, []byte, error) {
+	if len(data) < 4 {
+		return 0, nil, errSftpShortPacket
+	}
+	return binary.BigEndian.Uint32(data), data[4:], nil
+}
+
+// sftpString return string at head of data, and rest.
+func sftpString(data []byte) (string, []byte, error) {
+	n, data, err := sftpUint32(data)
+	if err != nil {
+		return "", nil, err
+	}
+	if uint32(len(data)) < n {
+		return "", nil, errSftpShortPacket
+	}
+	return string(data[:n]), data[n:], nil
+}
+
+// sftpAttrsMode return file mode of ATTRS at head of data, and rest.
+func sftpAttrsMode(data []byte) (mode os.FileMode, rest []byte, err error) {
+	flags, data, err := sftpUint32(data)
+	if err != nil {
+		return
+	}
+
+	skip := func(n int) error {
+		if len(data) < n {
+			return errSftpShortPacket
+		}
+		data = data[n:]
+		return nil
+	}
+
+	if flags&sshFileXferAttrSize != 0 {
+		if err = skip(8); err != nil {
+			return
+		}
+	}
+	if flags&sshFileXferAttrUIDGID != 0 {
+		if err = skip(8); err != nil {
+			return
+		}
+	}
+	if flags&sshFileXferAttrPermissions != 0 {
+		var perm uint32
+		if perm, data, err = sftpUint32(data); err != nil {
+			return
+		}
+		mode = sftpFileMode(perm)
+	}
+	if flags&sshFileXferAttrACModTime != 0 {
+		if err = skip(8); err != nil {
+			return
+		}
+	}
+	if flags&sshFileXferAttrExtended != 0 {
+		var count uint32
+		if count, data, err = sftpUint32(data); err != nil {
+			return
+		}
+		for i := uint32(0); i < count*2; i++ {
+			if _, data, err = sftpString(data); err != nil {
+				return
+			}
+		}
+	}
+
+	return mode, data, nil
+}
+
+// sftpFileMode convert posix mode bits of sftp to os.FileMode. (directory and symlink only)
+func sftpFileMode(perm uint32) os.FileMode {
+	mode := os.FileMode(perm & 0777)
+	switch perm & 0170000 {
+	case 0040000:
+		mode |= os.ModeDir
+	case 0120000:
+		mode |= os.ModeSymlink
+	}
+	return mode
+}
@@ -0,0 +1,200 @@
+package ssh
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sftp packets are recorded from sftp server of github.com/pkg/sftp (after SSH_FXP_INIT/VERSION).
+// server directory:
+//
+//	dir/file.txt ... "hello\n" (0644)
+//	dir/link     ... symlink to file.txt
+//	dir/sub/     ... directory (0755)
+var sftpRecords = map[string]struct {
+	sent string // packets sent by sftpClient
+	recv string // packets sent by server
+}{
+	"realpath": {
+		sent: "0000000c100000000100000003646972",
+		recv: "00000037680000000100000001000000112f746d702f73667470726f6f742f646972000000112f746d702f73667470726f6f742f64697200000000",
+	},
+	"readdir": {
+		sent: "0000000c0b00000001000000036469720000000a0c0000000200000001310000000a0c0000000300000001310000000a04000000040000000131",
+		recv: "0000000a66000000010000000131000001446800000002000000030000000866696c652e7478740000003f2d72772d722d2d722d2d202020203120726f6f742020202020726f6f7420202020202020202020202036204a616e20322020323032302066696c652e7478740000000f00000000000000060000000000000000000081a45e0d5da55e0d5da5000000046c696e6b0000003b6c727778727778727778202020203120726f6f742020202020726f6f7420202020202020202020202038204a616e2032202032303230206c696e6b0000000f000000000000000800000000000000000000a1ff5e0d5da55e0d5da5000000037375620000003a64727778722d78722d78202020203220726f6f742020202020726f6f7420202020202020202034303936204a616e2032202032303230207375620000000f00000000000010000000000000000000000041ed5e0d5da55e0d5da50000001465000000030000000100000003454f4600000000000000116500000004000000000000000000000000",
+	},
+	"stat": {
+		sent: "0000001511000000010000000c6469722f66696c652e747874",
+		recv: "0000002569000000010000000f00000000000000060000000000000000000081a45e0d5da55e0d5da5",
+	},
+	"stat missing": {
+		sent: "0000001411000000010000000b6469722f6d697373696e67",
+		recv: "0000003c6500000001000000020000002b73746174206469722f6d697373696e673a206e6f20737563682066696c65206f72206469726563746f727900000000",
+	},
+	"download": {
+		sent: "0000001d03000000010000000c6469722f66696c652e7478740000000100000000000000160500000002000000013100000000000000000000800000000016050000000300000001310000000000000006000080000000000a04000000040000000131",
+		recv: "0000000a660000000100000001310000000f67000000020000000668656c6c6f0a0000001465000000030000000100000003454f4600000000000000116500000004000000000000000000000000",
+	},
+	"upload": {
+		sent: "0000001f03000000010000000a6469722f75702e7478740000001a00000004000001800000001d0600000002000000013100000000000000000000000775706c6f61640a0000000a04000000030000000131",
+		recv: "0000000a66000000010000000131000000116500000002000000000000000000000000000000116500000003000000000000000000000000",
+	},
+	"mkdir": {
+		sent: "0000001b0e000000010000000a6469722f6e657764697200000004000001ed",
+		recv: "000000116500000001000000000000000000000000",
+	},
+}
+
+// newRecordedSftpClient return sftpClient that read recorded packets of name, and buffer of sent packets.
+func newRecordedSftpClient(t *testing.T, name string) (*sftpClient, *bytes.Buffer) {
+	recv, err := hex.DecodeString(sftpRecords[name].recv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := new(bytes.Buffer)
+	return &sftpClient{w: nopWriteCloser{sent}, r: bytes.NewReader(recv)}, sent
+}
+
+func TestSftpClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lssh-sftp-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	upload := filepath.Join(dir, "up.txt")
+	if err = ioutil.WriteFile(upload, []byte("upload\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	download := filepath.Join(dir, "file.txt")
+
+	type TestData struct {
+		desc      string
+		record    string
+		run       func(s *sftpClient) (interface{}, error)
+		expect    interface{}
+		expectErr string
+	}
+	tds := []TestData{
+		{
+			desc:   "RealPath",
+			record: "realpath",
+			run:    func(s *sftpClient) (interface{}, error) { return s.RealPath("dir") },
+			expect: "/tmp/sftproot/dir",
+		},
+		{
+			desc:   "ReadDir",
+			record: "readdir",
+			run:    func(s *sftpClient) (interface{}, error) { return s.ReadDir("dir") },
+			expect: []sftpEntry{
+				{Name: "file.txt", Mode: 0644},
+				{Name: "link", Mode: os.ModeSymlink | 0777},
+				{Name: "sub", Mode: os.ModeDir | 0755},
+			},
+		},
+		{
+			desc:   "Stat",
+			record: "stat",
+			run:    func(s *sftpClient) (interface{}, error) { return s.Stat("dir/file.txt") },
+			expect: os.FileMode(0644),
+		},
+		{
+			desc:      "Stat of missing file",
+			record:    "stat missing",
+			run:       func(s *sftpClient) (interface{}, error) { return s.Stat("dir/missing") },
+			expect:    os.FileMode(0),
+			expectErr: "sftp: stat dir/missing: no such file or directory (code 2)",
+		},
+		{
+			desc:   "Download",
+			record: "download",
+			run:    func(s *sftpClient) (interface{}, error) { return s.Download("dir/file.txt", download) },
+			expect: int64(6),
+		},
+		{
+			desc:   "Upload",
+			record: "upload",
+			run:    func(s *sftpClient) (interface{}, error) { return s.Upload(upload, "dir/up.txt") },
+			expect: int64(7),
+		},
+		{
+			desc:   "Mkdir",
+			record: "mkdir",
+			run:    func(s *sftpClient) (interface{}, error) { return nil, s.Mkdir("dir/newdir", 0755) },
+			expect: nil,
+		},
+	}
+
+	for _, v := range tds {
+		s, sent := newRecordedSftpClient(t, v.record)
+
+		result, err := v.run(s)
+		if v.expectErr != "" {
+			assert.EqualError(t, err, v.expectErr, v.desc)
+		} else {
+			assert.NoError(t, err, v.desc)
+		}
+		assert.Equal(t, v.expect, result, v.desc)
+		assert.Equal(t, sftpRecords[v.record].sent, hex.EncodeToString(sent.Bytes()), v.desc)
+	}
+
+	data, err := ioutil.ReadFile(download)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", string(data))
+}
+
+func TestSftpAttrsMode(t *testing.T) {
+	type TestData struct {
+		desc       string
+		attrs      string // hex
+		expect     os.FileMode
+		expectRest string // hex
+		expectErr  error
+	}
+	tds := []TestData{
+		{
+			desc:   "No attributes",
+			attrs:  "00000000",
+			expect: 0,
+		},
+		{
+			desc:   "Size, uid/gid, permissions and time (regular file)",
+			attrs:  "0000000f00000000000000060000000000000000000081a45e0d5da55e0d5da5",
+			expect: 0644,
+		},
+		{
+			desc:       "Permissions (directory) and extended attribute, with rest",
+			attrs:      "80000004000041ed00000001000000036b65790000000576616c7565" + "ff",
+			expect:     os.ModeDir | 0755,
+			expectRest: "ff",
+		},
+		{
+			desc:      "Short permissions",
+			attrs:     "000000040000",
+			expectErr: errSftpShortPacket,
+		},
+		{
+			desc:      "Short extended attribute",
+			attrs:     "80000000000000010000000a6b6579",
+			expectErr: errSftpShortPacket,
+		},
+	}
+
+	for _, v := range tds {
+		data, _ := hex.DecodeString(v.attrs)
+		mode, rest, err := sftpAttrsMode(data)
+		assert.Equal(t, v.expectErr, err, v.desc)
+		if v.expectErr != nil {
+			continue
+		}
+		assert.Equal(t, v.expect, mode, v.desc)
+		assert.Equal(t, v.expectRest, hex.EncodeToString(rest), v.desc)
+	}
+}
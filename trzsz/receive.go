@@ -0,0 +1,138 @@
+package trzsz
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Receive receive files from remote `tsz`, and save them in directory dir.
+// r is remote output after start sequence (see ReadMode), and w is input to remote.
+// If file exists, it is saved with number suffix (ex. `file.txt.1`), unless remote request overwrite (`tsz -y`).
+// It return paths of saved files.
+func Receive(r io.ByteReader, w io.Writer, dir string, progress Progress) (paths []string, err error) {
+	c := newConn(r, w)
+
+	var f *os.File
+
+	// remove incomplete file
+	defer func() {
+		if f != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	cfg, err := c.start()
+	if err != nil {
+		return nil, c.sendError(err)
+	}
+
+	num, err := c.recvInteger("NUM")
+	if err != nil {
+		return nil, c.sendError(err)
+	}
+	if err = c.sendInteger("SUCC", num); err != nil {
+		return
+	}
+
+	names := []string{}
+	for i := int64(0); i < num; i++ {
+		if f, err = c.receiveFile(dir, cfg.Overwrite, progress); err != nil {
+			return paths, c.sendError(err)
+		}
+		paths = append(paths, f.Name())
+		names = append(names, filepath.Base(f.Name()))
+		f = nil
+	}
+
+	return paths, c.finish(savedMessage(names, dir))
+}
+
+// receiveFile receive a file, and save it in dir. Returned file is closed.
+func (c *conn) receiveFile(dir string, overwrite bool, progress Progress) (f *os.File, err error) {
+	name, err := c.recvString("NAME")
+	if err != nil {
+		return
+	}
+	name = filepath.Base(filepath.FromSlash(name))
+	if f, err = createFile(dir, name, overwrite); err != nil {
+		return nil, err
+	}
+	if err = c.sendString("SUCC", filepath.Base(f.Name())); err != nil {
+		return
+	}
+
+	size, err := c.recvInteger("SIZE")
+	if err != nil {
+		return
+	}
+	if err = c.sendInteger("SUCC", size); err != nil {
+		return
+	}
+
+	hash := md5.New()
+	for n := int64(0); n < size; {
+		s, err := c.recvLine("DATA")
+		if err != nil {
+			return f, err
+		}
+		data, err := decode(s)
+		if err != nil {
+			return f, err
+		}
+
+		if _, err = f.Write(data); err != nil {
+			return f, err
+		}
+		hash.Write(data)
+		n += int64(len(data))
+		if progress != nil {
+			progress(name, n, size)
+		}
+
+		if err = c.sendInteger("SUCC", int64(len(data))); err != nil {
+			return f, err
+		}
+	}
+
+	s, err := c.recvLine("MD5")
+	if err != nil {
+		return
+	}
+	digest, err := decode(s)
+	if err != nil {
+		return
+	}
+	if !bytes.Equal(digest, hash.Sum(nil)) {
+		return f, errors.New("trzsz: check MD5 failed")
+	}
+	if err = c.sendLine("SUCC", s); err != nil {
+		return
+	}
+	return f, f.Close()
+}
+
+// createFile create file name in dir. If it exists, number suffix is added (ex. `file.txt.1`), unless overwrite is true.
+func createFile(dir, name string, overwrite bool) (f *os.File, err error) {
+	if name == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+		return nil, fmt.Errorf("trzsz: invalid file name %q", name)
+	}
+
+	path := filepath.Join(dir, name)
+	if overwrite {
+		return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	}
+	for i := 1; ; i++ {
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) || i > 100 {
+			return
+		}
+		path = filepath.Join(dir, name+"."+strconv.Itoa(i))
+	}
+}
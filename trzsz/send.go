@@ -0,0 +1,126 @@
+package trzsz
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// defaultBufSize is length of data line to send, if remote does not tell it.
+const defaultBufSize = 10 * 1024
+
+// Send send files to remote `trz`. Files are sent with base name.
+// r is remote output after start sequence (see ReadMode), and w is input to remote.
+func Send(r io.ByteReader, w io.Writer, paths []string, progress Progress) (err error) {
+	c := newConn(r, w)
+
+	// check files before start
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			c.sendAction(false)
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			c.sendAction(false)
+			return fmt.Errorf("%s: not a regular file", p)
+		}
+	}
+
+	cfg, err := c.start()
+	if err != nil {
+		return c.sendError(err)
+	}
+
+	bufSize := cfg.BufSize
+	if bufSize <= 0 {
+		bufSize = defaultBufSize
+	}
+	if cfg.MaxBufSize > 0 && bufSize > cfg.MaxBufSize {
+		bufSize = cfg.MaxBufSize
+	}
+
+	if err = c.sendInteger("NUM", int64(len(paths))); err != nil {
+		return
+	}
+	if err = c.checkInteger("SUCC", int64(len(paths))); err != nil {
+		return c.sendError(err)
+	}
+
+	names := []string{}
+	for _, p := range paths {
+		name, err := c.sendFile(p, bufSize, progress)
+		if err != nil {
+			return c.sendError(err)
+		}
+		names = append(names, name)
+	}
+
+	return c.finish(savedMessage(names, ""))
+}
+
+// sendFile send file p, and return name saved at remote.
+func (c *conn) sendFile(p string, bufSize int64, progress Progress) (remoteName string, err error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	size := info.Size()
+	name := filepath.Base(p)
+
+	if err = c.sendString("NAME", name); err != nil {
+		return
+	}
+	if remoteName, err = c.recvString("SUCC"); err != nil {
+		return
+	}
+
+	if err = c.sendInteger("SIZE", size); err != nil {
+		return
+	}
+	if err = c.checkInteger("SUCC", size); err != nil {
+		return
+	}
+
+	hash := md5.New()
+	buf := make([]byte, bufSize)
+	for n := int64(0); n < size; {
+		if size-n < int64(len(buf)) {
+			buf = buf[:size-n]
+		}
+		l, rerr := f.Read(buf)
+		if l == 0 && rerr != nil {
+			if rerr == io.EOF {
+				rerr = fmt.Errorf("%s: file size changed", p)
+			}
+			return remoteName, rerr
+		}
+
+		if err = c.sendLine("DATA", encode(buf[:l])); err != nil {
+			return
+		}
+		if err = c.checkInteger("SUCC", int64(l)); err != nil {
+			return
+		}
+		hash.Write(buf[:l])
+		n += int64(l)
+		if progress != nil {
+			progress(name, n, size)
+		}
+	}
+
+	digest := encode(hash.Sum(nil))
+	if err = c.sendLine("MD5", digest); err != nil {
+		return
+	}
+	_, err = c.recvLine("SUCC")
+	return
+}
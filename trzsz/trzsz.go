@@ -0,0 +1,306 @@
+// Package trzsz implement client side of trzsz file transfer protocol, to transfer files
+// with `tsz` and `trz` at remote, over terminal session.
+//
+// Files are transferred as base64 text lines (binary mode and directories are not supported).
+package trzsz
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// clientVersion is trzsz version told to remote.
+const clientVersion = "1.1.0"
+
+// maxLineLength is max length of line to receive from remote.
+const maxLineLength = 16 * 1024 * 1024
+
+// Mode is transfer mode requested by remote.
+type Mode byte
+
+const (
+	Download  Mode = 'S' // remote `tsz` send files
+	Upload    Mode = 'R' // remote `trz` wait for files
+	UploadDir Mode = 'D' // remote `trz -d` wait for directories
+)
+
+// Progress is called while transferring file name, with transferred bytes n and file size.
+type Progress func(name string, n, size int64)
+
+var errBadMagic = errors.New("trzsz: bad start sequence")
+
+// magicKey is printed by `tsz` and `trz`, to start transfer. `<magicPrefix>::TRZSZ:TRANSFER:<mode>:<version>:<id>`
+var (
+	magicKey    = []byte("::TRZSZ:TRANSFER:")
+	magicPrefix = []byte("\x1b7\x07")
+)
+
+// Detect find start of trzsz transfer in remote output data. If not found, index is -1, and
+// partial is length of incomplete start sequence at the end of data, that may continue at next output.
+// Mode is read from data at index with ReadMode.
+func Detect(data []byte) (index int, partial int) {
+	if i := bytes.Index(data, magicKey); i >= 0 {
+		if bytes.HasSuffix(data[:i], magicPrefix) {
+			i -= len(magicPrefix)
+		}
+		return i, 0
+	}
+
+	for _, key := range [][]byte{append(append([]byte{}, magicPrefix...), magicKey...), magicKey} {
+		for n := len(key) - 1; n > partial; n-- {
+			if n <= len(data) && bytes.HasSuffix(data, key[:n]) {
+				partial = n
+				break
+			}
+		}
+	}
+	return -1, partial
+}
+
+// ReadMode read start sequence line of remote from r, and return transfer mode.
+func ReadMode(r io.ByteReader) (Mode, error) {
+	line, err := (&conn{r: r}).readLine()
+	if err != nil {
+		return 0, err
+	}
+
+	line = bytes.TrimPrefix(line, magicPrefix)
+	if !bytes.HasPrefix(line, magicKey) || len(line) <= len(magicKey) {
+		return 0, errBadMagic
+	}
+
+	switch mode := Mode(line[len(magicKey)]); mode {
+	case Download, Upload, UploadDir:
+		return mode, nil
+	default:
+		return 0, fmt.Errorf("trzsz: unknown mode %q", byte(mode))
+	}
+}
+
+// Cancel reject transfer requested by remote. It is sent after ReadMode.
+func Cancel(w io.Writer) error {
+	return newConn(nil, w).sendAction(false)
+}
+
+// RemoteError is error sent by remote.
+type RemoteError string
+
+func (e RemoteError) Error() string {
+	return "trzsz: remote error: " + string(e)
+}
+
+// action is answer of client to start sequence.
+type action struct {
+	Lang       string `json:"lang"`
+	Version    string `json:"version"`
+	Confirm    bool   `json:"confirm"`
+	Newline    string `json:"newline"`
+	SupportDir bool   `json:"support_dir"`
+}
+
+// config is transfer config of remote.
+type config struct {
+	Binary     bool  `json:"binary"`
+	Directory  bool  `json:"directory"`
+	Overwrite  bool  `json:"overwrite"`
+	BufSize    int64 `json:"bufsize"`
+	MaxBufSize int64 `json:"max_buf_size"`
+}
+
+// conn is connection with remote. Messages are lines of `#<TYPE>:<content>`.
+type conn struct {
+	r io.ByteReader
+	w *bufio.Writer
+}
+
+func newConn(r io.ByteReader, w io.Writer) *conn {
+	return &conn{r: r, w: bufio.NewWriter(w)}
+}
+
+// sendLine send message of typ.
+func (c *conn) sendLine(typ, content string) error {
+	fmt.Fprintf(c.w, "#%s:%s\n", typ, content)
+	return c.w.Flush()
+}
+
+func (c *conn) sendInteger(typ string, n int64) error {
+	return c.sendLine(typ, strconv.FormatInt(n, 10))
+}
+
+func (c *conn) sendString(typ, s string) error {
+	return c.sendLine(typ, encode([]byte(s)))
+}
+
+// sendAction send answer to start sequence.
+func (c *conn) sendAction(confirm bool) error {
+	data, err := json.Marshal(action{
+		Lang:    "go",
+		Version: clientVersion,
+		Confirm: confirm,
+		Newline: "\n",
+	})
+	if err != nil {
+		return err
+	}
+	return c.sendLine("ACT", encode(data))
+}
+
+// sendError tell error to remote, and return err.
+func (c *conn) sendError(err error) error {
+	if _, ok := err.(RemoteError); !ok {
+		c.sendString("FAIL", err.Error())
+	}
+	return err
+}
+
+// readLine read a line from remote, without CR LF.
+func (c *conn) readLine() ([]byte, error) {
+	line := []byte{}
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == '\n' {
+			return bytes.TrimRight(line, "\r"), nil
+		}
+		if len(line) >= maxLineLength {
+			return nil, errors.New("trzsz: line too long")
+		}
+		line = append(line, b)
+	}
+}
+
+// recvLine receive message of typ, and return content of it.
+func (c *conn) recvLine(typ string) (string, error) {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return "", err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		s := string(line)
+		for _, fail := range []string{"#FAIL:", "#fail:"} {
+			if i := strings.LastIndex(s, fail); i >= 0 {
+				msg, _ := decode(s[i+len(fail):])
+				return "", RemoteError(msg)
+			}
+		}
+
+		key := "#" + typ + ":"
+		i := strings.LastIndex(s, key)
+		if i < 0 {
+			return "", fmt.Errorf("trzsz: unexpected message %q (expect %s)", trim(s), typ)
+		}
+		return s[i+len(key):], nil
+	}
+}
+
+func (c *conn) recvInteger(typ string) (int64, error) {
+	s, err := c.recvLine(typ)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func (c *conn) recvString(typ string) (string, error) {
+	s, err := c.recvLine(typ)
+	if err != nil {
+		return "", err
+	}
+	data, err := decode(s)
+	return string(data), err
+}
+
+// checkInteger receive message of typ, and check that it is n.
+func (c *conn) checkInteger(typ string, n int64) error {
+	v, err := c.recvInteger(typ)
+	if err == nil && v != n {
+		err = fmt.Errorf("trzsz: %s %d is not %d", typ, v, n)
+	}
+	return err
+}
+
+// start answer to start sequence, and receive config of remote.
+func (c *conn) start() (cfg config, err error) {
+	if err = c.sendAction(true); err != nil {
+		return
+	}
+
+	s, err := c.recvString("CFG")
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal([]byte(s), &cfg); err != nil {
+		return
+	}
+	if cfg.Binary {
+		return cfg, errors.New("trzsz: binary mode is not supported")
+	}
+	if cfg.Directory {
+		return cfg, errors.New("trzsz: directory transfer is not supported")
+	}
+	return
+}
+
+// finish send message printed by remote at the end of transfer.
+func (c *conn) finish(msg string) error {
+	return c.sendString("EXIT", msg)
+}
+
+// savedMessage return message of saved files.
+func savedMessage(names []string, dir string) string {
+	msg := fmt.Sprintf("Saved %d file(s)", len(names))
+	if dir != "" {
+		msg += " to " + dir
+	}
+	for _, name := range names {
+		msg += "\r\n- " + name
+	}
+	return msg
+}
+
+// encode compress data with zlib, and encode it to base64.
+func encode(data []byte) string {
+	buf := new(bytes.Buffer)
+	w := zlib.NewWriter(buf)
+	w.Write(data)
+	w.Close()
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// decode decode data encoded by encode.
+func decode(s string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// trim shorten s for error message.
+func trim(s string) string {
+	if len(s) > 64 {
+		return s[:64] + "..."
+	}
+	return s
+}
@@ -0,0 +1,256 @@
+package trzsz
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	type TestData struct {
+		desc    string
+		data    string
+		index   int
+		partial int
+	}
+	tds := []TestData{
+		{desc: "tsz", data: "$ tsz a.txt\r\n\x1b7\x07::TRZSZ:TRANSFER:S:1.1.5:1234567890123\r\n", index: 13},
+		{desc: "No prefix", data: "x::TRZSZ:TRANSFER:R:1.1.5:1234567890123\r\n", index: 1},
+		{desc: "Incomplete", data: "$ tsz a.txt\r\n\x1b7\x07::TRZ", index: -1, partial: 8},
+		{desc: "Incomplete key", data: "a ::TRZ", index: -1, partial: 5},
+		{desc: "Text", data: "a::b", index: -1},
+	}
+	for _, v := range tds {
+		index, partial := Detect([]byte(v.data))
+		assert.Equal(t, v.index, index, v.desc)
+		assert.Equal(t, v.partial, partial, v.desc)
+	}
+}
+
+func TestReadMode(t *testing.T) {
+	r := bufio.NewReader(bytesReader("\x1b7\x07::TRZSZ:TRANSFER:R:1.1.5:1234567890123\r\n#CFG:"))
+	mode, err := ReadMode(r)
+	assert.Nil(t, err)
+	assert.Equal(t, Upload, mode)
+
+	// rest is not read
+	rest, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "#CFG:", string(rest))
+
+	_, err = ReadMode(bufio.NewReader(bytesReader("::TRZSZ:TRANSFER:\r\n")))
+	assert.Equal(t, errBadMagic, err)
+}
+
+func TestEncode(t *testing.T) {
+	for _, s := range []string{"", "file.txt", string([]byte{0, 0xff, '\n'})} {
+		data, err := decode(encode([]byte(s)))
+		assert.Nil(t, err)
+		assert.Equal(t, s, string(data))
+	}
+}
+
+func bytesReader(s string) io.Reader {
+	r, w := io.Pipe()
+	go func() {
+		io.WriteString(w, s)
+		w.Close()
+	}()
+	return r
+}
+
+// remote is fake `tsz` and `trz`. It speak to client through pipes, and output lines like terminal (CR LF).
+type remote struct {
+	t   *testing.T
+	in  *bufio.Reader // input from client
+	out io.Writer     // output to client
+	cfg map[string]interface{}
+}
+
+// newRemote return remote, and output reader and input writer of it for client.
+func newRemote(t *testing.T, cfg map[string]interface{}) (*remote, *bufio.Reader, io.Writer) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	return &remote{t: t, in: bufio.NewReader(inR), out: outW, cfg: cfg}, bufio.NewReader(outR), inW
+}
+
+func (r *remote) send(typ, content string) {
+	fmt.Fprintf(r.out, "#%s:%s\r\n", typ, content)
+}
+
+func (r *remote) recv(typ string) string {
+	line, err := r.in.ReadString('\n')
+	assert.Nil(r.t, err)
+	key := "#" + typ + ":"
+	assert.Equal(r.t, key, line[:len(key)])
+	return line[len(key) : len(line)-1]
+}
+
+func (r *remote) recvString(typ string) string {
+	data, err := decode(r.recv(typ))
+	assert.Nil(r.t, err)
+	return string(data)
+}
+
+// start receive action, and send config.
+func (r *remote) start() bool {
+	var act action
+	assert.Nil(r.t, json.Unmarshal([]byte(r.recvString("ACT")), &act))
+	if !act.Confirm {
+		return false
+	}
+	cfg, _ := json.Marshal(r.cfg)
+	r.send("CFG", encode(cfg))
+	return true
+}
+
+// tsz send files.
+func (r *remote) tsz(names []string, contents [][]byte) (saved []string, exit string) {
+	if !r.start() {
+		return
+	}
+	r.send("NUM", strconv.Itoa(len(names)))
+	assert.Equal(r.t, strconv.Itoa(len(names)), r.recv("SUCC"))
+	for i, name := range names {
+		r.send("NAME", encode([]byte(name)))
+		saved = append(saved, r.recvString("SUCC"))
+		r.send("SIZE", strconv.Itoa(len(contents[i])))
+		r.recv("SUCC")
+		for data := contents[i]; len(data) > 0; {
+			n := 1000
+			if n > len(data) {
+				n = len(data)
+			}
+			r.send("DATA", encode(data[:n]))
+			assert.Equal(r.t, strconv.Itoa(n), r.recv("SUCC"))
+			data = data[n:]
+		}
+		sum := md5.Sum(contents[i])
+		r.send("MD5", encode(sum[:]))
+		r.recv("SUCC")
+	}
+	return saved, r.recvString("EXIT")
+}
+
+// trz receive files.
+func (r *remote) trz() (names []string, contents [][]byte, exit string) {
+	if !r.start() {
+		return
+	}
+	num := r.recv("NUM")
+	r.send("SUCC", num)
+	n, _ := strconv.Atoi(num)
+	for i := 0; i < n; i++ {
+		name := r.recvString("NAME")
+		names = append(names, name)
+		r.send("SUCC", encode([]byte(name)))
+		size := r.recv("SIZE")
+		r.send("SUCC", size)
+		l, _ := strconv.Atoi(size)
+		content := []byte{}
+		for len(content) < l {
+			data, err := decode(r.recv("DATA"))
+			assert.Nil(r.t, err)
+			content = append(content, data...)
+			r.send("SUCC", strconv.Itoa(len(data)))
+		}
+		contents = append(contents, content)
+		digest := r.recv("MD5")
+		r.send("SUCC", digest)
+	}
+	return names, contents, r.recvString("EXIT")
+}
+
+func TestReceive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lssh_trzsz")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("exist"), 0644))
+
+	names := []string{"a.txt", "../b.bin", "empty"}
+	contents := [][]byte{[]byte("hello"), make([]byte, 5000), {}}
+	rand.Read(contents[1])
+
+	r, out, in := newRemote(t, map[string]interface{}{"timeout": 20})
+	done := make(chan struct{})
+	go func() {
+		saved, exit := r.tsz(names, contents)
+		assert.Equal(t, []string{"a.txt.1", "b.bin", "empty"}, saved)
+		assert.Equal(t, "Saved 3 file(s) to "+dir+"\r\n- a.txt.1\r\n- b.bin\r\n- empty", exit)
+		close(done)
+	}()
+
+	paths, err := Receive(out, in, dir, nil)
+	assert.Nil(t, err)
+	<-done
+	for i, p := range paths {
+		data, err := ioutil.ReadFile(p)
+		assert.Nil(t, err)
+		assert.Equal(t, contents[i], data)
+	}
+
+	// binary mode is not supported
+	r, out, in = newRemote(t, map[string]interface{}{"binary": true})
+	go func() {
+		r.start()
+		assert.Equal(t, "trzsz: binary mode is not supported", r.recvString("FAIL"))
+	}()
+	_, err = Receive(out, in, dir, nil)
+	assert.NotNil(t, err)
+}
+
+func TestSend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lssh_trzsz")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	paths := []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.bin")}
+	contents := [][]byte{[]byte("hello"), make([]byte, 5000)}
+	rand.Read(contents[1])
+	for i, p := range paths {
+		assert.Nil(t, ioutil.WriteFile(p, contents[i], 0644))
+	}
+
+	r, out, in := newRemote(t, map[string]interface{}{"bufsize": 1024})
+	done := make(chan struct{})
+	go func() {
+		names, received, exit := r.trz()
+		assert.Equal(t, []string{"a.txt", "b.bin"}, names)
+		assert.Equal(t, contents, received)
+		assert.Equal(t, "Saved 2 file(s)\r\n- a.txt\r\n- b.bin", exit)
+		close(done)
+	}()
+
+	var last int64
+	err = Send(out, in, paths, func(name string, n, size int64) { last = n })
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5000), last)
+	<-done
+
+	// not exist file cancel transfer
+	r, out, in = newRemote(t, nil)
+	go func() {
+		assert.False(t, r.start())
+	}()
+	err = Send(out, in, []string{filepath.Join(dir, "none")}, nil)
+	assert.NotNil(t, err)
+
+	// error of remote
+	r, out, in = newRemote(t, nil)
+	go func() {
+		r.start()
+		r.recv("NUM")
+		r.send("FAIL", encode([]byte("no space")))
+	}()
+	err = Send(out, in, paths, nil)
+	assert.Equal(t, RemoteError("no space"), err)
+}
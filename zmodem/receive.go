@@ -0,0 +1,191 @@
+package zmodem
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Receive receive files from remote sender (`sz`), and save them in directory dir.
+// r is remote output from start of session (ZRQINIT), and w is input to remote.
+// File name is base name sent by remote. If file exists, it is saved with number suffix (ex. `file.txt.1`).
+// It return paths of saved files.
+func Receive(r io.ByteReader, w io.Writer, dir string, progress Progress) (paths []string, err error) {
+	c := newConn(r, w)
+
+	var (
+		f    *os.File
+		name string
+		size int64
+		pos  int64
+	)
+
+	// remove incomplete file
+	defer func() {
+		if f != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	for {
+		h, err := c.readHeader()
+		if err != nil {
+			return paths, err
+		}
+
+		switch h.typ {
+		case zrqinit:
+			err = c.writeRinit()
+
+		case zsinit:
+			// attention string is not used
+			if _, _, err = c.readData(); err != nil {
+				err = c.writeHexHeader(header{typ: znak})
+				break
+			}
+			err = c.writeHexHeader(header{typ: zack})
+
+		case zfile:
+			data, _, rerr := c.readData()
+			if rerr != nil {
+				err = c.writeHexHeader(header{typ: znak})
+				break
+			}
+
+			if f != nil {
+				f.Close()
+				os.Remove(f.Name())
+				f = nil
+			}
+
+			var perm os.FileMode
+			name, size, perm = parseFileInfo(data)
+			if f, err = createFile(dir, name, perm); err != nil {
+				f = nil
+				err = c.writeHexHeader(header{typ: zskip})
+				break
+			}
+			pos = 0
+			err = c.writeHexHeader(posHeader(zrpos, pos))
+
+		case zdata:
+			if f == nil {
+				break
+			}
+			if h.pos() != pos {
+				err = c.writeHexHeader(posHeader(zrpos, pos))
+				break
+			}
+			err = c.receiveData(f, &pos, func(n int64) {
+				if progress != nil {
+					progress(name, n, size)
+				}
+			})
+
+		case zeof:
+			if f == nil || h.pos() != pos {
+				break
+			}
+			if err = f.Close(); err != nil {
+				return paths, err
+			}
+			paths = append(paths, f.Name())
+			f = nil
+			err = c.writeRinit()
+
+		case zfin:
+			err = c.writeHexHeader(header{typ: zfin})
+			return paths, err
+
+		case zabort, zcan, zferr:
+			return paths, ErrAborted
+
+		case zcommand:
+			return paths, fmt.Errorf("zmodem: remote command is not supported")
+		}
+
+		if err != nil {
+			return paths, err
+		}
+	}
+}
+
+// writeRinit write ZRINIT header with capability of receiver.
+func (c *conn) writeRinit() error {
+	return c.writeHexHeader(header{typ: zrinit, data: [4]byte{0, 0, 0, canfdx | canovio | canfc32}})
+}
+
+// receiveData read data subpackets after ZDATA header, and write them to f at pos.
+// If subpacket is broken, ZRPOS is sent to resend from pos.
+func (c *conn) receiveData(f *os.File, pos *int64, progress func(n int64)) error {
+	for {
+		data, end, err := c.readData()
+		if err == errBadCRC || err == errBadEscape || err == errTooLong {
+			return c.writeHexHeader(posHeader(zrpos, *pos))
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err = f.Write(data); err != nil {
+			return err
+		}
+		*pos += int64(len(data))
+		progress(*pos)
+
+		switch end {
+		case zcrcq:
+			if err = c.writeHexHeader(posHeader(zack, *pos)); err != nil {
+				return err
+			}
+		case zcrcw:
+			return c.writeHexHeader(posHeader(zack, *pos))
+		case zcrce:
+			return nil
+		}
+	}
+}
+
+// parseFileInfo parse data subpacket of ZFILE. `name NUL length modtime mode ...`
+// Name is base name (without directory). length and mode are optional.
+func parseFileInfo(data []byte) (name string, size int64, perm os.FileMode) {
+	fields := bytes.SplitN(data, []byte{0}, 2)
+	name = filepath.Base(filepath.FromSlash(string(fields[0])))
+
+	perm = 0644
+	if len(fields) < 2 {
+		return
+	}
+
+	info := strings.Fields(string(bytes.TrimRight(fields[1], "\x00")))
+	if len(info) > 0 {
+		size, _ = strconv.ParseInt(info[0], 10, 64)
+	}
+	if len(info) > 2 {
+		if mode, err := strconv.ParseUint(info[2], 8, 32); err == nil && mode&0777 != 0 {
+			perm = os.FileMode(mode & 0777)
+		}
+	}
+	return
+}
+
+// createFile create new file name in dir. If it exists, number suffix is added. (ex. `file.txt.1`)
+func createFile(dir, name string, perm os.FileMode) (f *os.File, err error) {
+	if name == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+		return nil, fmt.Errorf("zmodem: invalid file name %q", name)
+	}
+
+	path := filepath.Join(dir, name)
+	for i := 1; ; i++ {
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if !os.IsExist(err) || i > 100 {
+			return
+		}
+		path = filepath.Join(dir, name+"."+strconv.Itoa(i))
+	}
+}
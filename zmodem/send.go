@@ -0,0 +1,223 @@
+package zmodem
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// subpacketSize is length of data subpacket to send.
+const subpacketSize = 1024
+
+// windowSize is length of data to send before waiting ZACK of receiver. (if receiver buffer is not smaller)
+const windowSize = 64 * 1024
+
+// Send send files to remote receiver (`rz`). Files are sent with base name.
+// r is remote output from start of session (ZRINIT), and w is input to remote.
+// If receiver skip a file (ex. it exists at remote), it is not sent.
+func Send(r io.ByteReader, w io.Writer, paths []string, progress Progress) (err error) {
+	c := newConn(r, w)
+
+	// wait ZRINIT of receiver
+	var h header
+	for h.typ != zrinit {
+		if h, err = c.readHeader(); err != nil {
+			return
+		}
+		switch h.typ {
+		case zchallenge:
+			err = c.writeHexHeader(header{typ: zack, data: h.data})
+		case zabort, zcan, zferr:
+			err = ErrAborted
+		}
+		if err != nil {
+			return
+		}
+	}
+	c.crc32 = h.data[3]&canfc32 != 0
+	c.escctl = h.data[3]&escctl != 0
+
+	window := windowSize
+	if bufSize := int(h.data[0]) | int(h.data[1])<<8; bufSize > 0 && bufSize < window {
+		window = bufSize
+	}
+
+	// remaining bytes of files, for file information
+	var total int64
+	for _, p := range paths {
+		if info, err := os.Stat(p); err == nil {
+			total += info.Size()
+		}
+	}
+
+	for i, p := range paths {
+		size, err := c.sendFile(p, len(paths)-i, total, window, progress)
+		if err != nil {
+			return err
+		}
+		total -= size
+	}
+
+	// finish session
+	if err = c.writeHexHeader(header{typ: zfin}); err != nil {
+		return
+	}
+	for {
+		if h, err = c.readHeader(); err != nil {
+			return
+		}
+		switch h.typ {
+		case zfin:
+			c.w.WriteString("OO")
+			return c.w.Flush()
+		case zrinit, zack:
+			continue
+		}
+		return unexpected(h)
+	}
+}
+
+// sendFile send file p, and return size of it. remain and remainBytes are number and bytes of files not sent yet.
+func (c *conn) sendFile(p string, remain int, remainBytes int64, window int, progress Progress) (size int64, err error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	if !info.Mode().IsRegular() {
+		return 0, fmt.Errorf("%s: not a regular file", p)
+	}
+	size = info.Size()
+	name := filepath.Base(p)
+
+	// file information. `name NUL length modtime mode serial files_remaining bytes_remaining NUL`
+	fileInfo := fmt.Sprintf("%s\x00%d %o %o 0 %d %d\x00", name, size, info.ModTime().Unix(), 0100000|info.Mode().Perm(), remain, remainBytes)
+
+	// send ZFILE, and wait ZRPOS
+	var pos int64
+	for sent := false; !sent; {
+		c.writeBinHeader(header{typ: zfile, data: [4]byte{0, 0, 0, zcbin}})
+		c.writeData([]byte(fileInfo), zcrcw)
+		if err = c.w.Flush(); err != nil {
+			return
+		}
+
+		for answered := false; !answered; {
+			h, err := c.readHeader()
+			if err != nil {
+				return size, err
+			}
+
+			switch h.typ {
+			case zrinit:
+				// ZFILE is not received, send again
+				answered = true
+			case zskip:
+				return size, nil
+			case zrpos:
+				pos, sent, answered = h.pos(), true, true
+			case zcrc:
+				crc, err := fileCRC(f, h.pos())
+				if err != nil {
+					return size, err
+				}
+				c.writeBinHeader(posHeader(zcrc, int64(crc)))
+				if err = c.w.Flush(); err != nil {
+					return size, err
+				}
+			default:
+				return size, unexpected(h)
+			}
+		}
+	}
+
+	// send data from pos. receiver request resend with ZRPOS, if data is broken.
+	buf := make([]byte, subpacketSize)
+	if window < len(buf) {
+		buf = buf[:window]
+	}
+	for {
+		if _, err = f.Seek(pos, io.SeekStart); err != nil {
+			return
+		}
+		c.writeBinHeader(posHeader(zdata, pos))
+
+		end := byte(zcrcg)
+		for n := 0; end == zcrcg; {
+			l, rerr := io.ReadFull(f, buf)
+			switch {
+			case rerr == io.EOF || rerr == io.ErrUnexpectedEOF:
+				end = zcrce
+			case rerr != nil:
+				return size, rerr
+			case n+l >= window:
+				end = zcrcw
+			}
+
+			c.writeData(buf[:l], end)
+			n += l
+			pos += int64(l)
+			if progress != nil {
+				progress(name, pos, size)
+			}
+		}
+		if end == zcrce {
+			c.writeBinHeader(posHeader(zeof, pos))
+		}
+		if err = c.w.Flush(); err != nil {
+			return
+		}
+
+		// wait ZACK (end of window) or ZRINIT (end of file)
+		for {
+			h, err := c.readHeader()
+			if err != nil {
+				return size, err
+			}
+
+			switch h.typ {
+			case zack:
+				if end == zcrce {
+					continue
+				}
+			case zrinit:
+				if end != zcrce {
+					continue
+				}
+				return size, nil
+			case zrpos:
+				pos = h.pos()
+			case zskip:
+				return size, nil
+			default:
+				return size, unexpected(h)
+			}
+			break
+		}
+	}
+}
+
+// fileCRC return CRC-32 of first length bytes of f. If length is 0, whole file.
+func fileCRC(f *os.File, length int64) (crc uint32, err error) {
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	var r io.Reader = f
+	if length > 0 {
+		r = io.LimitReader(f, length)
+	}
+
+	hash := crc32.NewIEEE()
+	if _, err = io.Copy(hash, r); err != nil {
+		return
+	}
+	return hash.Sum32(), nil
+}
@@ -0,0 +1,504 @@
+// Package zmodem implement ZMODEM file transfer protocol (sender and receiver), to transfer files
+// with `sz` and `rz` (lrzsz) at remote, over terminal session.
+//
+// 16-bit and 32-bit CRC are supported. Crash recovery, compression, encryption and remote commands
+// (ZCOMMAND) are not supported.
+package zmodem
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// special characters
+const (
+	zpad   = '*'  // padding character, begins frames
+	zdle   = 0x18 // ZMODEM escape (ctrl-X)
+	zbin   = 'A'  // binary frame indicator (CRC-16)
+	zhex   = 'B'  // hex frame indicator
+	zbin32 = 'C'  // binary frame indicator (CRC-32)
+	xon    = 0x11
+	xoff   = 0x13
+)
+
+// frame types
+const (
+	zrqinit    = 0  // request receive init
+	zrinit     = 1  // receive init
+	zsinit     = 2  // send init sequence
+	zack       = 3  // ack
+	zfile      = 4  // file name from sender
+	zskip      = 5  // to sender: skip this file
+	znak       = 6  // last packet was garbled
+	zabort     = 7  // abort batch transfers
+	zfin       = 8  // finish session
+	zrpos      = 9  // resume data transmission here
+	zdata      = 10 // data packet(s) follow
+	zeof       = 11 // end of file
+	zferr      = 12 // fatal read or write error detected
+	zcrc       = 13 // request for file crc and response
+	zchallenge = 14 // receiver's challenge
+	zcompl     = 15 // request is complete
+	zcan       = 16 // other end canned session with CAN*5
+	zfreecnt   = 17 // request for free bytes on filesystem
+	zcommand   = 18 // command from sending program
+)
+
+// ZDLE sequences
+const (
+	zcrce = 'h' // CRC next, frame ends, header packet follows
+	zcrcg = 'i' // CRC next, frame continues nonstop
+	zcrcq = 'j' // CRC next, frame continues, ZACK expected
+	zcrcw = 'k' // CRC next, ZACK expected, end of frame
+	zrub0 = 'l' // translate to rubout 0177
+	zrub1 = 'm' // translate to rubout 0377
+)
+
+// receiver capability flags of ZRINIT (ZF0)
+const (
+	canfdx  = 0x01 // can send and receive true full duplex
+	canovio = 0x02 // can receive data during disk I/O
+	canfc32 = 0x20 // can use 32 bit frame check
+	escctl  = 0x40 // receiver expects ctl chars to be escaped
+)
+
+// zcbin is conversion option of ZFILE (ZF0). binary transfer, inhibit conversion.
+const zcbin = 1
+
+// maxSubpacket is max length of data subpacket to receive.
+const maxSubpacket = 16 * 1024
+
+// Direction is direction of file transfer, seen from local.
+type Direction int
+
+const (
+	None     Direction = iota
+	Download           // remote `sz` request to send files (ZRQINIT)
+	Upload             // remote `rz` wait for files (ZRINIT)
+)
+
+// Progress is called while transferring file name, with transferred bytes n and file size.
+type Progress func(name string, n, size int64)
+
+var (
+	// ErrAborted is returned if remote cancel the session.
+	ErrAborted = errors.New("zmodem: transfer aborted by remote")
+
+	errBadCRC    = errors.New("zmodem: bad crc")
+	errBadEscape = errors.New("zmodem: bad escape sequence")
+	errTooLong   = errors.New("zmodem: data subpacket too long")
+)
+
+// startPrefix is head of hex header, that start ZMODEM session.
+var startPrefix = []byte{zpad, zpad, zdle, zhex}
+
+// hexHeaderLength is length of hex header (without CR LF). `**<ZDLE>B` + type, data and crc in hex.
+const hexHeaderLength = 4 + 14
+
+// Detect find start of ZMODEM session (hex header of ZRQINIT or ZRINIT) in remote output data.
+// It return index of the header and direction of transfer. If not found, index is -1, and
+// partial is length of incomplete header at the end of data, that may continue at next output.
+func Detect(data []byte) (index int, dir Direction, partial int) {
+	for i := 0; i < len(data); i++ {
+		if data[i] != zpad {
+			continue
+		}
+
+		rest := data[i:]
+		if len(rest) < hexHeaderLength {
+			if isPrefix(rest, startPrefix) {
+				return -1, None, len(rest)
+			}
+			continue
+		}
+		if !isPrefix(rest, startPrefix) {
+			continue
+		}
+
+		h, err := decodeHexHeader(rest[len(startPrefix):hexHeaderLength])
+		if err != nil {
+			continue
+		}
+		switch h.typ {
+		case zrqinit:
+			return i, Download, 0
+		case zrinit:
+			return i, Upload, 0
+		}
+	}
+	return -1, None, 0
+}
+
+// isPrefix return true if data and prefix are same in common length.
+func isPrefix(data, prefix []byte) bool {
+	for i := 0; i < len(data) && i < len(prefix); i++ {
+		if data[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Abort write cancel sequence to w, to abort ZMODEM session of remote.
+func Abort(w io.Writer) error {
+	_, err := w.Write([]byte("\x18\x18\x18\x18\x18\x18\x18\x18\x18\x18\b\b\b\b\b\b\b\b\b\b"))
+	return err
+}
+
+// header is ZMODEM frame header.
+type header struct {
+	typ  byte
+	data [4]byte // ZP0..ZP3 (= ZF3..ZF0)
+}
+
+// posHeader return header of typ with file position pos.
+func posHeader(typ byte, pos int64) header {
+	h := header{typ: typ}
+	binary.LittleEndian.PutUint32(h.data[:], uint32(pos))
+	return h
+}
+
+// pos return file position of h.
+func (h header) pos() int64 {
+	return int64(binary.LittleEndian.Uint32(h.data[:]))
+}
+
+// decodeHexHeader decode type, data and crc of hex header (14 hex digits). Parity bit of digits is ignored.
+func decodeHexHeader(digits []byte) (h header, err error) {
+	src := make([]byte, len(digits))
+	for i, d := range digits {
+		src[i] = d & 0x7f
+	}
+
+	b := make([]byte, 7)
+	if _, err = hex.Decode(b, src); err != nil || crc16(b[:5]) != binary.BigEndian.Uint16(b[5:]) {
+		return h, errBadCRC
+	}
+
+	h.typ = b[0]
+	copy(h.data[:], b[1:5])
+	return
+}
+
+// conn is ZMODEM connection with remote.
+type conn struct {
+	r io.ByteReader
+	w *bufio.Writer
+
+	// sender options, set by ZRINIT of receiver.
+	crc32  bool // use 32-bit crc
+	escctl bool // escape all control characters
+
+	rxcrc32  bool // last binary header received was 32-bit crc. (data subpackets follow it)
+	lastSent byte
+}
+
+// newConn return conn that read remote output from r and write to w.
+func newConn(r io.ByteReader, w io.Writer) *conn {
+	return &conn{r: r, w: bufio.NewWriter(w)}
+}
+
+// writeHexHeader write hex header h, and flush.
+func (c *conn) writeHexHeader(h header) error {
+	b := append([]byte{h.typ}, h.data[:]...)
+	crc := crc16(b)
+	b = append(b, byte(crc>>8), byte(crc))
+
+	c.w.Write(startPrefix)
+	c.w.WriteString(hex.EncodeToString(b))
+	c.w.WriteString("\r\x8a")
+	if h.typ != zfin && h.typ != zack {
+		c.w.WriteByte(xon)
+	}
+	return c.w.Flush()
+}
+
+// writeBinHeader write binary header h. (not flushed)
+func (c *conn) writeBinHeader(h header) {
+	b := append([]byte{h.typ}, h.data[:]...)
+
+	c.w.WriteByte(zpad)
+	c.w.WriteByte(zdle)
+	if c.crc32 {
+		c.w.WriteByte(zbin32)
+		b = appendCRC32(b, b)
+	} else {
+		c.w.WriteByte(zbin)
+		b = appendCRC16(b, b)
+	}
+	for _, v := range b {
+		c.writeEscaped(v)
+	}
+}
+
+// writeData write data subpacket with frame end. (not flushed)
+func (c *conn) writeData(data []byte, end byte) {
+	for _, v := range data {
+		c.writeEscaped(v)
+	}
+	c.w.WriteByte(zdle)
+	c.w.WriteByte(end)
+
+	crcData := append(append([]byte{}, data...), end)
+	var crc []byte
+	if c.crc32 {
+		crc = appendCRC32(nil, crcData)
+	} else {
+		crc = appendCRC16(nil, crcData)
+	}
+	for _, v := range crc {
+		c.writeEscaped(v)
+	}
+
+	if end == zcrcw {
+		c.w.WriteByte(xon)
+	}
+}
+
+// writeEscaped write b with ZDLE escape, if needed.
+// ZDLE, DLE, XON and XOFF (with or without parity bit) and CR after `@` are escaped.
+func (c *conn) writeEscaped(b byte) {
+	switch {
+	case b == zdle,
+		b&0x7f == 0x10, b&0x7f == xon, b&0x7f == xoff,
+		b&0x7f == '\r' && c.lastSent&0x7f == '@',
+		c.escctl && b&0x60 == 0:
+		c.w.WriteByte(zdle)
+		b ^= 0x40
+	}
+	c.w.WriteByte(b)
+	c.lastSent = b
+}
+
+// readHeader read next header. Bytes before header are skipped.
+// If remote send CAN 5 times (abort), return ErrAborted.
+func (c *conn) readHeader() (h header, err error) {
+	cancel := 0
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return h, err
+		}
+
+		if b == zdle {
+			if cancel++; cancel >= 5 {
+				return h, ErrAborted
+			}
+		} else {
+			cancel = 0
+		}
+		if b != zpad {
+			continue
+		}
+
+		// `*` `*`... ZDLE format
+		for b == zpad {
+			if b, err = c.r.ReadByte(); err != nil {
+				return h, err
+			}
+		}
+		if b != zdle {
+			continue
+		}
+		if b, err = c.r.ReadByte(); err != nil {
+			return h, err
+		}
+
+		switch b {
+		case zhex:
+			h, err = c.readHexHeader()
+		case zbin:
+			h, err = c.readBinHeader(false)
+		case zbin32:
+			h, err = c.readBinHeader(true)
+		default:
+			continue
+		}
+		if err == errBadCRC || err == errBadEscape {
+			continue
+		}
+		return h, err
+	}
+}
+
+// readHexHeader read rest of hex header, after `**<ZDLE>B`.
+func (c *conn) readHexHeader() (h header, err error) {
+	digits := make([]byte, 14)
+	for i := range digits {
+		if digits[i], err = c.r.ReadByte(); err != nil {
+			return
+		}
+	}
+	if h, err = decodeHexHeader(digits); err != nil {
+		return
+	}
+
+	// throw away CR LF
+	b, err := c.r.ReadByte()
+	if err == nil && b&0x7f == '\r' {
+		_, err = c.r.ReadByte()
+	}
+	return h, err
+}
+
+// readBinHeader read rest of binary header, after `*<ZDLE>A` or `*<ZDLE>C`.
+func (c *conn) readBinHeader(is32 bool) (h header, err error) {
+	n := 7
+	if is32 {
+		n = 9
+	}
+
+	b := make([]byte, n)
+	for i := range b {
+		var end bool
+		if b[i], end, err = c.readEscaped(); err != nil {
+			return
+		}
+		if end {
+			return h, errBadEscape
+		}
+	}
+	if !checkCRC(b[:5], b[5:], is32) {
+		return h, errBadCRC
+	}
+
+	c.rxcrc32 = is32
+	h.typ = b[0]
+	copy(h.data[:], b[1:5])
+	return
+}
+
+// readData read data subpacket, and return data and frame end (zcrce, zcrcg, zcrcq or zcrcw).
+func (c *conn) readData() (data []byte, end byte, err error) {
+	for {
+		b, isEnd, err := c.readEscaped()
+		if err != nil {
+			return nil, 0, err
+		}
+		if isEnd {
+			end = b
+			break
+		}
+		if len(data) >= maxSubpacket {
+			return nil, 0, errTooLong
+		}
+		data = append(data, b)
+	}
+
+	n := 2
+	if c.rxcrc32 {
+		n = 4
+	}
+	crc := make([]byte, n)
+	for i := range crc {
+		var isEnd bool
+		if crc[i], isEnd, err = c.readEscaped(); err != nil {
+			return
+		}
+		if isEnd {
+			return nil, 0, errBadEscape
+		}
+	}
+	if !checkCRC(append(data, end), crc, c.rxcrc32) {
+		return nil, 0, errBadCRC
+	}
+
+	return data, end, nil
+}
+
+// readEscaped read a byte with ZDLE escape. If it is frame end (ZDLE + zcrce..zcrcw), end is true.
+// Unescaped XON and XOFF are ignored.
+func (c *conn) readEscaped() (b byte, end bool, err error) {
+	for {
+		if b, err = c.r.ReadByte(); err != nil {
+			return
+		}
+		switch b {
+		case xon, xoff, xon | 0x80, xoff | 0x80:
+			continue
+		case zdle:
+		default:
+			return b, false, nil
+		}
+
+		// after ZDLE
+		cancel := 1
+		for {
+			if b, err = c.r.ReadByte(); err != nil {
+				return
+			}
+			switch b {
+			case xon, xoff, xon | 0x80, xoff | 0x80:
+				continue
+			case zdle:
+				if cancel++; cancel >= 5 {
+					return 0, false, ErrAborted
+				}
+				continue
+			case zcrce, zcrcg, zcrcq, zcrcw:
+				return b, true, nil
+			case zrub0:
+				return 0x7f, false, nil
+			case zrub1:
+				return 0xff, false, nil
+			}
+			if b&0x60 == 0x40 {
+				return b ^ 0x40, false, nil
+			}
+			return 0, false, errBadEscape
+		}
+	}
+}
+
+// crc16 return CRC-16/XMODEM of data.
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// appendCRC16 append CRC-16 of data to b. (big endian)
+func appendCRC16(b, data []byte) []byte {
+	crc := crc16(data)
+	return append(b, byte(crc>>8), byte(crc))
+}
+
+// appendCRC32 append CRC-32 of data to b. (little endian)
+func appendCRC32(b, data []byte) []byte {
+	crc := crc32.ChecksumIEEE(data)
+	return append(b, byte(crc), byte(crc>>8), byte(crc>>16), byte(crc>>24))
+}
+
+// checkCRC return true if crc is CRC of data.
+func checkCRC(data, crc []byte, is32 bool) bool {
+	var expect []byte
+	if is32 {
+		expect = appendCRC32(nil, data)
+	} else {
+		expect = appendCRC16(nil, data)
+	}
+	return string(expect) == string(crc)
+}
+
+// unexpected return error of unexpected header h.
+func unexpected(h header) error {
+	switch h.typ {
+	case zabort, zcan, zferr:
+		return ErrAborted
+	}
+	return fmt.Errorf("zmodem: unexpected frame type %d", h.typ)
+}
@@ -0,0 +1,213 @@
+package zmodem
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	type TestData struct {
+		desc    string
+		data    string
+		index   int
+		dir     Direction
+		partial int
+	}
+	tds := []TestData{
+		{desc: "sz", data: "rz\r**\x18B00000000000000\r\x8a\x11", index: 3, dir: Download},
+		{desc: "rz", data: "rz waiting to receive.**\x18B0100000023be50\r\x8a\x11", index: 22, dir: Upload},
+		{desc: "Incomplete", data: "$ **\x18B0000", index: -1, partial: 8},
+		{desc: "Bad crc", data: "**\x18B0100000023be51\r\x8a", index: -1},
+		{desc: "Other frame", data: "**\x18B0800000000022d\r\x8a", index: -1},
+		{desc: "Text", data: "a * b **", index: -1, partial: 2},
+	}
+	for _, v := range tds {
+		index, dir, partial := Detect([]byte(v.data))
+		assert.Equal(t, v.index, index, v.desc)
+		assert.Equal(t, v.dir, dir, v.desc)
+		assert.Equal(t, v.partial, partial, v.desc)
+	}
+}
+
+func TestWriteHexHeader(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := newConn(nil, buf)
+	assert.Nil(t, c.writeHexHeader(header{typ: zrinit, data: [4]byte{0, 0, 0, 0x23}}))
+	assert.Equal(t, "**\x18B0100000023be50\r\x8a\x11", buf.String())
+
+	// read it back
+	c = newConn(bytes.NewReader(buf.Bytes()), nil)
+	h, err := c.readHeader()
+	assert.Nil(t, err)
+	assert.Equal(t, header{typ: zrinit, data: [4]byte{0, 0, 0, 0x23}}, h)
+}
+
+func TestBinHeaderAndData(t *testing.T) {
+	for _, is32 := range []bool{false, true} {
+		buf := new(bytes.Buffer)
+		c := newConn(nil, buf)
+		c.crc32 = is32
+		c.escctl = true
+
+		data := make([]byte, 256)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		c.writeBinHeader(posHeader(zdata, 0x1811))
+		c.writeData(data, zcrcw)
+		c.w.Flush()
+
+		c = newConn(bytes.NewReader(buf.Bytes()), nil)
+		h, err := c.readHeader()
+		assert.Nil(t, err)
+		assert.Equal(t, posHeader(zdata, 0x1811), h)
+		got, end, err := c.readData()
+		assert.Nil(t, err)
+		assert.Equal(t, data, got)
+		assert.Equal(t, byte(zcrcw), end)
+	}
+}
+
+func TestParseFileInfo(t *testing.T) {
+	name, size, perm := parseFileInfo([]byte("../dir/file.txt\x0012345 13615202741 100755 0 1 12345\x00"))
+	assert.Equal(t, "file.txt", name)
+	assert.Equal(t, int64(12345), size)
+	assert.Equal(t, os.FileMode(0755), perm)
+
+	name, size, perm = parseFileInfo([]byte("file.txt\x00"))
+	assert.Equal(t, "file.txt", name)
+	assert.Equal(t, int64(0), size)
+	assert.Equal(t, os.FileMode(0644), perm)
+}
+
+// pipe is buffered pipe, that is io.Writer and io.ByteReader.
+type pipe struct {
+	buf    bytes.Buffer
+	mu     sync.Mutex
+	cond   *sync.Cond
+	closed bool
+
+	// if corrupt > 0, byte at offset corrupt is changed once.
+	corrupt int
+	written int
+}
+
+func newPipe() *pipe {
+	p := &pipe{}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *pipe) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	data := append([]byte{}, b...)
+	if i := p.corrupt - p.written; p.corrupt > 0 && i >= 0 && i < len(data) {
+		data[i] ^= 0x01
+		p.corrupt = 0
+	}
+	p.written += len(b)
+	p.buf.Write(data)
+	p.cond.Broadcast()
+	return len(b), nil
+}
+
+func (p *pipe) ReadByte() (byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.buf.Len() == 0 && !p.closed {
+		p.cond.Wait()
+	}
+	if p.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return p.buf.ReadByte()
+}
+
+func (p *pipe) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+func TestSendReceive(t *testing.T) {
+	type TestData struct {
+		desc    string
+		sizes   []int
+		corrupt int
+	}
+	tds := []TestData{
+		{desc: "Files", sizes: []int{0, 1, 1024, 200 * 1024}},
+		{desc: "Broken data", sizes: []int{100 * 1024}, corrupt: 50 * 1024},
+	}
+	for _, v := range tds {
+		srcDir, err := ioutil.TempDir("", "lssh_zmodem_src")
+		assert.Nil(t, err)
+		defer os.RemoveAll(srcDir)
+		dstDir, err := ioutil.TempDir("", "lssh_zmodem_dst")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dstDir)
+
+		// file of same name exists at receiver
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dstDir, "file0"), []byte("exist"), 0644))
+
+		paths := []string{}
+		contents := [][]byte{}
+		for i, size := range v.sizes {
+			data := make([]byte, size)
+			rand.Read(data)
+			path := filepath.Join(srcDir, "file"+string('0'+rune(i)))
+			assert.Nil(t, ioutil.WriteFile(path, data, 0640))
+			paths = append(paths, path)
+			contents = append(contents, data)
+		}
+
+		toReceiver, toSender := newPipe(), newPipe()
+		toReceiver.corrupt = v.corrupt
+
+		// remote sz start with ZRQINIT
+		newConn(nil, toReceiver).writeHexHeader(header{typ: zrqinit})
+
+		received := make(chan []string)
+		go func() {
+			saved, err := Receive(toReceiver, toSender, dstDir, nil)
+			assert.Nil(t, err, v.desc)
+			received <- saved
+		}()
+
+		var last int64
+		err = Send(toSender, toReceiver, paths, func(name string, n, size int64) { last = n })
+		assert.Nil(t, err, v.desc)
+		assert.Equal(t, int64(v.sizes[len(v.sizes)-1]), last, v.desc)
+
+		saved := <-received
+		assert.Len(t, saved, len(paths), v.desc)
+		for i, path := range saved {
+			expect := filepath.Join(dstDir, filepath.Base(paths[i]))
+			if i == 0 {
+				expect += ".1"
+			}
+			assert.Equal(t, expect, path, v.desc)
+
+			data, err := ioutil.ReadFile(path)
+			assert.Nil(t, err, v.desc)
+			assert.Equal(t, contents[i], data, v.desc)
+		}
+
+		// sender say "OO" (over and out) at the end
+		b1, _ := toReceiver.ReadByte()
+		b2, _ := toReceiver.ReadByte()
+		assert.Equal(t, "OO", string([]byte{b1, b2}), v.desc)
+	}
+}